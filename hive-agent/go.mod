@@ -3,6 +3,8 @@ module hive-agent
 go 1.19
 
 require (
+	github.com/coreos/go-systemd/v22 v22.5.0
+	github.com/creack/pty v1.1.18
 	github.com/fsnotify/fsnotify v1.7.0
 	github.com/gorilla/websocket v1.5.0
 	github.com/shirou/gopsutil/v3 v3.23.9
@@ -12,6 +14,7 @@ require (
 
 require (
 	github.com/go-ole/go-ole v1.2.6 // indirect
+	github.com/godbus/dbus/v5 v5.0.4 // indirect
 	github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
 	github.com/power-devops/perfstat v0.0.0-20210106213030-5aafc221ea8c // indirect
 	github.com/shoenig/go-m1cpu v0.1.6 // indirect
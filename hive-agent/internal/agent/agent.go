@@ -2,12 +2,11 @@ package agent
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"time"
@@ -32,6 +31,9 @@ type Agent struct {
 	pipeline   *pipeline.Pipeline
 	metrics    *metrics.Manager
 	health     *health.Checker
+	commands   *commandJournal
+	policy     *commandPolicy
+	verifier   *commandVerifier
 	
 	ctx        context.Context
 	cancel     context.CancelFunc
@@ -46,6 +48,16 @@ type Agent struct {
 	mu       sync.RWMutex
 	status   string
 	lastHeartbeat time.Time
+	lastPoll      time.Time
+	lastPollErr   error
+
+	// Running system commands, for cancellation
+	running   map[string]context.CancelFunc
+	runningMu sync.Mutex
+
+	// Open shell sessions by session ID
+	sessions   map[string]*shellSession
+	sessionsMu sync.Mutex
 }
 
 // New creates a new Hive agent instance
@@ -74,6 +86,26 @@ func New(cfg *config.Config, log *logger.Logger) (*Agent, error) {
 	// Create metrics manager
 	metricsManager := metrics.New(cfg.Agent, log.Subsystem("metrics"))
 
+	// Load the local command policy
+	policy, err := loadCommandPolicy(cfg.Commands.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	if policy.restricted() {
+		log.Info("Loaded command policy", "file", policy.source)
+	} else {
+		log.Warn("No command policy file, platform commands are not restricted and file transfers are refused", "file", defaultCommandPolicyFile)
+	}
+
+	// Load the pinned command signing keys
+	verifier, err := newCommandVerifier(cfg.Commands)
+	if err != nil {
+		return nil, err
+	}
+	if verifier.enabled() {
+		log.Info("Command signatures required", "keys", len(verifier.keys))
+	}
+
 	// Create health checker
 	healthChecker := health.New(cfg.Healthcheck, log.Subsystem("health"))
 
@@ -84,11 +116,16 @@ func New(cfg *config.Config, log *logger.Logger) (*Agent, error) {
 		pipeline:   pipelineInstance,
 		metrics:    metricsManager,
 		health:     healthChecker,
+		commands:   newCommandJournal(filepath.Join(cfg.Agent.DataDir, "commands"), log.Subsystem("commands")),
+		policy:     policy,
+		verifier:   verifier,
 		collectors: []collectors.Collector{},
 		outputs:    []outputs.Output{},
 		dataChan:   dataChan,
 		errorChan:  errorChan,
 		status:     "initializing",
+		running:    make(map[string]context.CancelFunc),
+		sessions:   make(map[string]*shellSession),
 		startTime:  time.Now(),
 	}
 
@@ -131,6 +168,7 @@ func (a *Agent) Start(ctx context.Context) error {
 	}
 
 	// Start health checker
+	a.health.Register("command_channel", a.commandChannelHealth)
 	if a.config.Healthcheck.Enabled {
 		if err := a.health.Start(a.ctx); err != nil {
 			return fmt.Errorf("failed to start health checker: %w", err)
@@ -283,6 +321,70 @@ func (a *Agent) initializeCollectors() error {
 			return fmt.Errorf("failed to create log collector: %w", err)
 		}
 		a.collectors = append(a.collectors, logCollector)
+
+		// Docker container logs
+		if a.config.Collectors.Logs.Docker.Enabled {
+			dockerLogCollector, err := collectors.NewDockerLogCollector(
+				a.config.Collectors.Logs.Docker,
+				a.config.Agent.DataDir,
+				a.logger.Subsystem("docker-log-collector"),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create docker log collector: %w", err)
+			}
+			a.collectors = append(a.collectors, dockerLogCollector)
+		}
+
+		// Kernel ring buffer
+		if a.config.Collectors.Logs.Kernel.Enabled {
+			kernelLogCollector, err := collectors.NewKernelLogCollector(
+				a.config.Collectors.Logs.Kernel,
+				a.logger.Subsystem("kernel-log-collector"),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create kernel log collector: %w", err)
+			}
+			a.collectors = append(a.collectors, kernelLogCollector)
+		}
+
+		// systemd journal
+		if a.config.Collectors.Logs.Journald.Enabled {
+			journaldCollector, err := collectors.NewJournaldCollector(
+				a.config.Collectors.Logs.Journald,
+				a.config.Agent.DataDir,
+				a.logger.Subsystem("journald-collector"),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create journald collector: %w", err)
+			}
+			a.collectors = append(a.collectors, journaldCollector)
+		}
+
+		// Syslog receiver
+		if a.config.Collectors.Logs.Syslog.Enabled {
+			syslogCollector, err := collectors.NewSyslogCollector(
+				a.config.Collectors.Logs.Syslog,
+				a.logger.Subsystem("syslog-collector"),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create syslog collector: %w", err)
+			}
+			a.collectors = append(a.collectors, syslogCollector)
+		}
+
+		// Kubernetes pod logs
+		if a.config.Collectors.Logs.Kubernetes.Enabled {
+			kubernetesLogCollector, err := collectors.NewKubernetesLogCollector(
+				a.config.Collectors.Logs.Kubernetes,
+				a.config.Collectors.Logs.Parsers,
+				a.config.Agent.DataDir,
+				a.logger.Subsystem("kubernetes-log-collector"),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes log collector: %w", err)
+			}
+			a.collectors = append(a.collectors, kubernetesLogCollector)
+		}
 	}
 
 	// Metrics collector
@@ -313,6 +415,7 @@ func (a *Agent) initializeCollectors() error {
 	if a.config.Collectors.Events.Enabled {
 		eventsCollector, err := collectors.NewSystemEventsCollector(
 			a.config.Collectors.Events,
+			a.config.Agent.DataDir,
 			a.logger.Subsystem("events-collector"),
 		)
 		if err != nil {
@@ -321,6 +424,30 @@ func (a *Agent) initializeCollectors() error {
 		a.collectors = append(a.collectors, eventsCollector)
 	}
 
+	// StatsD receiver
+	if a.config.Collectors.StatsD.Enabled {
+		statsdCollector, err := collectors.NewStatsDCollector(
+			a.config.Collectors.StatsD,
+			a.logger.Subsystem("statsd-collector"),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create statsd collector: %w", err)
+		}
+		a.collectors = append(a.collectors, statsdCollector)
+	}
+
+	// Prometheus/OpenMetrics scrape targets
+	if a.config.Collectors.Scrape.Enabled {
+		scrapeCollector, err := collectors.NewScrapeCollector(
+			a.config.Collectors.Scrape,
+			a.logger.Subsystem("scrape-collector"),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create scrape collector: %w", err)
+		}
+		a.collectors = append(a.collectors, scrapeCollector)
+	}
+
 	return nil
 }
 
@@ -433,152 +560,6 @@ func (a *Agent) syncConfiguration() error {
 	return nil
 }
 
-// commandService polls for commands from the platform (more reliable than WebSocket)
-func (a *Agent) commandService() {
-	defer a.wg.Done()
-	
-	// Poll for commands every 10 seconds
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	a.logger.Info("Command service started - polling for commands")
-	
-	for {
-		select {
-		case <-a.ctx.Done():
-			return
-		case <-ticker.C:
-			// Poll for pending commands
-			if err := a.pollForCommands(); err != nil {
-				a.logger.Error("Failed to poll for commands", "error", err)
-			}
-		}
-	}
-}
-
-// pollForCommands checks for pending commands from the platform
-func (a *Agent) pollForCommands() error {
-	commands, err := a.platform.GetPendingCommands(a.ctx)
-	if err != nil {
-		return err
-	}
-
-	for _, cmd := range commands {
-		a.logger.Info("Received command", "id", cmd.ID, "type", cmd.Type, "command", cmd.Command)
-		
-		// Execute command in background
-		go func(command platform.Command) {
-			response := a.executeCommand(command)
-			if err := a.platform.SendCommandResponse(a.ctx, response); err != nil {
-				a.logger.Error("Failed to send command response", "error", err)
-			}
-		}(cmd)
-	}
-
-	return nil
-}
-
-// executeCommand executes a command and returns the response
-func (a *Agent) executeCommand(cmd platform.Command) platform.CommandResponse {
-	startTime := time.Now()
-	response := platform.CommandResponse{
-		ID:        cmd.ID,
-		Success:   false,
-		Timestamp: time.Now(),
-	}
-
-	// Handle different command types
-	switch cmd.Type {
-	case "system", "execute":
-		// Execute system command (handle both "system" and "execute" types)
-		output, exitCode, err := a.executeSystemCommand(cmd.Command)
-		if err != nil {
-			response.Error = err.Error()
-			response.ExitCode = exitCode
-		} else {
-			response.Success = true
-			response.Response = output
-			response.ExitCode = exitCode
-		}
-		
-	case "config_reload":
-		// Reload configuration
-		if err := a.reloadConfiguration(); err != nil {
-			response.Error = err.Error()
-		} else {
-			response.Success = true
-			response.Response = "Configuration reloaded successfully"
-		}
-		
-	case "restart":
-		// Execute restart command
-		output, exitCode, err := a.executeSystemCommand("sudo systemctl restart hive-agent || sudo launchctl restart com.pulse.hive-agent || sudo service hive-agent restart")
-		if err != nil {
-			// Try alternative restart methods
-			altOutput, altExitCode, altErr := a.executeSystemCommand("sudo pkill -f hive-agent && sleep 2 && sudo systemctl start hive-agent || sudo launchctl start com.pulse.hive-agent || sudo service hive-agent start")
-			if altErr != nil {
-				response.Error = fmt.Sprintf("Restart failed: %s; Alternative failed: %s", err.Error(), altErr.Error())
-				response.ExitCode = exitCode
-			} else {
-				response.Success = true
-				response.Response = fmt.Sprintf("Agent restarted via alternative method: %s", altOutput)
-				response.ExitCode = altExitCode
-			}
-		} else {
-			response.Success = true
-			response.Response = fmt.Sprintf("Agent restart command executed: %s", output)
-			response.ExitCode = exitCode
-		}
-		
-	case "status":
-		// Return status information
-		response.Success = true
-		status := map[string]interface{}{
-			"status":      a.Status(),
-			"uptime":      time.Since(a.startTime).Seconds(),
-			"system_info": a.getSystemInfo(),
-		}
-		statusJson, _ := json.Marshal(status)
-		response.Response = string(statusJson)
-		
-	default:
-		response.Error = fmt.Sprintf("Unknown command type: %s", cmd.Type)
-	}
-
-	response.ExecutionTime = time.Since(startTime).Milliseconds()
-	
-	a.logger.Info("Command executed", 
-		"id", cmd.ID, 
-		"type", cmd.Type, 
-		"success", response.Success,
-		"execution_time_ms", response.ExecutionTime,
-	)
-
-	return response
-}
-
-// executeSystemCommand executes a system command using shell
-func (a *Agent) executeSystemCommand(command string) (string, int, error) {
-	// Set timeout for command execution
-	ctx, cancel := context.WithTimeout(a.ctx, 30*time.Second)
-	defer cancel()
-	
-	cmd := exec.CommandContext(ctx, "sh", "-c", command)
-	
-	output, err := cmd.CombinedOutput()
-	exitCode := 0
-	
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			exitCode = 1
-		}
-	}
-	
-	return string(output), exitCode, err
-}
-
 // reloadConfiguration reloads the agent configuration
 func (a *Agent) reloadConfiguration() error {
 	// This would reload the configuration and restart necessary components
@@ -618,6 +599,12 @@ func (a *Agent) getCapabilities() []string {
 	if a.config.Collectors.Events.Enabled {
 		capabilities = append(capabilities, "events")
 	}
+	if a.config.Collectors.StatsD.Enabled {
+		capabilities = append(capabilities, "statsd")
+	}
+	if a.config.Collectors.Scrape.Enabled {
+		capabilities = append(capabilities, "scrape")
+	}
 
 	return capabilities
 }
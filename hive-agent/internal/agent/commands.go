@@ -0,0 +1,418 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"hive-agent/internal/health"
+	"hive-agent/internal/platform"
+)
+
+// commandPollInterval is how often pending commands are polled while the
+// WebSocket channel is down
+const commandPollInterval = 10 * time.Second
+
+// commandService receives commands over the WebSocket channel and polls
+// for pending commands whenever it is not connected. Commands from both
+// channels go through the same dispatch path.
+func (a *Agent) commandService() {
+	defer a.wg.Done()
+
+	if err := a.commands.load(); err != nil {
+		a.logger.Error("Failed to load command journal, commands will be refused", "error", err)
+	}
+
+	a.wg.Add(1)
+	go a.commandRetryService()
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.platform.RunWebSocket(a.ctx)
+	}()
+
+	ticker := time.NewTicker(commandPollInterval)
+	defer ticker.Stop()
+
+	a.logger.Info("Command service started")
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case cmd, ok := <-a.platform.GetCommandChannel():
+			if !ok {
+				return
+			}
+			a.dispatchCommand(cmd, "websocket")
+		case message, ok := <-a.platform.GetSessionChannel():
+			if !ok {
+				return
+			}
+			a.handleSessionMessage(message)
+		case <-ticker.C:
+			if a.platform.WebSocketConnected() {
+				continue
+			}
+			err := a.pollForCommands()
+			a.mu.Lock()
+			a.lastPoll = time.Now()
+			a.lastPollErr = err
+			a.mu.Unlock()
+			if err != nil {
+				a.logger.Error("Failed to poll for commands", "error", err)
+			}
+		}
+	}
+}
+
+// pollForCommands checks for pending commands from the platform
+func (a *Agent) pollForCommands() error {
+	commands, err := a.platform.GetPendingCommands(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, cmd := range commands {
+		a.dispatchCommand(cmd, "poll")
+	}
+
+	return nil
+}
+
+// dispatchCommand executes a command in the background and reports the
+// response, whichever channel delivered the command. Commands are
+// journaled by ID, so a command delivered more than once runs only once.
+// When signing keys are pinned, unverified commands are answered with an
+// error without being journaled, as are commands the journal cannot
+// persist.
+func (a *Agent) dispatchCommand(cmd platform.Command, channel string) {
+	if !validCommandID(cmd.ID) {
+		a.logger.Warn("Ignoring command without ID", "type", cmd.Type, "channel", channel)
+		return
+	}
+	if err := a.verifier.verify(cmd, time.Now()); err != nil {
+		a.logger.Warn("Rejecting unverified command", "id", cmd.ID, "type", cmd.Type, "channel", channel, "reason", err)
+		go a.sendRejection(cmd, err)
+		return
+	}
+	started, err := a.commands.begin(cmd, channel)
+	if err != nil {
+		a.logger.Error("Rejecting command that could not be journaled", "id", cmd.ID, "type", cmd.Type, "channel", channel, "error", err)
+		go a.sendRejection(cmd, err)
+		return
+	}
+	if !started {
+		a.logger.Debug("Ignoring duplicate command", "id", cmd.ID, "type", cmd.Type, "channel", channel)
+		return
+	}
+
+	a.logger.Info("Received command", "id", cmd.ID, "type", cmd.Type, "command", cmd.Command, "channel", channel)
+
+	go func() {
+		a.commands.running(cmd.ID)
+		response := a.executeCommand(cmd)
+		a.commands.finish(response)
+		a.deliverCommandResponse(response)
+	}()
+}
+
+// sendRejection answers a command that was refused before it was
+// journaled. The response is sent once and not retried.
+func (a *Agent) sendRejection(cmd platform.Command, reason error) {
+	response := platform.CommandResponse{
+		ID:        cmd.ID,
+		Success:   false,
+		Error:     "command rejected: " + reason.Error(),
+		Timestamp: time.Now(),
+	}
+	if err := a.sendCommandResponse(response); err != nil {
+		a.logger.Error("Failed to send command response", "id", cmd.ID, "error", err)
+	}
+}
+
+// commandRetryService re-sends responses the platform has not
+// acknowledged yet, including those left over from a previous run
+func (a *Agent) commandRetryService() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(commandRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, response := range a.commands.pending() {
+			if a.ctx.Err() != nil {
+				return
+			}
+			a.deliverCommandResponse(response)
+		}
+		a.commands.prune()
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverCommandResponse sends a response and records the outcome in the
+// journal; failed deliveries are retried later
+func (a *Agent) deliverCommandResponse(response platform.CommandResponse) {
+	err := a.sendCommandResponse(response)
+	a.commands.sent(response.ID, err)
+	if err != nil {
+		a.logger.Error("Failed to send command response, will retry", "id", response.ID, "error", err)
+	}
+}
+
+// sendCommandResponse sends a response over the WebSocket channel when it
+// is connected, and over HTTP otherwise or if that fails
+func (a *Agent) sendCommandResponse(response platform.CommandResponse) error {
+	if a.platform.WebSocketConnected() {
+		if err := a.platform.SendCommandResponseWS(response); err == nil {
+			return nil
+		}
+	}
+	return a.platform.SendCommandResponse(a.ctx, response)
+}
+
+// sendCommandOutput sends streamed output over the WebSocket channel when
+// it is connected, and over HTTP otherwise or if that fails
+func (a *Agent) sendCommandOutput(id string, chunks []platform.CommandOutput) error {
+	if a.platform.WebSocketConnected() {
+		if err := a.platform.SendCommandOutputWS(chunks); err == nil {
+			return nil
+		}
+	}
+	return a.platform.SendCommandOutput(a.ctx, id, chunks)
+}
+
+// commandChannelHealth reports the command channel state. Polling keeps
+// commands flowing while the WebSocket is down, so the channel is only
+// unhealthy when polling fails too.
+func (a *Agent) commandChannelHealth() health.ComponentStatus {
+	state := a.platform.WebSocketState()
+
+	a.mu.RLock()
+	lastPoll, lastPollErr := a.lastPoll, a.lastPollErr
+	a.mu.RUnlock()
+
+	status := health.ComponentStatus{
+		Healthy: true,
+		Message: "WebSocket connected",
+		Details: map[string]string{
+			"websocket": state.State,
+			"since":     state.Since.Format(time.RFC3339),
+			"failures":  strconv.Itoa(state.Failures),
+			"connects":  strconv.Itoa(state.Connects),
+			"polling":   strconv.FormatBool(state.State != "connected"),
+		},
+	}
+	if state.LastError != "" {
+		status.Details["last_error"] = state.LastError
+	}
+	if !lastPoll.IsZero() {
+		status.Details["last_poll"] = lastPoll.Format(time.RFC3339)
+	}
+	status.Details["sessions"] = strconv.Itoa(a.sessionCount())
+	states, unsent := a.commands.stats()
+	status.Details["commands_running"] = strconv.Itoa(states[commandReceived] + states[commandRunning])
+	status.Details["commands_done"] = strconv.Itoa(states[commandDone])
+	status.Details["responses_unsent"] = strconv.Itoa(unsent)
+
+	if state.State != "connected" {
+		status.Message = "WebSocket " + state.State + ", polling for commands"
+		if lastPollErr != nil {
+			status.Healthy = false
+			status.Message = fmt.Sprintf("WebSocket %s and polling failed: %v", state.State, lastPollErr)
+		}
+	}
+	if err := a.commands.loadError(); err != nil {
+		status.Healthy = false
+		status.Message = fmt.Sprintf("Command journal unavailable, commands are refused: %v", err)
+	}
+
+	return status
+}
+
+// executeCommand executes a command and returns the response
+func (a *Agent) executeCommand(cmd platform.Command) platform.CommandResponse {
+	startTime := time.Now()
+	response := platform.CommandResponse{
+		ID:        cmd.ID,
+		Success:   false,
+		Timestamp: time.Now(),
+	}
+
+	if cmd.BadTimeout != "" {
+		return a.rejectCommand(cmd, response, fmt.Errorf("invalid command timeout %s", cmd.BadTimeout))
+	}
+
+	// Enforce the local command policy
+	if err := a.policy.checkType(cmd.Type); err != nil {
+		return a.rejectCommand(cmd, response, err)
+	}
+	// Cancelling must work when the concurrency limit is reached
+	if cmd.Type != "cancel" {
+		if !a.policy.acquire() {
+			return a.rejectCommand(cmd, response, fmt.Errorf("command rejected by policy: too many commands running"))
+		}
+		defer a.policy.release()
+	}
+
+	// Handle different command types
+	switch cmd.Type {
+	case "system", "execute":
+		// Execute system command (handle both "system" and "execute" types)
+		result, err := a.executePolicyCommand(cmd)
+		response.Response = result.output
+		response.ExitCode = result.exitCode
+		response.OutputChunks = result.chunks
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Success = true
+		}
+
+	case "cancel":
+		// Kill a running system command; the command field holds its ID
+		if err := a.cancelCommand(cmd.Command); err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Success = true
+			response.Response = fmt.Sprintf("Command %s cancelled", cmd.Command)
+		}
+
+	case "session":
+		// Open an interactive shell session; its traffic flows as session
+		// messages over the WebSocket channel
+		if err := a.openSession(cmd); err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Success = true
+			response.Response = fmt.Sprintf("Session %s opened", cmd.SessionID)
+		}
+
+	case "file_get":
+		// Send a file to the platform in chunks
+		result, chunks, err := a.fileGet(cmd)
+		response.OutputChunks = chunks
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Success = true
+			response.Response = result
+		}
+
+	case "file_put":
+		// Write a file downloaded from the platform
+		result, err := a.filePut(cmd)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Success = true
+			response.Response = result
+		}
+
+	case "tail_log", "list_files", "collector_health", "output_health", "top_processes",
+		"disk_usage", "net_connections", "flush_pipeline", "set_log_level":
+		// Built-in diagnostics, answered with JSON and without a shell
+		result, err := a.runDiagnostic(cmd)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Success = true
+			response.Response = result
+		}
+
+	case "config_reload":
+		// Reload configuration
+		if err := a.reloadConfiguration(); err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Success = true
+			response.Response = "Configuration reloaded successfully"
+		}
+
+	case "restart":
+		// Execute restart command
+		output, exitCode, err := a.executeSystemCommand("sudo systemctl restart hive-agent || sudo launchctl restart com.pulse.hive-agent || sudo service hive-agent restart")
+		if err != nil {
+			// Try alternative restart methods
+			altOutput, altExitCode, altErr := a.executeSystemCommand("sudo pkill -f hive-agent && sleep 2 && sudo systemctl start hive-agent || sudo launchctl start com.pulse.hive-agent || sudo service hive-agent start")
+			if altErr != nil {
+				response.Error = fmt.Sprintf("Restart failed: %s; Alternative failed: %s", err.Error(), altErr.Error())
+				response.ExitCode = exitCode
+			} else {
+				response.Success = true
+				response.Response = fmt.Sprintf("Agent restarted via alternative method: %s", altOutput)
+				response.ExitCode = altExitCode
+			}
+		} else {
+			response.Success = true
+			response.Response = fmt.Sprintf("Agent restart command executed: %s", output)
+			response.ExitCode = exitCode
+		}
+
+	case "status":
+		// Return status information
+		response.Success = true
+		status := map[string]interface{}{
+			"status":      a.Status(),
+			"uptime":      time.Since(a.startTime).Seconds(),
+			"system_info": a.getSystemInfo(),
+		}
+		statusJson, _ := json.Marshal(status)
+		response.Response = string(statusJson)
+
+	default:
+		response.Error = fmt.Sprintf("Unknown command type: %s", cmd.Type)
+	}
+
+	response.ExecutionTime = time.Since(startTime).Milliseconds()
+
+	a.logger.Info("Command executed",
+		"id", cmd.ID,
+		"type", cmd.Type,
+		"success", response.Success,
+		"execution_time_ms", response.ExecutionTime,
+	)
+
+	return response
+}
+
+// rejectCommand completes the response of a command refused by policy
+func (a *Agent) rejectCommand(cmd platform.Command, response platform.CommandResponse, err error) platform.CommandResponse {
+	a.logger.Warn("Command rejected", "id", cmd.ID, "type", cmd.Type, "command", cmd.Command, "reason", err)
+	response.Error = err.Error()
+	return response
+}
+
+// executeSystemCommand executes a system command using shell
+func (a *Agent) executeSystemCommand(command string) (string, int, error) {
+	// Set timeout for command execution
+	ctx, cancel := context.WithTimeout(a.ctx, 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+
+	output, err := cmd.CombinedOutput()
+	return string(output), commandExitCode(err), err
+}
+
+// commandExitCode returns the exit code for the error of a finished
+// command, 1 when it did not exit normally
+func commandExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
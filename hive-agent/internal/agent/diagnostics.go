@@ -0,0 +1,495 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"hive-agent/internal/collectors"
+	"hive-agent/internal/outputs"
+	"hive-agent/internal/platform"
+)
+
+const (
+	// tailLogDefaultLines and tailLogMaxLines bound the lines of tail_log
+	tailLogDefaultLines = 100
+	tailLogMaxLines     = 1000
+	// tailLogMaxBytes is how far back from the end tail_log reads
+	tailLogMaxBytes = 1024 * 1024
+	// tailLogBlockSize is the size of the blocks read backwards
+	tailLogBlockSize = 64 * 1024
+
+	// topProcessesDefault and topProcessesMax bound the processes listed
+	topProcessesDefault = 10
+	topProcessesMax     = 100
+	// processSampleInterval is the interval CPU usage is measured over
+	processSampleInterval = 500 * time.Millisecond
+
+	// netConnectionsDefault and netConnectionsMax bound the connections
+	// listed
+	netConnectionsDefault = 500
+	netConnectionsMax     = 10000
+)
+
+// diagnosticCommands are the built-in command types that inspect the agent
+// and the host without running a shell. The policy restricts them only by
+// allowed_types, so they remain available when shell commands are not.
+var diagnosticCommands = map[string]func(*Agent, context.Context, platform.Command) (interface{}, error){
+	"tail_log":         (*Agent).tailLog,
+	"list_files":       (*Agent).listFiles,
+	"collector_health": (*Agent).collectorHealth,
+	"output_health":    (*Agent).outputHealth,
+	"top_processes":    (*Agent).topProcesses,
+	"disk_usage":       (*Agent).diskUsage,
+	"net_connections":  (*Agent).netConnections,
+	"flush_pipeline":   (*Agent).flushPipeline,
+	"set_log_level":    (*Agent).setLogLevel,
+}
+
+// runDiagnostic runs a built-in diagnostic command and returns its result
+// as JSON
+func (a *Agent) runDiagnostic(cmd platform.Command) (string, error) {
+	diagnostic, exists := diagnosticCommands[cmd.Type]
+	if !exists {
+		return "", fmt.Errorf("unknown diagnostic command: %s", cmd.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, a.commandTimeout(cmd))
+	defer cancel()
+
+	result, err := diagnostic(a, ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode result: %w", err)
+	}
+	return string(data), nil
+}
+
+// watchedFile is a file tailed by a collector, as listed by list_files
+type watchedFile struct {
+	Collector string `json:"collector"`
+	Path      string `json:"path"`
+	Offset    int64  `json:"offset"`
+	Size      int64  `json:"size"`
+	Lag       int64  `json:"lag"`
+	Error     string `json:"error,omitempty"`
+}
+
+// watchedFiles returns the files tailed by all collectors, sorted by
+// collector and path
+func (a *Agent) watchedFiles() []watchedFile {
+	var files []watchedFile
+	for _, collector := range a.collectors {
+		watcher, ok := collector.(collectors.FileWatcher)
+		if !ok {
+			continue
+		}
+		for _, file := range watcher.WatchedFiles() {
+			files = append(files, watchedFile{Collector: collector.Name(), Path: file.Path, Offset: file.Offset})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Collector != files[j].Collector {
+			return files[i].Collector < files[j].Collector
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// listFiles lists the watched files with their read offsets and how far
+// each is behind the end of the file
+func (a *Agent) listFiles(ctx context.Context, cmd platform.Command) (interface{}, error) {
+	files := a.watchedFiles()
+	for i := range files {
+		info, err := os.Stat(files[i].Path)
+		if err != nil {
+			files[i].Error = err.Error()
+			continue
+		}
+		files[i].Size = info.Size()
+		if lag := info.Size() - files[i].Offset; lag > 0 {
+			files[i].Lag = lag
+		}
+	}
+	return map[string]interface{}{"files": files}, nil
+}
+
+// tailLog returns the last lines of a watched file. Only files a collector
+// tails can be read, so tail_log does not widen what the policy's file
+// paths allow.
+func (a *Agent) tailLog(ctx context.Context, cmd platform.Command) (interface{}, error) {
+	path, _ := cmd.Parameters["path"].(string)
+	if path == "" {
+		path = cmd.Command
+	}
+	if path == "" {
+		return nil, fmt.Errorf("tail_log requires a path")
+	}
+	path = filepath.Clean(path)
+
+	watched := false
+	for _, file := range a.watchedFiles() {
+		if filepath.Clean(file.Path) == path {
+			watched = true
+			break
+		}
+	}
+	if !watched {
+		return nil, fmt.Errorf("%s is not a watched file", path)
+	}
+
+	count, err := intParameter(cmd, "lines", tailLogDefaultLines, tailLogMaxLines)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, size, truncated, err := tailFile(path, count)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path":      path,
+		"size":      size,
+		"lines":     lines,
+		"truncated": truncated,
+	}, nil
+}
+
+// tailFile reads the last lines of a file backwards from its end, reading
+// at most tailLogMaxBytes. truncated reports whether fewer lines than
+// requested were returned because of that limit.
+func tailFile(path string, count int) ([]string, int64, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	size := info.Size()
+
+	// Read one newline more than requested, to know where the first line
+	// starts; a final newline ends the last line rather than starting one
+	end := size
+	var data []byte
+	for end > 0 && len(data) < tailLogMaxBytes && bytes.Count(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) < count {
+		length := int64(tailLogBlockSize)
+		if length > end {
+			length = end
+		}
+		block := make([]byte, length)
+		n, err := file.ReadAt(block, end-length)
+		if err != nil && err != io.EOF {
+			return nil, size, false, err
+		}
+		data = append(block[:n], data...)
+		end -= length
+	}
+
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return []string{}, size, false, nil
+	}
+	lines := strings.Split(text, "\n")
+	if end > 0 {
+		// The first line is cut off at the start of what was read
+		lines = lines[1:]
+	}
+	truncated := len(lines) < count && end > 0
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines, size, truncated, nil
+}
+
+// collectorHealth returns the health of every collector by name
+func (a *Agent) collectorHealth(ctx context.Context, cmd platform.Command) (interface{}, error) {
+	health := make(map[string]collectors.HealthStatus, len(a.collectors))
+	for _, collector := range a.collectors {
+		health[collector.Name()] = collector.Health()
+	}
+	return health, nil
+}
+
+// outputHealth returns the health of every output by name
+func (a *Agent) outputHealth(ctx context.Context, cmd platform.Command) (interface{}, error) {
+	health := make(map[string]outputs.HealthStatus, len(a.outputs))
+	for _, output := range a.outputs {
+		health[output.Name()] = output.Health()
+	}
+	return health, nil
+}
+
+// processInfo is a process listed by top_processes
+type processInfo struct {
+	PID        int32   `json:"pid"`
+	Name       string  `json:"name"`
+	User       string  `json:"user,omitempty"`
+	Cmdline    string  `json:"cmdline,omitempty"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSS        uint64  `json:"rss_bytes"`
+	Threads    int32   `json:"threads,omitempty"`
+}
+
+// topProcesses lists the processes using the most CPU or memory. CPU usage
+// is measured over processSampleInterval rather than the process lifetime,
+// so it reflects what is busy now.
+func (a *Agent) topProcesses(ctx context.Context, cmd platform.Command) (interface{}, error) {
+	limit, err := intParameter(cmd, "limit", topProcessesDefault, topProcessesMax)
+	if err != nil {
+		return nil, err
+	}
+	sortBy, _ := cmd.Parameters["sort"].(string)
+	if sortBy == "" {
+		sortBy = "cpu"
+	}
+	if sortBy != "cpu" && sortBy != "memory" {
+		return nil, fmt.Errorf("invalid sort %q, expected cpu or memory", sortBy)
+	}
+
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	// The first call records a baseline; the second measures from it
+	for _, p := range procs {
+		p.PercentWithContext(ctx, 0)
+	}
+	if !platform.SleepContext(ctx, processSampleInterval) {
+		return nil, ctx.Err()
+	}
+
+	type sample struct {
+		proc *process.Process
+		info processInfo
+	}
+	samples := make([]sample, 0, len(procs))
+	for _, p := range procs {
+		cpu, err := p.PercentWithContext(ctx, 0)
+		if err != nil {
+			// The process exited in the meantime
+			continue
+		}
+		s := sample{proc: p, info: processInfo{PID: p.Pid, CPUPercent: cpu}}
+		if memory, err := p.MemoryInfoWithContext(ctx); err == nil {
+			s.info.RSS = memory.RSS
+		}
+		samples = append(samples, s)
+	}
+
+	ranksBefore := func(i, j int) bool { return samples[i].info.CPUPercent > samples[j].info.CPUPercent }
+	if sortBy == "memory" {
+		ranksBefore = func(i, j int) bool { return samples[i].info.RSS > samples[j].info.RSS }
+	}
+	ranked := collectors.TopRanked(len(samples), limit, ranksBefore)
+
+	// Look up the details only for the processes listed
+	top := make([]processInfo, 0, len(ranked))
+	for _, i := range ranked {
+		s := samples[i]
+		s.info.Name, _ = s.proc.NameWithContext(ctx)
+		s.info.User, _ = s.proc.UsernameWithContext(ctx)
+		s.info.Cmdline, _ = s.proc.CmdlineWithContext(ctx)
+		s.info.Threads, _ = s.proc.NumThreadsWithContext(ctx)
+		top = append(top, s.info)
+	}
+
+	return map[string]interface{}{
+		"sort":      sortBy,
+		"total":     len(procs),
+		"processes": top,
+	}, nil
+}
+
+// diskInfo is a filesystem listed by disk_usage
+type diskInfo struct {
+	Device            string  `json:"device"`
+	Mountpoint        string  `json:"mountpoint"`
+	Fstype            string  `json:"fstype"`
+	Total             uint64  `json:"total_bytes"`
+	Used              uint64  `json:"used_bytes"`
+	Free              uint64  `json:"free_bytes"`
+	UsedPercent       float64 `json:"used_percent"`
+	InodesTotal       uint64  `json:"inodes_total"`
+	InodesUsed        uint64  `json:"inodes_used"`
+	InodesUsedPercent float64 `json:"inodes_used_percent"`
+}
+
+// diskUsage lists the space and inode usage of the mounted filesystems
+func (a *Agent) diskUsage(ctx context.Context, cmd platform.Command) (interface{}, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+
+	disks := make([]diskInfo, 0, len(partitions))
+	seen := make(map[string]bool)
+	for _, partition := range partitions {
+		if seen[partition.Mountpoint] {
+			continue
+		}
+		seen[partition.Mountpoint] = true
+
+		usage, err := disk.UsageWithContext(ctx, partition.Mountpoint)
+		if err != nil {
+			continue
+		}
+		disks = append(disks, diskInfo{
+			Device:            partition.Device,
+			Mountpoint:        partition.Mountpoint,
+			Fstype:            partition.Fstype,
+			Total:             usage.Total,
+			Used:              usage.Used,
+			Free:              usage.Free,
+			UsedPercent:       usage.UsedPercent,
+			InodesTotal:       usage.InodesTotal,
+			InodesUsed:        usage.InodesUsed,
+			InodesUsedPercent: usage.InodesUsedPercent,
+		})
+	}
+
+	return map[string]interface{}{"filesystems": disks}, nil
+}
+
+// connectionInfo is a socket listed by net_connections
+type connectionInfo struct {
+	Protocol string `json:"protocol"`
+	Local    string `json:"local"`
+	Remote   string `json:"remote,omitempty"`
+	State    string `json:"state,omitempty"`
+	PID      int32  `json:"pid,omitempty"`
+}
+
+// netConnections lists the host's TCP and UDP sockets, optionally only
+// those in the given state, such as LISTEN or ESTABLISHED
+func (a *Agent) netConnections(ctx context.Context, cmd platform.Command) (interface{}, error) {
+	limit, err := intParameter(cmd, "limit", netConnectionsDefault, netConnectionsMax)
+	if err != nil {
+		return nil, err
+	}
+	state, _ := cmd.Parameters["state"].(string)
+	state = strings.ToUpper(state)
+
+	stats, err := net.ConnectionsWithoutUidsWithContext(ctx, "inet")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connections: %w", err)
+	}
+
+	connections := make([]connectionInfo, 0)
+	matched := 0
+	for _, stat := range stats {
+		if state != "" && stat.Status != state {
+			continue
+		}
+		matched++
+		if len(connections) >= limit {
+			continue
+		}
+
+		connection := connectionInfo{
+			Protocol: socketProtocol(stat.Family, stat.Type),
+			Local:    joinHostPort(stat.Laddr.IP, stat.Laddr.Port),
+			State:    stat.Status,
+			PID:      stat.Pid,
+		}
+		if stat.Raddr.Port != 0 {
+			connection.Remote = joinHostPort(stat.Raddr.IP, stat.Raddr.Port)
+		}
+		connections = append(connections, connection)
+	}
+
+	return map[string]interface{}{
+		"total":       matched,
+		"truncated":   matched > len(connections),
+		"connections": connections,
+	}, nil
+}
+
+// socketProtocol names a socket's protocol, such as tcp or udp6
+func socketProtocol(family, kind uint32) string {
+	protocol := "unknown"
+	switch kind {
+	case syscall.SOCK_STREAM:
+		protocol = "tcp"
+	case syscall.SOCK_DGRAM:
+		protocol = "udp"
+	}
+	if family == syscall.AF_INET6 {
+		protocol += "6"
+	}
+	return protocol
+}
+
+// joinHostPort formats an address, bracketing IPv6 hosts
+func joinHostPort(ip string, port uint32) string {
+	if strings.Contains(ip, ":") {
+		return "[" + ip + "]:" + strconv.FormatUint(uint64(port), 10)
+	}
+	return ip + ":" + strconv.FormatUint(uint64(port), 10)
+}
+
+// flushPipeline sends the data buffered in the pipeline to the outputs
+// without waiting for the flush interval
+func (a *Agent) flushPipeline(ctx context.Context, cmd platform.Command) (interface{}, error) {
+	flushed := a.pipeline.Flush()
+	a.logger.Info("Pipeline flushed by command", "id", cmd.ID, "items", flushed)
+	return map[string]interface{}{"flushed": flushed}, nil
+}
+
+// setLogLevel changes the agent's log level until it is changed again or
+// the agent restarts, which restores the configured level
+func (a *Agent) setLogLevel(ctx context.Context, cmd platform.Command) (interface{}, error) {
+	level, _ := cmd.Parameters["level"].(string)
+	if level == "" {
+		level = cmd.Command
+	}
+	level = strings.ToLower(strings.TrimSpace(level))
+
+	previous := a.logger.GetLevel().String()
+	if err := a.logger.SetLevelName(level); err != nil {
+		return nil, err
+	}
+	a.logger.Info("Log level changed by command", "id", cmd.ID, "previous", previous, "level", level)
+	return map[string]interface{}{"previous": previous, "level": a.logger.GetLevel().String()}, nil
+}
+
+// intParameter returns a positive integer parameter, the default when it
+// is absent, capped at max
+func intParameter(cmd platform.Command, name string, def, max int) (int, error) {
+	raw, exists := cmd.Parameters[name]
+	if !exists || raw == nil {
+		return def, nil
+	}
+	value, ok := raw.(float64)
+	if !ok || value < 1 || value != float64(int64(value)) {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	if value > float64(max) {
+		return max, nil
+	}
+	return int(value), nil
+}
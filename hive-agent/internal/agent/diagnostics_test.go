@@ -0,0 +1,383 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"hive-agent/internal/collectors"
+	"hive-agent/internal/config"
+	"hive-agent/internal/outputs"
+	"hive-agent/internal/pipeline"
+	"hive-agent/internal/platform"
+)
+
+// testCollector is a collector that tails a fixed list of files
+type testCollector struct {
+	name  string
+	files []collectors.WatchedFile
+}
+
+func (c *testCollector) Name() string                                          { return c.name }
+func (c *testCollector) Start(ctx context.Context, _ chan<- interface{}) error { return nil }
+func (c *testCollector) Stop(ctx context.Context) error                        { return nil }
+func (c *testCollector) Health() collectors.HealthStatus {
+	return collectors.HealthStatus{Healthy: true, Message: c.name + " ok"}
+}
+func (c *testCollector) WatchedFiles() []collectors.WatchedFile { return c.files }
+
+// testOutput is an output that reports itself unhealthy
+type testOutput struct{}
+
+func (o *testOutput) Name() string                                       { return "broken" }
+func (o *testOutput) Start(ctx context.Context) error                    { return nil }
+func (o *testOutput) Stop(ctx context.Context) error                     { return nil }
+func (o *testOutput) Send(ctx context.Context, data []interface{}) error { return nil }
+func (o *testOutput) Health() outputs.HealthStatus {
+	return outputs.HealthStatus{Healthy: false, Message: "connection refused"}
+}
+
+// newDiagnosticAgent returns an agent with the given collectors that can
+// run diagnostics
+func newDiagnosticAgent(t *testing.T, sources ...collectors.Collector) *Agent {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &Agent{
+		config:     &config.Config{Commands: config.CommandsConfig{DefaultTimeout: 10 * time.Second, MaxTimeout: time.Minute}},
+		logger:     newTestLogger(t),
+		collectors: sources,
+		outputs:    []outputs.Output{&testOutput{}},
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// runTestDiagnostic runs a diagnostic and decodes its JSON result
+func runTestDiagnostic(t *testing.T, a *Agent, cmd platform.Command) (map[string]interface{}, error) {
+	t.Helper()
+
+	output, err := a.runDiagnostic(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("invalid result %q: %v", output, err)
+	}
+	return result, nil
+}
+
+// writeLines writes count lines of the given length, newline included
+func writeLines(t *testing.T, path string, count, length int) {
+	t.Helper()
+
+	line := strings.Repeat("x", length-1) + "\n"
+	if err := os.WriteFile(path, []byte(strings.Repeat(line, count)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTailFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		count   int
+		want    []string
+	}{
+		{"last lines", "a\nb\nc\n", 2, []string{"b", "c"}},
+		{"whole file", "a\nb\nc\n", 10, []string{"a", "b", "c"}},
+		{"no final newline", "a\nb", 1, []string{"b"}},
+		{"carriage returns", "a\r\nb\r\n", 2, []string{"a", "b"}},
+		{"empty lines", "a\n\n\n", 2, []string{"", ""}},
+		{"empty file", "", 5, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "log")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			lines, size, truncated, err := tailFile(path, tt.count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(lines, tt.want) || size != int64(len(tt.content)) || truncated {
+				t.Errorf("got %q, size %d, truncated %v; want %q", lines, size, truncated, tt.want)
+			}
+		})
+	}
+
+	// Lines of 64 bytes fill a block exactly; the first line of the block
+	// is dropped as it may be cut off, which leaves exactly 1023
+	path := filepath.Join(dir, "aligned")
+	writeLines(t, path, 3000, 64)
+	for _, count := range []int{1000, 1023} {
+		lines, _, truncated, err := tailFile(path, count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != count || truncated {
+			t.Errorf("%d lines: got %d, truncated %v", count, len(lines), truncated)
+		}
+	}
+
+	// Only tailLogMaxBytes are read, so long lines give fewer than asked
+	path = filepath.Join(dir, "long")
+	writeLines(t, path, 400, 4096)
+	lines, _, truncated, err := tailFile(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := tailLogMaxBytes/4096 - 1; len(lines) != want || !truncated || len(lines[0]) != 4095 {
+		t.Errorf("got %d lines, truncated %v; want %d, truncated", len(lines), truncated, want)
+	}
+
+	if _, _, _, err := tailFile(filepath.Join(dir, "missing"), 10); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestTailLog(t *testing.T) {
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(watched, []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "secret")
+	if err := os.WriteFile(other, []byte("password\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := newDiagnosticAgent(t, &testCollector{name: "logs", files: []collectors.WatchedFile{{Path: watched, Offset: 4}}})
+
+	result, err := runTestDiagnostic(t, a, platform.Command{Type: "tail_log", Parameters: map[string]interface{}{"path": dir + "/./app.log", "lines": float64(2)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result["lines"], []interface{}{"two", "three"}) || result["path"] != watched || result["truncated"] != false {
+		t.Errorf("got %v", result)
+	}
+
+	for _, cmd := range []platform.Command{
+		{Type: "tail_log", Command: other},
+		{Type: "tail_log"},
+		{Type: "tail_log", Command: watched, Parameters: map[string]interface{}{"lines": float64(0)}},
+		{Type: "tail_log", Command: watched, Parameters: map[string]interface{}{"lines": "ten"}},
+	} {
+		if _, err := runTestDiagnostic(t, a, cmd); err == nil {
+			t.Errorf("%+v: expected an error", cmd)
+		}
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := newDiagnosticAgent(t,
+		&testCollector{name: "b", files: []collectors.WatchedFile{{Path: path, Offset: 4}}},
+		&testCollector{name: "a", files: []collectors.WatchedFile{{Path: filepath.Join(dir, "gone.log"), Offset: 1}}},
+	)
+
+	result, err := a.listFiles(context.Background(), platform.Command{Type: "list_files"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := result.(map[string]interface{})["files"].([]watchedFile)
+	if len(files) != 2 {
+		t.Fatalf("got %+v", files)
+	}
+	if files[0].Collector != "a" || files[0].Error == "" {
+		t.Errorf("missing file = %+v", files[0])
+	}
+	if files[1] != (watchedFile{Collector: "b", Path: path, Offset: 4, Size: 10, Lag: 6}) {
+		t.Errorf("watched file = %+v", files[1])
+	}
+}
+
+func TestHealthDiagnostics(t *testing.T) {
+	a := newDiagnosticAgent(t, &testCollector{name: "logs"})
+
+	result, err := runTestDiagnostic(t, a, platform.Command{Type: "collector_health"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health, _ := result["logs"].(map[string]interface{}); health["healthy"] != true || health["message"] != "logs ok" {
+		t.Errorf("collector health = %v", result)
+	}
+
+	result, err = runTestDiagnostic(t, a, platform.Command{Type: "output_health"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health, _ := result["broken"].(map[string]interface{}); health["healthy"] != false || health["message"] != "connection refused" {
+		t.Errorf("output health = %v", result)
+	}
+}
+
+func TestTopProcesses(t *testing.T) {
+	a := newDiagnosticAgent(t)
+
+	result, err := runTestDiagnostic(t, a, platform.Command{Type: "top_processes", Parameters: map[string]interface{}{"limit": float64(3), "sort": "memory"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	processes, _ := result["processes"].([]interface{})
+	if result["sort"] != "memory" || len(processes) == 0 || len(processes) > 3 {
+		t.Fatalf("got %v", result)
+	}
+	var previous float64 = -1
+	for _, raw := range processes {
+		rss := raw.(map[string]interface{})["rss_bytes"].(float64)
+		if previous >= 0 && rss > previous {
+			t.Errorf("processes not sorted by memory: %v", processes)
+		}
+		previous = rss
+	}
+
+	if _, err := runTestDiagnostic(t, a, platform.Command{Type: "top_processes", Parameters: map[string]interface{}{"sort": "name"}}); err == nil {
+		t.Error("expected an error for an invalid sort")
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	result, err := runTestDiagnostic(t, newDiagnosticAgent(t), platform.Command{Type: "disk_usage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filesystems, ok := result["filesystems"].([]interface{})
+	if !ok {
+		t.Fatalf("got %v", result)
+	}
+	seen := make(map[interface{}]bool)
+	for _, raw := range filesystems {
+		mountpoint := raw.(map[string]interface{})["mountpoint"]
+		if seen[mountpoint] {
+			t.Errorf("%v listed twice", mountpoint)
+		}
+		seen[mountpoint] = true
+	}
+}
+
+func TestNetConnections(t *testing.T) {
+	a := newDiagnosticAgent(t)
+
+	result, err := runTestDiagnostic(t, a, platform.Command{Type: "net_connections", Parameters: map[string]interface{}{"state": "listen", "limit": float64(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connections, _ := result["connections"].([]interface{})
+	total, _ := result["total"].(float64)
+	if len(connections) > 1 || result["truncated"] != (total > 1) {
+		t.Errorf("got %v", result)
+	}
+	for _, raw := range connections {
+		if state := raw.(map[string]interface{})["state"]; state != "LISTEN" {
+			t.Errorf("connection in state %v listed", state)
+		}
+	}
+
+	tests := []struct {
+		family, kind uint32
+		want         string
+	}{
+		{syscall.AF_INET, syscall.SOCK_STREAM, "tcp"},
+		{syscall.AF_INET6, syscall.SOCK_STREAM, "tcp6"},
+		{syscall.AF_INET6, syscall.SOCK_DGRAM, "udp6"},
+		{syscall.AF_INET, syscall.SOCK_RAW, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := socketProtocol(tt.family, tt.kind); got != tt.want {
+			t.Errorf("socketProtocol(%d, %d) = %s, want %s", tt.family, tt.kind, got, tt.want)
+		}
+	}
+	if got := joinHostPort("::1", 443); got != "[::1]:443" {
+		t.Errorf("got %s", got)
+	}
+	if got := joinHostPort("10.0.0.1", 53); got != "10.0.0.1:53" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestFlushPipeline(t *testing.T) {
+	a := newDiagnosticAgent(t)
+	a.pipeline = pipeline.New(pipeline.Config{BufferSize: 10, BatchSize: 10, FlushInterval: time.Hour}, a.logger)
+	data := make(chan interface{})
+	if err := a.pipeline.Start(a.ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	defer a.pipeline.Stop(context.Background())
+	for i := 0; i < 3; i++ {
+		data <- i
+	}
+
+	// Items are buffered once the pipeline has taken them off the channel,
+	// which the unbuffered channel does not guarantee for the last one
+	flushed := 0
+	deadline := time.Now().Add(5 * time.Second)
+	for flushed < 3 && time.Now().Before(deadline) {
+		result, err := runTestDiagnostic(t, a, platform.Command{Type: "flush_pipeline"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		flushed += int(result["flushed"].(float64))
+		time.Sleep(10 * time.Millisecond)
+	}
+	if flushed != 3 {
+		t.Errorf("flushed %d items, want 3", flushed)
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	a := newDiagnosticAgent(t)
+
+	result, err := runTestDiagnostic(t, a, platform.Command{Type: "set_log_level", Parameters: map[string]interface{}{"level": " DEBUG "}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["previous"] != "error" || result["level"] != "debug" || a.logger.GetLevel().String() != "debug" {
+		t.Errorf("got %v", result)
+	}
+
+	if _, err := runTestDiagnostic(t, a, platform.Command{Type: "set_log_level", Command: "loud"}); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+	if a.logger.GetLevel().String() != "debug" {
+		t.Error("invalid level changed the log level")
+	}
+	if _, err := runTestDiagnostic(t, a, platform.Command{Type: "reboot_host"}); err == nil {
+		t.Error("expected an error for an unknown diagnostic")
+	}
+}
+
+func TestIntParameter(t *testing.T) {
+	tests := []struct {
+		parameters map[string]interface{}
+		want       int
+		ok         bool
+	}{
+		{nil, 10, true},
+		{map[string]interface{}{"n": nil}, 10, true},
+		{map[string]interface{}{"n": float64(5)}, 5, true},
+		{map[string]interface{}{"n": float64(500)}, 100, true},
+		{map[string]interface{}{"n": float64(0)}, 0, false},
+		{map[string]interface{}{"n": float64(2.5)}, 0, false},
+		{map[string]interface{}{"n": "5"}, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := intParameter(platform.Command{Parameters: tt.parameters}, "n", 10, 100)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("%v: got %d, %v", tt.parameters, got, err)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"hive-agent/internal/platform"
+)
+
+const (
+	// fileChunkSize is the size of file transfer chunks
+	fileChunkSize = 256 * 1024
+	// fileTransferAttempts is how often a chunk is tried before the
+	// transfer fails
+	fileTransferAttempts = 3
+)
+
+// fileTransferResult describes a transferred file
+type fileTransferResult struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	Mode     string `json:"mode"`
+	Modified string `json:"modified,omitempty"`
+	Chunks   int64  `json:"chunks,omitempty"`
+}
+
+// fileGet sends a file to the platform as chunks of streamed output with
+// the "file" stream. The response describes the file, including its
+// SHA-256, so the platform can verify what it reassembled.
+func (a *Agent) fileGet(cmd platform.Command) (string, int64, error) {
+	if err := a.policy.checkFiles(); err != nil {
+		return "", 0, err
+	}
+	path, err := fileCommandPath(cmd)
+	if err != nil {
+		return "", 0, err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := a.policy.checkPath(resolved, false); err != nil {
+		return "", 0, err
+	}
+
+	file, err := openResolved(resolved)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return "", 0, fmt.Errorf("%s is not a regular file", resolved)
+	}
+	if info.Size() > a.policy.maxFileSize {
+		return "", 0, fmt.Errorf("command rejected by policy: %s is %d bytes, the limit is %d", resolved, info.Size(), a.policy.maxFileSize)
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, a.commandTimeout(cmd))
+	defer cancel()
+
+	// A file that grows while it is sent, such as a log, is sent up to the
+	// size it had when it was opened
+	hash := sha256.New()
+	reader := io.LimitReader(file, info.Size())
+	buf := make([]byte, fileChunkSize)
+	var offset, sequence int64
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 {
+			hash.Write(buf[:n])
+			sequence++
+			chunk := platform.CommandOutput{
+				ID:        cmd.ID,
+				Sequence:  sequence,
+				Stream:    "file",
+				Offset:    offset,
+				Data:      buf[:n],
+				Timestamp: time.Now(),
+			}
+			if err := a.sendFileChunk(ctx, chunk); err != nil {
+				return "", sequence, err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", sequence, err
+		}
+	}
+
+	result, _ := json.Marshal(fileTransferResult{
+		Path:     resolved,
+		Size:     offset,
+		SHA256:   hex.EncodeToString(hash.Sum(nil)),
+		Mode:     fmt.Sprintf("%04o", info.Mode().Perm()),
+		Modified: info.ModTime().UTC().Format(time.RFC3339),
+		Chunks:   sequence,
+	})
+
+	a.logger.Info("File sent", "id", cmd.ID, "path", resolved, "size", offset)
+	return string(result), sequence, nil
+}
+
+// openResolved opens a path without symlinks for reading, and checks that
+// the file opened is the one at that path. A symlink swapped in for any
+// part of the path after it was resolved and checked against the policy
+// is not followed.
+func openResolved(path string) (*os.File, error) {
+	// O_NONBLOCK keeps a FIFO from blocking the open; it is not a regular
+	// file, so it is rejected before it is read
+	file, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	opened, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", file.Fd()))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if opened != path {
+		file.Close()
+		return nil, fmt.Errorf("%s was replaced while it was opened", path)
+	}
+	return file, nil
+}
+
+// sendFileChunk sends a file chunk, retrying failed attempts
+func (a *Agent) sendFileChunk(ctx context.Context, chunk platform.CommandOutput) error {
+	var err error
+	for attempt := 1; attempt <= fileTransferAttempts; attempt++ {
+		if err = a.sendCommandOutput(chunk.ID, []platform.CommandOutput{chunk}); err == nil {
+			return nil
+		}
+		if !platform.SleepContext(ctx, time.Duration(attempt)*time.Second) {
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("failed to send file chunk %d: %w", chunk.Sequence, err)
+}
+
+// filePut writes a file with content downloaded from the platform in
+// chunks. The size and sha256 parameters are required and are verified
+// before the file atomically replaces the target; mode, owner and group
+// default to those of the file being replaced.
+func (a *Agent) filePut(cmd platform.Command) (string, error) {
+	if err := a.policy.checkFiles(); err != nil {
+		return "", err
+	}
+	path, err := fileCommandPath(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	size, ok := cmd.Parameters["size"].(float64)
+	if !ok || size < 0 || size != float64(int64(size)) {
+		return "", fmt.Errorf("file_put requires a size parameter")
+	}
+	expected, _ := cmd.Parameters["sha256"].(string)
+	expected = strings.ToLower(expected)
+	if len(expected) != sha256.Size*2 {
+		return "", fmt.Errorf("file_put requires a sha256 parameter")
+	}
+	if int64(size) > a.policy.maxFileSize {
+		return "", fmt.Errorf("command rejected by policy: %d bytes exceeds the limit of %d", int64(size), a.policy.maxFileSize)
+	}
+
+	// Resolve the directory, so the policy sees where the file really goes
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, filepath.Base(path))
+	if err := a.policy.checkPath(target, true); err != nil {
+		return "", err
+	}
+
+	mode := os.FileMode(0644)
+	uid, gid := -1, -1
+	if info, err := os.Lstat(target); err == nil {
+		if !info.Mode().IsRegular() {
+			return "", fmt.Errorf("%s exists and is not a regular file", target)
+		}
+		mode = info.Mode().Perm()
+		uid, gid = fileOwner(info)
+	}
+	if value, ok := cmd.Parameters["mode"].(string); ok && value != "" {
+		parsed, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || parsed > 0777 {
+			return "", fmt.Errorf("invalid mode %q", value)
+		}
+		mode = os.FileMode(parsed)
+	}
+	if value, ok := cmd.Parameters["owner"].(string); ok && value != "" {
+		if uid, err = lookupUser(value); err != nil {
+			return "", err
+		}
+	}
+	if value, ok := cmd.Parameters["group"].(string); ok && value != "" {
+		if gid, err = lookupGroup(value); err != nil {
+			return "", err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, a.commandTimeout(cmd))
+	defer cancel()
+
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".pulse-hive-*")
+	if err != nil {
+		return "", err
+	}
+	tempPath := temp.Name()
+	renamed := false
+	defer func() {
+		if !renamed {
+			temp.Close()
+			os.Remove(tempPath)
+		}
+	}()
+
+	hash := sha256.New()
+	total := int64(size)
+	var offset int64
+	for offset < total {
+		length := total - offset
+		if length > fileChunkSize {
+			length = fileChunkSize
+		}
+		data, err := a.fetchFileChunk(ctx, cmd.ID, offset, length)
+		if err != nil {
+			return "", err
+		}
+		if len(data) == 0 {
+			return "", fmt.Errorf("file content ended at %d of %d bytes", offset, total)
+		}
+		if _, err := temp.Write(data); err != nil {
+			return "", err
+		}
+		hash.Write(data)
+		offset += int64(len(data))
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != expected {
+		return "", fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+	}
+
+	// chmod explicitly, as the umask applies at creation
+	if err := temp.Chmod(mode); err != nil {
+		return "", err
+	}
+	if uid != -1 || gid != -1 {
+		if err := temp.Chown(uid, gid); err != nil {
+			return "", err
+		}
+	}
+	if err := temp.Sync(); err != nil {
+		return "", err
+	}
+	if err := temp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tempPath, target); err != nil {
+		return "", err
+	}
+	renamed = true
+
+	// Persist the rename itself
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	result, _ := json.Marshal(fileTransferResult{
+		Path:   target,
+		Size:   total,
+		SHA256: actual,
+		Mode:   fmt.Sprintf("%04o", mode),
+	})
+
+	a.logger.Info("File written", "id", cmd.ID, "path", target, "size", total, "mode", fmt.Sprintf("%04o", mode))
+	return string(result), nil
+}
+
+// fetchFileChunk downloads a chunk of file_put content, retrying failed
+// attempts
+func (a *Agent) fetchFileChunk(ctx context.Context, id string, offset, length int64) ([]byte, error) {
+	var err error
+	for attempt := 1; attempt <= fileTransferAttempts; attempt++ {
+		var data []byte
+		if data, err = a.platform.FetchCommandFile(ctx, id, offset, length); err == nil {
+			return data, nil
+		}
+		if !platform.SleepContext(ctx, time.Duration(attempt)*time.Second) {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("failed to fetch file content at offset %d: %w", offset, err)
+}
+
+// fileCommandPath returns the absolute, cleaned path of a file command,
+// given as the path parameter or the command itself
+func fileCommandPath(cmd platform.Command) (string, error) {
+	path, _ := cmd.Parameters["path"].(string)
+	if path == "" {
+		path = cmd.Command
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("file path must be absolute: %q", path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// lookupUser resolves a user name or numeric ID
+func lookupUser(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGroup resolves a group name or numeric ID
+func lookupGroup(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// fileOwner returns the owner and group of a file
+func fileOwner(info os.FileInfo) (int, int) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(stat.Uid), int(stat.Gid)
+	}
+	return -1, -1
+}
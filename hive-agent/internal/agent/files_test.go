@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenResolved(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	secret := filepath.Join(dir, "secret")
+	for _, sub := range []string{allowed, secret} {
+		if err := os.Mkdir(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sub, "file"), []byte(filepath.Base(sub)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(allowed, "file")
+	file, err := openResolved(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// The file itself replaced by a symlink after it was resolved
+	if err := os.Rename(path, path+".orig"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(secret, "file"), path); err != nil {
+		t.Fatal(err)
+	}
+	if file, err := openResolved(path); err == nil {
+		file.Close()
+		t.Error("symlinked file opened")
+	}
+
+	// A directory of the path replaced by a symlink
+	if err := os.Rename(allowed, allowed+".orig"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, allowed); err != nil {
+		t.Fatal(err)
+	}
+	file, err = openResolved(path)
+	if err == nil {
+		file.Close()
+		t.Fatal("file under a symlinked directory opened")
+	}
+	if !strings.Contains(err.Error(), "replaced") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"hive-agent/internal/logger"
+	"hive-agent/internal/platform"
+)
+
+const (
+	// commandJournalRetention is how long finished commands are remembered
+	// for deduplication after their response was delivered
+	commandJournalRetention = 7 * 24 * time.Hour
+	// commandRetryInterval is the base delay between response retries
+	commandRetryInterval = 15 * time.Second
+	// commandMaxRetryInterval caps the delay between response retries
+	commandMaxRetryInterval = 10 * time.Minute
+)
+
+// Command journal states
+const (
+	commandReceived = "received"
+	commandRunning  = "running"
+	commandDone     = "done"
+)
+
+// journalEntry is the persisted record of one command
+type journalEntry struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Command  string    `json:"command,omitempty"`
+	Channel  string    `json:"channel"`
+	State    string    `json:"state"`
+	Received time.Time `json:"received"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+
+	Response     *platform.CommandResponse `json:"response,omitempty"`
+	Sent         bool                      `json:"sent"`
+	SentAt       time.Time                 `json:"sent_at,omitempty"`
+	SendAttempts int                       `json:"send_attempts,omitempty"`
+	SendError    string                    `json:"send_error,omitempty"`
+	NextSend     time.Time                 `json:"next_send,omitempty"`
+}
+
+// commandJournal records commands under the data directory, keyed by
+// command ID, so that commands run at most once and their responses are
+// delivered even across restarts
+type commandJournal struct {
+	dir    string
+	logger *logger.Logger
+
+	mu      sync.Mutex
+	entries map[string]*journalEntry
+	loadErr error // set when the journal could not be read
+}
+
+// newCommandJournal creates a journal in dir
+func newCommandJournal(dir string, log *logger.Logger) *commandJournal {
+	return &commandJournal{
+		dir:     dir,
+		logger:  log,
+		entries: make(map[string]*journalEntry),
+	}
+}
+
+// load reads the journal. Commands that were received or running when
+// the agent stopped are not run again, since their effect is unknown;
+// they are finished with an error response instead. Without a readable
+// journal, duplicates and replays cannot be detected, so new commands are
+// refused.
+func (j *commandJournal) load() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.loadErr = j.loadLocked()
+	return j.loadErr
+}
+
+// loadLocked reads the journal entries; the caller holds the lock
+func (j *commandJournal) loadLocked() error {
+	if err := os.MkdirAll(j.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create command journal directory: %w", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(j.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			j.logger.Warn("Failed to read command journal entry", "file", file, "error", err)
+			continue
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.ID == "" {
+			j.logger.Warn("Ignoring invalid command journal entry", "file", file)
+			continue
+		}
+
+		if entry.State != commandDone {
+			j.logger.Warn("Command was interrupted by an agent restart", "id", entry.ID, "state", entry.State)
+			now, state := time.Now(), entry.State
+			entry.State = commandDone
+			entry.Finished = now
+			entry.Response = &platform.CommandResponse{
+				ID:        entry.ID,
+				Success:   false,
+				Error:     fmt.Sprintf("command interrupted by agent restart while %s", state),
+				Timestamp: now,
+			}
+			j.saveLocked(&entry)
+		}
+		j.entries[entry.ID] = &entry
+	}
+
+	return nil
+}
+
+// begin records a received command. It returns false for a command that
+// is already known; a duplicate of a finished command whose response was
+// delivered has that response queued again, as the platform evidently did
+// not record it. A command that cannot be persisted is not recorded and
+// must not run, since a replay of it would go unnoticed after a restart.
+func (j *commandJournal) begin(cmd platform.Command, channel string) (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.loadErr != nil {
+		return false, fmt.Errorf("command journal unavailable: %w", j.loadErr)
+	}
+	if entry, exists := j.entries[cmd.ID]; exists {
+		if entry.State == commandDone && entry.Sent {
+			entry.Sent = false
+			entry.NextSend = time.Time{}
+			j.saveLocked(entry)
+		}
+		return false, nil
+	}
+
+	entry := &journalEntry{
+		ID:       cmd.ID,
+		Type:     cmd.Type,
+		Command:  cmd.Command,
+		Channel:  channel,
+		State:    commandReceived,
+		Received: time.Now(),
+	}
+	if cmd.ExpiresAt != 0 {
+		entry.Expires = time.Unix(cmd.ExpiresAt, 0)
+	}
+	if err := j.saveLocked(entry); err != nil {
+		return false, err
+	}
+	j.entries[cmd.ID] = entry
+	return true, nil
+}
+
+// running marks a command as started
+func (j *commandJournal) running(id string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry, exists := j.entries[id]; exists {
+		entry.State = commandRunning
+		entry.Started = time.Now()
+		j.saveLocked(entry)
+	}
+}
+
+// finish records the response of a command. The caller sends it right
+// away, so retries are held back until that attempt had its chance.
+func (j *commandJournal) finish(response platform.CommandResponse) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry, exists := j.entries[response.ID]; exists {
+		entry.State = commandDone
+		entry.Finished = time.Now()
+		entry.Response = &response
+		entry.NextSend = entry.Finished.Add(commandRetryInterval)
+		j.saveLocked(entry)
+	}
+}
+
+// sent records the outcome of a delivery attempt. Failed deliveries are
+// retried with an exponential backoff.
+func (j *commandJournal) sent(id string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, exists := j.entries[id]
+	if !exists {
+		return
+	}
+
+	entry.SendAttempts++
+	if err == nil {
+		entry.Sent = true
+		entry.SentAt = time.Now()
+		entry.SendError = ""
+		entry.NextSend = time.Time{}
+	} else {
+		delay := commandRetryInterval
+		for i := 1; i < entry.SendAttempts && delay < commandMaxRetryInterval; i++ {
+			delay *= 2
+		}
+		if delay > commandMaxRetryInterval {
+			delay = commandMaxRetryInterval
+		}
+		entry.SendError = err.Error()
+		entry.NextSend = time.Now().Add(delay)
+	}
+	j.saveLocked(entry)
+}
+
+// pending returns the responses that are due for delivery
+func (j *commandJournal) pending() []platform.CommandResponse {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	var responses []platform.CommandResponse
+	for _, entry := range j.entries {
+		if entry.State == commandDone && !entry.Sent && entry.Response != nil && !now.Before(entry.NextSend) {
+			responses = append(responses, *entry.Response)
+		}
+	}
+	return responses
+}
+
+// prune forgets delivered commands older than the retention period. A
+// command is kept at least until it expires, so that it cannot be
+// replayed while it would still verify.
+func (j *commandJournal) prune() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for id, entry := range j.entries {
+		if entry.Sent && time.Since(entry.Finished) > commandJournalRetention && time.Since(entry.Expires) > commandClockSkew {
+			if err := os.Remove(j.path(id)); err != nil && !os.IsNotExist(err) {
+				j.logger.Warn("Failed to remove command journal entry", "id", id, "error", err)
+				continue
+			}
+			delete(j.entries, id)
+		}
+	}
+}
+
+// stats returns the number of commands per state and unsent responses
+func (j *commandJournal) stats() (map[string]int, int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	states := make(map[string]int)
+	unsent := 0
+	for _, entry := range j.entries {
+		states[entry.State]++
+		if entry.State == commandDone && !entry.Sent {
+			unsent++
+		}
+	}
+	return states, unsent
+}
+
+// loadError returns why the journal could not be loaded, if it could not
+func (j *commandJournal) loadError() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.loadErr
+}
+
+// path returns the file of a command. IDs come from the platform, so they
+// are hashed rather than used as file names.
+func (j *commandJournal) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(j.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// saveLocked writes an entry atomically; the caller holds the lock
+func (j *commandJournal) saveLocked(entry *journalEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := j.path(entry.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		j.logger.Error("Failed to write command journal entry", "id", entry.ID, "error", err)
+		return fmt.Errorf("failed to write command journal entry: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		j.logger.Error("Failed to write command journal entry", "id", entry.ID, "error", err)
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write command journal entry: %w", err)
+	}
+	return nil
+}
+
+// validCommandID reports whether a command can be journaled
+func validCommandID(id string) bool {
+	return strings.TrimSpace(id) != ""
+}
@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/logger"
+	"hive-agent/internal/platform"
+)
+
+// newTestLogger returns a logger that only reports errors
+func newTestLogger(t *testing.T) *logger.Logger {
+	t.Helper()
+	log, err := logger.New(config.LoggingConfig{Level: "error", Format: "text", Output: "stdout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+// newTestJournal returns a loaded journal in dir
+func newTestJournal(t *testing.T, dir string) *commandJournal {
+	t.Helper()
+	journal := newCommandJournal(dir, newTestLogger(t))
+	if err := journal.load(); err != nil {
+		t.Fatal(err)
+	}
+	return journal
+}
+
+// beginCommand records a command and fails the test on errors
+func beginCommand(t *testing.T, journal *commandJournal, id string) bool {
+	t.Helper()
+	started, err := journal.begin(platform.Command{ID: id, Type: "status"}, "poll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return started
+}
+
+// pendingIDs returns the IDs of the responses due for delivery
+func pendingIDs(journal *commandJournal) map[string]string {
+	ids := make(map[string]string)
+	for _, response := range journal.pending() {
+		ids[response.ID] = response.Error
+	}
+	return ids
+}
+
+func TestCommandJournalDedupe(t *testing.T) {
+	journal := newTestJournal(t, t.TempDir())
+
+	if !beginCommand(t, journal, "cmd-1") {
+		t.Fatal("new command not started")
+	}
+	if beginCommand(t, journal, "cmd-1") {
+		t.Fatal("duplicate of a running command started")
+	}
+
+	journal.running("cmd-1")
+	journal.finish(platform.CommandResponse{ID: "cmd-1", Success: true})
+	journal.sent("cmd-1", nil)
+	if len(journal.pending()) != 0 {
+		t.Fatal("delivered response is pending")
+	}
+
+	// A duplicate of a delivered command is not run again, but its
+	// response is queued for immediate delivery
+	if beginCommand(t, journal, "cmd-1") {
+		t.Fatal("duplicate of a finished command started")
+	}
+	if _, pending := pendingIDs(journal)["cmd-1"]; !pending {
+		t.Error("response not queued again for a duplicate")
+	}
+
+	states, unsent := journal.stats()
+	if states[commandDone] != 1 || unsent != 1 {
+		t.Errorf("stats = %v, %d unsent", states, unsent)
+	}
+}
+
+func TestCommandJournalRetry(t *testing.T) {
+	journal := newTestJournal(t, t.TempDir())
+	beginCommand(t, journal, "cmd-1")
+	journal.finish(platform.CommandResponse{ID: "cmd-1"})
+
+	// The first delivery is attempted by the caller, so retries wait
+	if len(journal.pending()) != 0 {
+		t.Fatal("response due for retry right after finishing")
+	}
+
+	// Failed deliveries back off exponentially up to the maximum
+	want := []time.Duration{15 * time.Second, 30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}
+	for i := 0; i < 10; i++ {
+		journal.entries["cmd-1"].NextSend = time.Now().Add(-time.Second)
+		if _, pending := pendingIDs(journal)["cmd-1"]; !pending {
+			t.Fatalf("attempt %d: response not pending", i+1)
+		}
+
+		before := time.Now()
+		journal.sent("cmd-1", errors.New("platform unavailable"))
+		delay := journal.entries["cmd-1"].NextSend.Sub(before)
+		expected := commandMaxRetryInterval
+		if i < len(want) {
+			expected = want[i]
+		}
+		if delay < expected || delay > expected+time.Second {
+			t.Errorf("attempt %d: retry after %s, want %s", i+1, delay, expected)
+		}
+	}
+	if entry := journal.entries["cmd-1"]; entry.SendAttempts != 10 || entry.SendError != "platform unavailable" {
+		t.Errorf("entry = %+v", entry)
+	}
+
+	journal.entries["cmd-1"].NextSend = time.Now().Add(-time.Second)
+	journal.sent("cmd-1", nil)
+	if entry := journal.entries["cmd-1"]; !entry.Sent || entry.SendError != "" || len(journal.pending()) != 0 {
+		t.Errorf("delivered entry = %+v", entry)
+	}
+}
+
+func TestCommandJournalLoad(t *testing.T) {
+	dir := t.TempDir()
+	journal := newTestJournal(t, dir)
+
+	beginCommand(t, journal, "received")
+	beginCommand(t, journal, "running")
+	journal.running("running")
+	beginCommand(t, journal, "delivered")
+	journal.finish(platform.CommandResponse{ID: "delivered", Success: true})
+	journal.sent("delivered", nil)
+	if err := os.WriteFile(filepath.Join(dir, "garbage.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart, interrupted commands are finished with an error and
+	// their responses are due right away
+	restarted := newTestJournal(t, dir)
+	pending := pendingIDs(restarted)
+	if len(pending) != 2 {
+		t.Fatalf("pending after restart = %v", pending)
+	}
+	if !strings.Contains(pending["received"], "while received") || !strings.Contains(pending["running"], "while running") {
+		t.Errorf("pending after restart = %v", pending)
+	}
+	for _, id := range []string{"received", "running", "delivered"} {
+		if state := restarted.entries[id].State; state != commandDone {
+			t.Errorf("%s is %s after restart", id, state)
+		}
+		if beginCommand(t, restarted, id) && id != "delivered" {
+			t.Errorf("%s started again after restart", id)
+		}
+	}
+
+	// The interrupted state is persisted, so a further restart keeps the
+	// original error
+	again := newTestJournal(t, dir)
+	if entry := again.entries["running"]; entry.State != commandDone || !strings.Contains(entry.Response.Error, "while running") {
+		t.Errorf("entry after a second restart = %+v", entry)
+	}
+}
+
+func TestCommandJournalPrune(t *testing.T) {
+	dir := t.TempDir()
+	journal := newTestJournal(t, dir)
+
+	old := time.Now().Add(-commandJournalRetention - time.Hour)
+	for _, id := range []string{"old", "unexpired", "unsent", "recent"} {
+		beginCommand(t, journal, id)
+		journal.finish(platform.CommandResponse{ID: id})
+		if id != "unsent" {
+			journal.sent(id, nil)
+		}
+		if id != "recent" {
+			journal.entries[id].Finished = old
+		}
+	}
+	// Signed commands are remembered until they can no longer verify
+	journal.entries["unexpired"].Expires = time.Now().Add(time.Hour)
+
+	journal.prune()
+
+	if _, exists := journal.entries["old"]; exists {
+		t.Error("old delivered command not pruned")
+	}
+	if _, err := os.Stat(journal.path("old")); !os.IsNotExist(err) {
+		t.Errorf("journal file of a pruned command: %v", err)
+	}
+	for _, id := range []string{"unexpired", "unsent", "recent"} {
+		if _, exists := journal.entries[id]; !exists {
+			t.Errorf("%s was pruned", id)
+		}
+	}
+}
+
+func TestCommandJournalPersistFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "journal")
+	journal := newTestJournal(t, dir)
+
+	// Replace the directory with a file so that entries cannot be written
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if started, err := journal.begin(platform.Command{ID: "cmd-1"}, "poll"); started || err == nil {
+		t.Fatalf("got %v, %v for an unwritable journal", started, err)
+	}
+	if _, exists := journal.entries["cmd-1"]; exists {
+		t.Error("command recorded without being persisted")
+	}
+
+	// A journal that cannot be loaded refuses every command
+	broken := newCommandJournal(dir, newTestLogger(t))
+	if err := broken.load(); err == nil {
+		t.Fatal("expected a load error")
+	}
+	if started, err := broken.begin(platform.Command{ID: "cmd-2"}, "poll"); started || err == nil || broken.loadError() == nil {
+		t.Errorf("got %v, %v from a journal that failed to load", started, err)
+	}
+
+	// Once the directory is back, commands are accepted again
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if !beginCommand(t, journal, "cmd-1") {
+		t.Error("command not started after the journal recovered")
+	}
+}
@@ -0,0 +1,472 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultCommandPolicyFile is read when commands.policy_file is not set.
+// Unlike an explicitly configured file it may be absent, in which case
+// commands are not restricted but sessions and file transfers are refused.
+const defaultCommandPolicyFile = "/etc/pulse-hive/command-policy.yaml"
+
+// Session defaults
+const (
+	defaultSessionShell       = "/bin/sh"
+	defaultSessionIdleTimeout = 15 * time.Minute
+)
+
+// defaultMaxFileSize limits file transfers unless the policy sets a limit
+const defaultMaxFileSize = 100 * 1024 * 1024
+
+// shellMetacharacters are the characters that let a shell command run
+// something other than its first word
+const shellMetacharacters = ";&|<>$`()\n"
+
+// assignmentPattern matches a leading NAME=value word, after which a shell
+// runs the next word as the command
+var assignmentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// commandPolicyFile is the on-disk format of the command policy
+type commandPolicyFile struct {
+	AllowedTypes   []string `yaml:"allowed_types"`
+	MaxConcurrency int      `yaml:"max_concurrency"`
+	Execute        struct {
+		Shell      *bool             `yaml:"shell"`
+		Allow      []string          `yaml:"allow"`
+		Deny       []string          `yaml:"deny"`
+		AllowArgv  [][]string        `yaml:"allow_argv"`
+		DenyArgv   [][]string        `yaml:"deny_argv"`
+		WorkingDir string            `yaml:"working_dir"`
+		Env        map[string]string `yaml:"env"`
+		ClearEnv   bool              `yaml:"clear_env"`
+	} `yaml:"execute"`
+	Session struct {
+		Enabled     bool          `yaml:"enabled"`
+		Shell       string        `yaml:"shell"`
+		Args        []string      `yaml:"args"`
+		IdleTimeout time.Duration `yaml:"idle_timeout"`
+		MaxSessions int           `yaml:"max_sessions"`
+	} `yaml:"session"`
+	Files struct {
+		ReadPaths  []string `yaml:"read_paths"`
+		WritePaths []string `yaml:"write_paths"`
+		MaxSize    int64    `yaml:"max_size"`
+	} `yaml:"files"`
+}
+
+// commandPolicy constrains the commands the platform may run. It is read
+// from a local file owned by the host administrator; nothing received from
+// the platform can change it.
+type commandPolicy struct {
+	source string
+
+	types      map[string]bool // nil allows every type
+	shell      bool
+	allow      []*regexp.Regexp
+	deny       []*regexp.Regexp
+	allowArgv  [][]string
+	denyArgv   [][]string
+	workingDir string
+	env        map[string]string
+	clearEnv   bool
+
+	slots chan struct{} // nil means unlimited concurrency
+
+	sessions    bool
+	shellArgv   []string
+	sessionIdle time.Duration
+	maxSessions int // 0 means unlimited
+
+	readPaths   []string
+	writePaths  []string
+	maxFileSize int64
+}
+
+// loadCommandPolicy reads the policy file. Without a configured file the
+// default location is tried, and an unrestricted policy is returned if it
+// does not exist.
+func loadCommandPolicy(file string) (*commandPolicy, error) {
+	explicit := file != ""
+	if !explicit {
+		file = defaultCommandPolicyFile
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return &commandPolicy{shell: true, maxFileSize: defaultMaxFileSize}, nil
+		}
+		return nil, fmt.Errorf("failed to read command policy: %w", err)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return nil, fmt.Errorf("command policy %s is writable by group or others", file)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read command policy: %w", err)
+	}
+
+	var spec commandPolicyFile
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse command policy %s: %w", file, err)
+	}
+
+	policy, err := newCommandPolicy(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command policy %s: %w", file, err)
+	}
+	policy.source = file
+	return policy, nil
+}
+
+// newCommandPolicy compiles a policy. Allow patterns must match the whole
+// command, deny patterns match anywhere in it.
+func newCommandPolicy(spec commandPolicyFile) (*commandPolicy, error) {
+	policy := &commandPolicy{
+		shell:      true,
+		allowArgv:  spec.Execute.AllowArgv,
+		denyArgv:   spec.Execute.DenyArgv,
+		workingDir: spec.Execute.WorkingDir,
+		env:        spec.Execute.Env,
+		clearEnv:   spec.Execute.ClearEnv,
+	}
+
+	if spec.AllowedTypes != nil {
+		policy.types = make(map[string]bool)
+		for _, t := range spec.AllowedTypes {
+			policy.types[t] = true
+		}
+	}
+	if spec.MaxConcurrency < 0 {
+		return nil, fmt.Errorf("max_concurrency must not be negative")
+	}
+	if spec.MaxConcurrency > 0 {
+		policy.slots = make(chan struct{}, spec.MaxConcurrency)
+	}
+	if spec.Execute.Shell != nil {
+		policy.shell = *spec.Execute.Shell
+	}
+
+	for _, pattern := range spec.Execute.Allow {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow pattern %q: %w", pattern, err)
+		}
+		policy.allow = append(policy.allow, re)
+	}
+	for _, pattern := range spec.Execute.Deny {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+		policy.deny = append(policy.deny, re)
+	}
+	for _, rules := range [][][]string{policy.allowArgv, policy.denyArgv} {
+		for _, rule := range rules {
+			if len(rule) == 0 {
+				return nil, fmt.Errorf("empty argv rule")
+			}
+			for _, pattern := range rule {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("invalid argv pattern %q: %w", pattern, err)
+				}
+			}
+		}
+	}
+
+	if policy.workingDir != "" && !filepath.IsAbs(policy.workingDir) {
+		return nil, fmt.Errorf("working_dir must be an absolute path")
+	}
+
+	policy.sessions = spec.Session.Enabled
+	shell := spec.Session.Shell
+	if shell == "" {
+		shell = defaultSessionShell
+	}
+	if !filepath.IsAbs(shell) {
+		return nil, fmt.Errorf("session shell must be an absolute path")
+	}
+	policy.shellArgv = append([]string{shell}, spec.Session.Args...)
+	policy.sessionIdle = spec.Session.IdleTimeout
+	if policy.sessionIdle <= 0 {
+		policy.sessionIdle = defaultSessionIdleTimeout
+	}
+	if spec.Session.MaxSessions < 0 {
+		return nil, fmt.Errorf("session max_sessions must not be negative")
+	}
+	policy.maxSessions = spec.Session.MaxSessions
+
+	for _, paths := range []struct {
+		name   string
+		in     []string
+		result *[]string
+	}{
+		{"read_paths", spec.Files.ReadPaths, &policy.readPaths},
+		{"write_paths", spec.Files.WritePaths, &policy.writePaths},
+	} {
+		for _, prefix := range paths.in {
+			if !filepath.IsAbs(prefix) {
+				return nil, fmt.Errorf("files %s entry %q must be an absolute path", paths.name, prefix)
+			}
+			*paths.result = append(*paths.result, filepath.Clean(prefix))
+		}
+	}
+	if spec.Files.MaxSize < 0 {
+		return nil, fmt.Errorf("files max_size must not be negative")
+	}
+	policy.maxFileSize = spec.Files.MaxSize
+	if policy.maxFileSize == 0 {
+		policy.maxFileSize = defaultMaxFileSize
+	}
+
+	return policy, nil
+}
+
+// checkSession rejects shell sessions unless the policy enables them.
+// Sessions are interactive, so they are not subject to the execute rules.
+func (p *commandPolicy) checkSession() error {
+	if !p.sessions {
+		return fmt.Errorf("command rejected by policy: shell sessions are not enabled")
+	}
+	return nil
+}
+
+// checkFiles rejects file transfers unless a policy file sets the paths
+// they may use. It is checked before paths are resolved, so that an
+// unrestricted agent does not reveal which files exist.
+func (p *commandPolicy) checkFiles() error {
+	if !p.restricted() {
+		return fmt.Errorf("command rejected by policy: file transfers require a command policy file")
+	}
+	return nil
+}
+
+// checkPath rejects file transfers outside the policy's path prefixes. A
+// direction without prefixes allows no paths. The path must already be
+// resolved.
+func (p *commandPolicy) checkPath(path string, write bool) error {
+	if err := p.checkFiles(); err != nil {
+		return err
+	}
+
+	prefixes, direction := p.readPaths, "reading"
+	if write {
+		prefixes, direction = p.writePaths, "writing"
+	}
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("command rejected by policy: %s %s is not allowed", direction, path)
+}
+
+// restricted returns whether the policy was read from a file
+func (p *commandPolicy) restricted() bool {
+	return p.source != ""
+}
+
+// checkType rejects command types the policy does not allow
+func (p *commandPolicy) checkType(commandType string) error {
+	if p.types != nil && !p.types[commandType] {
+		return fmt.Errorf("command rejected by policy: type %q is not allowed", commandType)
+	}
+	return nil
+}
+
+// checkExecute validates a system command against the allow and deny
+// lists. When the policy disables the shell it returns the argv to run
+// directly; otherwise it returns nil and the command goes through sh -c.
+func (p *commandPolicy) checkExecute(command string) ([]string, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("command rejected by policy: empty command")
+	}
+
+	for _, re := range p.deny {
+		if re.MatchString(command) {
+			return nil, fmt.Errorf("command rejected by policy: matches deny pattern %q", re.String())
+		}
+	}
+
+	argv, err := splitCommandLine(command)
+	if err != nil {
+		return nil, fmt.Errorf("command rejected by policy: %w", err)
+	}
+	for _, rule := range p.denyArgv {
+		if matchArgv(rule, argv) {
+			return nil, fmt.Errorf("command rejected by policy: matches denied argv %q", rule)
+		}
+	}
+	// Through a shell, a denied program can hide behind another command, a
+	// substitution or a variable assignment, so argv deny rules only admit
+	// single simple commands
+	if p.shell && len(p.denyArgv) > 0 &&
+		(strings.ContainsAny(command, shellMetacharacters) || assignmentPattern.MatchString(argv[0])) {
+		return nil, fmt.Errorf("command rejected by policy: shell syntax is not allowed with argv deny rules")
+	}
+
+	if len(p.allow) > 0 || len(p.allowArgv) > 0 {
+		allowed := false
+		for _, re := range p.allow {
+			if re.MatchString(command) {
+				allowed = true
+				break
+			}
+		}
+		// Through a shell, the words of a command only say what runs when
+		// there is a single simple command
+		if !allowed && (!p.shell || !strings.ContainsAny(command, shellMetacharacters)) {
+			for _, rule := range p.allowArgv {
+				if matchArgv(rule, argv) {
+					allowed = true
+					break
+				}
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("command rejected by policy: not in allowlist")
+		}
+	}
+
+	if p.shell {
+		return nil, nil
+	}
+	return argv, nil
+}
+
+// acquire takes an execution slot, returning false when the concurrency
+// limit is reached
+func (p *commandPolicy) acquire() bool {
+	if p.slots == nil {
+		return true
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release returns an execution slot
+func (p *commandPolicy) release() {
+	if p.slots != nil {
+		<-p.slots
+	}
+}
+
+// environ returns the environment for system commands, or nil to inherit
+// the agent's environment unchanged
+func (p *commandPolicy) environ() []string {
+	if len(p.env) == 0 && !p.clearEnv {
+		return nil
+	}
+
+	env := make(map[string]string)
+	if !p.clearEnv {
+		for _, kv := range os.Environ() {
+			if i := strings.IndexByte(kv, '='); i > 0 {
+				env[kv[:i]] = kv[i+1:]
+			}
+		}
+	}
+	for k, v := range p.env {
+		env[k] = v
+	}
+
+	result := make([]string, 0, len(env))
+	for k, v := range env {
+		result = append(result, k+"="+v)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// matchArgv reports whether argv starts with the words of a rule. Words
+// are glob patterns; a first word without a slash also matches a program
+// given by path.
+func matchArgv(rule, argv []string) bool {
+	if len(argv) < len(rule) {
+		return false
+	}
+	for i, pattern := range rule {
+		word := argv[i]
+		if i == 0 && !strings.Contains(pattern, "/") {
+			word = filepath.Base(word)
+		}
+		if ok, _ := path.Match(pattern, word); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitCommandLine splits a command into words the way a shell does for
+// a simple command, honouring quotes and backslash escapes
+func splitCommandLine(command string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune("\\\"$`", runes[i+1]) {
+				i++
+				word.WriteRune(runes[i])
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			if i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+			}
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return words, nil
+}
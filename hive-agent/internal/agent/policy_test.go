@@ -0,0 +1,267 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// testPolicy compiles a policy from its YAML form
+func testPolicy(t *testing.T, text string) *commandPolicy {
+	t.Helper()
+
+	var spec commandPolicyFile
+	if err := yaml.Unmarshal([]byte(text), &spec); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := newCommandPolicy(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"uptime", []string{"uptime"}},
+		{"  ls   -l\t/tmp \n", []string{"ls", "-l", "/tmp"}},
+		{`echo 'a b' "c d"`, []string{"echo", "a b", "c d"}},
+		{`echo a"b"'c'd`, []string{"echo", "abcd"}},
+		{`echo '' ""`, []string{"echo", "", ""}},
+		{`echo a\ b \'`, []string{"echo", "a b", "'"}},
+		// Inside single quotes backslashes are literal
+		{`echo 'a\'`, []string{"echo", `a\`}},
+		// Inside double quotes a backslash only escapes \ " $ and `
+		{`echo "\"q\" \$HOME \\ \n"`, []string{"echo", `"q" $HOME \ \n`}},
+		{`echo trailing\`, []string{"echo", "trailing"}},
+	}
+	for _, tt := range tests {
+		got, err := splitCommandLine(tt.command)
+		if err != nil {
+			t.Errorf("%q: %v", tt.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.command, got, tt.want)
+		}
+	}
+
+	for _, command := range []string{`echo 'open`, `echo "open`, `echo "a\"`, "", "   "} {
+		if words, err := splitCommandLine(command); err == nil {
+			t.Errorf("%q: got %q, want an error", command, words)
+		}
+	}
+}
+
+func TestMatchArgv(t *testing.T) {
+	tests := []struct {
+		rule []string
+		argv []string
+		want bool
+	}{
+		{[]string{"systemctl", "status", "*"}, []string{"systemctl", "status", "nginx"}, true},
+		{[]string{"systemctl", "status"}, []string{"systemctl", "status", "nginx", "--no-pager"}, true},
+		{[]string{"systemctl", "status", "*"}, []string{"systemctl", "status"}, false},
+		{[]string{"systemctl", "stop"}, []string{"systemctl", "status", "nginx"}, false},
+		{[]string{"journalctl", "-u", "*.service"}, []string{"journalctl", "-u", "nginx.service"}, true},
+		{[]string{"journalctl", "-u", "*.service"}, []string{"journalctl", "-u", "nginx.socket"}, false},
+		{[]string{"ls", "-[la]"}, []string{"ls", "-a"}, true},
+		// A program without a slash matches its basename
+		{[]string{"rm"}, []string{"/bin/rm", "-rf", "/"}, true},
+		{[]string{"rm"}, []string{"./rm"}, true},
+		{[]string{"/usr/bin/rm"}, []string{"rm"}, false},
+		{[]string{"/usr/bin/rm"}, []string{"/usr/bin/rm", "x"}, true},
+		// Only the first word is matched by basename
+		{[]string{"cat", "passwd"}, []string{"cat", "/etc/passwd"}, false},
+		// Globs do not cross slashes
+		{[]string{"cat", "/var/log/*"}, []string{"cat", "/var/log/nginx/access.log"}, false},
+	}
+	for _, tt := range tests {
+		if got := matchArgv(tt.rule, tt.argv); got != tt.want {
+			t.Errorf("matchArgv(%q, %q) = %v, want %v", tt.rule, tt.argv, got, tt.want)
+		}
+	}
+}
+
+func TestCheckExecute(t *testing.T) {
+	shellPolicy := testPolicy(t, `
+execute:
+  allow: ['uptime', 'rm -f /tmp/.*']
+  deny: ['rm\s']
+  allow_argv: [["systemctl", "status", "*"]]
+  deny_argv: [["systemctl", "stop"]]
+`)
+	denyOnly := testPolicy(t, `
+execute:
+  deny_argv: [["rm"]]
+`)
+	direct := testPolicy(t, `
+execute:
+  shell: false
+  allow_argv: [["ls", "*"]]
+  deny_argv: [["ls", "/root"]]
+`)
+	unrestricted := testPolicy(t, "{}")
+
+	tests := []struct {
+		name    string
+		policy  *commandPolicy
+		command string
+		argv    []string
+		err     string // substring of the error, empty when allowed
+	}{
+		{"allow pattern", shellPolicy, "uptime", nil, ""},
+		{"allow argv", shellPolicy, "systemctl status nginx", nil, ""},
+		{"not allowed", shellPolicy, "hostname", nil, "not in allowlist"},
+		{"deny pattern wins over allow", shellPolicy, "rm -f /tmp/x", nil, "deny pattern"},
+		{"deny argv", shellPolicy, "systemctl stop nginx", nil, "denied argv"},
+		{"allow argv with a list", shellPolicy, "systemctl status nginx; reboot", nil, "shell syntax"},
+		{"empty", shellPolicy, "  ", nil, "empty command"},
+		{"unterminated quote", shellPolicy, "systemctl status 'nginx", nil, "unterminated quote"},
+
+		// Through a shell, deny argv rules must not be bypassed
+		{"simple command", denyOnly, "ls -l /tmp", nil, ""},
+		{"denied by path", denyOnly, "/bin/rm -rf /", nil, "denied argv"},
+		{"denied quoted", denyOnly, `"r"m -rf /`, nil, "denied argv"},
+		{"list", denyOnly, "true; rm -rf /", nil, "shell syntax"},
+		{"and list", denyOnly, "echo x && rm -rf /", nil, "shell syntax"},
+		{"pipe", denyOnly, "echo / | xargs rm -rf", nil, "shell syntax"},
+		{"substitution", denyOnly, "$(rm -rf /)", nil, "shell syntax"},
+		{"backquotes", denyOnly, "echo `rm -rf /`", nil, "shell syntax"},
+		{"subshell", denyOnly, "(rm -rf /)", nil, "shell syntax"},
+		{"newline", denyOnly, "true\nrm -rf /", nil, "shell syntax"},
+		{"assignment", denyOnly, "FOO=1 rm -rf /", nil, "shell syntax"},
+		{"assignment value is not checked", denyOnly, "echo FOO=1", nil, ""},
+
+		// Without a shell the split words are returned and run directly
+		{"direct", direct, "ls 'a b'", []string{"ls", "a b"}, ""},
+		{"metacharacters are plain words", direct, "ls a;reboot", []string{"ls", "a;reboot"}, ""},
+		{"assignment is a program name", direct, "FOO=1 ls /tmp", nil, "not in allowlist"},
+		{"direct deny", direct, "ls /root", nil, "denied argv"},
+
+		{"unrestricted", unrestricted, "true; rm -rf /", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, err := tt.policy.checkExecute(tt.command)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("rejected: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.err)
+			}
+			if !reflect.DeepEqual(argv, tt.argv) {
+				t.Errorf("got argv %q, want %q", argv, tt.argv)
+			}
+		})
+	}
+}
+
+func TestNewCommandPolicy(t *testing.T) {
+	policy := testPolicy(t, `
+allowed_types: [status, system]
+files:
+  read_paths: [/var/log/]
+  write_paths: [/etc/myapp/../myapp]
+`)
+	if !policy.shell || policy.slots != nil || policy.sessions {
+		t.Errorf("unexpected defaults: shell %v, slots %v, sessions %v", policy.shell, policy.slots, policy.sessions)
+	}
+	if policy.sessionIdle != defaultSessionIdleTimeout || policy.maxFileSize != defaultMaxFileSize ||
+		!reflect.DeepEqual(policy.shellArgv, []string{defaultSessionShell}) {
+		t.Errorf("unexpected defaults: idle %s, max size %d, shell %q", policy.sessionIdle, policy.maxFileSize, policy.shellArgv)
+	}
+	if !reflect.DeepEqual(policy.readPaths, []string{"/var/log"}) || !reflect.DeepEqual(policy.writePaths, []string{"/etc/myapp"}) {
+		t.Errorf("paths not cleaned: %q %q", policy.readPaths, policy.writePaths)
+	}
+	if policy.checkType("status") != nil || policy.checkType("restart") == nil {
+		t.Error("allowed_types not applied")
+	}
+
+	invalid := map[string]string{
+		"negative concurrency":   "max_concurrency: -1",
+		"invalid allow pattern":  "execute: {allow: ['(']}",
+		"invalid deny pattern":   "execute: {deny: ['[']}",
+		"empty argv rule":        "execute: {allow_argv: [[]]}",
+		"invalid argv pattern":   "execute: {deny_argv: [['[']]}",
+		"relative working dir":   "execute: {working_dir: tmp}",
+		"relative session shell": "session: {shell: bash}",
+		"negative max sessions":  "session: {max_sessions: -1}",
+		"relative read path":     "files: {read_paths: [var/log]}",
+		"relative write path":    "files: {write_paths: [./etc]}",
+		"negative max size":      "files: {max_size: -1}",
+	}
+	for name, text := range invalid {
+		var spec commandPolicyFile
+		if err := yaml.Unmarshal([]byte(text), &spec); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := newCommandPolicy(spec); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if policy := testPolicy(t, "session: {idle_timeout: -1s}"); policy.sessionIdle != defaultSessionIdleTimeout {
+		t.Errorf("negative idle timeout gave %s", policy.sessionIdle)
+	}
+	if policy := testPolicy(t, "session: {idle_timeout: 5m}"); policy.sessionIdle != 5*time.Minute {
+		t.Errorf("idle timeout = %s", policy.sessionIdle)
+	}
+}
+
+func TestLoadCommandPolicy(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(file, []byte("max_concurrency: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := loadCommandPolicy(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.restricted() || policy.source != file {
+		t.Errorf("policy loaded from %q is not restricted", policy.source)
+	}
+
+	if err := os.Chmod(file, 0664); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCommandPolicy(file); err == nil || !strings.Contains(err.Error(), "writable") {
+		t.Errorf("got %v for a group-writable policy", err)
+	}
+	if _, err := loadCommandPolicy(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing configured policy")
+	}
+}
+
+func TestPolicyConcurrency(t *testing.T) {
+	policy := testPolicy(t, "max_concurrency: 2")
+	if !policy.acquire() || !policy.acquire() {
+		t.Fatal("could not take the configured slots")
+	}
+	if policy.acquire() {
+		t.Fatal("acquired a slot beyond max_concurrency")
+	}
+	policy.release()
+	if !policy.acquire() {
+		t.Error("released slot not available")
+	}
+
+	unlimited := testPolicy(t, "{}")
+	for i := 0; i < 100; i++ {
+		if !unlimited.acquire() {
+			t.Fatal("unlimited policy refused a slot")
+		}
+	}
+	unlimited.release()
+}
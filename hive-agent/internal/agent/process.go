@@ -0,0 +1,259 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"hive-agent/internal/platform"
+)
+
+const (
+	// commandChunkSize is the largest chunk of streamed output
+	commandChunkSize = 32 * 1024
+	// commandStreamInterval is how often buffered output is streamed
+	commandStreamInterval = time.Second
+)
+
+// systemResult is the outcome of a system command
+type systemResult struct {
+	output   string
+	exitCode int
+	chunks   int64 // output chunks streamed, in which case output is empty
+}
+
+// commandTimeout returns the timeout for a command: the requested one,
+// capped at the configured maximum, or the default
+func (a *Agent) commandTimeout(cmd platform.Command) time.Duration {
+	timeout := cmd.Timeout
+	if timeout <= 0 {
+		timeout = a.config.Commands.DefaultTimeout
+	}
+	if timeout > a.config.Commands.MaxTimeout {
+		a.logger.Warn("Command timeout capped", "id", cmd.ID, "requested", timeout, "max", a.config.Commands.MaxTimeout)
+		timeout = a.config.Commands.MaxTimeout
+	}
+	return timeout
+}
+
+// executePolicyCommand executes a platform-supplied system command within
+// the command policy: through the shell or directly as argv, in the
+// policy's working directory and environment. The command runs in its own
+// process group, which is killed on timeout or cancellation. With the
+// "stream" parameter set, output is streamed in chunks while it runs.
+func (a *Agent) executePolicyCommand(cmd platform.Command) (systemResult, error) {
+	argv, err := a.policy.checkExecute(cmd.Command)
+	if err != nil {
+		a.logger.Warn("System command rejected", "command", cmd.Command, "reason", err)
+		return systemResult{}, err
+	}
+
+	timeout := a.commandTimeout(cmd)
+	ctx, cancel := context.WithTimeout(a.ctx, timeout)
+	defer cancel()
+
+	a.runningMu.Lock()
+	a.running[cmd.ID] = cancel
+	a.runningMu.Unlock()
+	defer func() {
+		a.runningMu.Lock()
+		delete(a.running, cmd.ID)
+		a.runningMu.Unlock()
+	}()
+
+	var process *exec.Cmd
+	if argv != nil {
+		process = exec.Command(argv[0], argv[1:]...)
+	} else {
+		process = exec.Command("sh", "-c", cmd.Command)
+	}
+	process.Dir = a.policy.workingDir
+	process.Env = a.policy.environ()
+	process.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var output bytes.Buffer
+	var streamer *outputStreamer
+	if stream, _ := cmd.Parameters["stream"].(bool); stream {
+		streamer = newOutputStreamer(a, cmd.ID)
+		process.Stdout = streamer.writer("stdout")
+		process.Stderr = streamer.writer("stderr")
+	} else {
+		process.Stdout = &output
+		process.Stderr = &output
+	}
+
+	if err := process.Start(); err != nil {
+		if streamer != nil {
+			streamer.close()
+		}
+		return systemResult{exitCode: 1}, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- process.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Kill the whole group, so that children of the shell go too
+		syscall.Kill(-process.Process.Pid, syscall.SIGKILL)
+		err = <-done
+	}
+
+	result := systemResult{output: output.String(), exitCode: commandExitCode(err)}
+	if streamer != nil {
+		result.chunks = streamer.close()
+	}
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("command timed out after %s", timeout)
+	case ctx.Err() == context.Canceled && a.ctx.Err() == nil:
+		err = fmt.Errorf("command cancelled")
+	}
+
+	return result, err
+}
+
+// cancelCommand kills a running system command
+func (a *Agent) cancelCommand(id string) error {
+	a.runningMu.Lock()
+	cancel, exists := a.running[id]
+	a.runningMu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("no running command with ID %q", id)
+	}
+	cancel()
+	return nil
+}
+
+// outputStreamer sends command output to the platform in sequenced
+// chunks, batching what is written between flushes
+type outputStreamer struct {
+	agent *Agent
+	id    string
+
+	mu       sync.Mutex
+	sequence int64
+	pending  []platform.CommandOutput
+	sendMu   sync.Mutex // keeps chunks in order across flushes
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newOutputStreamer starts streaming output of a command
+func newOutputStreamer(a *Agent, id string) *outputStreamer {
+	s := &outputStreamer{
+		agent: a,
+		id:    id,
+		done:  make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(commandStreamInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.flush()
+			}
+		}
+	}()
+
+	return s
+}
+
+// writer returns a writer for one output stream
+func (s *outputStreamer) writer(stream string) io.Writer {
+	return streamWriter{streamer: s, stream: stream}
+}
+
+// write appends output to the pending chunks, splitting it at the chunk
+// size. Full chunks are sent right away, which also slows down a command
+// producing output faster than it can be delivered.
+func (s *outputStreamer) write(stream string, data []byte) {
+	s.mu.Lock()
+	full := false
+	for len(data) > 0 {
+		n := len(s.pending)
+		if n == 0 || s.pending[n-1].Stream != stream || len(s.pending[n-1].Data) >= commandChunkSize {
+			s.sequence++
+			s.pending = append(s.pending, platform.CommandOutput{
+				ID:        s.id,
+				Sequence:  s.sequence,
+				Stream:    stream,
+				Timestamp: time.Now(),
+			})
+			n++
+		}
+		chunk := &s.pending[n-1]
+		take := commandChunkSize - len(chunk.Data)
+		if take > len(data) {
+			take = len(data)
+		}
+		chunk.Data = append(chunk.Data, data[:take]...)
+		data = data[take:]
+		full = full || len(chunk.Data) >= commandChunkSize
+	}
+	s.mu.Unlock()
+
+	if full {
+		s.flush()
+	}
+}
+
+// flush sends the pending chunks. Streaming is best effort: chunks that
+// cannot be delivered are dropped, and the sequence numbers let the
+// platform notice the gap.
+func (s *outputStreamer) flush() {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	chunks := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if len(chunks) == 0 {
+		return
+	}
+	if err := s.agent.sendCommandOutput(s.id, chunks); err != nil {
+		s.agent.logger.Warn("Failed to stream command output", "id", s.id, "chunks", len(chunks), "error", err)
+	}
+}
+
+// close sends the remaining output and returns the number of chunks
+func (s *outputStreamer) close() int64 {
+	close(s.done)
+	s.wg.Wait()
+	s.flush()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sequence
+}
+
+// streamWriter writes to one stream of an outputStreamer
+type streamWriter struct {
+	streamer *outputStreamer
+	stream   string
+}
+
+// Write implements io.Writer
+func (w streamWriter) Write(p []byte) (int, error) {
+	w.streamer.write(w.stream, p)
+	return len(p), nil
+}
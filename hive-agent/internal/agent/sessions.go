@@ -0,0 +1,422 @@
+package agent
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+
+	"hive-agent/internal/platform"
+)
+
+const (
+	// sessionInputQueue is how many input messages may wait for a shell
+	// that is not reading before the session is closed
+	sessionInputQueue = 64
+	// sessionReadSize is the largest chunk of session output
+	sessionReadSize = 16 * 1024
+	// sessionKillRounds bounds the scans for processes left in a closed
+	// session
+	sessionKillRounds = 10
+)
+
+// sessionIDPattern restricts session IDs to characters safe in file names
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// shellSession is an interactive shell on a PTY, opened by a session
+// command and driven by session messages over the WebSocket channel
+type shellSession struct {
+	id        string
+	commandID string
+	process   *exec.Cmd
+	pty       *os.File
+
+	input        chan []byte
+	sequence     int64
+	lastActivity int64 // unix nanoseconds
+
+	// key verifies the platform's messages when commands are signed, and
+	// inputSequence is the sequence of the last one verified
+	key           ed25519.PublicKey
+	inputSequence int64
+
+	transcriptMu sync.Mutex
+	transcript   *os.File
+	started      time.Time
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// openSession starts a shell session for a session command. The shell,
+// its working directory and environment come from the command policy;
+// the optional rows and cols parameters give the initial terminal size.
+func (a *Agent) openSession(cmd platform.Command) error {
+	if err := a.policy.checkSession(); err != nil {
+		return err
+	}
+	if !sessionIDPattern.MatchString(cmd.SessionID) {
+		return fmt.Errorf("invalid session ID %q", cmd.SessionID)
+	}
+	if !a.platform.WebSocketConnected() {
+		return fmt.Errorf("shell sessions require the WebSocket channel")
+	}
+	key, err := a.verifier.sessionKey(cmd)
+	if err != nil {
+		return err
+	}
+
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+
+	if _, exists := a.sessions[cmd.SessionID]; exists {
+		return fmt.Errorf("session %s is already open", cmd.SessionID)
+	}
+	if a.policy.maxSessions > 0 && len(a.sessions) >= a.policy.maxSessions {
+		return fmt.Errorf("command rejected by policy: too many open sessions")
+	}
+	return a.startSession(cmd, key)
+}
+
+// startSession starts the shell of a session and its transcript, and
+// registers the session; the caller holds sessionsMu
+func (a *Agent) startSession(cmd platform.Command, key ed25519.PublicKey) error {
+	size := &pty.Winsize{Rows: 24, Cols: 80}
+	if rows, ok := cmd.Parameters["rows"].(float64); ok && rows > 0 {
+		size.Rows = uint16(rows)
+	}
+	if cols, ok := cmd.Parameters["cols"].(float64); ok && cols > 0 {
+		size.Cols = uint16(cols)
+	}
+
+	dir := filepath.Join(a.config.Agent.DataDir, "sessions")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create session transcript directory: %w", err)
+	}
+	started := time.Now()
+	transcriptPath := filepath.Join(dir, fmt.Sprintf("%s-%s.cast", started.UTC().Format("20060102T150405Z"), cmd.SessionID))
+	transcript, err := os.OpenFile(transcriptPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create session transcript: %w", err)
+	}
+
+	process := exec.Command(a.policy.shellArgv[0], a.policy.shellArgv[1:]...)
+	process.Dir = a.policy.workingDir
+	env := a.policy.environ()
+	if env == nil {
+		env = os.Environ()
+	}
+	process.Env = append(env, "TERM=xterm-256color")
+
+	terminal, err := pty.StartWithSize(process, size)
+	if err != nil {
+		transcript.Close()
+		os.Remove(transcriptPath)
+		return fmt.Errorf("failed to start shell: %w", err)
+	}
+
+	session := &shellSession{
+		id:         cmd.SessionID,
+		commandID:  cmd.ID,
+		process:    process,
+		pty:        terminal,
+		input:      make(chan []byte, sessionInputQueue),
+		key:        key,
+		transcript: transcript,
+		started:    started,
+		done:       make(chan struct{}),
+	}
+	session.touch()
+
+	// asciicast v2 header, so that transcripts can be replayed
+	header, _ := json.Marshal(map[string]interface{}{
+		"version":   2,
+		"width":     size.Cols,
+		"height":    size.Rows,
+		"timestamp": started.Unix(),
+		"title":     fmt.Sprintf("session %s (command %s) on %s", cmd.SessionID, cmd.ID, a.config.Agent.Hostname),
+		"env":       map[string]string{"SHELL": a.policy.shellArgv[0], "TERM": "xterm-256color"},
+	})
+	transcript.Write(append(header, '\n'))
+
+	a.sessions[session.id] = session
+
+	a.wg.Add(3)
+	go a.readSession(session)
+	go a.writeSession(session)
+	go a.watchSession(session)
+
+	a.logger.Info("Shell session opened", "session", session.id, "command", cmd.ID, "pid", process.Process.Pid, "transcript", transcriptPath)
+	return nil
+}
+
+// handleSessionMessage applies a message from the platform to a session.
+// It runs in the command service loop, so it must not block: input is
+// queued for the session's writer, and a session whose queue is full is
+// closed.
+func (a *Agent) handleSessionMessage(message platform.SessionMessage) {
+	a.sessionsMu.Lock()
+	session, exists := a.sessions[message.SessionID]
+	a.sessionsMu.Unlock()
+
+	if !exists {
+		a.logger.Debug("Message for unknown session", "session", message.SessionID, "type", message.Type)
+		a.sendSessionMessage(platform.SessionMessage{Type: "session_closed", SessionID: message.SessionID, Reason: "unknown session"})
+		return
+	}
+	if session.key != nil {
+		if err := verifySessionMessage(session.key, message, session.inputSequence); err != nil {
+			a.logger.Warn("Rejecting unverified session message", "session", session.id, "type", message.Type, "reason", err)
+			return
+		}
+		session.inputSequence = message.Sequence
+	}
+	session.touch()
+
+	switch message.Type {
+	case "session_input":
+		if len(message.Data) == 0 {
+			return
+		}
+		select {
+		case session.input <- message.Data:
+		case <-session.done:
+		default:
+			go a.closeSession(session, "shell is not reading input")
+		}
+
+	case "session_resize":
+		if message.Rows == 0 || message.Cols == 0 {
+			return
+		}
+		if err := pty.Setsize(session.pty, &pty.Winsize{Rows: message.Rows, Cols: message.Cols}); err != nil {
+			a.logger.Warn("Failed to resize session", "session", session.id, "error", err)
+			return
+		}
+		session.record("r", fmt.Sprintf("%dx%d", message.Cols, message.Rows))
+
+	case "session_close":
+		go a.closeSession(session, "closed by platform")
+	}
+}
+
+// readSession streams shell output to the platform until the shell exits
+func (a *Agent) readSession(session *shellSession) {
+	defer a.wg.Done()
+
+	buf := make([]byte, sessionReadSize)
+	for {
+		n, err := session.pty.Read(buf)
+		if n > 0 {
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			// Output does not count as activity, so that a session left
+			// running top or tail -f still reaches the idle timeout
+			session.record("o", string(data))
+			a.sendSessionMessage(platform.SessionMessage{
+				Type:      "session_output",
+				SessionID: session.id,
+				Sequence:  atomic.AddInt64(&session.sequence, 1),
+				Data:      data,
+			})
+		}
+		if err != nil {
+			// The PTY reports an error once the shell has exited
+			a.closeSession(session, "shell exited")
+			return
+		}
+	}
+}
+
+// writeSession feeds input to the shell
+func (a *Agent) writeSession(session *shellSession) {
+	defer a.wg.Done()
+
+	for {
+		select {
+		case <-session.done:
+			return
+		case data := <-session.input:
+			session.record("i", string(data))
+			if _, err := session.pty.Write(data); err != nil {
+				a.closeSession(session, "failed to write input")
+				return
+			}
+		}
+	}
+}
+
+// watchSession closes a session once the platform has sent nothing for
+// the policy's idle timeout, or when the agent stops
+func (a *Agent) watchSession(session *shellSession) {
+	defer a.wg.Done()
+
+	idle := a.policy.sessionIdle
+	interval := idle / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-session.done:
+			return
+		case <-a.ctx.Done():
+			a.closeSession(session, "agent stopping")
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, atomic.LoadInt64(&session.lastActivity))) > idle {
+				a.closeSession(session, "idle timeout")
+				return
+			}
+		}
+	}
+}
+
+// closeSession ends a session: it kills the shell's process group,
+// finishes the transcript and tells the platform
+func (a *Agent) closeSession(session *shellSession, reason string) {
+	session.closeOnce.Do(func() {
+		close(session.done)
+
+		a.sessionsMu.Lock()
+		delete(a.sessions, session.id)
+		a.sessionsMu.Unlock()
+
+		// With job control each job gets a process group of its own, so
+		// the whole session is killed, before the shell is reaped so that
+		// its children can still be found by parent
+		killSession(session.process.Process.Pid)
+		err := session.process.Wait()
+		session.pty.Close()
+		exitCode := commandExitCode(err)
+
+		session.transcriptMu.Lock()
+		session.transcript.Close()
+		session.transcriptMu.Unlock()
+
+		a.sendSessionMessage(platform.SessionMessage{
+			Type:      "session_closed",
+			SessionID: session.id,
+			ExitCode:  exitCode,
+			Reason:    reason,
+		})
+
+		a.logger.Info("Shell session closed", "session", session.id, "reason", reason,
+			"exit_code", exitCode, "duration", time.Since(session.started).Round(time.Second))
+	})
+}
+
+// killSession kills the processes of the session led by a shell, and
+// their descendants, which may have started sessions of their own. It
+// scans again until nothing is left, since processes can fork while the
+// others are killed.
+func killSession(sid int) {
+	for round := 0; round < sessionKillRounds; round++ {
+		pids := sessionProcesses(sid)
+		if len(pids) == 0 {
+			return
+		}
+		for _, pid := range pids {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// sessionProcesses returns the live processes in a session or descended
+// from one of them. Killed processes that were not yet reaped are skipped.
+func sessionProcesses(sid int) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	parents := make(map[int]int)
+	marked := make(map[int]bool)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// The command name may contain spaces and parentheses, so the
+		// fields are read after its closing parenthesis
+		stat := string(data)
+		fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+		if len(fields) < 4 || fields[0] == "Z" || fields[0] == "X" {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		session, _ := strconv.Atoi(fields[3])
+		parents[pid] = ppid
+		if session == sid || pid == sid {
+			marked[pid] = true
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for pid, ppid := range parents {
+			if !marked[pid] && marked[ppid] {
+				marked[pid] = true
+				changed = true
+			}
+		}
+	}
+
+	pids := make([]int, 0, len(marked))
+	for pid := range marked {
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+// sendSessionMessage sends a session message. Sessions depend on the
+// WebSocket channel; output produced while it is down only reaches the
+// transcript.
+func (a *Agent) sendSessionMessage(message platform.SessionMessage) {
+	if err := a.platform.SendSessionMessageWS(message); err != nil {
+		a.logger.Debug("Failed to send session message", "session", message.SessionID, "type", message.Type, "error", err)
+	}
+}
+
+// sessionCount returns the number of open sessions
+func (a *Agent) sessionCount() int {
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+	return len(a.sessions)
+}
+
+// touch records session activity
+func (s *shellSession) touch() {
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+}
+
+// record appends an event to the asciicast transcript
+func (s *shellSession) record(kind, data string) {
+	event, err := json.Marshal([]interface{}{time.Since(s.started).Seconds(), kind, data})
+	if err != nil {
+		return
+	}
+
+	s.transcriptMu.Lock()
+	defer s.transcriptMu.Unlock()
+	s.transcript.Write(append(event, '\n'))
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/platform"
+)
+
+// procState returns the state and process group of a process, or an empty
+// state once it is gone
+func procState(pid int) (string, int) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return "", 0
+	}
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 3 {
+		return "", 0
+	}
+	pgrp, _ := strconv.Atoi(fields[2])
+	return fields[0], pgrp
+}
+
+func TestCloseSessionKillsJobs(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &Agent{
+		config:   &config.Config{Agent: config.AgentConfig{DataDir: dir, Hostname: "test"}},
+		logger:   newTestLogger(t),
+		platform: &platform.Client{},
+		policy:   testPolicy(t, "session: {enabled: true, shell: /bin/sh}"),
+		ctx:      ctx,
+		cancel:   cancel,
+		sessions: make(map[string]*shellSession),
+	}
+	defer func() {
+		cancel()
+		a.wg.Wait()
+	}()
+
+	a.sessionsMu.Lock()
+	err := a.startSession(platform.Command{ID: "cmd-1", Type: "session", SessionID: "s-1"}, nil)
+	session := a.sessions["s-1"]
+	a.sessionsMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With job control on, each background job leads a process group of
+	// its own, out of reach of a kill of the shell's group
+	pidFile := filepath.Join(dir, "pids")
+	a.handleSessionMessage(platform.SessionMessage{
+		Type:      "session_input",
+		SessionID: "s-1",
+		Data:      []byte("set -m; sleep 1000 & a=$!; nohup sleep 1000 >/dev/null 2>&1 & echo $a $! > " + pidFile + ".tmp && mv " + pidFile + ".tmp " + pidFile + "\n"),
+	})
+
+	var pids []int
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pids) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("background jobs not started")
+		}
+		time.Sleep(20 * time.Millisecond)
+		data, err := os.ReadFile(pidFile)
+		if err != nil {
+			continue
+		}
+		for _, field := range strings.Fields(string(data)) {
+			pid, err := strconv.Atoi(field)
+			if err != nil {
+				t.Fatalf("invalid pid file %q", data)
+			}
+			pids = append(pids, pid)
+		}
+	}
+	for _, pid := range pids {
+		if state, pgrp := procState(pid); state == "" || pgrp == session.process.Process.Pid {
+			t.Fatalf("job %d: state %q, process group %d of the shell", pid, state, pgrp)
+		}
+	}
+
+	a.closeSession(session, "test")
+
+	for _, pid := range pids {
+		if state, _ := procState(pid); state != "" && state != "Z" {
+			t.Errorf("job %d still running (state %s) after the session closed", pid, state)
+		}
+	}
+	if a.sessionCount() != 0 {
+		t.Error("closed session still registered")
+	}
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/platform"
+)
+
+// commandClockSkew is the clock difference tolerated between the agent
+// and whoever signs commands
+const commandClockSkew = time.Minute
+
+// commandVerifier checks command signatures against the public keys
+// pinned in the agent configuration, so that the platform API key alone
+// is not enough to run commands
+type commandVerifier struct {
+	keys   []ed25519.PublicKey
+	maxTTL time.Duration
+}
+
+// newCommandVerifier parses the pinned signing keys
+func newCommandVerifier(cfg config.CommandsConfig) (*commandVerifier, error) {
+	verifier := &commandVerifier{maxTTL: cfg.MaxCommandTTL}
+
+	for i, encoded := range cfg.SigningKeys {
+		key, err := decodeBase64(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid commands.signing_keys[%d]: %w", i, err)
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid commands.signing_keys[%d]: expected %d bytes, got %d", i, ed25519.PublicKeySize, len(key))
+		}
+		verifier.keys = append(verifier.keys, ed25519.PublicKey(key))
+	}
+
+	return verifier, nil
+}
+
+// enabled returns whether commands must be signed
+func (v *commandVerifier) enabled() bool {
+	return len(v.keys) > 0
+}
+
+// verify checks the signature and expiry of a command. Replays within
+// the expiry are caught by the command journal, which remembers signed
+// commands until they expire.
+func (v *commandVerifier) verify(cmd platform.Command, now time.Time) error {
+	if !v.enabled() {
+		return nil
+	}
+
+	if cmd.Signature == "" {
+		return fmt.Errorf("command is not signed")
+	}
+	if cmd.ExpiresAt == 0 {
+		return fmt.Errorf("signed command has no expiry")
+	}
+
+	expires := time.Unix(cmd.ExpiresAt, 0)
+	if now.After(expires.Add(commandClockSkew)) {
+		return fmt.Errorf("command expired at %s", expires.UTC().Format(time.RFC3339))
+	}
+	if expires.After(now.Add(v.maxTTL + commandClockSkew)) {
+		return fmt.Errorf("command expiry %s is more than %s ahead", expires.UTC().Format(time.RFC3339), v.maxTTL)
+	}
+
+	signature, err := decodeBase64(cmd.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("malformed command signature")
+	}
+	payload, err := cmd.SigningPayload()
+	if err != nil {
+		return fmt.Errorf("failed to encode command for verification: %w", err)
+	}
+
+	for _, key := range v.keys {
+		if ed25519.Verify(key, payload, signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("command signature does not match any pinned key")
+}
+
+// sessionKey returns the public key that must sign the platform's
+// messages for a session. When commands are signed, the session command
+// carries it in its session_key parameter, so that the signature binds
+// the session's traffic to whoever signed the command; nil is returned
+// when commands are not signed.
+func (v *commandVerifier) sessionKey(cmd platform.Command) (ed25519.PublicKey, error) {
+	if !v.enabled() {
+		return nil, nil
+	}
+	encoded, _ := cmd.Parameters["session_key"].(string)
+	if encoded == "" {
+		return nil, fmt.Errorf("signed session command has no session_key")
+	}
+	key, err := decodeBase64(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("malformed session_key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifySessionMessage checks the signature of a session message from the
+// platform. Sequence numbers must increase, so a recorded message cannot
+// be replayed into the session.
+func verifySessionMessage(key ed25519.PublicKey, message platform.SessionMessage, lastSequence int64) error {
+	if message.Signature == "" {
+		return fmt.Errorf("session message is not signed")
+	}
+	if message.Sequence <= lastSequence {
+		return fmt.Errorf("session message sequence %d is not after %d", message.Sequence, lastSequence)
+	}
+
+	signature, err := decodeBase64(message.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("malformed session message signature")
+	}
+	payload, err := message.SigningPayload()
+	if err != nil {
+		return fmt.Errorf("failed to encode session message for verification: %w", err)
+	}
+	if !ed25519.Verify(key, payload, signature) {
+		return fmt.Errorf("session message signature does not match the session key")
+	}
+	return nil
+}
+
+// decodeBase64 decodes standard base64 with or without padding
+func decodeBase64(s string) ([]byte, error) {
+	if strings.HasSuffix(s, "=") {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/platform"
+)
+
+// testSigningKey returns a deterministic signing key
+func testSigningKey(seed byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed([]byte(strings.Repeat(string(rune('a'+seed)), ed25519.SeedSize)))
+}
+
+// signCommand signs a command with a key
+func signCommand(t *testing.T, key ed25519.PrivateKey, cmd platform.Command) platform.Command {
+	t.Helper()
+
+	payload, err := cmd.SigningPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	return cmd
+}
+
+func TestCommandVerifier(t *testing.T) {
+	key := testSigningKey(0)
+	other := testSigningKey(1)
+	verifier, err := newCommandVerifier(config.CommandsConfig{
+		SigningKeys:   []string{base64.RawStdEncoding.EncodeToString(other.Public().(ed25519.PublicKey)), base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))},
+		MaxCommandTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	base := platform.Command{
+		ID:         "cmd-1",
+		Type:       "execute",
+		Command:    "uptime",
+		Parameters: map[string]interface{}{"lines": float64(10)},
+		Timeout:    30 * time.Second,
+		SessionID:  "s-1",
+		ExpiresAt:  now.Add(10 * time.Minute).Unix(),
+	}
+	signed := signCommand(t, key, base)
+
+	if err := verifier.verify(signed, now); err != nil {
+		t.Fatalf("valid command rejected: %v", err)
+	}
+	unpadded := signed
+	unpadded.Signature = strings.TrimRight(signed.Signature, "=")
+	if err := verifier.verify(unpadded, now); err != nil {
+		t.Errorf("unpadded signature rejected: %v", err)
+	}
+	// The second pinned key is tried too
+	if err := verifier.verify(signCommand(t, other, base), now); err != nil {
+		t.Errorf("command signed by the other pinned key rejected: %v", err)
+	}
+
+	tamper := func(change func(*platform.Command)) platform.Command {
+		cmd := signed
+		cmd.Parameters = map[string]interface{}{"lines": float64(10)}
+		change(&cmd)
+		return cmd
+	}
+	tests := []struct {
+		name string
+		cmd  platform.Command
+		err  string
+	}{
+		{"unsigned", tamper(func(c *platform.Command) { c.Signature = "" }), "not signed"},
+		{"malformed signature", tamper(func(c *platform.Command) { c.Signature = "!!!" }), "malformed"},
+		{"short signature", tamper(func(c *platform.Command) { c.Signature = base64.StdEncoding.EncodeToString([]byte("short")) }), "malformed"},
+		{"unknown key", signCommand(t, testSigningKey(2), base), "does not match"},
+		{"missing expiry", signCommand(t, key, func() platform.Command { c := base; c.ExpiresAt = 0; return c }()), "no expiry"},
+		{"expired", signCommand(t, key, func() platform.Command { c := base; c.ExpiresAt = now.Add(-2 * time.Minute).Unix(); return c }()), "expired"},
+		{"expiry beyond the TTL", signCommand(t, key, func() platform.Command { c := base; c.ExpiresAt = now.Add(2 * time.Hour).Unix(); return c }()), "ahead"},
+		{"tampered command", tamper(func(c *platform.Command) { c.Command = "reboot" }), "does not match"},
+		{"tampered type", tamper(func(c *platform.Command) { c.Type = "system" }), "does not match"},
+		{"tampered parameters", tamper(func(c *platform.Command) { c.Parameters["lines"] = float64(11) }), "does not match"},
+		{"tampered timeout", tamper(func(c *platform.Command) { c.Timeout = time.Hour }), "does not match"},
+		{"tampered session", tamper(func(c *platform.Command) { c.SessionID = "s-2" }), "does not match"},
+		{"tampered expiry", tamper(func(c *platform.Command) { c.ExpiresAt++ }), "does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifier.verify(tt.cmd, now); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+
+	// Clock skew of up to a minute is tolerated either way
+	if err := verifier.verify(signed, time.Unix(base.ExpiresAt, 0).Add(30*time.Second)); err != nil {
+		t.Errorf("command within the clock skew rejected: %v", err)
+	}
+	if err := verifier.verify(signCommand(t, key, func() platform.Command { c := base; c.ExpiresAt = now.Add(time.Hour + 30*time.Second).Unix(); return c }()), now); err != nil {
+		t.Errorf("expiry within the clock skew rejected: %v", err)
+	}
+}
+
+func TestCommandVerifierDisabled(t *testing.T) {
+	verifier, err := newCommandVerifier(config.CommandsConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.verify(platform.Command{ID: "cmd-1", Type: "status"}, time.Now()); err != nil {
+		t.Errorf("unsigned command rejected without pinned keys: %v", err)
+	}
+	if key, err := verifier.sessionKey(platform.Command{Type: "session"}); key != nil || err != nil {
+		t.Errorf("got %v, %v for a session key without pinned keys", key, err)
+	}
+
+	for _, keys := range [][]string{{"not base64!"}, {base64.StdEncoding.EncodeToString([]byte("short"))}} {
+		if _, err := newCommandVerifier(config.CommandsConfig{SigningKeys: keys}); err == nil {
+			t.Errorf("%q: expected an error", keys)
+		}
+	}
+}
+
+func TestSessionMessageVerification(t *testing.T) {
+	commandKey := testSigningKey(0)
+	verifier, err := newCommandVerifier(config.CommandsConfig{
+		SigningKeys:   []string{base64.StdEncoding.EncodeToString(commandKey.Public().(ed25519.PublicKey))},
+		MaxCommandTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionKey := testSigningKey(3)
+	opener := platform.Command{
+		ID:         "cmd-1",
+		Type:       "session",
+		SessionID:  "s-1",
+		Parameters: map[string]interface{}{"session_key": base64.StdEncoding.EncodeToString(sessionKey.Public().(ed25519.PublicKey))},
+	}
+	key, err := verifier.sessionKey(opener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, parameters := range []map[string]interface{}{nil, {"session_key": "!!!"}, {"session_key": "c2hvcnQ="}} {
+		if _, err := verifier.sessionKey(platform.Command{Type: "session", Parameters: parameters}); err == nil {
+			t.Errorf("%v: expected an error", parameters)
+		}
+	}
+
+	sign := func(message platform.SessionMessage, signer ed25519.PrivateKey) platform.SessionMessage {
+		payload, err := message.SigningPayload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		message.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(signer, payload))
+		return message
+	}
+	input := sign(platform.SessionMessage{Type: "session_input", SessionID: "s-1", Sequence: 5, Data: []byte("id\n")}, sessionKey)
+
+	if err := verifySessionMessage(key, input, 4); err != nil {
+		t.Fatalf("valid message rejected: %v", err)
+	}
+
+	tampered := input
+	tampered.Data = []byte("rm -rf /\n")
+	otherSession := input
+	otherSession.SessionID = "s-2"
+	unsigned := input
+	unsigned.Signature = ""
+	tests := []struct {
+		name    string
+		message platform.SessionMessage
+		last    int64
+		err     string
+	}{
+		{"replayed", input, 5, "not after"},
+		{"older", input, 9, "not after"},
+		{"unsigned", unsigned, 0, "not signed"},
+		{"tampered data", tampered, 0, "does not match"},
+		{"other session", otherSession, 0, "does not match"},
+		// The command signing key is not the session key
+		{"wrong key", sign(platform.SessionMessage{Type: "session_close", SessionID: "s-1", Sequence: 6}, commandKey), 0, "does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifySessionMessage(key, tt.message, tt.last); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package collectors
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pressureResources are the resources covered by pressure stall information
+var pressureResources = []string{"cpu", "memory", "io"}
+
+// dockerScopeRegex extracts the container ID from a docker cgroup scope
+var dockerScopeRegex = regexp.MustCompile(`^(?:docker|cri-containerd|crio)-([0-9a-f]{64})\.scope$`)
+
+// pressureLine is one line of a PSI file, e.g.
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0"
+type pressureLine struct {
+	Kind   string // some, full
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64 // microseconds
+}
+
+// readPressureFile parses a PSI file such as /proc/pressure/cpu
+func readPressureFile(path string) ([]pressureLine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []pressureLine
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		line := pressureLine{Kind: fields[0]}
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			switch key {
+			case "avg10":
+				line.Avg10, _ = strconv.ParseFloat(value, 64)
+			case "avg60":
+				line.Avg60, _ = strconv.ParseFloat(value, 64)
+			case "avg300":
+				line.Avg300, _ = strconv.ParseFloat(value, 64)
+			case "total":
+				line.Total, _ = strconv.ParseUint(value, 10, 64)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// readKeyValueFile parses files of "key value" lines such as cpu.stat,
+// memory.stat and memory.events
+func readKeyValueFile(path string) (map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = value
+		}
+	}
+
+	return values, scanner.Err()
+}
+
+// readSingleValueFile parses files holding one number, such as
+// memory.current. The literal "max" is returned as ok=false.
+func readSingleValueFile(path string) (uint64, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false, err
+	}
+
+	text := strings.TrimSpace(string(data))
+	if text == "max" {
+		return 0, false, nil
+	}
+
+	value, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid value in %s: %w", path, err)
+	}
+	return value, true, nil
+}
+
+// readIOStat sums the per-device counters of an io.stat file, e.g.
+// "8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0"
+func readIOStat(path string) (map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	totals := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		// The first field is the device number
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+				totals[key] += n
+			}
+		}
+	}
+
+	return totals, scanner.Err()
+}
+
+// collectPressureMetrics collects host-wide pressure stall information
+func (smc *SystemMetricsCollector) collectPressureMetrics(timestamp time.Time) {
+	root := filepath.Join(smc.config.SystemMetrics.ProcRoot, "pressure")
+
+	collected := 0
+	for _, resource := range pressureResources {
+		lines, err := readPressureFile(filepath.Join(root, resource))
+		if err != nil {
+			smc.logger.Debug("Failed to read pressure stall information", "resource", resource, "error", err)
+			continue
+		}
+		collected++
+		smc.sendPressureMetrics("system.pressure", resource, lines, nil, timestamp)
+	}
+
+	if collected == 0 {
+		smc.lastError = fmt.Sprintf("Pressure metrics unavailable under %s", root)
+	}
+}
+
+// sendPressureMetrics emits the metrics of a parsed PSI file
+func (smc *SystemMetricsCollector) sendPressureMetrics(prefix, resource string, lines []pressureLine, labels map[string]string, timestamp time.Time) {
+	ts := timestamp.Format(time.RFC3339)
+
+	for _, line := range lines {
+		windows := []struct {
+			name  string
+			value float64
+		}{
+			{"avg10", line.Avg10},
+			{"avg60", line.Avg60},
+			{"avg300", line.Avg300},
+		}
+		for _, window := range windows {
+			windowLabels := copyLabels(labels)
+			windowLabels["resource"] = resource
+			windowLabels["kind"] = line.Kind
+			windowLabels["window"] = window.name
+
+			smc.sendMetric(&MetricData{Name: prefix, Type: "gauge", Value: window.value, Labels: windowLabels, Timestamp: ts, Unit: "percent"})
+		}
+
+		totalLabels := copyLabels(labels)
+		totalLabels["resource"] = resource
+		totalLabels["kind"] = line.Kind
+		smc.sendMetric(&MetricData{Name: prefix + ".stall_time", Type: "counter", Value: line.Total, Labels: totalLabels, Timestamp: ts, Unit: "microseconds"})
+	}
+}
+
+// collectCgroupMetrics collects CPU, memory, I/O and pressure metrics for
+// the configured cgroup v2 groups
+func (smc *SystemMetricsCollector) collectCgroupMetrics(timestamp time.Time) {
+	root := smc.config.SystemMetrics.Cgroups.Root
+
+	// Only the unified (v2) hierarchy is supported
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		smc.logger.Debug("cgroup v2 hierarchy not found", "root", root, "error", err)
+		smc.lastError = fmt.Sprintf("cgroup v2 hierarchy not found under %s", root)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, pattern := range smc.config.SystemMetrics.Cgroups.Paths {
+		matches, err := filepath.Glob(filepath.Join(root, pattern))
+		if err != nil {
+			smc.logger.Warn("Invalid cgroup path pattern", "pattern", pattern, "error", err)
+			continue
+		}
+
+		for _, dir := range matches {
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				continue
+			}
+
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				continue
+			}
+			smc.collectCgroup(dir, rel, timestamp)
+		}
+	}
+}
+
+// collectCgroup collects the metrics of a single cgroup directory
+func (smc *SystemMetricsCollector) collectCgroup(dir, rel string, timestamp time.Time) {
+	ts := timestamp.Format(time.RFC3339)
+
+	base := filepath.Base(rel)
+	labels := map[string]string{
+		"cgroup": rel,
+		"unit":   base,
+	}
+	if match := dockerScopeRegex.FindStringSubmatch(base); match != nil {
+		labels["container_id"] = shortContainerID(match[1])
+	}
+
+	// CPU usage and throttling
+	if cpuStat, err := readKeyValueFile(filepath.Join(dir, "cpu.stat")); err == nil {
+		smc.sendMetric(&MetricData{Name: "cgroup.cpu.usage", Type: "counter", Value: cpuStat["usage_usec"], Labels: labels, Timestamp: ts, Unit: "microseconds"})
+		smc.sendMetric(&MetricData{Name: "cgroup.cpu.user", Type: "counter", Value: cpuStat["user_usec"], Labels: labels, Timestamp: ts, Unit: "microseconds"})
+		smc.sendMetric(&MetricData{Name: "cgroup.cpu.system", Type: "counter", Value: cpuStat["system_usec"], Labels: labels, Timestamp: ts, Unit: "microseconds"})
+		if _, ok := cpuStat["nr_periods"]; ok {
+			smc.sendMetric(&MetricData{Name: "cgroup.cpu.periods", Type: "counter", Value: cpuStat["nr_periods"], Labels: labels, Timestamp: ts, Unit: "count"})
+			smc.sendMetric(&MetricData{Name: "cgroup.cpu.throttled_periods", Type: "counter", Value: cpuStat["nr_throttled"], Labels: labels, Timestamp: ts, Unit: "count"})
+			smc.sendMetric(&MetricData{Name: "cgroup.cpu.throttled_time", Type: "counter", Value: cpuStat["throttled_usec"], Labels: labels, Timestamp: ts, Unit: "microseconds"})
+		}
+	}
+
+	// Memory usage, limit and OOM events
+	if current, ok, err := readSingleValueFile(filepath.Join(dir, "memory.current")); err == nil && ok {
+		smc.sendMetric(&MetricData{Name: "cgroup.memory.current", Type: "gauge", Value: current, Labels: labels, Timestamp: ts, Unit: "bytes"})
+	}
+	if limit, ok, err := readSingleValueFile(filepath.Join(dir, "memory.max")); err == nil && ok {
+		smc.sendMetric(&MetricData{Name: "cgroup.memory.max", Type: "gauge", Value: limit, Labels: labels, Timestamp: ts, Unit: "bytes"})
+	}
+	if memStat, err := readKeyValueFile(filepath.Join(dir, "memory.stat")); err == nil {
+		smc.sendMetric(&MetricData{Name: "cgroup.memory.anon", Type: "gauge", Value: memStat["anon"], Labels: labels, Timestamp: ts, Unit: "bytes"})
+		smc.sendMetric(&MetricData{Name: "cgroup.memory.file", Type: "gauge", Value: memStat["file"], Labels: labels, Timestamp: ts, Unit: "bytes"})
+	}
+	if memEvents, err := readKeyValueFile(filepath.Join(dir, "memory.events")); err == nil {
+		smc.sendMetric(&MetricData{Name: "cgroup.memory.oom_events", Type: "counter", Value: memEvents["oom"], Labels: labels, Timestamp: ts, Unit: "count"})
+		smc.sendMetric(&MetricData{Name: "cgroup.memory.oom_kills", Type: "counter", Value: memEvents["oom_kill"], Labels: labels, Timestamp: ts, Unit: "count"})
+		smc.sendMetric(&MetricData{Name: "cgroup.memory.max_events", Type: "counter", Value: memEvents["max"], Labels: labels, Timestamp: ts, Unit: "count"})
+	}
+
+	// Block I/O
+	if ioStat, err := readIOStat(filepath.Join(dir, "io.stat")); err == nil {
+		smc.sendMetric(&MetricData{Name: "cgroup.io.read_bytes", Type: "counter", Value: ioStat["rbytes"], Labels: labels, Timestamp: ts, Unit: "bytes"})
+		smc.sendMetric(&MetricData{Name: "cgroup.io.write_bytes", Type: "counter", Value: ioStat["wbytes"], Labels: labels, Timestamp: ts, Unit: "bytes"})
+		smc.sendMetric(&MetricData{Name: "cgroup.io.read_ops", Type: "counter", Value: ioStat["rios"], Labels: labels, Timestamp: ts, Unit: "count"})
+		smc.sendMetric(&MetricData{Name: "cgroup.io.write_ops", Type: "counter", Value: ioStat["wios"], Labels: labels, Timestamp: ts, Unit: "count"})
+	}
+
+	// Process count
+	if pids, ok, err := readSingleValueFile(filepath.Join(dir, "pids.current")); err == nil && ok {
+		smc.sendMetric(&MetricData{Name: "cgroup.pids.current", Type: "gauge", Value: pids, Labels: labels, Timestamp: ts, Unit: "count"})
+	}
+
+	// Per-cgroup pressure stall information
+	for _, resource := range pressureResources {
+		if lines, err := readPressureFile(filepath.Join(dir, resource+".pressure")); err == nil {
+			smc.sendPressureMetrics("cgroup.pressure", resource, lines, labels, timestamp)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package collectors
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+// cgroupFixtures is a fixture root holding proc/pressure and a cgroup v2
+// hierarchy under sys/fs/cgroup
+const cgroupFixtures = "testdata/cgroups"
+
+// newTestMetricsCollector returns a system metrics collector whose metrics
+// are buffered for drainMetrics
+func newTestMetricsCollector(t *testing.T, cfg config.MetricsCollectorConfig) (*SystemMetricsCollector, chan interface{}) {
+	t.Helper()
+	data := make(chan interface{}, 10000)
+	return &SystemMetricsCollector{
+		name:     "system-metrics-collector",
+		config:   cfg,
+		logger:   newTestLogger(t),
+		dataChan: data,
+		ctx:      context.Background(),
+		healthy:  true,
+	}, data
+}
+
+// drainMetrics returns the buffered metrics keyed by metricKey
+func drainMetrics(data chan interface{}) map[string]interface{} {
+	metrics := make(map[string]interface{})
+	for {
+		select {
+		case item := <-data:
+			metric := item.(CollectedData).Data["metric"].(*MetricData)
+			metrics[metricKey(metric.Name, metric.Labels)] = metric.Value
+		default:
+			return metrics
+		}
+	}
+}
+
+// metricKey identifies a series as name{label=value,...} with sorted labels
+func metricKey(name string, labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func TestReadPressureFile(t *testing.T) {
+	lines, err := readPressureFile(filepath.Join(cgroupFixtures, "proc/pressure/memory"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []pressureLine{
+		{Kind: "some", Avg10: 12, Avg60: 8, Avg300: 4, Total: 987654},
+		{Kind: "full", Avg10: 6, Avg60: 3, Avg300: 1, Total: 456789},
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got %+v, want %+v", lines, want)
+	}
+
+	if _, err := readPressureFile(filepath.Join(cgroupFixtures, "proc/pressure/missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestCgroupFileParsers(t *testing.T) {
+	dir := filepath.Join(cgroupFixtures, "sys/fs/cgroup/system.slice/nginx.service")
+
+	tests := []struct {
+		name  string
+		read  func(string) (map[string]uint64, error)
+		file  string
+		wants map[string]uint64
+	}{
+		{"cpu.stat", readKeyValueFile, "cpu.stat", map[string]uint64{"usage_usec": 5000000, "nr_throttled": 7, "throttled_usec": 350000}},
+		{"memory.events", readKeyValueFile, "memory.events", map[string]uint64{"oom": 1, "oom_kill": 1, "max": 3}},
+		{"memory.stat", readKeyValueFile, "memory.stat", map[string]uint64{"anon": 83886080, "file": 20971520}},
+		// Counters are summed over devices
+		{"io.stat", readIOStat, "io.stat", map[string]uint64{"rbytes": 1500, "wbytes": 2000, "rios": 15, "wios": 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := tt.read(filepath.Join(dir, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, want := range tt.wants {
+				if values[k] != want {
+					t.Errorf("%s = %d, want %d", k, values[k], want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadSingleValueFile(t *testing.T) {
+	root := filepath.Join(cgroupFixtures, "sys/fs/cgroup/system.slice")
+
+	tests := []struct {
+		file    string
+		value   uint64
+		ok      bool
+		wantErr bool
+	}{
+		{"nginx.service/memory.current", 104857600, true, false},
+		{"nginx.service/memory.max", 0, false, false}, // "max" means no limit
+		{"nginx.service/cpu.stat", 0, false, true},    // not a single number
+		{"nginx.service/missing", 0, false, true},
+	}
+	for _, tt := range tests {
+		value, ok, err := readSingleValueFile(filepath.Join(root, tt.file))
+		if (err != nil) != tt.wantErr || value != tt.value || ok != tt.ok {
+			t.Errorf("%s: got (%d, %v, %v), want (%d, %v, error %v)", tt.file, value, ok, err, tt.value, tt.ok, tt.wantErr)
+		}
+	}
+}
+
+func TestCollectPressureMetrics(t *testing.T) {
+	var cfg config.MetricsCollectorConfig
+	cfg.SystemMetrics.ProcRoot = filepath.Join(cgroupFixtures, "proc")
+	smc, data := newTestMetricsCollector(t, cfg)
+
+	smc.collectPressureMetrics(time.Now())
+	metrics := drainMetrics(data)
+
+	tests := map[string]interface{}{
+		"system.pressure{kind=some,resource=cpu,window=avg10}":     1.5,
+		"system.pressure{kind=full,resource=memory,window=avg300}": 1.0,
+		"system.pressure{kind=some,resource=io,window=avg60}":      0.2,
+		"system.pressure.stall_time{kind=some,resource=memory}":    uint64(987654),
+	}
+	for key, want := range tests {
+		if got := metrics[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	// 3 resources x 2 kinds x (3 windows + stall time)
+	if len(metrics) != 24 {
+		t.Errorf("got %d metrics, want 24", len(metrics))
+	}
+	if smc.lastError != "" {
+		t.Errorf("unexpected error: %s", smc.lastError)
+	}
+
+	cfg.SystemMetrics.ProcRoot = filepath.Join(cgroupFixtures, "missing")
+	smc, _ = newTestMetricsCollector(t, cfg)
+	smc.collectPressureMetrics(time.Now())
+	if smc.lastError == "" {
+		t.Error("expected an error without pressure files")
+	}
+}
+
+func TestCollectCgroupMetrics(t *testing.T) {
+	var cfg config.MetricsCollectorConfig
+	cfg.SystemMetrics.Cgroups = config.CgroupMetricsConfig{
+		Enabled: true,
+		Root:    filepath.Join(cgroupFixtures, "sys/fs/cgroup"),
+		// The overlapping patterns must not report a group twice
+		Paths: []string{"system.slice/*.service", "system.slice/docker-*.scope", "system.slice/*"},
+	}
+	smc, data := newTestMetricsCollector(t, cfg)
+
+	smc.collectCgroupMetrics(time.Now())
+	metrics := drainMetrics(data)
+
+	nginx := "cgroup=system.slice/nginx.service,unit=nginx.service"
+	docker := "cgroup=system.slice/docker-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.scope," +
+		"container_id=0123456789ab,unit=docker-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.scope"
+
+	tests := map[string]interface{}{
+		"cgroup.cpu.usage{" + nginx + "}":             uint64(5000000),
+		"cgroup.cpu.throttled_periods{" + nginx + "}": uint64(7),
+		"cgroup.cpu.throttled_time{" + nginx + "}":    uint64(350000),
+		"cgroup.memory.current{" + nginx + "}":        uint64(104857600),
+		"cgroup.memory.oom_kills{" + nginx + "}":      uint64(1),
+		"cgroup.io.read_bytes{" + nginx + "}":         uint64(1500),
+		"cgroup.pids.current{" + nginx + "}":          uint64(12),
+		"cgroup.pressure{cgroup=system.slice/nginx.service,kind=some,resource=cpu,unit=nginx.service,window=avg10}": 2.0,
+		"cgroup.cpu.usage{" + docker + "}":        uint64(42),
+		"cgroup.memory.max{" + docker + "}":       uint64(536870912),
+		"cgroup.memory.oom_kills{" + docker + "}": uint64(2),
+	}
+	for key, want := range tests {
+		if got := metrics[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+
+	absent := []string{
+		// No limit is configured for nginx
+		"cgroup.memory.max{" + nginx + "}",
+		// Throttling counters only exist with a CPU limit
+		"cgroup.cpu.throttled_periods{" + docker + "}",
+	}
+	for _, key := range absent {
+		if _, exists := metrics[key]; exists {
+			t.Errorf("unexpected metric %s", key)
+		}
+	}
+	for key := range metrics {
+		if strings.Contains(key, "user.slice") {
+			t.Errorf("metric for a group outside the configured paths: %s", key)
+		}
+	}
+
+	cfg.SystemMetrics.Cgroups.Root = filepath.Join(cgroupFixtures, "proc")
+	smc, _ = newTestMetricsCollector(t, cfg)
+	smc.collectCgroupMetrics(time.Now())
+	if smc.lastError == "" {
+		t.Error("expected an error without a cgroup v2 hierarchy")
+	}
+}
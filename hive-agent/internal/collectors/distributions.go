@@ -0,0 +1,236 @@
+package collectors
+
+import (
+	"math"
+	"sort"
+)
+
+// Exponential histogram scale limits and bucket budget
+const (
+	maxExponentialScale   = 20
+	minExponentialScale   = -10
+	maxExponentialBuckets = 160
+)
+
+// newSummaryValue builds a summary from sorted observations. Quantiles are
+// given in percent; the minimum and maximum are included as quantiles 0
+// and 1.
+func newSummaryValue(sorted []float64, count uint64, sum float64, percentiles []float64) *SummaryValue {
+	summary := &SummaryValue{Count: count, Sum: sum}
+	if len(sorted) == 0 {
+		return summary
+	}
+
+	summary.Quantiles = append(summary.Quantiles, QuantileValue{Quantile: 0, Value: sorted[0]})
+	for _, p := range percentiles {
+		if p >= 100 {
+			continue
+		}
+		summary.Quantiles = append(summary.Quantiles, QuantileValue{Quantile: p / 100, Value: percentile(sorted, p)})
+	}
+	summary.Quantiles = append(summary.Quantiles, QuantileValue{Quantile: 1, Value: sorted[len(sorted)-1]})
+
+	return summary
+}
+
+// newExponentialHistogram builds an exponential histogram from observations,
+// using the finest scale at which positive and negative values each fit in
+// the bucket budget. Every observation counts weight times. NaN and infinite
+// observations have no bucket and are skipped.
+func newExponentialHistogram(values []float64, weight float64) *ExponentialHistogramValue {
+	histogram := &ExponentialHistogramValue{}
+
+	var finite []float64
+	for _, v := range values {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			finite = append(finite, v)
+		}
+	}
+	if len(finite) == 0 {
+		return histogram
+	}
+
+	minValue, maxValue := finite[0], finite[0]
+	var positive, negative []float64
+	zero := 0
+	sum := 0.0
+	for _, v := range finite {
+		sum += v
+		if v < minValue {
+			minValue = v
+		}
+		if v > maxValue {
+			maxValue = v
+		}
+		switch {
+		case v > 0:
+			positive = append(positive, v)
+		case v < 0:
+			negative = append(negative, -v)
+		default:
+			zero++
+		}
+	}
+
+	scale := int32(minExponentialScale)
+	for s := int32(maxExponentialScale); s >= minExponentialScale; s-- {
+		if exponentialSpan(positive, s) <= maxExponentialBuckets && exponentialSpan(negative, s) <= maxExponentialBuckets {
+			scale = s
+			break
+		}
+	}
+
+	histogram.Scale = scale
+	histogram.Sum = sum * weight
+	histogram.Min = &minValue
+	histogram.Max = &maxValue
+	histogram.ZeroCount = weightedCount(zero, weight)
+	histogram.Positive = exponentialBuckets(positive, scale, weight)
+	histogram.Negative = exponentialBuckets(negative, scale, weight)
+
+	histogram.Count = histogram.ZeroCount
+	for _, c := range histogram.Positive.Counts {
+		histogram.Count += c
+	}
+	for _, c := range histogram.Negative.Counts {
+		histogram.Count += c
+	}
+
+	return histogram
+}
+
+// exponentialIndex returns the bucket index of a positive value at a scale,
+// clamped to the int32 range
+func exponentialIndex(v float64, scale int32) int32 {
+	index := math.Ceil(math.Ldexp(math.Log2(v), int(scale))) - 1
+	switch {
+	case math.IsNaN(index) || index < math.MinInt32:
+		return math.MinInt32
+	case index > math.MaxInt32:
+		return math.MaxInt32
+	}
+	return int32(index)
+}
+
+// exponentialSpan returns the number of buckets needed for positive values
+func exponentialSpan(values []float64, scale int32) int {
+	if len(values) == 0 {
+		return 0
+	}
+	lo, hi := exponentialIndex(values[0], scale), exponentialIndex(values[0], scale)
+	for _, v := range values[1:] {
+		idx := exponentialIndex(v, scale)
+		if idx < lo {
+			lo = idx
+		}
+		if idx > hi {
+			hi = idx
+		}
+	}
+	return int(hi) - int(lo) + 1
+}
+
+// exponentialBuckets counts positive values into consecutive buckets
+func exponentialBuckets(values []float64, scale int32, weight float64) ExponentialHistogramBuckets {
+	if len(values) == 0 {
+		return ExponentialHistogramBuckets{}
+	}
+
+	raw := make(map[int32]int)
+	lo, hi := exponentialIndex(values[0], scale), exponentialIndex(values[0], scale)
+	for _, v := range values {
+		idx := exponentialIndex(v, scale)
+		raw[idx]++
+		if idx < lo {
+			lo = idx
+		}
+		if idx > hi {
+			hi = idx
+		}
+	}
+
+	buckets := ExponentialHistogramBuckets{Offset: lo, Counts: make([]uint64, int(hi)-int(lo)+1)}
+	for idx, n := range raw {
+		buckets.Counts[idx-lo] = weightedCount(n, weight)
+	}
+	return buckets
+}
+
+// weightedCount scales a raw count by a sample-rate weight
+func weightedCount(n int, weight float64) uint64 {
+	return uint64(math.Round(float64(n) * weight))
+}
+
+// ExplicitHistogram converts an exponential histogram to explicit bucket
+// bounds, for outputs that cannot represent exponential buckets
+func (e *ExponentialHistogramValue) ExplicitHistogram() *HistogramValue {
+	// bound returns base^index, computed as 2^(index * 2^-scale) to keep
+	// bounds at powers of two exact
+	bound := func(index float64) float64 {
+		return math.Exp2(math.Ldexp(index, -int(e.Scale)))
+	}
+	histogram := &HistogramValue{Count: e.Count, Sum: e.Sum, Min: e.Min, Max: e.Max}
+
+	// Negative buckets in ascending value order: bucket i holds values in
+	// [-base^(i+1), -base^i). Empty buckets are merged into the next one.
+	for k := len(e.Negative.Counts) - 1; k >= 0; k-- {
+		if e.Negative.Counts[k] == 0 {
+			continue
+		}
+		index := float64(e.Negative.Offset) + float64(k)
+		histogram.Bounds = append(histogram.Bounds, -bound(index))
+		histogram.Counts = append(histogram.Counts, e.Negative.Counts[k])
+	}
+
+	histogram.Bounds = append(histogram.Bounds, 0)
+	histogram.Counts = append(histogram.Counts, e.ZeroCount)
+
+	for k, count := range e.Positive.Counts {
+		if count == 0 {
+			continue
+		}
+		index := float64(e.Positive.Offset) + float64(k)
+		histogram.Bounds = append(histogram.Bounds, bound(index+1))
+		histogram.Counts = append(histogram.Counts, count)
+	}
+
+	// The last bucket is unbounded
+	histogram.Counts = append(histogram.Counts, 0)
+
+	return histogram
+}
+
+// cumulativeBucket is a Prometheus-style bucket with an inclusive upper
+// bound and a cumulative count
+type cumulativeBucket struct {
+	UpperBound float64
+	Count      float64
+}
+
+// histogramFromCumulative converts cumulative buckets to a HistogramValue.
+// The +Inf bucket, when missing, is derived from the total count.
+func histogramFromCumulative(buckets []cumulativeBucket, count uint64, sum float64) *HistogramValue {
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].UpperBound < buckets[j].UpperBound })
+
+	histogram := &HistogramValue{Count: count, Sum: sum, Bounds: []float64{}}
+	previous := 0.0
+	for _, bucket := range buckets {
+		if math.IsInf(bucket.UpperBound, 1) {
+			break
+		}
+		histogram.Bounds = append(histogram.Bounds, bucket.UpperBound)
+		histogram.Counts = append(histogram.Counts, nonNegativeDelta(bucket.Count, previous))
+		previous = bucket.Count
+	}
+	histogram.Counts = append(histogram.Counts, nonNegativeDelta(float64(count), previous))
+
+	return histogram
+}
+
+// nonNegativeDelta returns current-previous, clamped at zero
+func nonNegativeDelta(current, previous float64) uint64 {
+	if current <= previous {
+		return 0
+	}
+	return uint64(math.Round(current - previous))
+}
@@ -0,0 +1,68 @@
+package collectors
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestExponentialIndex(t *testing.T) {
+	tests := []struct {
+		value float64
+		scale int32
+		want  int32
+	}{
+		// Bucket i holds values in (2^i, 2^(i+1)] at scale 0
+		{1, 0, -1},
+		{1.5, 0, 0},
+		{2, 0, 0},
+		{4, 0, 1},
+		{4, 1, 3},
+		{math.Inf(1), 0, math.MaxInt32},
+		{0, 0, math.MinInt32},
+		{math.NaN(), 0, math.MinInt32},
+	}
+	for _, tt := range tests {
+		if got := exponentialIndex(tt.value, tt.scale); got != tt.want {
+			t.Errorf("exponentialIndex(%v, %d) = %d, want %d", tt.value, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestNewExponentialHistogram(t *testing.T) {
+	histogram := newExponentialHistogram([]float64{1, 2, 2, 0, -4}, 2)
+	if histogram.Count != 10 || histogram.ZeroCount != 2 || histogram.Sum != 2 {
+		t.Errorf("count %d, zero count %d, sum %v", histogram.Count, histogram.ZeroCount, histogram.Sum)
+	}
+	if *histogram.Min != -4 || *histogram.Max != 2 {
+		t.Errorf("min %v, max %v", *histogram.Min, *histogram.Max)
+	}
+	// 1 to 2 takes 129 buckets at scale 7 and 257 at scale 8
+	if histogram.Scale != 7 {
+		t.Errorf("scale = %d, want 7", histogram.Scale)
+	}
+}
+
+func TestNewExponentialHistogramNonFinite(t *testing.T) {
+	values := []float64{math.Inf(1), 3, math.NaN(), math.Inf(-1)}
+	histogram := newExponentialHistogram(values, 1)
+	if histogram.Count != 1 || histogram.Sum != 3 || *histogram.Min != 3 || *histogram.Max != 3 {
+		t.Errorf("got %+v, want only the finite observation", histogram)
+	}
+
+	empty := newExponentialHistogram([]float64{math.NaN(), math.Inf(1)}, 1)
+	if !reflect.DeepEqual(empty, &ExponentialHistogramValue{}) {
+		t.Errorf("got %+v for non-finite observations only", empty)
+	}
+}
+
+func TestNewExponentialHistogramExtremeRange(t *testing.T) {
+	// The smallest and largest positive floats must fit in the bucket budget
+	histogram := newExponentialHistogram([]float64{math.SmallestNonzeroFloat64, math.MaxFloat64}, 1)
+	if histogram.Count != 2 {
+		t.Errorf("count = %d, want 2", histogram.Count)
+	}
+	if n := len(histogram.Positive.Counts); n == 0 || n > maxExponentialBuckets {
+		t.Errorf("got %d buckets, want 1 to %d", n, maxExponentialBuckets)
+	}
+}
@@ -0,0 +1,318 @@
+package collectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dockerClient talks to the Docker Engine API over its unix socket
+type dockerClient struct {
+	socket     string
+	httpClient *http.Client
+}
+
+// dockerContainer is a container as returned by the list endpoint
+type dockerContainer struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	State   string            `json:"State"`
+	Created int64             `json:"Created"`
+	Labels  map[string]string `json:"Labels"`
+}
+
+// dockerContainerInfo is the subset of the inspect response we need
+type dockerContainerInfo struct {
+	ID         string `json:"Id"`
+	LogPath    string `json:"LogPath"`
+	HostConfig struct {
+		LogConfig struct {
+			Type string `json:"Type"`
+		} `json:"LogConfig"`
+	} `json:"HostConfig"`
+}
+
+// dockerCPUStats holds CPU counters from the stats endpoint
+type dockerCPUStats struct {
+	CPUUsage struct {
+		TotalUsage uint64 `json:"total_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage    uint64 `json:"system_cpu_usage"`
+	OnlineCPUs     uint32 `json:"online_cpus"`
+	ThrottlingData struct {
+		ThrottledPeriods uint64 `json:"throttled_periods"`
+		ThrottledTime    uint64 `json:"throttled_time"`
+	} `json:"throttling_data"`
+}
+
+// dockerStats is the one-shot stats response for a container
+type dockerStats struct {
+	CPUStats    dockerCPUStats `json:"cpu_stats"`
+	PreCPUStats dockerCPUStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes   uint64 `json:"rx_bytes"`
+		RxPackets uint64 `json:"rx_packets"`
+		RxErrors  uint64 `json:"rx_errors"`
+		TxBytes   uint64 `json:"tx_bytes"`
+		TxPackets uint64 `json:"tx_packets"`
+		TxErrors  uint64 `json:"tx_errors"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+}
+
+// newDockerClient creates a Docker Engine API client for the given socket
+func newDockerClient(socket string) *dockerClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+		MaxIdleConns:    10,
+		IdleConnTimeout: 30 * time.Second,
+	}
+
+	return &dockerClient{
+		socket:     socket,
+		httpClient: &http.Client{Transport: transport},
+	}
+}
+
+// get performs a GET request against the Engine API
+func (dc *dockerClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	endpoint := "http://docker" + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := dc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker API request %s failed: %w", path, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("docker API %s returned status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return resp, nil
+}
+
+// getJSON performs a GET request and decodes the JSON response into v
+func (dc *dockerClient) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	resp, err := dc.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode docker API response for %s: %w", path, err)
+	}
+	return nil
+}
+
+// listContainers returns all running containers
+func (dc *dockerClient) listContainers(ctx context.Context) ([]dockerContainer, error) {
+	var containers []dockerContainer
+	if err := dc.getJSON(ctx, "/containers/json", nil, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// inspectContainer returns low-level information about a container
+func (dc *dockerClient) inspectContainer(ctx context.Context, id string) (*dockerContainerInfo, error) {
+	var info dockerContainerInfo
+	if err := dc.getJSON(ctx, "/containers/"+id+"/json", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// containerStats returns a single stats sample for a container
+func (dc *dockerClient) containerStats(ctx context.Context, id string) (*dockerStats, error) {
+	var stats dockerStats
+	query := url.Values{"stream": []string{"false"}}
+	if err := dc.getJSON(ctx, "/containers/"+id+"/stats", query, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// containerName returns the primary name of a container without the leading slash
+func containerName(container dockerContainer) string {
+	if len(container.Names) == 0 {
+		return shortContainerID(container.ID)
+	}
+	return strings.TrimPrefix(container.Names[0], "/")
+}
+
+// shortContainerID returns the 12 character short form of a container ID
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// containerLabels returns the metric labels identifying a container
+func containerLabels(container dockerContainer) map[string]string {
+	labels := map[string]string{
+		"container_id":   shortContainerID(container.ID),
+		"container_name": containerName(container),
+		"image":          container.Image,
+	}
+
+	// Docker Compose labels
+	if project, ok := container.Labels["com.docker.compose.project"]; ok {
+		labels["compose_project"] = project
+	}
+	if service, ok := container.Labels["com.docker.compose.service"]; ok {
+		labels["compose_service"] = service
+	}
+
+	return labels
+}
+
+// collectDockerMetrics collects CPU, memory, network and block I/O metrics
+// for every running container
+func (smc *SystemMetricsCollector) collectDockerMetrics(timestamp time.Time) {
+	ctx, cancel := context.WithTimeout(smc.ctx, smc.config.Interval)
+	defer cancel()
+
+	containers, err := smc.docker.listContainers(ctx)
+	if err != nil {
+		smc.logger.Error("Failed to list docker containers", "error", err)
+		smc.lastError = fmt.Sprintf("Docker metrics error: %v", err)
+		return
+	}
+
+	smc.sendMetric(&MetricData{
+		Name:      "docker.containers.running",
+		Type:      "gauge",
+		Value:     len(containers),
+		Timestamp: timestamp.Format(time.RFC3339),
+		Unit:      "count",
+	})
+
+	// The stats endpoint blocks for about a second per container, so query
+	// containers concurrently with a small limit
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for _, container := range containers {
+		wg.Add(1)
+		go func(container dockerContainer) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			stats, err := smc.docker.containerStats(ctx, container.ID)
+			if err != nil {
+				smc.logger.Debug("Failed to get container stats", "container", containerName(container), "error", err)
+				return
+			}
+			smc.sendContainerMetrics(container, stats, timestamp)
+		}(container)
+	}
+	wg.Wait()
+}
+
+// sendContainerMetrics emits the metrics of a single container stats sample
+func (smc *SystemMetricsCollector) sendContainerMetrics(container dockerContainer, stats *dockerStats, timestamp time.Time) {
+	ts := timestamp.Format(time.RFC3339)
+	labels := containerLabels(container)
+
+	// CPU usage relative to the host, scaled by the number of CPUs
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	cpuPercent := 0.0
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpus := float64(stats.CPUStats.OnlineCPUs)
+		if cpus == 0 {
+			cpus = 1
+		}
+		cpuPercent = cpuDelta / systemDelta * cpus * 100
+	}
+
+	smc.sendMetric(&MetricData{Name: "docker.container.cpu.usage_percent", Type: "gauge", Value: cpuPercent, Labels: labels, Timestamp: ts, Unit: "percent"})
+	smc.sendMetric(&MetricData{Name: "docker.container.cpu.usage_total", Type: "counter", Value: stats.CPUStats.CPUUsage.TotalUsage, Labels: labels, Timestamp: ts, Unit: "nanoseconds"})
+	smc.sendMetric(&MetricData{Name: "docker.container.cpu.throttled_periods", Type: "counter", Value: stats.CPUStats.ThrottlingData.ThrottledPeriods, Labels: labels, Timestamp: ts, Unit: "count"})
+	smc.sendMetric(&MetricData{Name: "docker.container.cpu.throttled_time", Type: "counter", Value: stats.CPUStats.ThrottlingData.ThrottledTime, Labels: labels, Timestamp: ts, Unit: "nanoseconds"})
+
+	// Memory usage excluding page cache, as reported by `docker stats`
+	memUsage := stats.MemoryStats.Usage
+	if cache, ok := stats.MemoryStats.Stats["inactive_file"]; ok && cache < memUsage {
+		memUsage -= cache
+	} else if cache, ok := stats.MemoryStats.Stats["total_inactive_file"]; ok && cache < memUsage {
+		memUsage -= cache
+	}
+	smc.sendMetric(&MetricData{Name: "docker.container.memory.usage", Type: "gauge", Value: memUsage, Labels: labels, Timestamp: ts, Unit: "bytes"})
+	smc.sendMetric(&MetricData{Name: "docker.container.memory.limit", Type: "gauge", Value: stats.MemoryStats.Limit, Labels: labels, Timestamp: ts, Unit: "bytes"})
+	if stats.MemoryStats.Limit > 0 {
+		smc.sendMetric(&MetricData{
+			Name:      "docker.container.memory.usage_percent",
+			Type:      "gauge",
+			Value:     float64(memUsage) / float64(stats.MemoryStats.Limit) * 100,
+			Labels:    labels,
+			Timestamp: ts,
+			Unit:      "percent",
+		})
+	}
+
+	for iface, network := range stats.Networks {
+		netLabels := copyLabels(labels)
+		netLabels["interface"] = iface
+
+		smc.sendMetric(&MetricData{Name: "docker.container.network.bytes_recv", Type: "counter", Value: network.RxBytes, Labels: netLabels, Timestamp: ts, Unit: "bytes"})
+		smc.sendMetric(&MetricData{Name: "docker.container.network.bytes_sent", Type: "counter", Value: network.TxBytes, Labels: netLabels, Timestamp: ts, Unit: "bytes"})
+		smc.sendMetric(&MetricData{Name: "docker.container.network.packets_recv", Type: "counter", Value: network.RxPackets, Labels: netLabels, Timestamp: ts, Unit: "count"})
+		smc.sendMetric(&MetricData{Name: "docker.container.network.packets_sent", Type: "counter", Value: network.TxPackets, Labels: netLabels, Timestamp: ts, Unit: "count"})
+		smc.sendMetric(&MetricData{Name: "docker.container.network.errors_recv", Type: "counter", Value: network.RxErrors, Labels: netLabels, Timestamp: ts, Unit: "count"})
+		smc.sendMetric(&MetricData{Name: "docker.container.network.errors_sent", Type: "counter", Value: network.TxErrors, Labels: netLabels, Timestamp: ts, Unit: "count"})
+	}
+
+	var readBytes, writeBytes uint64
+	for _, entry := range stats.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			readBytes += entry.Value
+		case "write":
+			writeBytes += entry.Value
+		}
+	}
+	smc.sendMetric(&MetricData{Name: "docker.container.blkio.read_bytes", Type: "counter", Value: readBytes, Labels: labels, Timestamp: ts, Unit: "bytes"})
+	smc.sendMetric(&MetricData{Name: "docker.container.blkio.write_bytes", Type: "counter", Value: writeBytes, Labels: labels, Timestamp: ts, Unit: "bytes"})
+}
+
+// copyLabels returns a copy of a label map
+func copyLabels(labels map[string]string) map[string]string {
+	copied := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
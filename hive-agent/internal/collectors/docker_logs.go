@@ -0,0 +1,556 @@
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/logger"
+)
+
+const (
+	// dockerReadInterval is how often container log files are read
+	dockerReadInterval = time.Second
+	// dockerPositionSaveInterval is how often read positions are persisted
+	dockerPositionSaveInterval = 5 * time.Second
+	// dockerMaxLineSize caps a line reassembled from partial records
+	dockerMaxLineSize = 1024 * 1024
+	// dockerMaxLinesPerRead bounds the lines read from one file per
+	// interval so that a busy container cannot starve the others
+	dockerMaxLinesPerRead = 5000
+)
+
+// DockerLogCollector tails the json-file logs of Docker containers. The
+// Engine API is used to discover containers, find their log files and
+// enrich records with container metadata; the logs themselves are read
+// from disk, so they survive container restarts and agent downtime.
+type DockerLogCollector struct {
+	name          string
+	config        config.DockerLogsConfig
+	logger        *logger.Logger
+	dataChan      chan<- interface{}
+	docker        *dockerClient
+	positionsFile string
+
+	// Container log files by container ID
+	files     map[string]*dockerLogFile
+	skipped   map[string]string // containers with another log driver
+	filesMu   sync.Mutex
+	positions map[string]dockerLogPosition
+	dirty     bool
+	lines     int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	healthy   bool
+	lastError string
+}
+
+// dockerLogPosition is the persisted read position of a container log file
+type dockerLogPosition struct {
+	Offset int64  `json:"offset"`
+	Inode  uint64 `json:"inode"`
+}
+
+// dockerLogFile is the json-file log of a container being tailed
+type dockerLogFile struct {
+	container dockerContainer
+	path      string
+
+	file    *os.File
+	inode   uint64
+	offset  int64
+	partial map[string][]byte // partial records by stream
+	seen    bool              // still running at the last discovery
+}
+
+// NewDockerLogCollector creates a new docker log collector
+func NewDockerLogCollector(cfg config.DockerLogsConfig, dataDir string, log *logger.Logger) (*DockerLogCollector, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("docker log collector is disabled")
+	}
+
+	for _, pattern := range append(append([]string{}, cfg.Include...), cfg.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid container name pattern %s: %w", pattern, err)
+		}
+	}
+
+	return &DockerLogCollector{
+		name:          "docker-log-collector",
+		config:        cfg,
+		logger:        log,
+		docker:        newDockerClient(cfg.Socket),
+		positionsFile: filepath.Join(dataDir, "docker", "positions.json"),
+		files:         make(map[string]*dockerLogFile),
+		skipped:       make(map[string]string),
+		positions:     make(map[string]dockerLogPosition),
+		healthy:       true,
+	}, nil
+}
+
+// Name returns the collector name
+func (dlc *DockerLogCollector) Name() string {
+	return dlc.name
+}
+
+// Start starts the docker log collector
+func (dlc *DockerLogCollector) Start(ctx context.Context, dataChan chan<- interface{}) error {
+	dlc.ctx, dlc.cancel = context.WithCancel(ctx)
+	dlc.dataChan = dataChan
+
+	dlc.logger.Info("Starting docker log collector", "socket", dlc.config.Socket)
+
+	if data, err := os.ReadFile(dlc.positionsFile); err == nil {
+		if err := json.Unmarshal(data, &dlc.positions); err != nil {
+			dlc.logger.Warn("Ignoring invalid positions file", "path", dlc.positionsFile, "error", err)
+			dlc.positions = make(map[string]dockerLogPosition)
+		}
+	}
+
+	// Containers running at startup without a saved position start at
+	// the end of their logs
+	dlc.discover(true)
+
+	dlc.wg.Add(1)
+	go dlc.follow()
+
+	dlc.logger.Info("Docker log collector started")
+	return nil
+}
+
+// Stop stops the docker log collector
+func (dlc *DockerLogCollector) Stop(ctx context.Context) error {
+	dlc.logger.Info("Stopping docker log collector")
+
+	if dlc.cancel != nil {
+		dlc.cancel()
+	}
+
+	// Wait for goroutines to finish
+	done := make(chan struct{})
+	go func() {
+		dlc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		dlc.logger.Info("Docker log collector stopped")
+		return nil
+	case <-ctx.Done():
+		dlc.logger.Warn("Docker log collector stop timeout")
+		return ctx.Err()
+	}
+}
+
+// Health returns the collector health status
+func (dlc *DockerLogCollector) Health() HealthStatus {
+	dlc.filesMu.Lock()
+	tailCount := len(dlc.files)
+	skippedCount := len(dlc.skipped)
+	healthy, lastError := dlc.healthy, dlc.lastError
+	dlc.filesMu.Unlock()
+
+	status := HealthStatus{
+		Healthy:   healthy,
+		Message:   "Docker log collector operational",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Details: map[string]string{
+			"socket":             dlc.config.Socket,
+			"containers_tailed":  fmt.Sprintf("%d", tailCount),
+			"containers_skipped": fmt.Sprintf("%d", skippedCount),
+			"lines":              fmt.Sprintf("%d", atomic.LoadInt64(&dlc.lines)),
+		},
+	}
+
+	if lastError != "" {
+		status.Message = lastError
+		status.Healthy = false
+	}
+
+	return status
+}
+
+// WatchedFiles returns the container log files being tailed and their
+// read offsets
+func (dlc *DockerLogCollector) WatchedFiles() []WatchedFile {
+	dlc.filesMu.Lock()
+	defer dlc.filesMu.Unlock()
+
+	files := make([]WatchedFile, 0, len(dlc.files))
+	for _, file := range dlc.files {
+		files = append(files, WatchedFile{Path: file.path, Offset: file.offset})
+	}
+	return files
+}
+
+// follow reads files every interval and rediscovers containers every
+// refresh interval until the collector stops
+func (dlc *DockerLogCollector) follow() {
+	defer dlc.wg.Done()
+	defer dlc.closeFiles()
+
+	readTicker := time.NewTicker(dockerReadInterval)
+	defer readTicker.Stop()
+	refreshTicker := time.NewTicker(dlc.config.RefreshInterval)
+	defer refreshTicker.Stop()
+
+	lastSave := time.Now()
+	for {
+		select {
+		case <-dlc.ctx.Done():
+			return
+		case <-refreshTicker.C:
+			dlc.discover(false)
+		case <-readTicker.C:
+			dlc.readAll()
+			if time.Since(lastSave) >= dockerPositionSaveInterval {
+				dlc.savePositions()
+				lastSave = time.Now()
+			}
+		}
+	}
+}
+
+// discover opens the log files of new containers and closes those of
+// containers that are gone, after reading what remains in them
+func (dlc *DockerLogCollector) discover(initial bool) {
+	ctx, cancel := context.WithTimeout(dlc.ctx, 30*time.Second)
+	defer cancel()
+
+	containers, err := dlc.docker.listContainers(ctx)
+	if err != nil {
+		dlc.logger.Error("Failed to list docker containers", "error", err)
+		dlc.filesMu.Lock()
+		dlc.lastError = fmt.Sprintf("Docker API error: %v", err)
+		dlc.healthy = false
+		dlc.filesMu.Unlock()
+		return
+	}
+
+	dlc.filesMu.Lock()
+	dlc.lastError = ""
+	dlc.healthy = true
+
+	for _, file := range dlc.files {
+		file.seen = false
+	}
+
+	running := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		running[container.ID] = true
+		if file, exists := dlc.files[container.ID]; exists {
+			file.seen = true
+			continue
+		}
+		if _, skipped := dlc.skipped[container.ID]; skipped || !dlc.shouldCollect(container) {
+			continue
+		}
+
+		info, err := dlc.docker.inspectContainer(ctx, container.ID)
+		if err != nil {
+			dlc.logger.Warn("Failed to inspect container", "container", containerName(container), "error", err)
+			continue
+		}
+		if driver := info.HostConfig.LogConfig.Type; driver != "json-file" || info.LogPath == "" {
+			dlc.logger.Warn("Container logs not collected, only the json-file log driver is supported",
+				"container", containerName(container), "driver", driver)
+			dlc.skipped[container.ID] = driver
+			continue
+		}
+
+		file := &dockerLogFile{
+			container: container,
+			path:      info.LogPath,
+			partial:   make(map[string][]byte),
+		}
+		if err := dlc.open(file, initial); err != nil {
+			dlc.logger.Debug("Failed to open container log", "container", containerName(container), "path", file.path, "error", err)
+			continue
+		}
+		file.seen = true
+		dlc.files[container.ID] = file
+		dlc.logger.Debug("Tailing container log", "container", containerName(container), "path", file.path, "offset", file.offset)
+	}
+
+	if initial {
+		// Forget containers that went away while the agent was not running
+		for id := range dlc.positions {
+			if _, exists := dlc.files[id]; !exists {
+				delete(dlc.positions, id)
+				dlc.dirty = true
+			}
+		}
+	}
+
+	for id := range dlc.skipped {
+		if !running[id] {
+			delete(dlc.skipped, id)
+		}
+	}
+
+	var gone []*dockerLogFile
+	for id, file := range dlc.files {
+		if !file.seen {
+			gone = append(gone, file)
+			delete(dlc.files, id)
+		}
+	}
+	dlc.filesMu.Unlock()
+
+	// What remains is read without holding filesMu, as in readAll
+	for _, file := range gone {
+		dlc.read(file)
+		file.file.Close()
+		dlc.filesMu.Lock()
+		delete(dlc.positions, file.container.ID)
+		dlc.dirty = true
+		dlc.filesMu.Unlock()
+		dlc.logger.Debug("Stopped tailing container log", "container", containerName(file.container))
+	}
+}
+
+// shouldCollect applies the include and exclude name patterns
+func (dlc *DockerLogCollector) shouldCollect(container dockerContainer) bool {
+	name := containerName(container)
+
+	for _, pattern := range dlc.config.Exclude {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return false
+		}
+	}
+
+	if len(dlc.config.Include) == 0 {
+		return true
+	}
+	for _, pattern := range dlc.config.Include {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// open opens a container log file at its saved position. Without one,
+// logs of containers found at startup start at the end and those of
+// containers started later at the beginning.
+func (dlc *DockerLogCollector) open(file *dockerLogFile, initial bool) error {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	file.file = f
+	file.inode = fileInode(info)
+
+	if position, saved := dlc.positions[file.container.ID]; saved && position.Inode == file.inode && position.Offset <= info.Size() {
+		file.offset = position.Offset
+	} else if initial {
+		file.offset = info.Size()
+	}
+	return nil
+}
+
+// readAll reads new lines from every file. Sending lines blocks while the
+// pipeline is full, so the files are read without holding filesMu; only
+// the follow goroutine opens, reads and closes them, and the fields that
+// Health and WatchedFiles see are updated under the lock.
+func (dlc *DockerLogCollector) readAll() {
+	dlc.filesMu.Lock()
+	files := make([]*dockerLogFile, 0, len(dlc.files))
+	for _, file := range dlc.files {
+		files = append(files, file)
+	}
+	dlc.filesMu.Unlock()
+
+	for _, file := range files {
+		if dlc.ctx.Err() != nil {
+			return
+		}
+		dlc.read(file)
+	}
+}
+
+// read reads new complete lines from a file. When Docker rotates the log
+// (renaming it to <id>-json.log.1), the old file is read to the end
+// before the new one is opened.
+func (dlc *DockerLogCollector) read(file *dockerLogFile) {
+	if info, err := os.Stat(file.path); err == nil {
+		if inode := fileInode(info); inode != file.inode {
+			dlc.readLines(file)
+			file.file.Close()
+
+			f, err := os.Open(file.path)
+			if err != nil {
+				return
+			}
+			file.file = f
+			file.inode = inode
+			dlc.setOffset(file, 0)
+		} else if info.Size() < file.offset {
+			// Truncated in place
+			dlc.setOffset(file, 0)
+		}
+	}
+
+	dlc.readLines(file)
+}
+
+// setOffset moves the read offset of a file
+func (dlc *DockerLogCollector) setOffset(file *dockerLogFile, offset int64) {
+	dlc.filesMu.Lock()
+	defer dlc.filesMu.Unlock()
+	file.offset = offset
+}
+
+// readLines reads and handles complete lines from the current offset
+func (dlc *DockerLogCollector) readLines(file *dockerLogFile) {
+	buffer := make([]byte, 32*1024)
+	lines := 0
+	offset := file.offset
+	var pending []byte
+
+	for lines < dockerMaxLinesPerRead {
+		n, err := file.file.ReadAt(buffer, offset+int64(len(pending)))
+		if n == 0 {
+			if err != nil && err != io.EOF {
+				dlc.logger.Warn("Failed to read container log", "path", file.path, "error", err)
+			}
+			break
+		}
+
+		data := append(pending, buffer[:n]...)
+		for lines < dockerMaxLinesPerRead {
+			idx := bytes.IndexByte(data, '\n')
+			if idx < 0 {
+				break
+			}
+			dlc.handleLine(file, string(data[:idx]))
+			offset += int64(idx + 1)
+			data = data[idx+1:]
+			lines++
+		}
+		if len(data) > dockerMaxLineSize {
+			// A runaway line without a newline; drop it
+			offset += int64(len(data))
+			data = nil
+		}
+		pending = append([]byte(nil), data...)
+	}
+
+	// Pending bytes are re-read from the file on the next interval
+	dlc.filesMu.Lock()
+	defer dlc.filesMu.Unlock()
+	file.offset = offset
+	if lines > 0 {
+		dlc.positions[file.container.ID] = dockerLogPosition{Offset: offset, Inode: file.inode}
+		dlc.dirty = true
+	}
+}
+
+// handleLine decodes a json-file record, joins partial records (Docker
+// splits lines longer than 16 KB) and forwards complete lines
+func (dlc *DockerLogCollector) handleLine(file *dockerLogFile, line string) {
+	timestamp, stream, message, partial, ok := parseDockerJSONLine(line)
+	if !ok {
+		dlc.logger.Debug("Skipping malformed container log record", "path", file.path)
+		return
+	}
+
+	if partial || len(file.partial[stream]) > 0 {
+		joined := append(file.partial[stream], message...)
+		if partial && len(joined) < dockerMaxLineSize {
+			file.partial[stream] = joined
+			return
+		}
+		message = string(joined)
+		delete(file.partial, stream)
+	}
+	message = strings.TrimSuffix(message, "\r")
+	if message == "" {
+		return
+	}
+
+	atomic.AddInt64(&dlc.lines, 1)
+
+	// Flattened structure, matching the file log collector
+	data := map[string]interface{}{
+		"message":   message,
+		"timestamp": timestamp.Format(time.RFC3339Nano),
+		"source":    "docker",
+		"level":     "info",
+		"stream":    stream,
+	}
+	for k, v := range containerLabels(file.container) {
+		data[k] = v
+	}
+	for k, v := range dlc.config.Tags {
+		data[k] = v
+	}
+
+	select {
+	case dlc.dataChan <- CollectedData{
+		Type:      DataTypeLog,
+		Source:    "docker:" + containerName(file.container),
+		Data:      data,
+		Tags:      dlc.config.Tags,
+		Timestamp: timestamp.Format(time.RFC3339),
+	}:
+	case <-dlc.ctx.Done():
+	}
+}
+
+// closeFiles saves positions and closes all files
+func (dlc *DockerLogCollector) closeFiles() {
+	dlc.filesMu.Lock()
+	for _, file := range dlc.files {
+		file.file.Close()
+	}
+	dlc.filesMu.Unlock()
+	dlc.savePositions()
+}
+
+// savePositions persists read positions atomically when they changed
+func (dlc *DockerLogCollector) savePositions() {
+	dlc.filesMu.Lock()
+	if !dlc.dirty {
+		dlc.filesMu.Unlock()
+		return
+	}
+	data, err := json.Marshal(dlc.positions)
+	dlc.dirty = false
+	dlc.filesMu.Unlock()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dlc.positionsFile), 0755); err != nil {
+		dlc.logger.Error("Failed to create positions directory", "error", err)
+		return
+	}
+	tmp := dlc.positionsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		dlc.logger.Error("Failed to write positions", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, dlc.positionsFile); err != nil {
+		dlc.logger.Error("Failed to save positions", "error", err)
+	}
+}
@@ -0,0 +1,338 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+// fakeDockerEngine serves the container list and inspect endpoints for a
+// set of containers and their log files
+type fakeDockerEngine struct {
+	mu         sync.Mutex
+	containers map[string]fakeContainer
+}
+
+type fakeContainer struct {
+	name    string
+	logPath string
+	driver  string
+}
+
+func (e *fakeDockerEngine) set(id string, container fakeContainer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.containers[id] = container
+}
+
+func (e *fakeDockerEngine) remove(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.containers, id)
+}
+
+func (e *fakeDockerEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if r.URL.Path == "/containers/json" {
+		list := []map[string]interface{}{}
+		for id, container := range e.containers {
+			list = append(list, map[string]interface{}{
+				"Id":     id,
+				"Names":  []string{"/" + container.name},
+				"Image":  "app:latest",
+				"State":  "running",
+				"Labels": map[string]string{"com.docker.compose.service": container.name},
+			})
+		}
+		writeJSON(w, list)
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/json")
+	container, exists := e.containers[id]
+	if !exists {
+		http.Error(w, "no such container", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"Id":         id,
+		"LogPath":    container.logPath,
+		"HostConfig": map[string]interface{}{"LogConfig": map[string]interface{}{"Type": container.driver}},
+	})
+}
+
+// dockerLogTest runs a docker log collector against a fake engine
+type dockerLogTest struct {
+	t         *testing.T
+	engine    *fakeDockerEngine
+	socket    string
+	dir       string
+	dataDir   string
+	collector *DockerLogCollector
+	data      chan interface{}
+}
+
+func newDockerLogTest(t *testing.T) *dockerLogTest {
+	engine := &fakeDockerEngine{containers: make(map[string]fakeContainer)}
+	return &dockerLogTest{
+		t:       t,
+		engine:  engine,
+		socket:  newUnixTestServer(t, engine),
+		dir:     t.TempDir(),
+		dataDir: t.TempDir(),
+	}
+}
+
+// start starts a new collector; a previous one must have been stopped
+func (dt *dockerLogTest) start() {
+	dt.t.Helper()
+
+	collector, err := NewDockerLogCollector(config.DockerLogsConfig{
+		Enabled:         true,
+		Socket:          dt.socket,
+		Exclude:         []string{"ignored-*"},
+		Tags:            map[string]string{"env": "test"},
+		RefreshInterval: 50 * time.Millisecond,
+	}, dt.dataDir, newTestLogger(dt.t))
+	if err != nil {
+		dt.t.Fatal(err)
+	}
+	dt.collector = collector
+	dt.data = make(chan interface{}, 100)
+	if err := collector.Start(context.Background(), dt.data); err != nil {
+		dt.t.Fatal(err)
+	}
+	dt.t.Cleanup(dt.stop)
+}
+
+func (dt *dockerLogTest) stop() {
+	if dt.collector == nil {
+		return
+	}
+	dt.collector.Stop(context.Background())
+	dt.collector = nil
+}
+
+// logPath returns the path of a container's json-file log
+func (dt *dockerLogTest) logPath(id string) string {
+	return filepath.Join(dt.dir, id, id+"-json.log")
+}
+
+// write appends json-file records to a container log
+func (dt *dockerLogTest) write(id string, records ...string) {
+	dt.t.Helper()
+
+	path := dt.logPath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		dt.t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		dt.t.Fatal(err)
+	}
+	defer f.Close()
+	for _, record := range records {
+		if _, err := f.WriteString(record + "\n"); err != nil {
+			dt.t.Fatal(err)
+		}
+	}
+}
+
+// next waits for the next log record
+func (dt *dockerLogTest) next() map[string]interface{} {
+	dt.t.Helper()
+
+	select {
+	case item := <-dt.data:
+		return item.(CollectedData).Data
+	case <-time.After(5 * time.Second):
+		dt.t.Fatal("timed out waiting for a log record")
+		return nil
+	}
+}
+
+// expectNone checks that no record arrives for a while
+func (dt *dockerLogTest) expectNone() {
+	dt.t.Helper()
+
+	select {
+	case item := <-dt.data:
+		dt.t.Fatalf("unexpected log record: %v", item.(CollectedData).Data)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
+
+// record formats a json-file record
+func record(log, stream string) string {
+	return fmt.Sprintf(`{"log":%q,"stream":%q,"time":"2024-05-01T10:00:00.123456789Z"}`, log, stream)
+}
+
+func TestDockerLogCollectorTailsJSONFile(t *testing.T) {
+	dt := newDockerLogTest(t)
+
+	// Logs written before the agent started are skipped
+	dt.write("c1", record("old line\n", "stdout"))
+	dt.engine.set("c1", fakeContainer{name: "web", logPath: dt.logPath("c1"), driver: "json-file"})
+	dt.start()
+
+	dt.write("c1",
+		record("hello\n", "stdout"),
+		record("oops\r\n", "stderr"),
+		// Docker splits long lines into records without a newline
+		record("first half ", "stdout"),
+		record("second half\n", "stdout"),
+		`not json`,
+	)
+
+	first := dt.next()
+	if first["message"] != "hello" || first["stream"] != "stdout" {
+		t.Errorf("first record = %v", first)
+	}
+	if first["container_name"] != "web" || first["compose_service"] != "web" || first["image"] != "app:latest" || first["env"] != "test" {
+		t.Errorf("record lacks container metadata: %v", first)
+	}
+	if first["timestamp"] != "2024-05-01T10:00:00.123456789Z" {
+		t.Errorf("timestamp = %v", first["timestamp"])
+	}
+
+	second := dt.next()
+	if second["message"] != "oops" || second["stream"] != "stderr" {
+		t.Errorf("second record = %v", second)
+	}
+
+	third := dt.next()
+	if third["message"] != "first half second half" {
+		t.Errorf("partial records joined to %q", third["message"])
+	}
+	dt.expectNone()
+
+	files := dt.collector.WatchedFiles()
+	if len(files) != 1 || files[0].Path != dt.logPath("c1") {
+		t.Errorf("watched files = %+v", files)
+	}
+}
+
+func TestDockerLogCollectorRotation(t *testing.T) {
+	dt := newDockerLogTest(t)
+	dt.engine.set("c1", fakeContainer{name: "web", logPath: dt.logPath("c1"), driver: "json-file"})
+	dt.write("c1")
+	dt.start()
+
+	dt.write("c1", record("before rotation\n", "stdout"))
+	if got := dt.next()["message"]; got != "before rotation" {
+		t.Fatalf("got %q", got)
+	}
+
+	// Lines written just before rotation are still read from the old file
+	dt.write("c1", record("last in old file\n", "stdout"))
+	if err := os.Rename(dt.logPath("c1"), dt.logPath("c1")+".1"); err != nil {
+		t.Fatal(err)
+	}
+	dt.write("c1", record("first in new file\n", "stdout"))
+
+	if got := dt.next()["message"]; got != "last in old file" {
+		t.Errorf("got %q, want the rest of the rotated file", got)
+	}
+	if got := dt.next()["message"]; got != "first in new file" {
+		t.Errorf("got %q, want the start of the new file", got)
+	}
+}
+
+func TestDockerLogCollectorResumesAfterRestart(t *testing.T) {
+	dt := newDockerLogTest(t)
+	dt.engine.set("c1", fakeContainer{name: "web", logPath: dt.logPath("c1"), driver: "json-file"})
+	dt.write("c1")
+	dt.start()
+
+	dt.write("c1", record("one\n", "stdout"))
+	if got := dt.next()["message"]; got != "one" {
+		t.Fatalf("got %q", got)
+	}
+	dt.stop()
+
+	// Written while the agent was down
+	dt.write("c1", record("two\n", "stdout"))
+	dt.start()
+	if got := dt.next()["message"]; got != "two" {
+		t.Errorf("got %q after restart, want the line written while stopped", got)
+	}
+}
+
+func TestDockerLogCollectorNewAndRemovedContainers(t *testing.T) {
+	dt := newDockerLogTest(t)
+	dt.start()
+
+	// A container started after the agent is read from the beginning
+	dt.write("c2", record("started\n", "stdout"))
+	dt.engine.set("c2", fakeContainer{name: "worker", logPath: dt.logPath("c2"), driver: "json-file"})
+	if got := dt.next(); got["message"] != "started" || got["container_name"] != "worker" {
+		t.Errorf("got %v", got)
+	}
+
+	// Other log drivers and excluded names are not collected
+	dt.write("c3", record("journald\n", "stdout"))
+	dt.engine.set("c3", fakeContainer{name: "db", logPath: dt.logPath("c3"), driver: "journald"})
+	dt.write("c4", record("excluded\n", "stdout"))
+	dt.engine.set("c4", fakeContainer{name: "ignored-sidecar", logPath: dt.logPath("c4"), driver: "json-file"})
+	dt.expectNone()
+
+	health := dt.collector.Health()
+	if health.Details["containers_tailed"] != "1" || health.Details["containers_skipped"] != "1" {
+		t.Errorf("health details = %v", health.Details)
+	}
+
+	// Lines written before a container is removed are still delivered
+	dt.write("c2", record("stopping\n", "stdout"))
+	dt.engine.remove("c2")
+	if got := dt.next()["message"]; got != "stopping" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDockerLogCollectorFullPipeline(t *testing.T) {
+	dt := newDockerLogTest(t)
+	dt.engine.set("c1", fakeContainer{name: "web", logPath: dt.logPath("c1"), driver: "json-file"})
+	dt.write("c1")
+	dt.start()
+
+	// More lines than the data channel holds, so that reading blocks
+	records := make([]string, 150)
+	for i := range records {
+		records[i] = record(fmt.Sprintf("line %d\n", i), "stdout")
+	}
+	dt.write("c1", records...)
+	waitFor(t, "the data channel to fill up", func() bool { return len(dt.data) == cap(dt.data) })
+
+	done := make(chan struct{})
+	go func() {
+		dt.collector.Health()
+		dt.collector.WatchedFiles()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Health and WatchedFiles blocked while the pipeline is full")
+	}
+
+	for i := range records {
+		if got := dt.next()["message"]; got != fmt.Sprintf("line %d", i) {
+			t.Fatalf("got %q, want line %d", got, i)
+		}
+	}
+	waitFor(t, "the offset to reach the end", func() bool {
+		info, err := os.Stat(dt.logPath("c1"))
+		files := dt.collector.WatchedFiles()
+		return err == nil && len(files) == 1 && files[0].Offset == info.Size()
+	})
+}
@@ -0,0 +1,157 @@
+package collectors
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/logger"
+)
+
+// newUnixTestServer serves handler on a unix socket, standing in for the
+// Docker Engine API, and returns the socket path
+func newUnixTestServer(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	// Socket paths are limited to about 100 bytes, so avoid t.TempDir
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return socket
+}
+
+// newTestLogger returns a logger that only reports errors
+func newTestLogger(t *testing.T) *logger.Logger {
+	t.Helper()
+	log, err := logger.New(config.LoggingConfig{Level: "error", Format: "text", Output: "stdout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestDockerClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []map[string]interface{}{{
+			"Id":      "0123456789abcdef0123",
+			"Names":   []string{"/web"},
+			"Image":   "nginx:1.25",
+			"State":   "running",
+			"Created": 1700000000,
+			"Labels": map[string]string{
+				"com.docker.compose.project": "shop",
+				"com.docker.compose.service": "frontend",
+			},
+		}})
+	})
+	mux.HandleFunc("/containers/0123456789abcdef0123/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"Id":         "0123456789abcdef0123",
+			"LogPath":    "/var/lib/docker/containers/0123/0123-json.log",
+			"HostConfig": map[string]interface{}{"LogConfig": map[string]interface{}{"Type": "json-file"}},
+		})
+	})
+	mux.HandleFunc("/containers/0123456789abcdef0123/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("stream") != "false" {
+			t.Errorf("stats requested without stream=false: %s", r.URL.RawQuery)
+		}
+		writeJSON(w, map[string]interface{}{
+			"memory_stats": map[string]interface{}{"usage": 2048, "limit": 4096},
+			"networks": map[string]interface{}{
+				"eth0": map[string]interface{}{"rx_bytes": 10, "tx_bytes": 20},
+			},
+		})
+	})
+	mux.HandleFunc("/containers/missing/json", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"No such container: missing"}`, http.StatusNotFound)
+	})
+
+	client := newDockerClient(newUnixTestServer(t, mux))
+	ctx := context.Background()
+
+	containers, err := client.listContainers(ctx)
+	if err != nil {
+		t.Fatalf("listContainers: %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("got %d containers, want 1", len(containers))
+	}
+	labels := containerLabels(containers[0])
+	want := map[string]string{
+		"container_id":    "0123456789ab",
+		"container_name":  "web",
+		"image":           "nginx:1.25",
+		"compose_project": "shop",
+		"compose_service": "frontend",
+	}
+	for k, v := range want {
+		if labels[k] != v {
+			t.Errorf("label %s = %q, want %q", k, labels[k], v)
+		}
+	}
+
+	info, err := client.inspectContainer(ctx, containers[0].ID)
+	if err != nil {
+		t.Fatalf("inspectContainer: %v", err)
+	}
+	if info.LogPath != "/var/lib/docker/containers/0123/0123-json.log" || info.HostConfig.LogConfig.Type != "json-file" {
+		t.Errorf("unexpected inspect result: %+v", info)
+	}
+
+	stats, err := client.containerStats(ctx, containers[0].ID)
+	if err != nil {
+		t.Fatalf("containerStats: %v", err)
+	}
+	if stats.MemoryStats.Usage != 2048 || stats.Networks["eth0"].TxBytes != 20 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	_, err = client.inspectContainer(ctx, "missing")
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "No such container") {
+		t.Errorf("inspect of missing container returned %v", err)
+	}
+}
+
+func TestContainerName(t *testing.T) {
+	tests := []struct {
+		container dockerContainer
+		want      string
+	}{
+		{dockerContainer{ID: "0123456789abcdef", Names: []string{"/web"}}, "web"},
+		{dockerContainer{ID: "0123456789abcdef"}, "0123456789ab"},
+		{dockerContainer{ID: "abc"}, "abc"},
+	}
+	for _, tt := range tests {
+		if got := containerName(tt.container); got != tt.want {
+			t.Errorf("containerName(%+v) = %q, want %q", tt.container, got, tt.want)
+		}
+	}
+}
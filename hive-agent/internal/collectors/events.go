@@ -3,6 +3,8 @@ package collectors
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,27 +18,72 @@ type SystemEventsCollector struct {
 	config   config.EventsCollectorConfig
 	logger   *logger.Logger
 	dataChan chan<- interface{}
+
+	fileRules []*fileWatchRule
+	integrity *integrityMonitor
+
+	processEvents *processEvents
+	commandChecks []*commandCheck
+	webhooks      []*webhookEndpoint
 	
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 	
-	healthy   bool
-	lastError string
+	healthy  bool
+	errors   map[string]string // last error of each watcher
+	errorsMu sync.Mutex
 }
 
 // NewSystemEventsCollector creates a new system events collector
-func NewSystemEventsCollector(cfg config.EventsCollectorConfig, log *logger.Logger) (*SystemEventsCollector, error) {
+func NewSystemEventsCollector(cfg config.EventsCollectorConfig, dataDir string, log *logger.Logger) (*SystemEventsCollector, error) {
 	if !cfg.Enabled {
 		return nil, fmt.Errorf("events collector is disabled")
 	}
 
-	return &SystemEventsCollector{
+	collector := &SystemEventsCollector{
 		name:    "system-events-collector",
 		config:  cfg,
 		logger:  log,
 		healthy: true,
-	}, nil
+		errors:  make(map[string]string),
+	}
+
+	rules, err := collector.fileWatchRules()
+	if err != nil {
+		return nil, err
+	}
+	collector.fileRules = rules
+
+	checks, err := collector.buildCommandChecks()
+	if err != nil {
+		return nil, err
+	}
+	collector.commandChecks = checks
+
+	webhooks, err := collector.buildWebhookEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	collector.webhooks = webhooks
+
+	if cfg.SystemEvents.Process {
+		events, err := newProcessEvents(cfg.SystemEvents)
+		if err != nil {
+			return nil, err
+		}
+		collector.processEvents = events
+	}
+
+	if cfg.Integrity.Enabled {
+		monitor, err := newIntegrityMonitor(cfg.Integrity, dataDir)
+		if err != nil {
+			return nil, err
+		}
+		collector.integrity = monitor
+	}
+
+	return collector, nil
 }
 
 // Name returns the collector name
@@ -51,8 +98,44 @@ func (sec *SystemEventsCollector) Start(ctx context.Context, dataChan chan<- int
 	
 	sec.logger.Info("Starting system events collector")
 
-	// This would start various event collectors
-	sec.logger.Info("System events collector started (stub implementation)")
+	if sec.config.SystemEvents.Services {
+		sec.wg.Add(1)
+		go sec.watchServices()
+	}
+
+	if len(sec.fileRules) > 0 {
+		sec.wg.Add(1)
+		go sec.watchFiles()
+	}
+
+	if sec.processEvents != nil {
+		sec.wg.Add(1)
+		go sec.watchProcesses()
+	}
+
+	if sec.config.SystemEvents.Network {
+		sec.wg.Add(1)
+		go sec.watchNetwork()
+	}
+
+	for _, check := range sec.commandChecks {
+		sec.wg.Add(1)
+		go sec.runCommandCheck(check)
+	}
+
+	if sec.integrity != nil {
+		sec.wg.Add(1)
+		go sec.watchIntegrity()
+	}
+
+	if len(sec.webhooks) > 0 {
+		if err := sec.startWebhooks(); err != nil {
+			sec.cancel()
+			return err
+		}
+	}
+
+	sec.logger.Info("System events collector started")
 	return nil
 }
 
@@ -64,15 +147,91 @@ func (sec *SystemEventsCollector) Stop(ctx context.Context) error {
 		sec.cancel()
 	}
 
-	sec.logger.Info("System events collector stopped")
-	return nil
+	// Wait for goroutines to finish
+	done := make(chan struct{})
+	go func() {
+		sec.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		sec.logger.Info("System events collector stopped")
+		return nil
+	case <-ctx.Done():
+		sec.logger.Warn("System events collector stop timeout")
+		return ctx.Err()
+	}
 }
 
 // Health returns the collector health status
 func (sec *SystemEventsCollector) Health() HealthStatus {
-	return HealthStatus{
+	status := HealthStatus{
 		Healthy:   sec.healthy,
 		Message:   "System events collector operational",
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
-}
\ No newline at end of file
+
+	sec.errorsMu.Lock()
+	watchers := make([]string, 0, len(sec.errors))
+	for watcher := range sec.errors {
+		watchers = append(watchers, watcher)
+	}
+	sort.Strings(watchers)
+	messages := make([]string, 0, len(watchers))
+	for _, watcher := range watchers {
+		messages = append(messages, sec.errors[watcher])
+	}
+	sec.errorsMu.Unlock()
+
+	if len(messages) > 0 {
+		status.Message = strings.Join(messages, "; ")
+		status.Healthy = false
+	}
+
+	return status
+}
+
+// setError records the error of one watcher, or clears it when message
+// is empty. Watchers run concurrently, so each keeps its own error and
+// one recovering does not hide another's failure.
+func (sec *SystemEventsCollector) setError(watcher, message string) {
+	sec.errorsMu.Lock()
+	defer sec.errorsMu.Unlock()
+
+	if message == "" {
+		delete(sec.errors, watcher)
+	} else {
+		sec.errors[watcher] = message
+	}
+}
+
+// sendEvent sends an event to the data channel
+func (sec *SystemEventsCollector) sendEvent(source string, event *EventData) {
+	select {
+	case sec.dataChan <- CollectedData{
+		Type:      DataTypeEvent,
+		Source:    source,
+		Data:      map[string]interface{}{"event": event},
+		Tags:      event.Tags,
+		Timestamp: event.Timestamp,
+	}:
+	case <-sec.ctx.Done():
+		return
+	}
+}
+
+// sendIssue sends an issue to the data channel
+func (sec *SystemEventsCollector) sendIssue(source string, issue *IssueData, tags map[string]string) {
+	select {
+	case sec.dataChan <- CollectedData{
+		Type:      DataTypeEvent,
+		Source:    source,
+		Data:      map[string]interface{}{"issue": issue},
+		Tags:      tags,
+		Timestamp: issue.Timestamp,
+	}:
+	case <-sec.ctx.Done():
+		return
+	}
+}
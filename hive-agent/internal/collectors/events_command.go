@@ -0,0 +1,305 @@
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// commandCheckMaxCapture bounds the output of a check kept while it runs;
+// the pattern is matched against all of it, and events carry at most
+// max_output bytes
+const commandCheckMaxCapture = 1024 * 1024
+
+// commandCheckOptions are the options of a command custom event
+type commandCheckOptions struct {
+	Interval      time.Duration     `yaml:"interval"`
+	Timeout       time.Duration     `yaml:"timeout"`
+	OKCodes       []int             `yaml:"ok_codes"`       // exit codes treated as healthy, default 0
+	Severity      map[string]string `yaml:"severity"`       // exit code -> severity
+	Invert        bool              `yaml:"invert"`         // alert when the pattern does not match
+	MatchSeverity string            `yaml:"match_severity"` // severity of a pattern alert
+	MaxOutput     int               `yaml:"max_output"`     // bytes of output kept in events
+}
+
+// commandCheck is a scheduled command whose result raises events
+type commandCheck struct {
+	name    string
+	command string
+	pattern *regexp.Regexp
+	options commandCheckOptions
+	ok      map[int]bool
+}
+
+// commandResult is the outcome of one command check run
+type commandResult struct {
+	exitCode int
+	output   string
+	duration time.Duration
+	err      error
+	matched  bool
+	state    string // ok or a severity
+}
+
+// buildCommandChecks builds checks from the command custom events
+func (sec *SystemEventsCollector) buildCommandChecks() ([]*commandCheck, error) {
+	var checks []*commandCheck
+
+	for _, custom := range sec.config.CustomEvents {
+		if custom.Type != "command" {
+			continue
+		}
+		if custom.Source == "" {
+			return nil, fmt.Errorf("custom event %s: command source is required", custom.Name)
+		}
+
+		options := commandCheckOptions{
+			Interval:      time.Minute,
+			MatchSeverity: "warning",
+			MaxOutput:     4096,
+		}
+		if err := custom.DecodeOptions(&options); err != nil {
+			return nil, err
+		}
+		if options.Interval <= 0 {
+			return nil, fmt.Errorf("custom event %s: interval must be positive", custom.Name)
+		}
+		if options.Timeout <= 0 || options.Timeout > options.Interval {
+			options.Timeout = options.Interval
+			if options.Timeout > 30*time.Second {
+				options.Timeout = 30 * time.Second
+			}
+		}
+		if len(options.OKCodes) == 0 {
+			options.OKCodes = []int{0}
+		}
+
+		check := &commandCheck{
+			name:    custom.Name,
+			command: custom.Source,
+			options: options,
+			ok:      make(map[int]bool),
+		}
+		for _, code := range options.OKCodes {
+			check.ok[code] = true
+		}
+		if custom.Pattern != "" {
+			pattern, err := regexp.Compile(custom.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("custom event %s: invalid pattern: %w", custom.Name, err)
+			}
+			check.pattern = pattern
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
+
+// severityFor maps an exit code to a severity. The defaults follow the
+// Nagios plugin convention: 1 is a warning, 2 critical, anything else an
+// error.
+func (c *commandCheck) severityFor(exitCode int) string {
+	if severity, exists := c.options.Severity[strconv.Itoa(exitCode)]; exists {
+		return severity
+	}
+	switch exitCode {
+	case 1:
+		return "warning"
+	case 2:
+		return "critical"
+	default:
+		return "error"
+	}
+}
+
+// run executes the command once. A pattern, when set, decides the state
+// from the output; otherwise the exit code does.
+func (c *commandCheck) run(ctx context.Context) *commandResult {
+	ctx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+
+	output := &limitedBuffer{limit: commandCheckMaxCapture}
+	cmd := exec.Command("sh", "-c", c.command)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// A process group lets a timeout kill the whole pipeline
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	result := &commandResult{}
+	start := time.Now()
+
+	if err := cmd.Start(); err != nil {
+		result.err = err
+		result.exitCode = -1
+		result.state = "error"
+		return result
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+
+	result.duration = time.Since(start)
+	fullOutput := strings.TrimSpace(output.buf.String())
+	result.output = truncateUTF8(fullOutput, c.options.MaxOutput)
+
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.exitCode = exitErr.ExitCode()
+		} else {
+			result.exitCode = -1
+			result.err = err
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		result.err = fmt.Errorf("timed out after %s", c.options.Timeout)
+	}
+
+	switch {
+	case result.err != nil:
+		result.state = "error"
+	case c.pattern != nil:
+		result.matched = c.pattern.MatchString(fullOutput)
+		result.state = "ok"
+		if result.matched != c.options.Invert {
+			result.state = c.options.MatchSeverity
+		}
+	case c.ok[result.exitCode]:
+		result.state = "ok"
+	default:
+		result.state = c.severityFor(result.exitCode)
+	}
+
+	return result
+}
+
+// limitedBuffer is a writer that keeps the first limit bytes written to
+// it and discards the rest, so that a chatty command cannot exhaust memory
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+// Write implements io.Writer
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// truncateUTF8 cuts s to at most max bytes without splitting a character
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// runCommandCheck runs a check on its schedule and emits an event only
+// when its state changes
+func (sec *SystemEventsCollector) runCommandCheck(check *commandCheck) {
+	defer sec.wg.Done()
+
+	ticker := time.NewTicker(check.options.Interval)
+	defer ticker.Stop()
+
+	// A check that starts out healthy raises nothing
+	previous := "ok"
+
+	for {
+		result := check.run(sec.ctx)
+		if sec.ctx.Err() != nil {
+			return
+		}
+
+		if result.err != nil {
+			sec.logger.Warn("Command check failed to run", "check", check.name, "error", result.err)
+		}
+		if result.state != previous {
+			sec.sendCommandEvent(check, result, previous)
+			previous = result.state
+		}
+
+		select {
+		case <-sec.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendCommandEvent sends a command check state change event
+func (sec *SystemEventsCollector) sendCommandEvent(check *commandCheck, result *commandResult, previous string) {
+	data := map[string]interface{}{
+		"check":          check.name,
+		"command":        check.command,
+		"exit_code":      result.exitCode,
+		"output":         result.output,
+		"state":          result.state,
+		"previous_state": previous,
+		"duration_ms":    result.duration.Milliseconds(),
+	}
+	if check.pattern != nil {
+		data["pattern"] = check.pattern.String()
+		data["matched"] = result.matched
+	}
+	if result.err != nil {
+		data["error"] = result.err.Error()
+	}
+
+	eventType := "command_check_failed"
+	severity := result.state
+	title := fmt.Sprintf("Check %s is %s", check.name, result.state)
+	if result.state == "ok" {
+		eventType = "command_check_recovered"
+		severity = "info"
+		title = fmt.Sprintf("Check %s recovered", check.name)
+	}
+	if firstLine, _, _ := strings.Cut(result.output, "\n"); firstLine != "" {
+		title += ": " + firstLine
+	}
+
+	event := &EventData{
+		ID:        fmt.Sprintf("command-%s-%d", check.name, time.Now().UnixNano()),
+		Type:      eventType,
+		Category:  "command",
+		Severity:  severity,
+		Title:     title,
+		Data:      data,
+		Tags:      map[string]string{"check": check.name},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+
+	sec.logger.Info("Command check state changed",
+		"check", check.name,
+		"from", previous,
+		"to", result.state,
+		"exit_code", result.exitCode,
+	)
+
+	sec.sendEvent("command", event)
+}
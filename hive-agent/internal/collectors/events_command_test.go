@@ -0,0 +1,217 @@
+package collectors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+// startTestEvents starts an events collector and returns its data channel;
+// the collector is stopped when the test ends
+func startTestEvents(t *testing.T, cfg config.EventsCollectorConfig) (*SystemEventsCollector, chan interface{}) {
+	t.Helper()
+
+	cfg.Enabled = true
+	collector, err := NewSystemEventsCollector(cfg, t.TempDir(), newTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(chan interface{}, 100)
+	if err := collector.Start(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { collector.Stop(context.Background()) })
+	return collector, data
+}
+
+// nextEvent returns the next event sent by a collector
+func nextEvent(t *testing.T, data chan interface{}) *EventData {
+	t.Helper()
+
+	select {
+	case item := <-data:
+		event, ok := item.(CollectedData).Data["event"].(*EventData)
+		if !ok {
+			t.Fatalf("got %v, want an event", item)
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+// noEvent fails the test if a collector sends anything within wait
+func noEvent(t *testing.T, data chan interface{}, wait time.Duration) {
+	t.Helper()
+
+	select {
+	case item := <-data:
+		t.Fatalf("unexpected %v", item)
+	case <-time.After(wait):
+	}
+}
+
+// testCommandCheck builds the check of a command custom event
+func testCommandCheck(t *testing.T, custom config.CustomEventConfig) *commandCheck {
+	t.Helper()
+
+	custom.Type = "command"
+	collector := &SystemEventsCollector{config: config.EventsCollectorConfig{CustomEvents: []config.CustomEventConfig{custom}}}
+	checks, err := collector.buildCommandChecks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checks[0]
+}
+
+func TestCommandCheckRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		custom  config.CustomEventConfig
+		state   string
+		code    int
+		output  string
+		matched bool
+	}{
+		{"ok", config.CustomEventConfig{Source: "echo fine"}, "ok", 0, "fine", false},
+		{"warning", config.CustomEventConfig{Source: "echo degraded; exit 1"}, "warning", 1, "degraded", false},
+		{"critical", config.CustomEventConfig{Source: "exit 2"}, "critical", 2, "", false},
+		{"unknown", config.CustomEventConfig{Source: "exit 3"}, "error", 3, "", false},
+		{"mapped severity", config.CustomEventConfig{Source: "exit 1", Config: map[string]interface{}{"severity": map[string]interface{}{"1": "error"}}}, "error", 1, "", false},
+		{"ok codes", config.CustomEventConfig{Source: "exit 3", Config: map[string]interface{}{"ok_codes": []interface{}{0, 3}}}, "ok", 3, "", false},
+		{"stderr", config.CustomEventConfig{Source: "echo broken >&2; exit 2"}, "critical", 2, "broken", false},
+		{"pattern", config.CustomEventConfig{Source: "echo '[UU_U]'", Pattern: `\[U*_+U*\]`}, "warning", 0, "[UU_U]", true},
+		{"pattern decides over the exit code", config.CustomEventConfig{Source: "echo '[UUUU]'; exit 2", Pattern: `_`}, "ok", 2, "[UUUU]", false},
+		{"inverted pattern", config.CustomEventConfig{Source: "echo down", Pattern: "up", Config: map[string]interface{}{"invert": true, "match_severity": "critical"}}, "critical", 0, "down", false},
+		// The pattern sees the whole output, not what fits in the event
+		{"match beyond max output", config.CustomEventConfig{Source: "printf '%0100d'; echo FAILED", Pattern: "FAILED", Config: map[string]interface{}{"max_output": 10}}, "warning", 0, "0000000000", true},
+		// Output is cut at a character boundary
+		{"multibyte output", config.CustomEventConfig{Source: "echo ééé", Config: map[string]interface{}{"max_output": 3}}, "ok", 0, "é", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.custom.Name = "check"
+			result := testCommandCheck(t, tt.custom).run(context.Background())
+			if result.err != nil {
+				t.Fatal(result.err)
+			}
+			if result.state != tt.state || result.exitCode != tt.code || result.output != tt.output || result.matched != tt.matched {
+				t.Errorf("got state %s, code %d, output %q, matched %v", result.state, result.exitCode, result.output, result.matched)
+			}
+		})
+	}
+
+	check := testCommandCheck(t, config.CustomEventConfig{Name: "slow", Source: "sleep 10 | cat", Config: map[string]interface{}{"timeout": "100ms"}})
+	start := time.Now()
+	result := check.run(context.Background())
+	if result.err == nil || !strings.Contains(result.err.Error(), "timed out") || result.state != "error" {
+		t.Errorf("got %+v for a command that timed out", result)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timeout took %s", elapsed)
+	}
+}
+
+func TestCommandCheckOutputLimits(t *testing.T) {
+	buffer := &limitedBuffer{limit: 5}
+	for _, chunk := range []string{"abc", "defg", "hij"} {
+		if n, err := buffer.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	if got := buffer.buf.String(); got != "abcde" {
+		t.Errorf("buffered %q", got)
+	}
+
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"héllo", 2, "h"},
+		{"héllo", 3, "hé"},
+		{"€uro", 2, ""},
+		{"日本", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateUTF8(tt.s, tt.max); got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestCommandCheckEvents(t *testing.T) {
+	// The check exits with the code in a file, so the test can change it.
+	// The file is replaced rather than rewritten, so that the check never
+	// reads it empty.
+	codeFile := filepath.Join(t.TempDir(), "code")
+	setCode := func(code string) {
+		if err := os.WriteFile(codeFile+".tmp", []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(codeFile+".tmp", codeFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setCode("0")
+
+	_, data := startTestEvents(t, config.EventsCollectorConfig{CustomEvents: []config.CustomEventConfig{{
+		Name:   "disk",
+		Type:   "command",
+		Source: "code=$(cat " + codeFile + "); echo code $code; echo details; exit $code",
+		Config: map[string]interface{}{"interval": "50ms"},
+	}}})
+
+	// A check that starts out healthy raises nothing
+	noEvent(t, data, 300*time.Millisecond)
+
+	setCode("2")
+	event := nextEvent(t, data)
+	if event.Type != "command_check_failed" || event.Severity != "critical" || event.Title != "Check disk is critical: code 2" ||
+		event.Data["previous_state"] != "ok" || event.Data["output"] != "code 2\ndetails" || event.Tags["check"] != "disk" {
+		t.Errorf("failure event = %+v", event)
+	}
+	// Events are raised on changes only
+	noEvent(t, data, 300*time.Millisecond)
+
+	setCode("1")
+	if event := nextEvent(t, data); event.Severity != "warning" || event.Data["previous_state"] != "critical" {
+		t.Errorf("escalation event = %+v", event)
+	}
+
+	setCode("0")
+	if event := nextEvent(t, data); event.Type != "command_check_recovered" || event.Severity != "info" || event.Data["previous_state"] != "warning" {
+		t.Errorf("recovery event = %+v", event)
+	}
+	noEvent(t, data, 300*time.Millisecond)
+}
+
+func TestBuildCommandChecks(t *testing.T) {
+	check := testCommandCheck(t, config.CustomEventConfig{Name: "long", Source: "true", Config: map[string]interface{}{"interval": "10m"}})
+	if check.options.Timeout != 30*time.Second || !check.ok[0] || check.options.MaxOutput != 4096 {
+		t.Errorf("unexpected defaults: %+v", check.options)
+	}
+	check = testCommandCheck(t, config.CustomEventConfig{Name: "short", Source: "true", Config: map[string]interface{}{"interval": "5s", "timeout": "1m"}})
+	if check.options.Timeout != 5*time.Second {
+		t.Errorf("timeout = %s, want the interval", check.options.Timeout)
+	}
+
+	for _, custom := range []config.CustomEventConfig{
+		{Name: "no source", Type: "command"},
+		{Name: "bad pattern", Type: "command", Source: "true", Pattern: "("},
+		{Name: "no interval", Type: "command", Source: "true", Config: map[string]interface{}{"interval": "0s"}},
+	} {
+		collector := &SystemEventsCollector{config: config.EventsCollectorConfig{CustomEvents: []config.CustomEventConfig{custom}}}
+		if _, err := collector.buildCommandChecks(); err == nil {
+			t.Errorf("%s: expected an error", custom.Name)
+		}
+	}
+}
@@ -0,0 +1,666 @@
+package collectors
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Defaults for file watch rules
+const (
+	defaultFileWatchDebounce = 500 * time.Millisecond
+	defaultFileWatchMaxSize  = 1024 * 1024
+	maxFileDiffLines         = 200
+)
+
+// fileWatchOptions are the file_watch specific custom event options
+type fileWatchOptions struct {
+	Recursive bool          `yaml:"recursive"`
+	Events    []string      `yaml:"events"`   // create, modify, delete, chmod, rename
+	Debounce  time.Duration `yaml:"debounce"` // quiet period before an event is emitted
+	Hash      bool          `yaml:"hash"`     // track SHA-256 content hashes
+	Diff      bool          `yaml:"diff"`     // include a line diff, implies hash
+	MaxSize   int64         `yaml:"max_size"` // largest file hashed or diffed
+	Severity  string        `yaml:"severity"`
+}
+
+// fileWatchRule is a watched file or directory
+type fileWatchRule struct {
+	name      string
+	path      string
+	isDir     bool
+	pattern   string // glob matched against file names
+	recursive bool
+	ops       fsnotify.Op
+	debounce  time.Duration
+	hash      bool
+	diff      bool
+	maxSize   int64
+	severity  string
+}
+
+// fileSnapshot is the last known content of a hashed file
+type fileSnapshot struct {
+	hash  string
+	lines []string
+}
+
+// pendingFileChange accumulates raw events for a path until it is quiet
+type pendingFileChange struct {
+	rule     *fileWatchRule
+	path     string
+	ops      fsnotify.Op
+	first    time.Time
+	last     time.Time
+	existed  bool
+	previous *fileSnapshot
+	writers  []map[string]interface{}
+
+	// Writers are looked up once, in the background; a change is not
+	// emitted while its lookup runs
+	writersQueued  bool
+	writersPending bool
+}
+
+// fileOpNames maps configuration names to fsnotify operations
+var fileOpNames = map[string]fsnotify.Op{
+	"create": fsnotify.Create,
+	"modify": fsnotify.Write,
+	"delete": fsnotify.Remove,
+	"rename": fsnotify.Rename,
+	"chmod":  fsnotify.Chmod,
+}
+
+// fileWatchRules builds the watch rules from the system and custom event
+// configuration
+func (sec *SystemEventsCollector) fileWatchRules() ([]*fileWatchRule, error) {
+	var rules []*fileWatchRule
+
+	if sec.config.SystemEvents.FileSystem {
+		for _, path := range sec.config.SystemEvents.FileSystemPaths {
+			rule, err := newFileWatchRule("filesystem", path, "", fileWatchOptions{})
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	for _, custom := range sec.config.CustomEvents {
+		if custom.Type != "file_watch" {
+			continue
+		}
+
+		var options fileWatchOptions
+		if err := custom.DecodeOptions(&options); err != nil {
+			return nil, err
+		}
+		rule, err := newFileWatchRule(custom.Name, custom.Source, custom.Pattern, options)
+		if err != nil {
+			return nil, fmt.Errorf("custom event %s: %w", custom.Name, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// newFileWatchRule validates a watched path and its options
+func newFileWatchRule(name, path, pattern string, options fileWatchOptions) (*fileWatchRule, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file watch source is required")
+	}
+	if pattern != "" {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid file pattern %s: %w", pattern, err)
+		}
+	}
+
+	rule := &fileWatchRule{
+		name:      name,
+		path:      filepath.Clean(path),
+		pattern:   pattern,
+		recursive: options.Recursive,
+		debounce:  options.Debounce,
+		hash:      options.Hash || options.Diff,
+		diff:      options.Diff,
+		maxSize:   options.MaxSize,
+		severity:  options.Severity,
+	}
+	if rule.debounce == 0 {
+		rule.debounce = defaultFileWatchDebounce
+	}
+	if rule.maxSize == 0 {
+		rule.maxSize = defaultFileWatchMaxSize
+	}
+	if rule.severity == "" {
+		rule.severity = "info"
+	}
+
+	if len(options.Events) == 0 {
+		rule.ops = fsnotify.Create | fsnotify.Write | fsnotify.Remove | fsnotify.Rename | fsnotify.Chmod
+	}
+	for _, name := range options.Events {
+		op, ok := fileOpNames[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown file event %q", name)
+		}
+		rule.ops |= op
+	}
+
+	if info, err := os.Stat(rule.path); err == nil && info.IsDir() {
+		rule.isDir = true
+	}
+
+	return rule, nil
+}
+
+// matches reports whether a path is covered by the rule
+func (r *fileWatchRule) matches(path string) bool {
+	if !r.isDir {
+		return path == r.path
+	}
+
+	rel, err := filepath.Rel(r.path, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	if !r.recursive && strings.Contains(rel, string(filepath.Separator)) {
+		return false
+	}
+	if r.pattern != "" {
+		matched, _ := filepath.Match(r.pattern, filepath.Base(path))
+		return matched
+	}
+	return true
+}
+
+// watchFiles watches the configured paths and emits debounced file events
+func (sec *SystemEventsCollector) watchFiles() {
+	defer sec.wg.Done()
+
+	rules := sec.fileRules
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		sec.logger.Error("Failed to create file watcher", "error", err)
+		sec.setError("files", fmt.Sprintf("File watch error: %v", err))
+		return
+	}
+	defer watcher.Close()
+
+	snapshots := make(map[string]*fileSnapshot)
+	present := make(map[string]bool)
+	for _, rule := range rules {
+		sec.addFileWatches(watcher, rule)
+		scanFileRule(rule, snapshots, present)
+	}
+
+	pending := make(map[string]*pendingFileChange)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	// Scanning /proc for writers is slow, so it runs outside the watch
+	// loop, one scan at a time for every change waiting for one. The
+	// channel has room for the only result in flight, so the scan never
+	// blocks once the loop has returned.
+	writers := make(chan map[string][]map[string]interface{}, 1)
+	scanning := false
+	lookUpWriters := func() {
+		if scanning {
+			return
+		}
+		paths := make(map[string]bool)
+		for _, change := range pending {
+			if change.writersQueued {
+				change.writersQueued = false
+				change.writersPending = true
+				paths[change.path] = true
+			}
+		}
+		if len(paths) == 0 {
+			return
+		}
+		scanning = true
+		go func() { writers <- findFileWriters(paths) }()
+	}
+
+	for {
+		select {
+		case <-sec.ctx.Done():
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			sec.queueFileEvent(watcher, rules, snapshots, present, pending, event)
+			lookUpWriters()
+
+		case found := <-writers:
+			scanning = false
+			for _, change := range pending {
+				if change.writersPending {
+					change.writersPending = false
+					change.writers = found[change.path]
+				}
+			}
+			lookUpWriters()
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			sec.logger.Error("File watcher error", "error", err)
+
+		case now := <-ticker.C:
+			for key, change := range pending {
+				if now.Sub(change.last) >= change.rule.debounce && !change.writersQueued && !change.writersPending {
+					delete(pending, key)
+					sec.emitFileChange(change, snapshots, present)
+				}
+			}
+		}
+	}
+}
+
+// addFileWatches adds the directories a rule needs. Single files are
+// watched through their parent directory so that editors replacing the
+// file do not drop the watch.
+func (sec *SystemEventsCollector) addFileWatches(watcher *fsnotify.Watcher, rule *fileWatchRule) {
+	if !rule.isDir {
+		if err := watcher.Add(filepath.Dir(rule.path)); err != nil {
+			sec.logger.Warn("Failed to watch file", "rule", rule.name, "path", rule.path, "error", err)
+		}
+		return
+	}
+
+	if !rule.recursive {
+		if err := watcher.Add(rule.path); err != nil {
+			sec.logger.Warn("Failed to watch directory", "rule", rule.name, "path", rule.path, "error", err)
+		}
+		return
+	}
+
+	filepath.WalkDir(rule.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if err := watcher.Add(path); err != nil {
+				sec.logger.Warn("Failed to watch directory", "rule", rule.name, "path", path, "error", err)
+			}
+		}
+		return nil
+	})
+}
+
+// scanFileRule records which of the rule's files exist, so that a file
+// replaced by a rename is reported as modified rather than created, and
+// for hashed rules their current content hashes
+func scanFileRule(rule *fileWatchRule, snapshots map[string]*fileSnapshot, present map[string]bool) {
+	record := func(path string) {
+		present[path] = true
+		if !rule.hash {
+			return
+		}
+		if snapshot, err := readFileSnapshot(path, rule.maxSize, rule.diff); err == nil {
+			snapshots[path] = snapshot
+		}
+	}
+
+	if !rule.isDir {
+		if _, err := os.Lstat(rule.path); err == nil {
+			record(rule.path)
+		}
+		return
+	}
+
+	filepath.WalkDir(rule.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != rule.path && !rule.recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rule.matches(path) {
+			record(path)
+		}
+		return nil
+	})
+}
+
+// queueFileEvent records a raw event against every rule covering the path
+func (sec *SystemEventsCollector) queueFileEvent(watcher *fsnotify.Watcher, rules []*fileWatchRule, snapshots map[string]*fileSnapshot, present map[string]bool, pending map[string]*pendingFileChange, event fsnotify.Event) {
+	path := filepath.Clean(event.Name)
+	now := time.Now()
+
+	for i, rule := range rules {
+		// New directories under a recursive rule are watched as well
+		if rule.isDir && rule.recursive && event.Op&fsnotify.Create == fsnotify.Create {
+			if info, err := os.Stat(path); err == nil && info.IsDir() && strings.HasPrefix(path, rule.path+string(filepath.Separator)) {
+				if err := watcher.Add(path); err != nil {
+					sec.logger.Warn("Failed to watch directory", "rule", rule.name, "path", path, "error", err)
+				}
+			}
+		}
+
+		if event.Op&rule.ops == 0 || !rule.matches(path) {
+			continue
+		}
+
+		key := strconv.Itoa(i) + ":" + path
+		change, exists := pending[key]
+		if !exists {
+			// Only a create can be the first event of a path that did not
+			// exist; one that did was replaced, such as by a rename over it
+			change = &pendingFileChange{
+				rule:     rule,
+				path:     path,
+				first:    now,
+				existed:  event.Op&fsnotify.Create == 0 || present[path],
+				previous: snapshots[path],
+				// The writer may still hold the file open on the first event
+				writersQueued: rule.hash,
+			}
+			pending[key] = change
+		}
+		change.ops |= event.Op
+		change.last = now
+	}
+}
+
+// emitFileChange sends the event for a debounced change
+func (sec *SystemEventsCollector) emitFileChange(change *pendingFileChange, snapshots map[string]*fileSnapshot, present map[string]bool) {
+	rule := change.rule
+	info, statErr := os.Lstat(change.path)
+	exists := statErr == nil
+	if exists {
+		present[change.path] = true
+	} else {
+		delete(present, change.path)
+	}
+
+	var action string
+	switch {
+	case !exists && change.ops&fsnotify.Rename != 0:
+		action = "renamed"
+	case !exists:
+		action = "deleted"
+	case change.ops&fsnotify.Create != 0 && !change.existed:
+		action = "created"
+	case change.ops&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0:
+		action = "modified"
+	default:
+		action = "chmod"
+	}
+
+	var ops []string
+	for _, name := range []string{"create", "modify", "delete", "rename", "chmod"} {
+		if change.ops&fileOpNames[name] != 0 {
+			ops = append(ops, name)
+		}
+	}
+
+	data := map[string]interface{}{
+		"path":       change.path,
+		"rule":       rule.name,
+		"operations": ops,
+		"first_seen": change.first.Format(time.RFC3339Nano),
+		"last_seen":  change.last.Format(time.RFC3339Nano),
+	}
+
+	if exists {
+		data["size"] = info.Size()
+		data["mode"] = info.Mode().String()
+		data["modified_at"] = info.ModTime().Format(time.RFC3339Nano)
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			data["uid"] = stat.Uid
+			data["gid"] = stat.Gid
+			data["owner"] = lookupUser(stat.Uid)
+		}
+	}
+	if len(change.writers) > 0 {
+		data["writers"] = change.writers
+	}
+
+	// Content hash diff
+	if rule.hash {
+		if change.previous != nil {
+			data["previous_hash"] = change.previous.hash
+		}
+		if exists && info.Mode().IsRegular() {
+			snapshot, err := readFileSnapshot(change.path, rule.maxSize, rule.diff)
+			if err != nil {
+				data["hash_error"] = err.Error()
+			} else {
+				data["hash"] = snapshot.hash
+				changed := change.previous == nil || change.previous.hash != snapshot.hash
+				data["content_changed"] = changed
+				if rule.diff && changed && change.previous != nil {
+					data["diff"] = lineDiff(change.previous.lines, snapshot.lines, maxFileDiffLines)
+				}
+				snapshots[change.path] = snapshot
+			}
+		} else if !exists {
+			delete(snapshots, change.path)
+		}
+	}
+
+	severity := rule.severity
+	if (action == "deleted" || action == "renamed") && severity == "info" {
+		severity = "warning"
+	}
+
+	event := &EventData{
+		ID:       fmt.Sprintf("file-%d", time.Now().UnixNano()),
+		Type:     "file_" + action,
+		Category: "filesystem",
+		Severity: severity,
+		Title:    fmt.Sprintf("File %s %s", change.path, action),
+		Data:     data,
+		Tags: map[string]string{
+			"rule": rule.name,
+			"path": change.path,
+		},
+		Timestamp: change.last.Format(time.RFC3339),
+	}
+
+	sec.logger.Debug("File changed", "rule", rule.name, "path", change.path, "action", action)
+	sec.sendEvent("file_watch", event)
+}
+
+// readFileSnapshot hashes a file and optionally keeps its lines for diffs
+func readFileSnapshot(path string, maxSize int64, keepLines bool) (*fileSnapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file")
+	}
+	if info.Size() > maxSize {
+		return nil, fmt.Errorf("file larger than %d bytes", maxSize)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	snapshot := &fileSnapshot{hash: hex.EncodeToString(sum[:])}
+	if keepLines {
+		snapshot.lines = strings.Split(string(content), "\n")
+	}
+	return snapshot, nil
+}
+
+// lineDiff returns the removed ("-") and added ("+") lines between two
+// versions of a file, limited to maxLines entries
+func lineDiff(before, after []string, maxLines int) []string {
+	// Skip the common prefix and suffix
+	start := 0
+	for start < len(before) && start < len(after) && before[start] == after[start] {
+		start++
+	}
+	endBefore, endAfter := len(before), len(after)
+	for endBefore > start && endAfter > start && before[endBefore-1] == after[endAfter-1] {
+		endBefore--
+		endAfter--
+	}
+	a, b := before[start:endBefore], after[start:endAfter]
+
+	var diff []string
+	emit := func(line string) bool {
+		if len(diff) >= maxLines {
+			return false
+		}
+		diff = append(diff, line)
+		return true
+	}
+
+	// Longest common subsequence on the changed region, when small enough
+	if len(a)*len(b) > 1000000 {
+		for _, line := range a {
+			if !emit("-" + line) {
+				return append(diff, "...")
+			}
+		}
+		for _, line := range b {
+			if !emit("+" + line) {
+				return append(diff, "...")
+			}
+		}
+		return diff
+	}
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var ok bool
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+			continue
+		case j >= len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ok = emit(fmt.Sprintf("-%d: %s", start+i+1, a[i]))
+			i++
+		default:
+			ok = emit(fmt.Sprintf("+%d: %s", start+j+1, b[j]))
+			j++
+		}
+		if !ok {
+			return append(diff, "...")
+		}
+	}
+
+	return diff
+}
+
+// findFileWriters returns the processes holding each of the paths open,
+// with their user and audit login user, in a single scan of /proc. This
+// is best effort: writers that already closed a file are not found.
+func findFileWriters(paths map[string]bool) map[string][]map[string]interface{} {
+	writers := make(map[string][]map[string]interface{})
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return writers
+	}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		var identity map[string]interface{}
+		seen := make(map[string]bool)
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !paths[target] || seen[target] {
+				continue
+			}
+			seen[target] = true
+			if identity == nil {
+				identity = processIdentity(pid)
+			}
+			writers[target] = append(writers[target], identity)
+		}
+	}
+
+	return writers
+}
+
+// processIdentity describes a process by name, user and login user
+func processIdentity(pid int) map[string]interface{} {
+	identity := map[string]interface{}{"pid": pid}
+	procDir := filepath.Join("/proc", strconv.Itoa(pid))
+
+	if comm, err := os.ReadFile(filepath.Join(procDir, "comm")); err == nil {
+		identity["process"] = strings.TrimSpace(string(comm))
+	}
+	if info, err := os.Stat(procDir); err == nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			identity["user"] = lookupUser(stat.Uid)
+		}
+	}
+	// The audit login uid survives sudo and su
+	if data, err := os.ReadFile(filepath.Join(procDir, "loginuid")); err == nil {
+		if uid, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32); err == nil && uid != 4294967295 {
+			identity["login_user"] = lookupUser(uint32(uid))
+		}
+	}
+
+	return identity
+}
+
+// lookupUser returns the user name for a uid, or the uid itself
+func lookupUser(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
@@ -0,0 +1,207 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+func TestFileWatchRuleMatches(t *testing.T) {
+	dir := t.TempDir()
+	flat, err := newFileWatchRule("flat", dir, "*.conf", fileWatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recursive, err := newFileWatchRule("recursive", dir+"/", "", fileWatchOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := newFileWatchRule("file", filepath.Join(dir, "app.conf"), "", fileWatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rule *fileWatchRule
+		path string
+		want bool
+	}{
+		{flat, filepath.Join(dir, "app.conf"), true},
+		{flat, filepath.Join(dir, "app.conf.swp"), false},
+		{flat, filepath.Join(dir, "sub", "app.conf"), false},
+		{flat, dir, false},
+		{flat, dir + "-other/app.conf", false},
+		{recursive, filepath.Join(dir, "sub", "deeper", "x"), true},
+		{recursive, filepath.Dir(dir), false},
+		{file, filepath.Join(dir, "app.conf"), true},
+		{file, filepath.Join(dir, "other.conf"), false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.matches(tt.path); got != tt.want {
+			t.Errorf("%s matches %s = %v, want %v", tt.rule.name, tt.path, got, tt.want)
+		}
+	}
+
+	if !flat.isDir || file.isDir || flat.debounce != defaultFileWatchDebounce || flat.severity != "info" {
+		t.Errorf("unexpected rule %+v", flat)
+	}
+	for _, options := range []fileWatchOptions{{Events: []string{"write"}}} {
+		if _, err := newFileWatchRule("bad", dir, "", options); err == nil {
+			t.Errorf("%+v: expected an error", options)
+		}
+	}
+	if _, err := newFileWatchRule("bad", dir, "[", fileWatchOptions{}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	before := []string{"a", "b", "c", "d"}
+	after := []string{"a", "x", "c", "d", "e"}
+	want := []string{"-2: b", "+2: x", "+5: e"}
+	if got := lineDiff(before, after, 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := lineDiff(before, after, 1); !reflect.DeepEqual(got, []string{"-2: b", "..."}) {
+		t.Errorf("limited diff = %q", got)
+	}
+	if got := lineDiff(before, before, 10); len(got) != 0 {
+		t.Errorf("diff of equal files = %q", got)
+	}
+}
+
+func TestFileWatchEvents(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "app.conf")
+	hashed := filepath.Join(dir, "hashed.txt")
+	for _, path := range []string{conf, hashed} {
+		if err := os.WriteFile(path, []byte("a\nb\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without hashing, only the watch itself knows which files existed
+	_, data := startTestEvents(t, config.EventsCollectorConfig{CustomEvents: []config.CustomEventConfig{{
+		Name:    "configs",
+		Type:    "file_watch",
+		Source:  dir,
+		Pattern: "*.conf",
+		Config:  map[string]interface{}{"debounce": "150ms"},
+	}, {
+		Name:   "hashed",
+		Type:   "file_watch",
+		Source: hashed,
+		Config: map[string]interface{}{"debounce": "150ms", "diff": true},
+	}}})
+	// Let the watches be set up
+	time.Sleep(100 * time.Millisecond)
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A burst of writes within the debounce window is one event
+	for i := 0; i < 5; i++ {
+		write(hashed, "a\nc\n")
+		time.Sleep(20 * time.Millisecond)
+	}
+	event := nextEvent(t, data)
+	if event.Type != "file_modified" || event.Data["path"] != hashed || event.Data["content_changed"] != true ||
+		!reflect.DeepEqual(event.Data["diff"], []string{"-2: b", "+2: c"}) || event.Tags["rule"] != "hashed" {
+		t.Errorf("modification event = %+v", event)
+	}
+	noEvent(t, data, 300*time.Millisecond)
+
+	// The writer is found while it holds the file open
+	file, err := os.OpenFile(hashed, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("d\n")
+	event = nextEvent(t, data)
+	file.Close()
+	writers, _ := event.Data["writers"].([]map[string]interface{})
+	if len(writers) != 1 || writers[0]["pid"] != os.Getpid() {
+		t.Errorf("writers = %v", event.Data["writers"])
+	}
+	// Closing the file is not a change
+	noEvent(t, data, 300*time.Millisecond)
+
+	created := filepath.Join(dir, "new.conf")
+	write(created, "new\n")
+	if event := nextEvent(t, data); event.Type != "file_created" || event.Data["path"] != created {
+		t.Errorf("creation event = %+v", event)
+	}
+
+	// An editor replacing the file by a rename modifies it; the temporary
+	// file does not match the pattern
+	temporary := filepath.Join(dir, "app.conf.tmp")
+	write(temporary, "replaced\n")
+	if err := os.Rename(temporary, conf); err != nil {
+		t.Fatal(err)
+	}
+	event = nextEvent(t, data)
+	if event.Type != "file_modified" || event.Data["path"] != conf || event.Tags["rule"] != "configs" {
+		t.Errorf("replacement event = %+v", event)
+	}
+
+	// A file moved into place where none existed is created
+	write(temporary, "moved\n")
+	moved := filepath.Join(dir, "moved.conf")
+	if err := os.Rename(temporary, moved); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, data); event.Type != "file_created" || event.Data["path"] != moved {
+		t.Errorf("move event = %+v", event)
+	}
+
+	if err := os.Rename(moved, filepath.Join(dir, "moved.bak")); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, data); event.Type != "file_renamed" || event.Severity != "warning" {
+		t.Errorf("rename event = %+v", event)
+	}
+
+	if err := os.Remove(created); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, data); event.Type != "file_deleted" || event.Severity != "warning" || event.Data["path"] != created {
+		t.Errorf("deletion event = %+v", event)
+	}
+
+	// Once deleted, the file is created again rather than modified
+	write(created, "again\n")
+	if event := nextEvent(t, data); event.Type != "file_created" {
+		t.Errorf("re-creation event = %+v", event)
+	}
+	noEvent(t, data, 300*time.Millisecond)
+}
+
+func TestFindFileWriters(t *testing.T) {
+	dir := t.TempDir()
+	open := filepath.Join(dir, "open")
+	closed := filepath.Join(dir, "closed")
+	file, err := os.Create(open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := os.WriteFile(closed, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	writers := findFileWriters(map[string]bool{open: true, closed: true})
+	if len(writers[open]) != 1 || writers[open][0]["pid"] != os.Getpid() || writers[open][0]["process"] == "" {
+		t.Errorf("writers of an open file = %v", writers[open])
+	}
+	if len(writers[closed]) != 0 {
+		t.Errorf("writers of a closed file = %v", writers[closed])
+	}
+}
@@ -0,0 +1,561 @@
+package collectors
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"hive-agent/internal/config"
+)
+
+// integrityEntry is the recorded state of a monitored file
+type integrityEntry struct {
+	Rule   string `json:"rule"`
+	Hash   string `json:"sha256,omitempty"`
+	Mode   string `json:"mode"`
+	UID    uint32 `json:"uid"`
+	GID    uint32 `json:"gid"`
+	Size   int64  `json:"size"`
+	Mtime  string `json:"mtime"`
+	Target string `json:"link_target,omitempty"`
+}
+
+// integrityBaseline is the persisted baseline. Drift holds the fingerprint
+// of the last reported state of each drifted path, so that a drift is
+// reported once until the file changes again or returns to the baseline.
+type integrityBaseline struct {
+	Created string                    `json:"created"`
+	Rules   []string                  `json:"rules"`
+	Files   map[string]integrityEntry `json:"files"`
+	Drift   map[string]string         `json:"drift,omitempty"`
+}
+
+// integrityRule is a validated file integrity rule
+type integrityRule struct {
+	config.FileIntegrityRule
+	path  string
+	isDir bool
+}
+
+// integrityMonitor verifies files against the stored baseline
+type integrityMonitor struct {
+	config   config.FileIntegrityConfig
+	file     string
+	rules    []*integrityRule
+	baseline *integrityBaseline
+}
+
+// integrityDrift is a detected difference from the baseline
+type integrityDrift struct {
+	rule     *integrityRule
+	path     string
+	changes  []string
+	expected *integrityEntry
+	actual   *integrityEntry
+}
+
+// newIntegrityMonitor validates the integrity rules
+func newIntegrityMonitor(cfg config.FileIntegrityConfig, dataDir string) (*integrityMonitor, error) {
+	monitor := &integrityMonitor{
+		config: cfg,
+		file:   filepath.Join(dataDir, "fim", "baseline.json"),
+	}
+
+	names := make(map[string]bool)
+	for i, ruleCfg := range cfg.Rules {
+		if ruleCfg.Path == "" {
+			return nil, fmt.Errorf("integrity rule %d: path is required", i)
+		}
+		if ruleCfg.Name == "" {
+			ruleCfg.Name = ruleCfg.Path
+		}
+		if names[ruleCfg.Name] {
+			return nil, fmt.Errorf("duplicate integrity rule name %s", ruleCfg.Name)
+		}
+		names[ruleCfg.Name] = true
+
+		if ruleCfg.Severity == "" {
+			ruleCfg.Severity = "warning"
+		}
+		for _, pattern := range append(append([]string{}, ruleCfg.Include...), ruleCfg.Exclude...) {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("integrity rule %s: invalid pattern %s: %w", ruleCfg.Name, pattern, err)
+			}
+		}
+
+		rule := &integrityRule{FileIntegrityRule: ruleCfg, path: filepath.Clean(ruleCfg.Path)}
+		if info, err := os.Stat(rule.path); err == nil && info.IsDir() {
+			rule.isDir = true
+		}
+		monitor.rules = append(monitor.rules, rule)
+	}
+
+	return monitor, nil
+}
+
+// covers reports whether a path belongs to the rule
+func (r *integrityRule) covers(path string) bool {
+	if !r.isDir {
+		return path == r.path
+	}
+
+	rel, err := filepath.Rel(r.path, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	if !r.Recursive && strings.Contains(rel, string(filepath.Separator)) {
+		return false
+	}
+
+	name := filepath.Base(path)
+	if len(r.Include) > 0 {
+		included := false
+		for _, pattern := range r.Include {
+			if matched, _ := filepath.Match(pattern, name); matched {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, pattern := range r.Exclude {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleFor returns the first rule covering a path
+func (m *integrityMonitor) ruleFor(path string) *integrityRule {
+	for _, rule := range m.rules {
+		if rule.covers(path) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// scan returns the current state of all files covered by a rule
+func (m *integrityMonitor) scan(rule *integrityRule) map[string]integrityEntry {
+	entries := make(map[string]integrityEntry)
+
+	if !rule.isDir {
+		if entry, err := m.entry(rule.path, rule); err == nil {
+			entries[rule.path] = *entry
+		}
+		return entries
+	}
+
+	filepath.WalkDir(rule.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != rule.path && !rule.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// A path covered by an earlier rule belongs to that rule
+		if m.ruleFor(path) != rule {
+			return nil
+		}
+		if entry, err := m.entry(path, rule); err == nil {
+			entries[path] = *entry
+		}
+		return nil
+	})
+
+	return entries
+}
+
+// entry reads the state of a single file
+func (m *integrityMonitor) entry(path string, rule *integrityRule) (*integrityEntry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &integrityEntry{
+		Rule:  rule.Name,
+		Mode:  info.Mode().String(),
+		Size:  info.Size(),
+		Mtime: info.ModTime().UTC().Format(time.RFC3339Nano),
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		entry.UID = stat.Uid
+		entry.GID = stat.Gid
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		entry.Target, _ = os.Readlink(path)
+	case info.Mode().IsRegular() && info.Size() <= m.config.MaxSize:
+		hash, err := hashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		entry.Hash = hash
+	}
+
+	return entry, nil
+}
+
+// hashFile returns the hex SHA-256 of a file
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// load reads the baseline from disk, taking a new baseline for rules that
+// have none. It returns the names of newly baselined rules.
+func (m *integrityMonitor) load() ([]string, error) {
+	baseline := &integrityBaseline{}
+	data, err := os.ReadFile(m.file)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, baseline); err != nil {
+			return nil, fmt.Errorf("invalid baseline %s: %w", m.file, err)
+		}
+	case os.IsNotExist(err):
+		baseline.Created = time.Now().UTC().Format(time.RFC3339)
+	default:
+		return nil, fmt.Errorf("failed to read baseline: %w", err)
+	}
+	if baseline.Files == nil {
+		baseline.Files = make(map[string]integrityEntry)
+	}
+	if baseline.Drift == nil {
+		baseline.Drift = make(map[string]string)
+	}
+	m.baseline = baseline
+
+	known := make(map[string]bool)
+	for _, name := range baseline.Rules {
+		known[name] = true
+	}
+
+	var added []string
+	for _, rule := range m.rules {
+		if known[rule.Name] {
+			continue
+		}
+		for path, entry := range m.scan(rule) {
+			baseline.Files[path] = entry
+		}
+		baseline.Rules = append(baseline.Rules, rule.Name)
+		added = append(added, rule.Name)
+	}
+
+	if len(added) > 0 {
+		if err := m.save(); err != nil {
+			return added, err
+		}
+	}
+	return added, nil
+}
+
+// save writes the baseline atomically
+func (m *integrityMonitor) save() error {
+	if err := os.MkdirAll(filepath.Dir(m.file), 0700); err != nil {
+		return fmt.Errorf("failed to create baseline directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(m.baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := m.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	return os.Rename(tmp, m.file)
+}
+
+// verifyAll compares every monitored file with the baseline
+func (m *integrityMonitor) verifyAll() []integrityDrift {
+	var drifts []integrityDrift
+
+	for _, rule := range m.rules {
+		current := m.scan(rule)
+
+		for path, actual := range current {
+			actual := actual
+			if drift := m.compare(rule, path, &actual); drift != nil {
+				drifts = append(drifts, *drift)
+			}
+		}
+
+		for path, expected := range m.baseline.Files {
+			if expected.Rule != rule.Name {
+				continue
+			}
+			if _, exists := current[path]; !exists {
+				if drift := m.compare(rule, path, nil); drift != nil {
+					drifts = append(drifts, *drift)
+				}
+			}
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].path < drifts[j].path })
+	return drifts
+}
+
+// verifyPath compares a single file with the baseline
+func (m *integrityMonitor) verifyPath(path string) *integrityDrift {
+	rule := m.ruleFor(path)
+	if rule == nil {
+		return nil
+	}
+
+	actual, err := m.entry(path, rule)
+	if err != nil {
+		actual = nil
+	}
+	return m.compare(rule, path, actual)
+}
+
+// compare returns the drift of a file from the baseline, or nil when it
+// matches or the drift was already reported. actual is nil for a missing
+// file.
+func (m *integrityMonitor) compare(rule *integrityRule, path string, actual *integrityEntry) *integrityDrift {
+	var expected *integrityEntry
+	if entry, exists := m.baseline.Files[path]; exists {
+		expected = &entry
+	}
+
+	var changes []string
+	switch {
+	case expected == nil && actual == nil:
+		return nil
+	case expected == nil:
+		changes = []string{"added"}
+	case actual == nil:
+		changes = []string{"removed"}
+	default:
+		if expected.Hash != actual.Hash || expected.Target != actual.Target {
+			changes = append(changes, "content")
+		}
+		if expected.Mode != actual.Mode {
+			changes = append(changes, "permissions")
+		}
+		if expected.UID != actual.UID || expected.GID != actual.GID {
+			changes = append(changes, "owner")
+		}
+		if expected.Size != actual.Size && expected.Hash == "" {
+			changes = append(changes, "size")
+		}
+		if expected.Mtime != actual.Mtime {
+			changes = append(changes, "mtime")
+		}
+	}
+
+	if len(changes) == 0 {
+		delete(m.baseline.Drift, path)
+		return nil
+	}
+
+	fingerprint := "removed"
+	if actual != nil {
+		fingerprint = fmt.Sprintf("%s|%s|%d|%d|%s|%s", actual.Hash, actual.Mode, actual.UID, actual.GID, actual.Mtime, actual.Target)
+	}
+	if m.baseline.Drift[path] == fingerprint {
+		return nil
+	}
+	m.baseline.Drift[path] = fingerprint
+
+	return &integrityDrift{rule: rule, path: path, changes: changes, expected: expected, actual: actual}
+}
+
+// watchIntegrity takes or loads the baseline, then verifies it
+// periodically and on change events for rules with watch enabled
+func (sec *SystemEventsCollector) watchIntegrity() {
+	defer sec.wg.Done()
+
+	monitor := sec.integrity
+	added, err := monitor.load()
+	if err != nil {
+		sec.logger.Error("Failed to load integrity baseline", "file", monitor.file, "error", err)
+		sec.setError("integrity", fmt.Sprintf("Integrity baseline error: %v", err))
+		if monitor.baseline == nil {
+			return
+		}
+	}
+	if len(added) > 0 {
+		sec.logger.Info("Integrity baseline taken", "rules", added, "files", len(monitor.baseline.Files))
+	}
+
+	// Event-triggered verification
+	var events chan fsnotify.Event
+	var watcher *fsnotify.Watcher
+	for _, rule := range monitor.rules {
+		if !rule.Watch {
+			continue
+		}
+		if watcher == nil {
+			if watcher, err = fsnotify.NewWatcher(); err != nil {
+				sec.logger.Error("Failed to create integrity watcher", "error", err)
+				break
+			}
+			defer watcher.Close()
+		}
+		sec.addIntegrityWatches(watcher, rule)
+	}
+	if watcher != nil {
+		events = watcher.Events
+	}
+
+	// Verify once at startup to catch changes made while the agent was down
+	sec.reportDrifts(monitor, monitor.verifyAll(), "periodic")
+
+	ticker := time.NewTicker(monitor.config.Interval)
+	defer ticker.Stop()
+	debounce := time.NewTicker(monitor.config.Debounce / 2)
+	defer debounce.Stop()
+
+	pending := make(map[string]time.Time)
+
+	for {
+		select {
+		case <-sec.ctx.Done():
+			return
+
+		case <-ticker.C:
+			sec.reportDrifts(monitor, monitor.verifyAll(), "periodic")
+
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			path := filepath.Clean(event.Name)
+			if rule := monitor.ruleFor(path); rule != nil && rule.Watch {
+				pending[path] = time.Now()
+			}
+			// New directories under recursive rules are watched as well
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(path); err == nil && info.IsDir() {
+					for _, rule := range monitor.rules {
+						if rule.Watch && rule.isDir && rule.Recursive && strings.HasPrefix(path, rule.path+string(filepath.Separator)) {
+							watcher.Add(path)
+							break
+						}
+					}
+				}
+			}
+
+		case now := <-debounce.C:
+			var drifts []integrityDrift
+			for path, seen := range pending {
+				if now.Sub(seen) < monitor.config.Debounce {
+					continue
+				}
+				delete(pending, path)
+				if drift := monitor.verifyPath(path); drift != nil {
+					drifts = append(drifts, *drift)
+				}
+			}
+			sec.reportDrifts(monitor, drifts, "event")
+		}
+	}
+}
+
+// addIntegrityWatches watches the directories of a rule
+func (sec *SystemEventsCollector) addIntegrityWatches(watcher *fsnotify.Watcher, rule *integrityRule) {
+	if !rule.isDir {
+		if err := watcher.Add(filepath.Dir(rule.path)); err != nil {
+			sec.logger.Warn("Failed to watch integrity path", "rule", rule.Name, "path", rule.path, "error", err)
+		}
+		return
+	}
+
+	filepath.WalkDir(rule.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != rule.path && !rule.Recursive {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			sec.logger.Warn("Failed to watch integrity path", "rule", rule.Name, "path", path, "error", err)
+		}
+		return nil
+	})
+}
+
+// reportDrifts emits an issue per drift and persists the reported state
+func (sec *SystemEventsCollector) reportDrifts(monitor *integrityMonitor, drifts []integrityDrift, trigger string) {
+	if len(drifts) == 0 {
+		return
+	}
+
+	for _, drift := range drifts {
+		sec.sendIntegrityIssue(monitor, drift, trigger)
+	}
+
+	if err := monitor.save(); err != nil {
+		sec.logger.Error("Failed to save integrity baseline", "error", err)
+	}
+}
+
+// sendIntegrityIssue sends an issue describing a drift
+func (sec *SystemEventsCollector) sendIntegrityIssue(monitor *integrityMonitor, drift integrityDrift, trigger string) {
+	context := map[string]interface{}{
+		"path":             drift.path,
+		"rule":             drift.rule.Name,
+		"changes":          drift.changes,
+		"trigger":          trigger,
+		"baseline_created": monitor.baseline.Created,
+	}
+	if drift.expected != nil {
+		context["expected"] = drift.expected
+	}
+	if drift.actual != nil {
+		context["actual"] = drift.actual
+	}
+
+	issue := &IssueData{
+		ID:          fmt.Sprintf("fim-%d", time.Now().UnixNano()),
+		Severity:    drift.rule.Severity,
+		Category:    "integrity",
+		Title:       fmt.Sprintf("File integrity change: %s (%s)", drift.path, strings.Join(drift.changes, ", ")),
+		Description: fmt.Sprintf("%s differs from the baseline taken at %s", drift.path, monitor.baseline.Created),
+		Pattern:     drift.rule.Name,
+		Context:     context,
+		Source:      "fim",
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+
+	sec.logger.Warn("File integrity change detected",
+		"path", drift.path,
+		"rule", drift.rule.Name,
+		"changes", strings.Join(drift.changes, ","),
+	)
+
+	sec.sendIssue("fim", issue, map[string]string{"rule": drift.rule.Name, "path": drift.path})
+}
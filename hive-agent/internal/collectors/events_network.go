@@ -0,0 +1,496 @@
+package collectors
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Socket states in /proc/net/{tcp,udp}
+const (
+	tcpListenState      = "0A"
+	udpUnconnectedState = "07"
+)
+
+// defaultEphemeralPorts is the kernel's default local port range, used
+// when it cannot be read
+var defaultEphemeralPorts = portRange{low: 32768, high: 60999}
+
+// portRange is an inclusive range of ports
+type portRange struct {
+	low, high int
+}
+
+// contains reports whether a port is in the range
+func (r portRange) contains(port int) bool {
+	return port >= r.low && port <= r.high
+}
+
+// readEphemeralPorts returns the range the kernel picks local ports from
+func readEphemeralPorts() portRange {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return defaultEphemeralPorts
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return defaultEphemeralPorts
+	}
+	low, errLow := strconv.Atoi(fields[0])
+	high, errHigh := strconv.Atoi(fields[1])
+	if errLow != nil || errHigh != nil || low > high {
+		return defaultEphemeralPorts
+	}
+	return portRange{low: low, high: high}
+}
+
+// networkInterface is the observed state of an interface
+type networkInterface struct {
+	Name      string
+	Index     int
+	MAC       string
+	MTU       int
+	AdminUp   bool
+	OperState string
+	Addresses []string
+}
+
+// up reports whether the interface can carry traffic
+func (ni networkInterface) up() bool {
+	return ni.AdminUp && ni.OperState != "down" && ni.OperState != "lowerlayerdown" && ni.OperState != "notpresent"
+}
+
+// listener is a listening TCP socket or an unconnected UDP socket
+type listener struct {
+	Protocol string
+	Address  string
+	Port     int
+	Inode    uint64
+	Owner    map[string]interface{}
+}
+
+// key identifies a listener independently of its socket
+func (l *listener) key() string {
+	return l.Protocol + " " + net.JoinHostPort(l.Address, strconv.Itoa(l.Port))
+}
+
+// watchNetwork polls interface state and listening sockets and emits an
+// event for every change between two polls
+func (sec *SystemEventsCollector) watchNetwork() {
+	defer sec.wg.Done()
+
+	ticker := time.NewTicker(sec.config.SystemEvents.NetworkInterval)
+	defer ticker.Stop()
+
+	var interfaces map[string]networkInterface
+	var listeners map[string]*listener
+	ephemeral := readEphemeralPorts()
+
+	for {
+		currentInterfaces, err := sec.readInterfaces()
+		if err != nil {
+			sec.logger.Error("Failed to read network interfaces", "error", err)
+			sec.setError("interfaces", fmt.Sprintf("Network events error: %v", err))
+		} else {
+			sec.setError("interfaces", "")
+			// The first successful poll only establishes the baseline
+			if interfaces != nil {
+				sec.compareInterfaces(interfaces, currentInterfaces)
+			}
+			interfaces = currentInterfaces
+		}
+
+		currentListeners, err := readListeners(listeners, ephemeral, sec.config.SystemEvents.ExpectedPorts)
+		if err != nil {
+			sec.logger.Error("Failed to read listening sockets", "error", err)
+			sec.setError("listeners", fmt.Sprintf("Network events error: %v", err))
+		} else {
+			sec.setError("listeners", "")
+			if listeners != nil {
+				sec.compareListeners(listeners, currentListeners)
+			}
+			listeners = currentListeners
+		}
+
+		select {
+		case <-sec.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readInterfaces returns the state of the watched interfaces keyed by name
+func (sec *SystemEventsCollector) readInterfaces() (map[string]networkInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]networkInterface, len(ifaces))
+	for _, iface := range ifaces {
+		if !sec.watchesInterface(iface.Name) {
+			continue
+		}
+
+		state := networkInterface{
+			Name:      iface.Name,
+			Index:     iface.Index,
+			MAC:       iface.HardwareAddr.String(),
+			MTU:       iface.MTU,
+			AdminUp:   iface.Flags&net.FlagUp != 0,
+			OperState: "unknown",
+		}
+		if data, err := os.ReadFile(filepath.Join("/sys/class/net", iface.Name, "operstate")); err == nil {
+			state.OperState = strings.TrimSpace(string(data))
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				state.Addresses = append(state.Addresses, addr.String())
+			}
+			sort.Strings(state.Addresses)
+		}
+
+		current[iface.Name] = state
+	}
+	return current, nil
+}
+
+// watchesInterface reports whether an interface matches the configured globs
+func (sec *SystemEventsCollector) watchesInterface(name string) bool {
+	patterns := sec.config.SystemEvents.NetworkInterfaces
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// compareInterfaces emits events for link state and address changes
+func (sec *SystemEventsCollector) compareInterfaces(previous, current map[string]networkInterface) {
+	for name, iface := range current {
+		before, existed := previous[name]
+		if !existed {
+			sec.sendInterfaceEvent("interface_added", iface, nil,
+				fmt.Sprintf("Network interface %s added", name))
+			continue
+		}
+
+		if before.up() != iface.up() {
+			eventType, title := "interface_up", fmt.Sprintf("Network interface %s is up", name)
+			if !iface.up() {
+				eventType, title = "interface_down", fmt.Sprintf("Network interface %s is down", name)
+			}
+			sec.sendInterfaceEvent(eventType, iface, map[string]interface{}{
+				"previous_oper_state": before.OperState,
+				"previous_admin_up":   before.AdminUp,
+			}, title)
+		}
+
+		added, removed := diffStrings(before.Addresses, iface.Addresses)
+		for _, addr := range added {
+			sec.sendInterfaceEvent("address_added", iface, map[string]interface{}{"address": addr},
+				fmt.Sprintf("Address %s added to %s", addr, name))
+		}
+		for _, addr := range removed {
+			sec.sendInterfaceEvent("address_removed", iface, map[string]interface{}{"address": addr},
+				fmt.Sprintf("Address %s removed from %s", addr, name))
+		}
+	}
+
+	for name, before := range previous {
+		if _, exists := current[name]; !exists {
+			sec.sendInterfaceEvent("interface_removed", before, nil,
+				fmt.Sprintf("Network interface %s removed", name))
+		}
+	}
+}
+
+// diffStrings returns the values only in b and only in a
+func diffStrings(a, b []string) (added, removed []string) {
+	inA := make(map[string]bool, len(a))
+	for _, v := range a {
+		inA[v] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, v := range b {
+		inB[v] = true
+		if !inA[v] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range a {
+		if !inB[v] {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed
+}
+
+// sendInterfaceEvent sends an interface state change event
+func (sec *SystemEventsCollector) sendInterfaceEvent(eventType string, iface networkInterface, extra map[string]interface{}, title string) {
+	data := map[string]interface{}{
+		"interface":  iface.Name,
+		"index":      iface.Index,
+		"mac":        iface.MAC,
+		"mtu":        iface.MTU,
+		"admin_up":   iface.AdminUp,
+		"oper_state": iface.OperState,
+		"addresses":  iface.Addresses,
+	}
+	for key, value := range extra {
+		data[key] = value
+	}
+
+	severity := "info"
+	switch eventType {
+	case "interface_down", "interface_removed":
+		severity = "warning"
+	}
+
+	event := &EventData{
+		ID:        fmt.Sprintf("network-%s-%d", iface.Name, time.Now().UnixNano()),
+		Type:      eventType,
+		Category:  "network",
+		Severity:  severity,
+		Title:     title,
+		Data:      data,
+		Tags:      map[string]string{"interface": iface.Name},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+
+	sec.logger.Info("Network interface changed", "interface", iface.Name, "event", eventType)
+
+	sec.sendEvent("network", event)
+}
+
+// readListeners returns the listening sockets keyed by protocol and local
+// address. Owners are looked up for sockets not in previous.
+//
+// UDP has no listening state: clients such as DNS resolvers also hold
+// unconnected sockets, bound to a port from the ephemeral range. Those
+// are skipped unless their port is one of the expected ports.
+func readListeners(previous map[string]*listener, ephemeral portRange, expectedPorts []int) (map[string]*listener, error) {
+	current := make(map[string]*listener)
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		state := tcpListenState
+		if strings.HasPrefix(proto, "udp") {
+			state = udpUnconnectedState
+		}
+		if err := readProcNetSockets(filepath.Join("/proc/net", proto), proto, state, current); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+	}
+
+	expected := make(map[int]bool, len(expectedPorts))
+	for _, port := range expectedPorts {
+		expected[port] = true
+	}
+	for key, l := range current {
+		if strings.HasPrefix(l.Protocol, "udp") && ephemeral.contains(l.Port) && !expected[l.Port] {
+			delete(current, key)
+		}
+	}
+
+	// Carry owners over and resolve the rest in a single /proc scan
+	unresolved := make(map[uint64]*listener)
+	for key, l := range current {
+		if before, exists := previous[key]; exists && before.Inode == l.Inode {
+			l.Owner = before.Owner
+			continue
+		}
+		unresolved[l.Inode] = l
+	}
+	if len(unresolved) > 0 {
+		for inode, pid := range socketOwners(unresolved) {
+			unresolved[inode].Owner = processIdentity(pid)
+		}
+	}
+
+	return current, nil
+}
+
+// readProcNetSockets parses a /proc/net/<proto> file for sockets in a
+// state that have no remote address
+func readProcNetSockets(path, proto, state string, into map[string]*listener) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+
+		address, port, err := parseProcNetAddress(fields[1])
+		if err != nil {
+			continue
+		}
+		if _, remotePort, err := parseProcNetAddress(fields[2]); err != nil || remotePort != 0 {
+			continue
+		}
+		inode, _ := strconv.ParseUint(fields[9], 10, 64)
+
+		l := &listener{Protocol: proto, Address: address, Port: port, Inode: inode}
+		into[l.key()] = l
+	}
+	return scanner.Err()
+}
+
+// parseProcNetAddress decodes an address such as 0100007F:0035. The
+// address is stored as 32-bit words in host byte order; supported
+// platforms are little-endian.
+func parseProcNetAddress(s string) (string, int, error) {
+	hexAddr, hexPort, found := strings.Cut(s, ":")
+	if !found {
+		return "", 0, fmt.Errorf("invalid socket address %s", s)
+	}
+
+	raw, err := hex.DecodeString(hexAddr)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid socket address %s", s)
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid socket port %s", s)
+	}
+	return net.IP(raw).String(), int(port), nil
+}
+
+// socketOwners maps socket inodes to the pid holding them open
+func socketOwners(inodes map[uint64]*listener) map[uint64]int {
+	owners := make(map[uint64]int)
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			if _, wanted := inodes[inode]; wanted {
+				if _, found := owners[inode]; !found {
+					owners[inode] = pid
+				}
+			}
+		}
+
+		if len(owners) == len(inodes) {
+			break
+		}
+	}
+
+	return owners
+}
+
+// compareListeners emits events for opened and closed listening sockets
+func (sec *SystemEventsCollector) compareListeners(previous, current map[string]*listener) {
+	for key, l := range current {
+		if _, existed := previous[key]; !existed {
+			sec.sendListenerEvent("listener_opened", l)
+		}
+	}
+	for key, l := range previous {
+		if _, exists := current[key]; !exists {
+			sec.sendListenerEvent("listener_closed", l)
+		}
+	}
+}
+
+// sendListenerEvent sends a listening socket change event. New listeners
+// on ports outside the expected ports are flagged.
+func (sec *SystemEventsCollector) sendListenerEvent(eventType string, l *listener) {
+	expected := len(sec.config.SystemEvents.ExpectedPorts) == 0
+	for _, port := range sec.config.SystemEvents.ExpectedPorts {
+		if port == l.Port {
+			expected = true
+			break
+		}
+	}
+
+	data := map[string]interface{}{
+		"protocol": l.Protocol,
+		"address":  l.Address,
+		"port":     l.Port,
+		"inode":    l.Inode,
+		"expected": expected,
+	}
+	tags := map[string]string{"protocol": l.Protocol, "port": strconv.Itoa(l.Port)}
+	if l.Owner != nil {
+		data["owner"] = l.Owner
+		if name, ok := l.Owner["process"].(string); ok {
+			tags["process"] = name
+		}
+	}
+
+	severity := "info"
+	title := fmt.Sprintf("Listening socket closed: %s", l.key())
+	if eventType == "listener_opened" {
+		title = fmt.Sprintf("New listening socket: %s", l.key())
+		if !expected {
+			severity = "warning"
+			title = fmt.Sprintf("Unexpected listening socket: %s", l.key())
+		}
+	}
+	if name, ok := tags["process"]; ok {
+		title += fmt.Sprintf(" (%s)", name)
+	}
+
+	event := &EventData{
+		ID:        fmt.Sprintf("listener-%d-%d", l.Port, time.Now().UnixNano()),
+		Type:      eventType,
+		Category:  "network",
+		Severity:  severity,
+		Title:     title,
+		Data:      data,
+		Tags:      tags,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+
+	sec.logger.Info("Listening sockets changed", "event", eventType, "socket", l.key())
+
+	sec.sendEvent("network", event)
+}
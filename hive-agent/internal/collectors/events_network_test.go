@@ -0,0 +1,154 @@
+package collectors
+
+import (
+	"context"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"hive-agent/internal/config"
+)
+
+func TestParseProcNetAddress(t *testing.T) {
+	tests := []struct {
+		raw     string
+		address string
+		port    int
+	}{
+		{"0100007F:0035", "127.0.0.1", 53},
+		{"00000000:1F90", "0.0.0.0", 8080},
+		{"0F02000A:AFC8", "10.0.2.15", 45000},
+		{"00000000000000000000000000000000:0016", "::", 22},
+		{"00000000000000000000000001000000:0277", "::1", 631},
+		{"000080FE000000000000000001000000:0050", "fe80::1", 80},
+		// IPv4-mapped addresses are shown as IPv4
+		{"0000000000000000FFFF00000100007F:01BB", "127.0.0.1", 443},
+	}
+	for _, tt := range tests {
+		address, port, err := parseProcNetAddress(tt.raw)
+		if err != nil {
+			t.Errorf("%s: %v", tt.raw, err)
+			continue
+		}
+		if address != tt.address || port != tt.port {
+			t.Errorf("%s: got %s port %d, want %s port %d", tt.raw, address, port, tt.address, tt.port)
+		}
+	}
+
+	for _, raw := range []string{"", "0100007F", "0100:0035", "ZZ00007F:0035", "0100007F:GGGG", "0100007F:10000"} {
+		if address, port, err := parseProcNetAddress(raw); err == nil {
+			t.Errorf("%q: got %s port %d, want an error", raw, address, port)
+		}
+	}
+}
+
+func TestDiffStrings(t *testing.T) {
+	tests := []struct {
+		a, b           []string
+		added, removed []string
+	}{
+		{nil, nil, nil, nil},
+		{[]string{"10.0.0.1/24"}, []string{"10.0.0.1/24"}, nil, nil},
+		{nil, []string{"10.0.0.1/24"}, []string{"10.0.0.1/24"}, nil},
+		{[]string{"10.0.0.1/24", "fe80::1/64"}, []string{"fe80::1/64", "10.0.0.2/24"}, []string{"10.0.0.2/24"}, []string{"10.0.0.1/24"}},
+		{[]string{"a", "b"}, nil, nil, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		added, removed := diffStrings(tt.a, tt.b)
+		if !reflect.DeepEqual(added, tt.added) || !reflect.DeepEqual(removed, tt.removed) {
+			t.Errorf("diffStrings(%q, %q) = %q, %q; want %q, %q", tt.a, tt.b, added, removed, tt.added, tt.removed)
+		}
+	}
+}
+
+func TestReadProcNetSockets(t *testing.T) {
+	sockets := make(map[string]*listener)
+	if err := readProcNetSockets("testdata/network/udp", "udp", udpUnconnectedState, sockets); err != nil {
+		t.Fatal(err)
+	}
+
+	// Connected sockets and sockets with a remote address are not listeners
+	var keys []string
+	for key := range sockets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if want := []string{"udp 0.0.0.0:68", "udp 10.0.2.15:45000", "udp 127.0.0.53:53"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %q, want %q", keys, want)
+	}
+	if l := sockets["udp 127.0.0.53:53"]; l == nil || l.Inode != 21001 || l.Port != 53 {
+		t.Errorf("resolver socket = %+v", l)
+	}
+}
+
+func TestReadListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+
+	tcpKey := "tcp " + tcp.Addr().String()
+	udpPort := udp.LocalAddr().(*net.UDPAddr).Port
+	udpKey := "udp " + udp.LocalAddr().String()
+
+	// The UDP socket is bound to an ephemeral port, like a client's
+	ephemeral := portRange{low: udpPort, high: udpPort}
+	listeners, err := readListeners(nil, ephemeral, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := listeners[tcpKey]; l == nil || l.Owner["pid"] != os.Getpid() {
+		t.Errorf("TCP listener = %+v", l)
+	}
+	if l := listeners[udpKey]; l != nil {
+		t.Errorf("UDP socket on an ephemeral port listed: %+v", l)
+	}
+
+	// Expected ports are reported anyway, and owners carry over
+	again, err := readListeners(listeners, ephemeral, []int{udpPort})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := again[udpKey]; l == nil || l.Owner["pid"] != os.Getpid() {
+		t.Errorf("expected UDP socket = %+v", l)
+	}
+	if l := again[tcpKey]; l == nil || !reflect.DeepEqual(l.Owner, listeners[tcpKey].Owner) {
+		t.Errorf("TCP listener after a second read = %+v", l)
+	}
+
+	if ports := readEphemeralPorts(); ports.low <= 0 || ports.high < ports.low || ports.high > 65535 {
+		t.Errorf("ephemeral ports = %+v", ports)
+	}
+}
+
+func TestListenerEvents(t *testing.T) {
+	collector := &SystemEventsCollector{config: config.EventsCollectorConfig{SystemEvents: config.SystemEventsConfig{ExpectedPorts: []int{22}}}, logger: newTestLogger(t)}
+	data := make(chan interface{}, 10)
+	collector.dataChan = data
+	collector.ctx, collector.cancel = context.WithCancel(context.Background())
+	defer collector.cancel()
+
+	ssh := &listener{Protocol: "tcp", Address: "0.0.0.0", Port: 22, Owner: map[string]interface{}{"process": "sshd"}}
+	rogue := &listener{Protocol: "tcp6", Address: "::", Port: 4444}
+	collector.compareListeners(map[string]*listener{ssh.key(): ssh}, map[string]*listener{rogue.key(): rogue})
+
+	events := map[string]*EventData{}
+	for i := 0; i < 2; i++ {
+		event := nextEvent(t, data)
+		events[event.Type] = event
+	}
+	if event := events["listener_opened"]; event == nil || event.Severity != "warning" || event.Title != "Unexpected listening socket: tcp6 [::]:4444" {
+		t.Errorf("opened event = %+v", event)
+	}
+	if event := events["listener_closed"]; event == nil || event.Severity != "info" || event.Tags["process"] != "sshd" {
+		t.Errorf("closed event = %+v", event)
+	}
+}
@@ -0,0 +1,501 @@
+package collectors
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+// Netlink proc connector constants from linux/connector.h and
+// linux/cn_proc.h
+const (
+	netlinkConnector   = 11
+	cnIdxProc          = 1
+	cnValProc          = 1
+	procCnMcastListen  = 1
+	procCnMcastIgnore  = 2
+	procEventExec      = 0x00000002
+	procEventExit      = 0x80000000
+	cnMsgHeaderLen     = 20
+	procEventHeaderLen = 16
+)
+
+// clockTicks is USER_HZ, the unit of process start times in /proc
+const clockTicks = 100
+
+// procInfo describes a running process
+type procInfo struct {
+	pid        int
+	ppid       int
+	name       string
+	uid        uint32
+	user       string
+	cmdline    string
+	startTicks uint64
+	started    time.Time
+}
+
+// procExit holds the exit status of a process, when known
+type procExit struct {
+	code   int
+	signal int
+}
+
+// processEvents tracks running processes between exec and exit
+type processEvents struct {
+	include []*processMatcher
+	exclude []*processMatcher
+	users   map[uint32]string
+	known   map[int]*procInfo
+}
+
+// newProcessEvents compiles the process event filters
+func newProcessEvents(cfg config.SystemEventsConfig) (*processEvents, error) {
+	include, err := compileProcessMatchers(cfg.ProcessInclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid process include: %w", err)
+	}
+	exclude, err := compileProcessMatchers(cfg.ProcessExclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid process exclude: %w", err)
+	}
+
+	return &processEvents{
+		include: include,
+		exclude: exclude,
+		users:   make(map[uint32]string),
+		known:   make(map[int]*procInfo),
+	}, nil
+}
+
+// readUptime returns the time since boot from /proc/uptime
+func readUptime() (time.Duration, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("malformed /proc/uptime")
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// readProcStat reads the name, parent and start time of a process
+func readProcStat(pid int) (name string, ppid int, startTicks uint64, err error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return parseProcStat(pid, string(data))
+}
+
+// parseProcStat parses the content of /proc/<pid>/stat
+func parseProcStat(pid int, stat string) (name string, ppid int, startTicks uint64, err error) {
+	// The command name is parenthesized and may itself contain parentheses
+	open, end := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return "", 0, 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	name = stat[open+1 : end]
+
+	// Fields after the name start at field 3 (state); ppid is field 4 and
+	// starttime field 22
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 20 {
+		return "", 0, 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	ppid, _ = strconv.Atoi(fields[1])
+	startTicks, _ = strconv.ParseUint(fields[19], 10, 64)
+	return name, ppid, startTicks, nil
+}
+
+// read returns the details of a running process
+func (pe *processEvents) read(pid int) (*procInfo, error) {
+	name, ppid, startTicks, err := readProcStat(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	procDir := filepath.Join("/proc", strconv.Itoa(pid))
+	info := &procInfo{
+		pid:        pid,
+		ppid:       ppid,
+		name:       name,
+		startTicks: startTicks,
+		started:    time.Now(),
+	}
+	// The boot time in /proc/stat has second precision, so the start time
+	// is derived from the uptime instead
+	if uptime, err := readUptime(); err == nil {
+		info.started = time.Now().Add(time.Duration(startTicks)*time.Second/clockTicks - uptime)
+	}
+
+	if fi, err := os.Stat(procDir); err == nil {
+		if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+			info.uid = stat.Uid
+			info.user = pe.userName(stat.Uid)
+		}
+	}
+	if cmdline, err := os.ReadFile(filepath.Join(procDir, "cmdline")); err == nil {
+		info.cmdline = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	}
+
+	return info, nil
+}
+
+// userName resolves a uid, caching the result
+func (pe *processEvents) userName(uid uint32) string {
+	if name, exists := pe.users[uid]; exists {
+		return name
+	}
+	name := lookupUser(uid)
+	pe.users[uid] = name
+	return name
+}
+
+// filter returns the name of the include rule matching a process, and
+// whether the process produces events at all
+func (pe *processEvents) filter(info *procInfo) (string, bool) {
+	sample := &processSample{pid: int32(info.pid), name: info.name, user: info.user, cmdline: info.cmdline}
+	for _, m := range pe.exclude {
+		if m.matches(sample) {
+			return "", false
+		}
+	}
+	if len(pe.include) == 0 {
+		return "", true
+	}
+	for _, m := range pe.include {
+		if m.matches(sample) {
+			return m.name, true
+		}
+	}
+	return "", false
+}
+
+// listPIDs returns the process ids in /proc
+func listPIDs() ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	pids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// snapshot records all running processes without emitting events
+func (pe *processEvents) snapshot() error {
+	pids, err := listPIDs()
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		if info, err := pe.read(pid); err == nil {
+			pe.known[pid] = info
+		}
+	}
+	return nil
+}
+
+// watchProcesses emits process exec and exit events, from the netlink
+// proc connector when it is available and by diffing snapshots otherwise
+func (sec *SystemEventsCollector) watchProcesses() {
+	defer sec.wg.Done()
+
+	events := sec.processEvents
+	if err := events.snapshot(); err != nil {
+		sec.logger.Error("Failed to list processes", "error", err)
+		sec.setError("processes", fmt.Sprintf("Process events error: %v", err))
+		return
+	}
+
+	source := sec.config.SystemEvents.ProcessSource
+	if source != "poll" {
+		fd, err := openProcConnector()
+		if err == nil {
+			sec.logger.Info("Watching processes via the proc connector")
+			sec.readProcConnector(fd)
+			return
+		}
+		if source == "netlink" {
+			sec.logger.Error("Failed to open proc connector", "error", err)
+			sec.setError("processes", fmt.Sprintf("Process events error: %v", err))
+			return
+		}
+		sec.logger.Info("Proc connector unavailable, polling processes", "error", err)
+	}
+
+	sec.pollProcesses()
+}
+
+// pollProcesses diffs process snapshots at the configured interval. Exit
+// codes are not available in this mode.
+func (sec *SystemEventsCollector) pollProcesses() {
+	events := sec.processEvents
+	ticker := time.NewTicker(sec.config.SystemEvents.ProcessInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sec.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pids, err := listPIDs()
+		if err != nil {
+			sec.logger.Error("Failed to list processes", "error", err)
+			sec.setError("processes", fmt.Sprintf("Process events error: %v", err))
+			continue
+		}
+
+		current := make(map[int]bool, len(pids))
+		for _, pid := range pids {
+			_, _, startTicks, err := readProcStat(pid)
+			if err != nil {
+				continue
+			}
+			current[pid] = true
+
+			previous, exists := events.known[pid]
+			if exists && previous.startTicks == startTicks {
+				continue
+			}
+			// A reused pid means the previous process has exited
+			if exists {
+				sec.processExited(previous, nil, "poll")
+			}
+			if info, err := events.read(pid); err == nil {
+				sec.processExecuted(info, "poll")
+			}
+		}
+
+		for pid, info := range events.known {
+			if !current[pid] {
+				sec.processExited(info, nil, "poll")
+			}
+		}
+	}
+}
+
+// openProcConnector subscribes to process events from the kernel. This
+// requires CAP_NET_ADMIN.
+func openProcConnector() (int, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, netlinkConnector)
+	if err != nil {
+		return -1, fmt.Errorf("failed to create netlink socket: %w", err)
+	}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: cnIdxProc}); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+
+	// A receive timeout lets the reader notice cancellation
+	timeout := syscall.Timeval{Sec: 1}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("failed to set netlink timeout: %w", err)
+	}
+
+	if err := sendProcConnectorOp(fd, procCnMcastListen); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("failed to subscribe to proc events: %w", err)
+	}
+	return fd, nil
+}
+
+// sendProcConnectorOp sends a multicast listen or ignore request. Netlink
+// uses host byte order; supported platforms are little-endian.
+func sendProcConnectorOp(fd int, op uint32) error {
+	msg := make([]byte, syscall.NLMSG_HDRLEN+cnMsgHeaderLen+4)
+	order := binary.LittleEndian
+
+	order.PutUint32(msg[0:], uint32(len(msg)))
+	order.PutUint16(msg[4:], syscall.NLMSG_DONE)
+	order.PutUint32(msg[12:], uint32(os.Getpid()))
+
+	cn := msg[syscall.NLMSG_HDRLEN:]
+	order.PutUint32(cn[0:], cnIdxProc)
+	order.PutUint32(cn[4:], cnValProc)
+	order.PutUint16(cn[16:], 4)
+	order.PutUint32(cn[cnMsgHeaderLen:], op)
+
+	return syscall.Sendto(fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+}
+
+// readProcConnector handles exec and exit notifications until cancelled
+func (sec *SystemEventsCollector) readProcConnector(fd int) {
+	defer func() {
+		sendProcConnectorOp(fd, procCnMcastIgnore)
+		syscall.Close(fd)
+	}()
+
+	events := sec.processEvents
+	order := binary.LittleEndian
+	buf := make([]byte, 16*1024)
+
+	for {
+		if sec.ctx.Err() != nil {
+			return
+		}
+
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+			// ENOBUFS means events were dropped; keep reading
+			if err == syscall.ENOBUFS {
+				sec.logger.Warn("Proc connector receive buffer overrun, events lost")
+				continue
+			}
+			sec.logger.Error("Failed to read proc connector", "error", err)
+			sec.setError("processes", fmt.Sprintf("Process events error: %v", err))
+			return
+		}
+
+		messages, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		for _, msg := range messages {
+			data := msg.Data
+			if len(data) < cnMsgHeaderLen+procEventHeaderLen+8 {
+				continue
+			}
+			event := data[cnMsgHeaderLen:]
+			what := order.Uint32(event[0:])
+			body := event[procEventHeaderLen:]
+
+			switch what {
+			case procEventExec:
+				pid, tgid := int(order.Uint32(body[0:])), int(order.Uint32(body[4:]))
+				if pid != tgid {
+					continue
+				}
+				if info, err := events.read(pid); err == nil {
+					sec.processExecuted(info, "netlink")
+				}
+
+			case procEventExit:
+				if len(body) < 16 {
+					continue
+				}
+				pid, tgid := int(order.Uint32(body[0:])), int(order.Uint32(body[4:]))
+				if pid != tgid {
+					continue
+				}
+				info, exists := events.known[pid]
+				if !exists {
+					continue
+				}
+				status := order.Uint32(body[8:])
+				sec.processExited(info, &procExit{code: int(status>>8) & 0xff, signal: int(status & 0x7f)}, "netlink")
+			}
+		}
+	}
+}
+
+// processExecuted records a started process and emits its exec event
+func (sec *SystemEventsCollector) processExecuted(info *procInfo, source string) {
+	events := sec.processEvents
+	events.known[info.pid] = info
+
+	if rule, ok := events.filter(info); ok {
+		sec.sendProcessEvent("process_exec", info, nil, rule, source)
+	}
+}
+
+// processExited forgets an exited process and emits its exit event
+func (sec *SystemEventsCollector) processExited(info *procInfo, exit *procExit, source string) {
+	events := sec.processEvents
+	delete(events.known, info.pid)
+
+	if rule, ok := events.filter(info); ok {
+		sec.sendProcessEvent("process_exit", info, exit, rule, source)
+	}
+}
+
+// sendProcessEvent sends a process exec or exit event
+func (sec *SystemEventsCollector) sendProcessEvent(eventType string, info *procInfo, exit *procExit, rule, source string) {
+	data := map[string]interface{}{
+		"pid":        info.pid,
+		"ppid":       info.ppid,
+		"process":    info.name,
+		"user":       info.user,
+		"uid":        info.uid,
+		"cmdline":    info.cmdline,
+		"start_time": info.started.Format(time.RFC3339Nano),
+		"source":     source,
+	}
+	tags := map[string]string{"process": info.name}
+	if rule != "" {
+		data["rule"] = rule
+		tags["rule"] = rule
+	}
+
+	severity := "info"
+	title := fmt.Sprintf("Process started: %s (pid %d)", info.name, info.pid)
+	if eventType == "process_exit" {
+		data["lifetime_seconds"] = time.Since(info.started).Seconds()
+		title = fmt.Sprintf("Process exited: %s (pid %d)", info.name, info.pid)
+		if exit != nil {
+			data["exit_code"] = exit.code
+			severity = processExitSeverity(exit)
+			if exit.signal != 0 {
+				data["signal"] = exit.signal
+				data["signal_name"] = syscall.Signal(exit.signal).String()
+				title += fmt.Sprintf(" killed by signal %d (%s)", exit.signal, syscall.Signal(exit.signal))
+			} else {
+				title += fmt.Sprintf(" with code %d", exit.code)
+			}
+		}
+	}
+
+	event := &EventData{
+		ID:        fmt.Sprintf("process-%d-%d", info.pid, time.Now().UnixNano()),
+		Type:      eventType,
+		Category:  "process",
+		Severity:  severity,
+		Title:     title,
+		Data:      data,
+		Tags:      tags,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+
+	sec.logger.Debug(title, "cmdline", info.cmdline, "user", info.user)
+
+	sec.sendEvent("process", event)
+}
+
+// processExitSeverity maps an exit status to an event severity
+func processExitSeverity(exit *procExit) string {
+	switch syscall.Signal(exit.signal) {
+	case syscall.SIGSEGV, syscall.SIGABRT, syscall.SIGBUS, syscall.SIGILL, syscall.SIGFPE, syscall.SIGKILL:
+		return "error"
+	}
+	if exit.code != 0 || exit.signal != 0 {
+		return "warning"
+	}
+	return "info"
+}
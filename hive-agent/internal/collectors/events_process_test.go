@@ -0,0 +1,188 @@
+package collectors
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+// statLine builds a /proc/<pid>/stat line with the given name, parent and
+// start time
+func statLine(pid int, name string, ppid int, startTicks uint64) string {
+	fields := []string{"S", strconv.Itoa(ppid)}
+	for len(fields) < 19 {
+		fields = append(fields, "0")
+	}
+	fields = append(fields, strconv.FormatUint(startTicks, 10), "1234567", "89")
+	return strconv.Itoa(pid) + " (" + name + ") " + strings.Join(fields, " ") + "\n"
+}
+
+func TestParseProcStat(t *testing.T) {
+	tests := []struct {
+		name       string
+		ppid       int
+		startTicks uint64
+	}{
+		{"nginx", 1, 4242},
+		{"(sd-pam)", 1, 7},
+		{"a) S 1 (b", 77, 99},
+		{"with space", 2, 100},
+		{"", 3, 1},
+	}
+	for _, tt := range tests {
+		name, ppid, startTicks, err := parseProcStat(10, statLine(10, tt.name, tt.ppid, tt.startTicks))
+		if err != nil {
+			t.Errorf("%q: %v", tt.name, err)
+			continue
+		}
+		if name != tt.name || ppid != tt.ppid || startTicks != tt.startTicks {
+			t.Errorf("%q: got %q, %d, %d", tt.name, name, ppid, startTicks)
+		}
+	}
+
+	for _, stat := range []string{
+		"",
+		"10 nginx S 1",
+		"10 (nginx S 1 2 3",
+		"10 (nginx) S 1 2 3",
+	} {
+		if _, _, _, err := parseProcStat(10, stat); err == nil {
+			t.Errorf("%q: expected an error", stat)
+		}
+	}
+}
+
+func TestReadProcStat(t *testing.T) {
+	// The kernel takes the name from the executable, parentheses included
+	binary := filepath.Join(t.TempDir(), "x) (y")
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not found")
+	}
+	content, err := os.ReadFile(sleep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binary, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(binary, "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	name, ppid, startTicks, err := readProcStat(cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "x) (y" || ppid != os.Getpid() || startTicks == 0 {
+		t.Errorf("got %q, %d, %d", name, ppid, startTicks)
+	}
+
+	if _, _, _, err := readProcStat(-1); err == nil {
+		t.Error("expected an error for a missing process")
+	}
+}
+
+func TestProcessExitSeverity(t *testing.T) {
+	tests := []struct {
+		exit procExit
+		want string
+	}{
+		{procExit{code: 0}, "info"},
+		{procExit{code: 1}, "warning"},
+		{procExit{signal: int(syscall.SIGTERM)}, "warning"},
+		{procExit{signal: int(syscall.SIGHUP)}, "warning"},
+		{procExit{signal: int(syscall.SIGSEGV)}, "error"},
+		{procExit{signal: int(syscall.SIGABRT)}, "error"},
+		{procExit{signal: int(syscall.SIGKILL)}, "error"},
+		{procExit{signal: int(syscall.SIGBUS)}, "error"},
+	}
+	for _, tt := range tests {
+		if got := processExitSeverity(&tt.exit); got != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.exit, got, tt.want)
+		}
+	}
+}
+
+func TestProcessEventsFilter(t *testing.T) {
+	events, err := newProcessEvents(config.SystemEventsConfig{
+		ProcessInclude: []config.ProcessMatchConfig{{Name: "web", Process: "nginx"}, {Cmdline: "^java .*app\\.jar"}},
+		ProcessExclude: []config.ProcessMatchConfig{{User: "nobody"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		info procInfo
+		rule string
+		ok   bool
+	}{
+		{procInfo{name: "nginx", user: "www-data"}, "web", true},
+		{procInfo{name: "nginx", user: "nobody"}, "", false},
+		{procInfo{name: "java", cmdline: "java -jar app.jar"}, `cmdline=^java .*app\.jar`, true},
+		{procInfo{name: "bash"}, "", false},
+	}
+	for _, tt := range tests {
+		rule, ok := events.filter(&tt.info)
+		if rule != tt.rule || ok != tt.ok {
+			t.Errorf("%+v: got %q, %v", tt.info, rule, ok)
+		}
+	}
+
+	all, err := newProcessEvents(config.SystemEventsConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule, ok := all.filter(&procInfo{name: "bash"}); rule != "" || !ok {
+		t.Errorf("without filters got %q, %v", rule, ok)
+	}
+	if _, err := newProcessEvents(config.SystemEventsConfig{ProcessInclude: []config.ProcessMatchConfig{{Cmdline: "("}}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestProcessEventsPoll(t *testing.T) {
+	_, data := startTestEvents(t, config.EventsCollectorConfig{SystemEvents: config.SystemEventsConfig{
+		Process:         true,
+		ProcessSource:   "poll",
+		ProcessInterval: 50 * time.Millisecond,
+		ProcessInclude:  []config.ProcessMatchConfig{{Name: "sleeper", Cmdline: "^sleep 31337$"}},
+	}})
+	// Let the first snapshot be taken
+	time.Sleep(200 * time.Millisecond)
+
+	cmd := exec.Command("sleep", "31337")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	event := nextEvent(t, data)
+	if event.Type != "process_exec" || event.Data["pid"] != cmd.Process.Pid || event.Data["rule"] != "sleeper" ||
+		event.Data["source"] != "poll" || event.Data["ppid"] != os.Getpid() {
+		t.Errorf("exec event = %+v", event)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	event = nextEvent(t, data)
+	if event.Type != "process_exit" || event.Data["pid"] != cmd.Process.Pid || event.Severity != "info" {
+		t.Errorf("exit event = %+v", event)
+	}
+	// Exit codes are not known when polling
+	if _, exists := event.Data["exit_code"]; exists {
+		t.Errorf("exit event from polling has an exit code: %+v", event)
+	}
+	noEvent(t, data, 200*time.Millisecond)
+}
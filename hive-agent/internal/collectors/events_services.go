@@ -0,0 +1,129 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// watchServices polls systemd unit states and emits an event whenever a
+// watched unit changes state or is restarted between two polls
+func (sec *SystemEventsCollector) watchServices() {
+	defer sec.wg.Done()
+
+	reader := newSystemdReader()
+	defer reader.close()
+
+	ticker := time.NewTicker(sec.config.SystemEvents.ServiceInterval)
+	defer ticker.Stop()
+
+	var previous map[string]systemdUnit
+
+	for {
+		current, err := sec.pollServices(reader)
+		if err != nil {
+			sec.logger.Error("Failed to get systemd unit states", "error", err)
+			sec.setError("services", fmt.Sprintf("Service events error: %v", err))
+		} else {
+			sec.setError("services", "")
+			// The first successful poll only establishes the baseline
+			if previous != nil {
+				sec.compareServices(previous, current)
+			}
+			previous = current
+		}
+
+		select {
+		case <-sec.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollServices returns the current state of all watched units keyed by name
+func (sec *SystemEventsCollector) pollServices(reader *systemdReader) (map[string]systemdUnit, error) {
+	ctx, cancel := context.WithTimeout(sec.ctx, 30*time.Second)
+	defer cancel()
+
+	units, err := reader.units(ctx, sec.config.SystemEvents.ServiceUnits)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]systemdUnit, len(units))
+	for _, unit := range units {
+		current[unit.Name] = unit
+	}
+	return current, nil
+}
+
+// compareServices emits events for units whose state differs between polls
+func (sec *SystemEventsCollector) compareServices(previous, current map[string]systemdUnit) {
+	for name, unit := range current {
+		before, existed := previous[name]
+		if !existed {
+			continue
+		}
+
+		switch {
+		case before.ActiveState != unit.ActiveState || before.SubState != unit.SubState:
+			sec.sendServiceEvent("service_state_change", before, unit,
+				fmt.Sprintf("Service %s changed from %s to %s", name, before.ActiveState, unit.ActiveState))
+		case unit.Restarts > before.Restarts:
+			sec.sendServiceEvent("service_restarted", before, unit,
+				fmt.Sprintf("Service %s restarted %d time(s)", name, unit.Restarts-before.Restarts))
+		}
+	}
+
+	for name, before := range previous {
+		if _, exists := current[name]; !exists {
+			sec.sendServiceEvent("service_removed", before, systemdUnit{Name: name, ActiveState: "unloaded"},
+				fmt.Sprintf("Service %s is no longer loaded", name))
+		}
+	}
+}
+
+// sendServiceEvent sends a service state change event
+func (sec *SystemEventsCollector) sendServiceEvent(eventType string, before, after systemdUnit, title string) {
+	event := &EventData{
+		ID:       fmt.Sprintf("service-%s-%d", after.Name, time.Now().UnixNano()),
+		Type:     eventType,
+		Category: "service",
+		Severity: serviceEventSeverity(eventType, after),
+		Title:    title,
+		Data: map[string]interface{}{
+			"unit":               after.Name,
+			"previous_state":     before.ActiveState,
+			"previous_sub_state": before.SubState,
+			"state":              after.ActiveState,
+			"sub_state":          after.SubState,
+			"restarts":           after.Restarts,
+		},
+		Tags:      map[string]string{"unit": after.Name},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+
+	sec.logger.Info("Service state changed",
+		"unit", after.Name,
+		"from", before.ActiveState,
+		"to", after.ActiveState,
+		"sub_state", after.SubState,
+	)
+
+	sec.sendEvent("systemd", event)
+}
+
+// serviceEventSeverity maps a unit state transition to an event severity
+func serviceEventSeverity(eventType string, unit systemdUnit) string {
+	switch {
+	case unit.ActiveState == "failed":
+		return "critical"
+	case eventType == "service_restarted" || unit.restarting():
+		return "error"
+	case unit.ActiveState == "inactive" || unit.ActiveState == "deactivating" || eventType == "service_removed":
+		return "warning"
+	default:
+		return "info"
+	}
+}
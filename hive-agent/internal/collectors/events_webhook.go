@@ -0,0 +1,323 @@
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// webhookOptions are the options of a webhook custom event
+type webhookOptions struct {
+	Path            string            `yaml:"path"`
+	Secret          string            `yaml:"secret"`
+	SecretFile      string            `yaml:"secret_file"`
+	SignatureHeader string            `yaml:"signature_header"`
+	Template        map[string]string `yaml:"template"` // event field or tags.<name> -> template
+	Severity        string            `yaml:"severity"`
+	MaxBody         int64             `yaml:"max_body"`
+}
+
+// webhookEndpoint receives events for one webhook custom event
+type webhookEndpoint struct {
+	name      string
+	address   string
+	options   webhookOptions
+	secret    []byte
+	templates map[string]*template.Template
+}
+
+// buildWebhookEndpoints builds endpoints from the webhook custom events.
+// Source is the listen address; endpoints may share an address if their
+// paths differ.
+func (sec *SystemEventsCollector) buildWebhookEndpoints() ([]*webhookEndpoint, error) {
+	var endpoints []*webhookEndpoint
+	routes := make(map[string]bool)
+
+	for _, custom := range sec.config.CustomEvents {
+		if custom.Type != "webhook" {
+			continue
+		}
+		if custom.Source == "" {
+			return nil, fmt.Errorf("custom event %s: webhook listen address is required", custom.Name)
+		}
+
+		options := webhookOptions{
+			Path:            "/" + custom.Name,
+			SignatureHeader: "X-Hub-Signature-256",
+			Severity:        "info",
+			MaxBody:         1024 * 1024,
+		}
+		if err := custom.DecodeOptions(&options); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(options.Path, "/") {
+			options.Path = "/" + options.Path
+		}
+		if options.MaxBody <= 0 {
+			return nil, fmt.Errorf("custom event %s: max_body must be positive", custom.Name)
+		}
+
+		route := custom.Source + options.Path
+		if routes[route] {
+			return nil, fmt.Errorf("custom event %s: duplicate webhook endpoint %s", custom.Name, route)
+		}
+		routes[route] = true
+
+		endpoint := &webhookEndpoint{
+			name:      custom.Name,
+			address:   custom.Source,
+			options:   options,
+			templates: make(map[string]*template.Template),
+		}
+
+		secret := options.Secret
+		if options.SecretFile != "" {
+			data, err := os.ReadFile(options.SecretFile)
+			if err != nil {
+				return nil, fmt.Errorf("custom event %s: failed to read secret file: %w", custom.Name, err)
+			}
+			secret = strings.TrimSpace(string(data))
+		}
+		if secret != "" {
+			endpoint.secret = []byte(secret)
+		} else if !loopbackAddress(custom.Source) {
+			// Anyone who can reach the port could raise events
+			return nil, fmt.Errorf("custom event %s: webhooks listening on %s, which is not a loopback address, require a secret or secret_file", custom.Name, custom.Source)
+		}
+
+		for field, text := range options.Template {
+			tmpl, err := template.New(field).Funcs(webhookTemplateFuncs(nil)).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("custom event %s: invalid template for %s: %w", custom.Name, field, err)
+			}
+			endpoint.templates[field] = tmpl
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, nil
+}
+
+// loopbackAddress reports whether a listen address only accepts local
+// connections. An empty host listens on every interface.
+func loopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// webhookTemplateFuncs returns the functions available to templates
+func webhookTemplateFuncs(header http.Header) template.FuncMap {
+	return template.FuncMap{
+		"header": func(name string) string { return header.Get(name) },
+		"json": func(v interface{}) string {
+			data, _ := json.Marshal(v)
+			return string(data)
+		},
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"default": func(fallback string, v interface{}) string {
+			if v == nil || fmt.Sprint(v) == "" {
+				return fallback
+			}
+			return fmt.Sprint(v)
+		},
+	}
+}
+
+// startWebhooks listens on every webhook address. Listen errors are
+// returned so that a misconfigured port fails the collector start.
+func (sec *SystemEventsCollector) startWebhooks() error {
+	muxes := make(map[string]*http.ServeMux)
+	var order []string
+	for _, endpoint := range sec.webhooks {
+		mux, exists := muxes[endpoint.address]
+		if !exists {
+			mux = http.NewServeMux()
+			muxes[endpoint.address] = mux
+			order = append(order, endpoint.address)
+		}
+		mux.Handle(endpoint.options.Path, sec.webhookHandler(endpoint))
+	}
+
+	for _, address := range order {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return fmt.Errorf("failed to listen for webhooks on %s: %w", address, err)
+		}
+
+		server := &http.Server{
+			Handler:           muxes[address],
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      30 * time.Second,
+		}
+
+		sec.wg.Add(1)
+		go sec.serveWebhooks(server, listener)
+		sec.logger.Info("Listening for webhook events", "address", listener.Addr().String())
+	}
+
+	return nil
+}
+
+// serveWebhooks serves a webhook listener until the collector stops
+func (sec *SystemEventsCollector) serveWebhooks(server *http.Server, listener net.Listener) {
+	defer sec.wg.Done()
+
+	go func() {
+		<-sec.ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		sec.logger.Error("Webhook server failed", "address", listener.Addr().String(), "error", err)
+		sec.setError("webhook "+listener.Addr().String(), fmt.Sprintf("Webhook server error: %v", err))
+	}
+}
+
+// webhookHandler verifies, decodes and forwards webhook requests
+func (sec *SystemEventsCollector) webhookHandler(endpoint *webhookEndpoint) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, endpoint.options.MaxBody+1))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > endpoint.options.MaxBody {
+			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if endpoint.secret != nil && !endpoint.verify(body, r.Header.Get(endpoint.options.SignatureHeader)) {
+			sec.logger.Warn("Rejected webhook with invalid signature", "webhook", endpoint.name, "remote", r.RemoteAddr)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var payload interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&payload); err != nil {
+			http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+
+		event, err := endpoint.event(payload, r.Header)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		sec.logger.Debug("Webhook event received", "webhook", endpoint.name, "type", event.Type)
+		sec.sendEvent("webhook", event)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"id": event.ID})
+	})
+}
+
+// verify checks a hex HMAC-SHA256 signature of the body, with or
+// without a sha256= prefix
+func (e *webhookEndpoint) verify(body []byte, signature string) bool {
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	received, err := hex.DecodeString(signature)
+	if err != nil || len(received) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, e.secret)
+	mac.Write(body)
+	return hmac.Equal(received, mac.Sum(nil))
+}
+
+// event maps a payload into an event using the endpoint templates. The
+// payload is kept as the event data.
+func (e *webhookEndpoint) event(payload interface{}, header http.Header) (*EventData, error) {
+	fields := make(map[string]string, len(e.templates))
+	for field, tmpl := range e.templates {
+		// Templates are shared between requests; the header function is
+		// bound on a clone
+		clone, err := tmpl.Clone()
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := clone.Funcs(webhookTemplateFuncs(header)).Execute(&buf, payload); err != nil {
+			return nil, fmt.Errorf("template %s: %v", field, err)
+		}
+		if value := strings.TrimSpace(buf.String()); value != "<no value>" {
+			fields[field] = value
+		}
+	}
+
+	event := &EventData{
+		ID:          fields["id"],
+		Type:        fields["type"],
+		Category:    fields["category"],
+		Severity:    fields["severity"],
+		Title:       fields["title"],
+		Description: fields["description"],
+		Data:        map[string]interface{}{"webhook": e.name},
+		Tags:        map[string]string{"webhook": e.name},
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+	if event.ID == "" {
+		event.ID = fmt.Sprintf("webhook-%s-%d", e.name, time.Now().UnixNano())
+	}
+	if event.Type == "" {
+		event.Type = "webhook"
+	}
+	if event.Category == "" {
+		event.Category = "webhook"
+	}
+	if event.Severity == "" {
+		event.Severity = e.options.Severity
+	}
+	if event.Title == "" {
+		event.Title = fmt.Sprintf("Webhook event from %s", e.name)
+	}
+
+	for field, value := range fields {
+		if name := strings.TrimPrefix(field, "tags."); name != field && value != "" {
+			event.Tags[name] = value
+		}
+	}
+	if object, ok := payload.(map[string]interface{}); ok {
+		for key, value := range object {
+			event.Data[key] = value
+		}
+		event.Data["webhook"] = e.name
+	} else {
+		event.Data["payload"] = payload
+	}
+
+	return event, nil
+}
@@ -0,0 +1,235 @@
+package collectors
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+// testWebhooks builds the endpoints of webhook custom events
+func testWebhooks(t *testing.T, customs ...config.CustomEventConfig) (*SystemEventsCollector, []*webhookEndpoint, error) {
+	t.Helper()
+
+	for i := range customs {
+		customs[i].Type = "webhook"
+	}
+	collector := &SystemEventsCollector{
+		config: config.EventsCollectorConfig{CustomEvents: customs},
+		logger: newTestLogger(t),
+	}
+	endpoints, err := collector.buildWebhookEndpoints()
+	return collector, endpoints, err
+}
+
+// sign returns the X-Hub-Signature-256 value of a body
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookVerify(t *testing.T) {
+	endpoint := &webhookEndpoint{secret: []byte("s3cret")}
+	body := []byte(`{"status":"ok"}`)
+	signature := sign("s3cret", string(body))
+
+	tests := []struct {
+		signature string
+		want      bool
+	}{
+		{signature, true},
+		{strings.TrimPrefix(signature, "sha256="), true},
+		{" " + strings.ToUpper(strings.TrimPrefix(signature, "sha256=")) + " ", true},
+		{sign("other", string(body)), false},
+		{sign("s3cret", `{"status":"failed"}`), false},
+		{"sha256=", false},
+		{"", false},
+		{"sha256=not-hex", false},
+		{signature[:len(signature)-2], false},
+	}
+	for _, tt := range tests {
+		if got := endpoint.verify(body, tt.signature); got != tt.want {
+			t.Errorf("verify(%q) = %v, want %v", tt.signature, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookEvent(t *testing.T) {
+	_, endpoints, err := testWebhooks(t, config.CustomEventConfig{
+		Name:   "deploy",
+		Source: "127.0.0.1:9280",
+		Config: map[string]interface{}{
+			"severity": "notice",
+			"template": map[string]interface{}{
+				"type":         "deployment",
+				"title":        "Deployed {{.service}} {{.version}}",
+				"severity":     `{{if eq .status "failed"}}error{{else}}info{{end}}`,
+				"description":  `{{default "unknown" .missing}} by {{header "X-User" | lower}}`,
+				"tags.service": "{{.service | upper}}",
+				"tags.empty":   "{{.missing}}",
+				"category":     "{{json .version}}",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := endpoints[0]
+
+	header := http.Header{"X-User": []string{"Alice"}}
+	payload := map[string]interface{}{"service": "api", "version": "1.2", "status": "failed"}
+	event, err := endpoint.event(payload, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != "deployment" || event.Title != "Deployed api 1.2" || event.Severity != "error" ||
+		event.Description != "unknown by alice" || event.Category != `"1.2"` {
+		t.Errorf("event = %+v", event)
+	}
+	if len(event.Tags) != 2 || event.Tags["service"] != "API" || event.Tags["webhook"] != "deploy" {
+		t.Errorf("tags = %v", event.Tags)
+	}
+	if event.Data["service"] != "api" || event.Data["webhook"] != "deploy" {
+		t.Errorf("data = %v", event.Data)
+	}
+
+	// Without templates the defaults apply, and non-object payloads are
+	// kept whole
+	plain := &webhookEndpoint{name: "plain", options: webhookOptions{Severity: "info"}}
+	event, err = plain.event([]interface{}{"a", "b"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != "webhook" || event.Category != "webhook" || event.Severity != "info" ||
+		event.Title != "Webhook event from plain" || !strings.HasPrefix(event.ID, "webhook-plain-") || event.Data["payload"] == nil {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	collector, endpoints, err := testWebhooks(t, config.CustomEventConfig{
+		Name:   "alerts",
+		Source: "0.0.0.0:9280",
+		Config: map[string]interface{}{
+			"secret_file": secretFile,
+			"max_body":    64,
+			"template":    map[string]interface{}{"title": "{{.title}}", "severity": "{{.level.name}}"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(chan interface{}, 10)
+	collector.dataChan = data
+	collector.ctx, collector.cancel = context.WithCancel(context.Background())
+	defer collector.cancel()
+	handler := collector.webhookHandler(endpoints[0])
+
+	post := func(method, body, signature string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/alerts", strings.NewReader(body))
+		if signature != "" {
+			request.Header.Set("X-Hub-Signature-256", signature)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	body := `{"title":"disk full","level":{"name":"critical"}}`
+	response := post(http.MethodPost, body, sign("s3cret", body))
+	if response.Code != http.StatusAccepted {
+		t.Fatalf("got %d: %s", response.Code, response.Body)
+	}
+	var accepted map[string]string
+	json.NewDecoder(response.Body).Decode(&accepted)
+	event := nextEvent(t, data)
+	if event.Title != "disk full" || event.Severity != "critical" || accepted["id"] != event.ID {
+		t.Errorf("event = %+v, response %v", event, accepted)
+	}
+
+	long := `{"title":"` + strings.Repeat("x", 64) + `"}`
+	tests := []struct {
+		name      string
+		method    string
+		body      string
+		signature string
+		code      int
+	}{
+		{"get", http.MethodGet, "", "", http.StatusMethodNotAllowed},
+		{"unsigned", http.MethodPost, body, "", http.StatusUnauthorized},
+		{"wrong secret", http.MethodPost, body, sign("guess", body), http.StatusUnauthorized},
+		// The limit applies before the signature is checked
+		{"too large", http.MethodPost, long, sign("s3cret", long), http.StatusRequestEntityTooLarge},
+		{"invalid JSON", http.MethodPost, "{", sign("s3cret", "{"), http.StatusBadRequest},
+		{"template error", http.MethodPost, `{"level":"flat"}`, sign("s3cret", `{"level":"flat"}`), http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if response := post(tt.method, tt.body, tt.signature); response.Code != tt.code {
+				t.Errorf("got %d, want %d: %s", response.Code, tt.code, response.Body)
+			}
+		})
+	}
+	noEvent(t, data, 50*time.Millisecond)
+
+	// A body of exactly max_body bytes is accepted
+	exact := `{"title":"` + strings.Repeat("x", 64-len(`{"title":""}`)) + `"}`
+	if response := post(http.MethodPost, exact, sign("s3cret", exact)); response.Code != http.StatusAccepted {
+		t.Errorf("body of max_body bytes: got %d", response.Code)
+	}
+}
+
+func TestBuildWebhookEndpoints(t *testing.T) {
+	_, endpoints, err := testWebhooks(t,
+		config.CustomEventConfig{Name: "a", Source: "127.0.0.1:9280"},
+		config.CustomEventConfig{Name: "b", Source: "127.0.0.1:9280", Config: map[string]interface{}{"path": "hooks/b"}},
+		config.CustomEventConfig{Name: "c", Source: "[::1]:9280"},
+		config.CustomEventConfig{Name: "d", Source: "localhost:9281"},
+		config.CustomEventConfig{Name: "e", Source: ":9282", Config: map[string]interface{}{"secret": "s3cret"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoints[0].options.Path != "/a" || endpoints[1].options.Path != "/hooks/b" || endpoints[0].options.MaxBody != 1024*1024 {
+		t.Errorf("unexpected options %+v, %+v", endpoints[0].options, endpoints[1].options)
+	}
+	if endpoints[0].secret != nil || string(endpoints[4].secret) != "s3cret" {
+		t.Error("secrets not applied")
+	}
+
+	invalid := map[string]config.CustomEventConfig{
+		"no address":            {Name: "a"},
+		"unauthenticated":       {Name: "a", Source: ":9280"},
+		"unauthenticated on IP": {Name: "a", Source: "10.0.0.1:9280"},
+		"missing secret file":   {Name: "a", Source: "127.0.0.1:9280", Config: map[string]interface{}{"secret_file": "/nonexistent"}},
+		"invalid template":      {Name: "a", Source: "127.0.0.1:9280", Config: map[string]interface{}{"template": map[string]interface{}{"title": "{{"}}},
+		"undefined function":    {Name: "a", Source: "127.0.0.1:9280", Config: map[string]interface{}{"template": map[string]interface{}{"title": "{{.title | bad}}"}}},
+		"no body":               {Name: "a", Source: "127.0.0.1:9280", Config: map[string]interface{}{"max_body": 0}},
+	}
+	for name, custom := range invalid {
+		if _, _, err := testWebhooks(t, custom); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, _, err := testWebhooks(t,
+		config.CustomEventConfig{Name: "a", Source: "127.0.0.1:9280", Config: map[string]interface{}{"path": "/x"}},
+		config.CustomEventConfig{Name: "b", Source: "127.0.0.1:9280", Config: map[string]interface{}{"path": "/x"}},
+	); err == nil {
+		t.Error("expected an error for a duplicate endpoint")
+	}
+}
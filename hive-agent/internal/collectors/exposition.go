@@ -0,0 +1,294 @@
+package collectors
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// metricFamily is a group of samples sharing a metric name, type and help
+// text in the Prometheus text or OpenMetrics exposition format
+type metricFamily struct {
+	Name    string
+	Type    string // counter, gauge, histogram, gaugehistogram, summary, info, stateset, untyped, unknown
+	Help    string
+	Unit    string
+	Samples []expositionSample
+}
+
+// expositionSample is a single sample line
+type expositionSample struct {
+	Name         string
+	Labels       map[string]string
+	Value        float64
+	TimestampMs  int64
+	HasTimestamp bool
+}
+
+// familySuffixes are the sample name suffixes that belong to a family of
+// the given type
+var familySuffixes = map[string][]string{
+	"counter":        {"_total", "_created"},
+	"histogram":      {"_bucket", "_sum", "_count", "_created"},
+	"gaugehistogram": {"_bucket", "_gsum", "_gcount"},
+	"summary":        {"_sum", "_count", "_created"},
+	"info":           {"_info"},
+}
+
+// parseExposition parses a Prometheus text format (0.0.4) or OpenMetrics
+// exposition into metric families, in the order they appear
+func parseExposition(r io.Reader, openMetrics bool) ([]*metricFamily, error) {
+	var families []*metricFamily
+	byName := make(map[string]*metricFamily)
+
+	family := func(name string) *metricFamily {
+		if f, exists := byName[name]; exists {
+			return f
+		}
+		f := &metricFamily{Name: name, Type: "untyped"}
+		if openMetrics {
+			f.Type = "unknown"
+		}
+		byName[name] = f
+		families = append(families, f)
+		return f
+	}
+
+	var current *metricFamily
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+			if len(fields) < 2 {
+				// "# EOF" and plain comments
+				continue
+			}
+			switch fields[0] {
+			case "TYPE":
+				if len(fields) < 3 {
+					return nil, fmt.Errorf("line %d: missing metric type", lineNo)
+				}
+				current = family(fields[1])
+				current.Type = strings.ToLower(strings.TrimSpace(fields[2]))
+			case "HELP":
+				current = family(fields[1])
+				if len(fields) == 3 {
+					current.Help = unescapeHelp(fields[2])
+				}
+			case "UNIT":
+				current = family(fields[1])
+				if len(fields) == 3 {
+					current.Unit = fields[2]
+				}
+			}
+			continue
+		}
+
+		sample, err := parseSampleLine(line, openMetrics)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		// Samples normally follow their family's metadata; fall back to a
+		// lookup by base name, then to an untyped family of their own
+		target := current
+		if target == nil || !target.owns(sample.Name) {
+			target = nil
+			for _, f := range families {
+				if f.owns(sample.Name) {
+					target = f
+					break
+				}
+			}
+			if target == nil {
+				target = family(sample.Name)
+			}
+		}
+		target.Samples = append(target.Samples, sample)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return families, nil
+}
+
+// owns reports whether a sample name belongs to this family
+func (f *metricFamily) owns(name string) bool {
+	if name == f.Name {
+		return true
+	}
+	if !strings.HasPrefix(name, f.Name) {
+		return false
+	}
+	suffix := name[len(f.Name):]
+	for _, s := range familySuffixes[f.Type] {
+		if suffix == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSampleLine parses `name{label="value",...} value [timestamp]`
+// with an optional OpenMetrics exemplar, which is ignored
+func parseSampleLine(line string, openMetrics bool) (expositionSample, error) {
+	var sample expositionSample
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return sample, fmt.Errorf("invalid sample %q", line)
+	}
+	sample.Name = line[:end]
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		labels, n, err := parseLabels(rest)
+		if err != nil {
+			return sample, err
+		}
+		sample.Labels = labels
+		rest = rest[n:]
+	}
+
+	// Drop the exemplar, which follows the label set
+	if openMetrics {
+		if idx := strings.Index(rest, " # {"); idx >= 0 {
+			rest = rest[:idx]
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, fmt.Errorf("invalid sample %q", line)
+	}
+
+	value, err := parseExpositionFloat(fields[0])
+	if err != nil {
+		return sample, fmt.Errorf("invalid value %q: %w", fields[0], err)
+	}
+	sample.Value = value
+
+	if len(fields) == 2 {
+		if openMetrics {
+			// OpenMetrics timestamps are seconds
+			seconds, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return sample, fmt.Errorf("invalid timestamp %q: %w", fields[1], err)
+			}
+			sample.TimestampMs = int64(seconds * 1000)
+		} else {
+			ms, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return sample, fmt.Errorf("invalid timestamp %q: %w", fields[1], err)
+			}
+			sample.TimestampMs = ms
+		}
+		sample.HasTimestamp = true
+	}
+
+	return sample, nil
+}
+
+// parseLabels parses a `{name="value",...}` label set and returns the
+// number of bytes consumed
+func parseLabels(s string) (map[string]string, int, error) {
+	labels := make(map[string]string)
+	i := 1 // skip '{'
+
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("unterminated label set")
+		}
+		if s[i] == '}' {
+			return labels, i + 1, nil
+		}
+
+		start := i
+		for i < len(s) && s[i] != '=' && s[i] != ' ' {
+			i++
+		}
+		name := s[start:i]
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if name == "" || i >= len(s) || s[i] != '=' {
+			return nil, 0, fmt.Errorf("invalid label near %q", s[start:])
+		}
+		i++
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) || s[i] != '"' {
+			return nil, 0, fmt.Errorf("invalid label near %q", s[start:])
+		}
+		i++
+
+		var value strings.Builder
+		closed := false
+		for i < len(s) {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				switch s[i+1] {
+				case 'n':
+					value.WriteByte('\n')
+				case '"', '\\':
+					value.WriteByte(s[i+1])
+				default:
+					value.WriteByte('\\')
+					value.WriteByte(s[i+1])
+				}
+				i += 2
+				continue
+			}
+			if c == '"' {
+				closed = true
+				i++
+				break
+			}
+			value.WriteByte(c)
+			i++
+		}
+		if !closed {
+			return nil, 0, fmt.Errorf("unterminated value for label %s", name)
+		}
+		labels[name] = value.String()
+	}
+}
+
+// parseExpositionFloat parses a sample value including NaN and infinities
+func parseExpositionFloat(s string) (float64, error) {
+	switch s {
+	case "+Inf", "Inf", "+inf", "inf":
+		return math.Inf(1), nil
+	case "-Inf", "-inf":
+		return math.Inf(-1), nil
+	case "NaN", "nan":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// unescapeHelp unescapes a HELP docstring
+func unescapeHelp(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\"`, `"`).Replace(s)
+}
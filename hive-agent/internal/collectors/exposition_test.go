@@ -0,0 +1,172 @@
+package collectors
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+func TestParseExpositionText(t *testing.T) {
+	input := `# HELP http_requests_total Requests served\nby path, with a \\ backslash
+# TYPE http_requests_total counter
+http_requests_total{method="GET",path="/a\"b\\c\nd"} 1027 1395066363000
+http_requests_total{ method = "POST" ,} 3
+
+# A plain comment
+# TYPE temperature gauge
+temperature -Inf
+orphan_metric NaN
+`
+	families, err := parseExposition(strings.NewReader(input), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 3 {
+		t.Fatalf("got %d families, want 3", len(families))
+	}
+
+	requests := families[0]
+	if requests.Name != "http_requests_total" || requests.Type != "counter" {
+		t.Errorf("family = %s %s", requests.Name, requests.Type)
+	}
+	if requests.Help != "Requests served\nby path, with a \\ backslash" {
+		t.Errorf("help = %q", requests.Help)
+	}
+	want := []expositionSample{
+		{Name: "http_requests_total", Labels: map[string]string{"method": "GET", "path": "/a\"b\\c\nd"}, Value: 1027, TimestampMs: 1395066363000, HasTimestamp: true},
+		{Name: "http_requests_total", Labels: map[string]string{"method": "POST"}, Value: 3},
+	}
+	if !reflect.DeepEqual(requests.Samples, want) {
+		t.Errorf("samples = %+v, want %+v", requests.Samples, want)
+	}
+
+	if value := families[1].Samples[0].Value; !math.IsInf(value, -1) {
+		t.Errorf("temperature = %v, want -Inf", value)
+	}
+
+	// Samples without metadata get an untyped family of their own
+	orphan := families[2]
+	if orphan.Name != "orphan_metric" || orphan.Type != "untyped" || !math.IsNaN(orphan.Samples[0].Value) {
+		t.Errorf("orphan family = %+v", orphan)
+	}
+}
+
+func TestParseExpositionOpenMetrics(t *testing.T) {
+	input := `# TYPE rpc_duration_seconds histogram
+# UNIT rpc_duration_seconds seconds
+rpc_duration_seconds_bucket{le="0.1"} 8 # {trace_id="abc123"} 0.054 1700000000.5
+rpc_duration_seconds_bucket{le="+Inf"} 10
+rpc_duration_seconds_sum 1.5
+rpc_duration_seconds_count 10
+rpc_duration_seconds_created 1700000000.25
+# TYPE jobs counter
+jobs_total 42 1700000001.5 # {job="x"} 1
+jobs_created 1700000000
+# TYPE build info
+build_info{version="1.2.3",note="a # {b}"} 1
+# EOF
+`
+	families, err := parseExposition(strings.NewReader(input), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 3 {
+		t.Fatalf("got %d families, want 3", len(families))
+	}
+
+	histogram := families[0]
+	if histogram.Type != "histogram" || histogram.Unit != "seconds" || len(histogram.Samples) != 5 {
+		t.Fatalf("histogram family = %+v", histogram)
+	}
+	// The exemplar is not part of the sample
+	if bucket := histogram.Samples[0]; bucket.Value != 8 || bucket.HasTimestamp || bucket.Labels["le"] != "0.1" {
+		t.Errorf("bucket = %+v", bucket)
+	}
+	if created := histogram.Samples[4]; created.Name != "rpc_duration_seconds_created" || created.Value != 1700000000.25 {
+		t.Errorf("created sample = %+v", created)
+	}
+
+	counter := families[1]
+	if len(counter.Samples) != 2 || counter.Samples[1].Name != "jobs_created" {
+		t.Fatalf("counter family = %+v", counter)
+	}
+	// OpenMetrics timestamps are in seconds
+	if total := counter.Samples[0]; total.Value != 42 || total.TimestampMs != 1700000001500 {
+		t.Errorf("jobs_total = %+v", total)
+	}
+
+	if info := families[2]; info.Type != "info" || info.Samples[0].Labels["note"] != "a # {b}" {
+		t.Errorf("info family = %+v", info)
+	}
+}
+
+func TestParseSampleLineInvalid(t *testing.T) {
+	lines := []string{
+		"{a=\"b\"} 1",
+		"metric",
+		"metric one",
+		"metric 1 2 3",
+		"metric 1 soon",
+		`metric{a="b"`,
+		`metric{a="b} 1`,
+		`metric{a=b} 1`,
+		`metric{="b"} 1`,
+	}
+	for _, line := range lines {
+		if sample, err := parseSampleLine(line, false); err == nil {
+			t.Errorf("%q: expected an error, got %+v", line, sample)
+		}
+	}
+
+	if _, err := parseExposition(strings.NewReader("# TYPE metric\n"), false); err == nil {
+		t.Error("expected an error for a TYPE line without a type")
+	}
+}
+
+func TestScrapeSendFamilies(t *testing.T) {
+	target, err := newScrapeTarget(config.ScrapeTargetConfig{Name: "app", URL: "http://app:9100/metrics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(chan interface{}, 100)
+	sc := &ScrapeCollector{dataChan: data, ctx: context.Background()}
+
+	input := `# TYPE jobs counter
+jobs_total{queue="a"} 3
+jobs_created{queue="a"} 1700000000
+# TYPE temperature gauge
+temperature{sensor="ok"} 21.5
+temperature{sensor="broken"} NaN
+temperature{sensor="pegged"} +Inf
+# TYPE latency histogram
+latency_bucket{le="1"} 2
+latency_bucket{le="+Inf"} 3
+latency_sum 2.5
+latency_count 3
+latency_created 1700000000
+# EOF
+`
+	families, err := parseExposition(strings.NewReader(input), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent := sc.sendFamilies(target, families, time.Now()); sent != 3 {
+		t.Errorf("sent %d series, want 3", sent)
+	}
+
+	metrics := drainMetrics(data)
+	for _, key := range []string{
+		"jobs_total{instance=app:9100,job=app,queue=a}",
+		"temperature{instance=app:9100,job=app,sensor=ok}",
+		"latency{instance=app:9100,job=app}",
+	} {
+		if _, exists := metrics[key]; !exists {
+			t.Errorf("missing %s in %v", key, metrics)
+		}
+	}
+}
@@ -27,6 +27,18 @@ type HealthStatus struct {
 	Timestamp string            `json:"timestamp"`
 }
 
+// FileWatcher is implemented by collectors that tail files
+type FileWatcher interface {
+	// WatchedFiles returns the files being tailed and their read offsets
+	WatchedFiles() []WatchedFile
+}
+
+// WatchedFile is a file tailed by a collector
+type WatchedFile struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+}
+
 // DataType represents the type of data collected
 type DataType string
 
@@ -60,13 +72,58 @@ type LogData struct {
 // MetricData represents metric data
 type MetricData struct {
 	Name      string            `json:"name"`
-	Type      string            `json:"type"` // counter, gauge, histogram
-	Value     interface{}       `json:"value"`
+	Type      string            `json:"type"`  // counter, gauge, histogram, exponential_histogram, summary
+	Value     interface{}       `json:"value"` // number, or *HistogramValue, *ExponentialHistogramValue, *SummaryValue
 	Labels    map[string]string `json:"labels,omitempty"`
 	Timestamp string            `json:"timestamp"`
 	Unit      string            `json:"unit,omitempty"`
 }
 
+// HistogramValue is the value of a histogram metric with explicit bucket
+// bounds. Counts holds one non-cumulative count per bucket, so it has one
+// more entry than Bounds; the last bucket is unbounded.
+type HistogramValue struct {
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+	Min    *float64  `json:"min,omitempty"`
+	Max    *float64  `json:"max,omitempty"`
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+}
+
+// ExponentialHistogramValue is the value of a base-2 exponential histogram.
+// Bucket index i covers (base^i, base^(i+1)] where base = 2^(2^-Scale).
+type ExponentialHistogramValue struct {
+	Count     uint64                      `json:"count"`
+	Sum       float64                     `json:"sum"`
+	Min       *float64                    `json:"min,omitempty"`
+	Max       *float64                    `json:"max,omitempty"`
+	Scale     int32                       `json:"scale"`
+	ZeroCount uint64                      `json:"zero_count"`
+	Positive  ExponentialHistogramBuckets `json:"positive"`
+	Negative  ExponentialHistogramBuckets `json:"negative"`
+}
+
+// ExponentialHistogramBuckets holds consecutive bucket counts starting at
+// bucket index Offset
+type ExponentialHistogramBuckets struct {
+	Offset int32    `json:"offset"`
+	Counts []uint64 `json:"counts"`
+}
+
+// SummaryValue is the value of a summary metric with precomputed quantiles
+type SummaryValue struct {
+	Count     uint64          `json:"count"`
+	Sum       float64         `json:"sum"`
+	Quantiles []QuantileValue `json:"quantiles"`
+}
+
+// QuantileValue is a single summary quantile, with Quantile in [0, 1]
+type QuantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
 // TraceData represents trace data
 type TraceData struct {
 	TraceID    string                 `json:"trace_id"`
@@ -0,0 +1,401 @@
+package collectors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/logger"
+)
+
+// journaldCursorSaveInterval is how often the read position is persisted
+const journaldCursorSaveInterval = 5 * time.Second
+
+// JournaldCollector follows the systemd journal through journalctl's
+// export format and resumes from a persisted cursor
+type JournaldCollector struct {
+	name       string
+	config     config.JournaldLogsConfig
+	logger     *logger.Logger
+	dataChan   chan<- interface{}
+	cursorFile string
+
+	maxPriority int
+	cursor      string
+	cursorSaved string
+	entries     int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	healthy   bool
+	lastError string
+}
+
+// NewJournaldCollector creates a new journald collector
+func NewJournaldCollector(cfg config.JournaldLogsConfig, dataDir string, log *logger.Logger) (*JournaldCollector, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("journald collector is disabled")
+	}
+
+	maxPriority := -1
+	for i, name := range syslogSeverityNames {
+		if name == cfg.Level {
+			maxPriority = i
+		}
+	}
+	if maxPriority < 0 {
+		return nil, fmt.Errorf("invalid journald level %s", cfg.Level)
+	}
+
+	for _, pattern := range append(append([]string{}, cfg.Include...), cfg.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid unit pattern %s: %w", pattern, err)
+		}
+	}
+
+	return &JournaldCollector{
+		name:        "journald-collector",
+		config:      cfg,
+		logger:      log,
+		cursorFile:  filepath.Join(dataDir, "journald", "cursor"),
+		maxPriority: maxPriority,
+		healthy:     true,
+	}, nil
+}
+
+// Name returns the collector name
+func (jc *JournaldCollector) Name() string {
+	return jc.name
+}
+
+// Start starts the journald collector
+func (jc *JournaldCollector) Start(ctx context.Context, dataChan chan<- interface{}) error {
+	jc.ctx, jc.cancel = context.WithCancel(ctx)
+	jc.dataChan = dataChan
+
+	jc.logger.Info("Starting journald collector", "command", jc.config.Command)
+
+	if data, err := os.ReadFile(jc.cursorFile); err == nil {
+		jc.cursor = strings.TrimSpace(string(data))
+		jc.cursorSaved = jc.cursor
+	}
+
+	resume := jc.cursor != ""
+	jc.wg.Add(1)
+	go jc.follow()
+
+	jc.logger.Info("Journald collector started", "resume", resume)
+	return nil
+}
+
+// Stop stops the journald collector
+func (jc *JournaldCollector) Stop(ctx context.Context) error {
+	jc.logger.Info("Stopping journald collector")
+
+	if jc.cancel != nil {
+		jc.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		jc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		jc.logger.Info("Journald collector stopped")
+		return nil
+	case <-ctx.Done():
+		jc.logger.Warn("Journald collector stop timeout")
+		return ctx.Err()
+	}
+}
+
+// Health returns the collector health status
+func (jc *JournaldCollector) Health() HealthStatus {
+	status := HealthStatus{
+		Healthy:   jc.healthy,
+		Message:   "Journald collector operational",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Details: map[string]string{
+			"entries": strconv.FormatInt(atomic.LoadInt64(&jc.entries), 10),
+		},
+	}
+
+	if jc.lastError != "" {
+		status.Message = jc.lastError
+		status.Healthy = false
+	}
+
+	return status
+}
+
+// follow runs journalctl, restarting it if it exits
+func (jc *JournaldCollector) follow() {
+	defer jc.wg.Done()
+	defer jc.saveCursor()
+
+	for {
+		err := jc.run()
+		if jc.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			jc.logger.Error("journalctl failed", "error", err)
+			jc.lastError = fmt.Sprintf("journalctl error: %v", err)
+		} else {
+			jc.logger.Warn("journalctl exited, restarting")
+		}
+		jc.saveCursor()
+
+		select {
+		case <-jc.ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// args returns the journalctl arguments, resuming after the cursor
+func (jc *JournaldCollector) args() []string {
+	args := []string{"--output=export", "--follow", "--no-pager"}
+	if jc.config.Directory != "" {
+		args = append(args, "--directory="+jc.config.Directory)
+	}
+	if jc.cursor != "" {
+		args = append(args, "--after-cursor="+jc.cursor)
+	} else {
+		// Without a cursor only new entries are read
+		args = append(args, "--lines=0")
+	}
+	return args
+}
+
+// run reads entries from one journalctl process until it exits
+func (jc *JournaldCollector) run() error {
+	cmd := exec.CommandContext(jc.ctx, jc.config.Command, jc.args()...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(stdout, 64*1024)
+	lastSave := time.Now()
+	var readErr error
+	for {
+		entry, err := readJournalEntry(reader)
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+		if len(entry) == 0 {
+			continue
+		}
+
+		jc.handle(entry)
+
+		if time.Since(lastSave) >= journaldCursorSaveInterval {
+			jc.saveCursor()
+			lastSave = time.Now()
+		}
+	}
+
+	// Drain so that journalctl is not blocked on a full pipe while exiting
+	io.Copy(io.Discard, stdout)
+	waitErr := cmd.Wait()
+
+	if readErr != nil {
+		return readErr
+	}
+	if waitErr != nil && jc.ctx.Err() == nil {
+		return fmt.Errorf("%v: %s", waitErr, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// readJournalEntry reads one entry of the journal export format. Fields
+// are KEY=value lines, or for binary values KEY, a little-endian 64-bit
+// length, the data and a newline. Entries end with an empty line; an entry
+// cut off by the end of the stream is an io.ErrUnexpectedEOF, so that its
+// cursor is not committed.
+func readJournalEntry(reader *bufio.Reader) (map[string]string, error) {
+	entry := make(map[string]string)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && (len(entry) > 0 || line != "") {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return entry, nil
+		}
+
+		if key, value, found := strings.Cut(line, "="); found {
+			entry[key] = value
+			continue
+		}
+
+		var size uint64
+		if err := binary.Read(reader, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("invalid binary field %s: %w", line, err)
+		}
+		if size > 16*1024*1024 {
+			return nil, fmt.Errorf("binary field %s too large: %d bytes", line, size)
+		}
+		value := make([]byte, size+1) // data and trailing newline
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, fmt.Errorf("invalid binary field %s: %w", line, err)
+		}
+		if value[size] != '\n' {
+			return nil, fmt.Errorf("invalid binary field %s: missing newline", line)
+		}
+		entry[line] = string(value[:size])
+	}
+}
+
+// handle filters an entry and forwards it as a log record
+func (jc *JournaldCollector) handle(entry map[string]string) {
+	if cursor, ok := entry["__CURSOR"]; ok {
+		jc.cursor = cursor
+	}
+
+	unit := entry["_SYSTEMD_UNIT"]
+	if !jc.includesUnit(unit) {
+		return
+	}
+
+	priority := 6
+	if p, err := strconv.Atoi(entry["PRIORITY"]); err == nil {
+		priority = p
+	}
+	if priority > jc.maxPriority {
+		return
+	}
+
+	timestamp := time.Now()
+	if usec, err := strconv.ParseInt(entry["__REALTIME_TIMESTAMP"], 10, 64); err == nil {
+		timestamp = time.UnixMicro(usec)
+	}
+
+	// Flattened structure, matching the file log collector
+	data := map[string]interface{}{
+		"message":   entry["MESSAGE"],
+		"timestamp": timestamp.Format(time.RFC3339Nano),
+		"source":    "journald",
+		"level":     syslogLevel(priority),
+		"priority":  priority,
+	}
+	if unit != "" {
+		data["unit"] = unit
+	}
+	if pid, err := strconv.Atoi(entry["_PID"]); err == nil {
+		data["pid"] = pid
+	}
+	optional := map[string]string{
+		"SYSLOG_IDENTIFIER":  "identifier",
+		"_COMM":              "process",
+		"_HOSTNAME":          "hostname",
+		"_TRANSPORT":         "transport",
+		"_BOOT_ID":           "boot_id",
+		"_SYSTEMD_USER_UNIT": "user_unit",
+		"CONTAINER_NAME":     "container_name",
+	}
+	for field, name := range optional {
+		if value, ok := entry[field]; ok && value != "" {
+			data[name] = value
+		}
+	}
+	if facility, err := strconv.Atoi(entry["SYSLOG_FACILITY"]); err == nil {
+		data["facility"] = syslogName(syslogFacilityNames, facility)
+	}
+	for k, v := range jc.config.Tags {
+		data[k] = v
+	}
+
+	atomic.AddInt64(&jc.entries, 1)
+
+	source := "journald"
+	if unit != "" {
+		source = "journald:" + unit
+	}
+
+	select {
+	case jc.dataChan <- CollectedData{
+		Type:      DataTypeLog,
+		Source:    source,
+		Data:      data,
+		Tags:      jc.config.Tags,
+		Timestamp: timestamp.Format(time.RFC3339),
+	}:
+	case <-jc.ctx.Done():
+	}
+}
+
+// includesUnit applies the unit include and exclude globs. Entries
+// without a unit pass only when no include list is set.
+func (jc *JournaldCollector) includesUnit(unit string) bool {
+	for _, pattern := range jc.config.Exclude {
+		if matched, _ := filepath.Match(pattern, unit); matched {
+			return false
+		}
+	}
+	if len(jc.config.Include) == 0 {
+		return true
+	}
+	for _, pattern := range jc.config.Include {
+		if matched, _ := filepath.Match(pattern, unit); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// saveCursor persists the cursor atomically when it changed
+func (jc *JournaldCollector) saveCursor() {
+	if jc.cursor == "" || jc.cursor == jc.cursorSaved {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(jc.cursorFile), 0755); err != nil {
+		jc.logger.Error("Failed to create cursor directory", "error", err)
+		return
+	}
+	tmp := jc.cursorFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(jc.cursor+"\n"), 0644); err != nil {
+		jc.logger.Error("Failed to save journal cursor", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, jc.cursorFile); err != nil {
+		jc.logger.Error("Failed to save journal cursor", "error", err)
+		return
+	}
+	jc.cursorSaved = jc.cursor
+}
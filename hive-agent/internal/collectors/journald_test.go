@@ -0,0 +1,236 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+// binaryJournalField encodes a field in the binary form of the journal
+// export format, used for values containing newlines
+func binaryJournalField(key, value string) string {
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, uint64(len(value)))
+	return key + "\n" + string(size) + value + "\n"
+}
+
+func TestReadJournalEntry(t *testing.T) {
+	export := "__CURSOR=s=1;i=1\n" +
+		"PRIORITY=3\n" +
+		"MESSAGE=key=value in the message\n" +
+		binaryJournalField("STACK", "line one\nline two") +
+		"_SYSTEMD_UNIT=app.service\n" +
+		"\n" +
+		"__CURSOR=s=1;i=2\n" +
+		binaryJournalField("MESSAGE", "") +
+		"\n"
+	reader := bufio.NewReader(strings.NewReader(export))
+
+	entry, err := readJournalEntry(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"__CURSOR":      "s=1;i=1",
+		"PRIORITY":      "3",
+		"MESSAGE":       "key=value in the message",
+		"STACK":         "line one\nline two",
+		"_SYSTEMD_UNIT": "app.service",
+	}
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("got %q, want %q", entry, want)
+	}
+
+	entry, err = readJournalEntry(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entry, map[string]string{"__CURSOR": "s=1;i=2", "MESSAGE": ""}) {
+		t.Errorf("got %q", entry)
+	}
+
+	if _, err := readJournalEntry(reader); err != io.EOF {
+		t.Errorf("got %v at the end of the stream, want io.EOF", err)
+	}
+}
+
+func TestReadJournalEntryTruncated(t *testing.T) {
+	field := binaryJournalField("MESSAGE", "multi\nline")
+	tooLarge := make([]byte, 8)
+	binary.LittleEndian.PutUint64(tooLarge, 1<<40)
+
+	tests := []struct {
+		name   string
+		export string
+	}{
+		{"entry without terminator", "__CURSOR=c1\nMESSAGE=hello\n"},
+		{"partial line", "__CURSOR=c1\nMESSA"},
+		{"partial first line", "__CURS"},
+		{"partial length", "__CURSOR=c1\nMESSAGE\n\x05\x00\x00"},
+		{"partial data", field[:len(field)-4]},
+		{"missing newline after data", field[:len(field)-1] + "X\n"},
+		{"oversized field", "MESSAGE\n" + string(tooLarge)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := readJournalEntry(bufio.NewReader(strings.NewReader(tt.export)))
+			if err == nil || err == io.EOF {
+				t.Errorf("got %q, %v; want an error", entry, err)
+			}
+		})
+	}
+
+	// An entry cut off by the end of the stream is not returned
+	_, err := readJournalEntry(bufio.NewReader(strings.NewReader("__CURSOR=c1\nMESSAGE=hello\n")))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+// newTestJournaldCollector returns a journald collector that runs a fake
+// journalctl printing export, and the file the fake writes its arguments to
+func newTestJournaldCollector(t *testing.T, cfg config.JournaldLogsConfig, dataDir, export string) (*JournaldCollector, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	exportFile := filepath.Join(dir, "export")
+	argsFile := filepath.Join(dir, "args")
+	if err := os.WriteFile(exportFile, []byte(export), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\ncat " + exportFile + "\n"
+	command := filepath.Join(dir, "journalctl")
+	if err := os.WriteFile(command, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Enabled = true
+	cfg.Command = command
+	if cfg.Level == "" {
+		cfg.Level = "info"
+	}
+	collector, err := NewJournaldCollector(cfg, dataDir, newTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collector, argsFile
+}
+
+// collectJournal runs the collector until want records arrive
+func collectJournal(t *testing.T, collector *JournaldCollector, want int) []CollectedData {
+	t.Helper()
+
+	data := make(chan interface{}, 100)
+	if err := collector.Start(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Stop(context.Background())
+
+	var records []CollectedData
+	for len(records) < want {
+		select {
+		case item := <-data:
+			records = append(records, item.(CollectedData))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d records, want %d", len(records), want)
+		}
+	}
+	return records
+}
+
+func TestJournaldCollector(t *testing.T) {
+	export := "__CURSOR=s=1;i=10\n" +
+		"__REALTIME_TIMESTAMP=1700000000123456\n" +
+		"PRIORITY=3\n" +
+		"SYSLOG_FACILITY=3\n" +
+		"SYSLOG_IDENTIFIER=nginx\n" +
+		"_PID=4242\n" +
+		"_SYSTEMD_UNIT=nginx.service\n" +
+		"_HOSTNAME=web-1\n" +
+		binaryJournalField("MESSAGE", "upstream failed\ndetails") +
+		"\n" +
+		// Below the configured level
+		"__CURSOR=s=1;i=11\nPRIORITY=7\nMESSAGE=debug\n_SYSTEMD_UNIT=nginx.service\n\n" +
+		// Excluded unit
+		"__CURSOR=s=1;i=12\nPRIORITY=6\nMESSAGE=noise\n_SYSTEMD_UNIT=cron.service\n\n" +
+		// Not in the include list
+		"__CURSOR=s=1;i=13\nPRIORITY=6\nMESSAGE=other\n_SYSTEMD_UNIT=sshd.service\n\n" +
+		"__CURSOR=s=1;i=14\nMESSAGE=default priority\n_SYSTEMD_UNIT=app@1.service\n\n"
+
+	dataDir := t.TempDir()
+	cfg := config.JournaldLogsConfig{
+		Include: []string{"nginx.service", "app@*.service", "cron.service"},
+		Exclude: []string{"cron.*"},
+		Tags:    map[string]string{"env": "test"},
+	}
+	collector, argsFile := newTestJournaldCollector(t, cfg, dataDir, export)
+	records := collectJournal(t, collector, 2)
+
+	nginx := records[0]
+	if nginx.Source != "journald:nginx.service" {
+		t.Errorf("source = %s", nginx.Source)
+	}
+	want := map[string]interface{}{
+		"message":    "upstream failed\ndetails",
+		"timestamp":  time.UnixMicro(1700000000123456).Format(time.RFC3339Nano),
+		"source":     "journald",
+		"level":      "error",
+		"priority":   3,
+		"unit":       "nginx.service",
+		"pid":        4242,
+		"identifier": "nginx",
+		"hostname":   "web-1",
+		"facility":   "daemon",
+		"env":        "test",
+	}
+	if !reflect.DeepEqual(nginx.Data, want) {
+		t.Errorf("got %v, want %v", nginx.Data, want)
+	}
+
+	app := records[1].Data
+	if app["message"] != "default priority" || app["priority"] != 6 || app["level"] != "info" {
+		t.Errorf("got %v", app)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(args)); got != "--output=export --follow --no-pager --lines=0" {
+		t.Errorf("journalctl arguments = %q", got)
+	}
+
+	// The cursor of the last entry read is saved on stop, including
+	// filtered entries
+	collector.Stop(context.Background())
+	cursor, err := os.ReadFile(filepath.Join(dataDir, "journald", "cursor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cursor) != "s=1;i=14\n" {
+		t.Errorf("saved cursor = %q", cursor)
+	}
+
+	// A new collector resumes after the saved cursor
+	collector, argsFile = newTestJournaldCollector(t, cfg, dataDir, "__CURSOR=s=1;i=15\nMESSAGE=next\n_SYSTEMD_UNIT=nginx.service\n\n")
+	if got := collectJournal(t, collector, 1)[0].Data["message"]; got != "next" {
+		t.Errorf("got %q after resuming", got)
+	}
+	args, err = os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(args)); got != "--output=export --follow --no-pager --after-cursor=s=1;i=14" {
+		t.Errorf("journalctl arguments = %q", got)
+	}
+}
@@ -0,0 +1,555 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/logger"
+)
+
+// syslogSeverityNames are the syslog severities by level number
+var syslogSeverityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// syslogFacilityNames are the syslog facilities by number
+var syslogFacilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// syslogLevel maps a syslog severity to a log level
+func syslogLevel(severity int) string {
+	switch {
+	case severity <= 2:
+		return "critical"
+	case severity == 3:
+		return "error"
+	case severity == 4:
+		return "warning"
+	case severity == 7:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+// syslogName returns the name at index i, or the number itself
+func syslogName(names []string, i int) string {
+	if i >= 0 && i < len(names) {
+		return names[i]
+	}
+	return strconv.Itoa(i)
+}
+
+// kmsgRecord is a parsed /dev/kmsg record
+type kmsgRecord struct {
+	Priority  int
+	Facility  int
+	Severity  int
+	Sequence  uint64
+	Monotonic time.Duration
+	Time      time.Time
+	Message   string
+	Metadata  map[string]string // continuation KEY=value lines
+}
+
+// kernelRule detects an incident in kernel messages
+type kernelRule struct {
+	name     string
+	category string
+	pattern  *regexp.Regexp
+	// issue builds the issue title, severity, dedup key and context
+	issue func(match []string, record *kmsgRecord) (title, severity, key string, context map[string]interface{})
+}
+
+// kernelRules are the built-in kernel incident rules
+var kernelRules = []*kernelRule{
+	{
+		name:     "oom_kill",
+		category: "memory",
+		pattern:  regexp.MustCompile(`(Memory cgroup )?[Oo]ut of memory.*?: Killed process (\d+) \(([^)]*)\)(?:.*?anon-rss:(\d+)kB)?`),
+		issue: func(m []string, r *kmsgRecord) (string, string, string, map[string]interface{}) {
+			context := map[string]interface{}{"victim_pid": atoiOrZero(m[2]), "victim_process": m[3], "cgroup_oom": m[1] != ""}
+			if m[4] != "" {
+				context["anon_rss_kb"] = atoiOrZero(m[4])
+			}
+			return fmt.Sprintf("OOM killer killed %s (pid %s)", m[3], m[2]), "critical", m[3] + "/" + m[2], context
+		},
+	},
+	{
+		name:     "hung_task",
+		category: "performance",
+		pattern:  regexp.MustCompile(`INFO: task (.+):(\d+) blocked for more than (\d+) seconds`),
+		issue: func(m []string, r *kmsgRecord) (string, string, string, map[string]interface{}) {
+			context := map[string]interface{}{"process": m[1], "pid": atoiOrZero(m[2]), "blocked_seconds": atoiOrZero(m[3])}
+			return fmt.Sprintf("Task %s (pid %s) blocked for more than %s seconds", m[1], m[2], m[3]), "error", m[1], context
+		},
+	},
+	{
+		name:     "fs_error",
+		category: "storage",
+		pattern:  regexp.MustCompile(`(EXT[234]-fs error \(device ([^)]+)\)|XFS \(([^)]+)\):.*(?:[Cc]orruption|I/O error|error)|BTRFS (?:error|critical) \(device ([^)]+)\)|Buffer I/O error on dev (\S+?),|I/O error, dev (\S+?),|EXT[234]-fs \(([^)]+)\): [Rr]emounting filesystem read-only)`),
+		issue: func(m []string, r *kmsgRecord) (string, string, string, map[string]interface{}) {
+			device := firstNonEmpty(m[2], m[3], m[4], m[5], m[6], m[7])
+			severity := "error"
+			if strings.Contains(r.Message, "read-only") {
+				severity = "critical"
+			}
+			context := map[string]interface{}{"device": device}
+			return fmt.Sprintf("Filesystem or I/O error on %s", device), severity, device, context
+		},
+	},
+	{
+		name:     "segfault",
+		category: "application",
+		pattern:  regexp.MustCompile(`(\S+)\[(\d+)\]: segfault at ([0-9a-f]+) ip ([0-9a-f]+) sp ([0-9a-f]+) error (\d+)(?: in ([^\[\s]+))?`),
+		issue: func(m []string, r *kmsgRecord) (string, string, string, map[string]interface{}) {
+			context := map[string]interface{}{
+				"process": m[1], "pid": atoiOrZero(m[2]), "address": m[3],
+				"ip": m[4], "sp": m[5], "error_code": m[6], "object": m[7],
+			}
+			return fmt.Sprintf("Segfault in %s (pid %s)", m[1], m[2]), "warning", m[1], context
+		},
+	},
+	{
+		name:     "mce",
+		category: "hardware",
+		pattern:  regexp.MustCompile(`(?i)(\[Hardware Error\].*|Machine check events logged|Machine Check Exception.*|EDAC \S+: \d+ (CE|UE) .*)`),
+		issue: func(m []string, r *kmsgRecord) (string, string, string, map[string]interface{}) {
+			severity := "critical"
+			if strings.EqualFold(m[2], "CE") || strings.Contains(m[1], "events logged") || strings.Contains(strings.ToLower(m[1]), "corrected error") {
+				severity = "warning"
+			}
+			return "Hardware error reported by the kernel", severity, m[1], map[string]interface{}{"detail": m[1]}
+		},
+	},
+}
+
+// atoiOrZero parses an integer, returning 0 on error
+func atoiOrZero(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// KernelLogCollector reads kernel messages from /dev/kmsg and raises
+// issues for known kernel incidents
+type KernelLogCollector struct {
+	name     string
+	config   config.KernelLogsConfig
+	logger   *logger.Logger
+	dataChan chan<- interface{}
+
+	maxSeverity int
+	rules       []*kernelRule
+	lastIssue   map[string]time.Time
+	bootTime    time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	healthy   bool
+	lastError string
+}
+
+// NewKernelLogCollector creates a new kernel log collector
+func NewKernelLogCollector(cfg config.KernelLogsConfig, log *logger.Logger) (*KernelLogCollector, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("kernel log collector is disabled")
+	}
+
+	maxSeverity := -1
+	for i, name := range syslogSeverityNames {
+		if name == cfg.Level {
+			maxSeverity = i
+		}
+	}
+	if maxSeverity < 0 {
+		return nil, fmt.Errorf("invalid kernel log level %s", cfg.Level)
+	}
+
+	disabled := make(map[string]bool)
+	for _, name := range cfg.DisableRules {
+		disabled[name] = true
+	}
+	var rules []*kernelRule
+	for _, rule := range kernelRules {
+		if !disabled[rule.name] {
+			rules = append(rules, rule)
+		}
+	}
+
+	return &KernelLogCollector{
+		name:        "kernel-log-collector",
+		config:      cfg,
+		logger:      log,
+		maxSeverity: maxSeverity,
+		rules:       rules,
+		lastIssue:   make(map[string]time.Time),
+		healthy:     true,
+	}, nil
+}
+
+// Name returns the collector name
+func (klc *KernelLogCollector) Name() string {
+	return klc.name
+}
+
+// Start starts the kernel log collector
+func (klc *KernelLogCollector) Start(ctx context.Context, dataChan chan<- interface{}) error {
+	klc.ctx, klc.cancel = context.WithCancel(ctx)
+	klc.dataChan = dataChan
+
+	klc.logger.Info("Starting kernel log collector", "path", klc.config.Path)
+
+	// Record timestamps are relative to boot
+	klc.bootTime = time.Now()
+	if uptime, err := readUptime(); err == nil {
+		klc.bootTime = klc.bootTime.Add(-uptime)
+	}
+
+	file, err := os.Open(klc.config.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", klc.config.Path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	klc.wg.Add(1)
+	if info.Mode().IsRegular() {
+		go klc.readFile(file)
+	} else {
+		if !klc.config.FromStart {
+			if _, err := file.Seek(0, io.SeekEnd); err != nil {
+				klc.logger.Warn("Failed to seek to the end of the kernel log", "error", err)
+			}
+		}
+		go klc.readDevice(file)
+	}
+
+	klc.logger.Info("Kernel log collector started")
+	return nil
+}
+
+// Stop stops the kernel log collector
+func (klc *KernelLogCollector) Stop(ctx context.Context) error {
+	klc.logger.Info("Stopping kernel log collector")
+
+	if klc.cancel != nil {
+		klc.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		klc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		klc.logger.Info("Kernel log collector stopped")
+		return nil
+	case <-ctx.Done():
+		klc.logger.Warn("Kernel log collector stop timeout")
+		return ctx.Err()
+	}
+}
+
+// Health returns the collector health status
+func (klc *KernelLogCollector) Health() HealthStatus {
+	status := HealthStatus{
+		Healthy:   klc.healthy,
+		Message:   "Kernel log collector operational",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Details: map[string]string{
+			"path": klc.config.Path,
+		},
+	}
+
+	if klc.lastError != "" {
+		status.Message = klc.lastError
+		status.Healthy = false
+	}
+
+	return status
+}
+
+// readDevice reads /dev/kmsg, where every read returns one record
+func (klc *KernelLogCollector) readDevice(file *os.File) {
+	defer klc.wg.Done()
+
+	// Closing the device unblocks a pending read
+	go func() {
+		<-klc.ctx.Done()
+		file.Close()
+	}()
+
+	buf := make([]byte, 8192)
+	for {
+		n, err := file.Read(buf)
+		if err != nil {
+			if klc.ctx.Err() != nil {
+				return
+			}
+			// EPIPE means records were overwritten before they were read
+			if errors.Is(err, syscall.EPIPE) {
+				klc.logger.Warn("Kernel log records were lost")
+				continue
+			}
+			if errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) {
+				continue
+			}
+			klc.logger.Error("Failed to read kernel log", "error", err)
+			klc.lastError = fmt.Sprintf("Kernel log read error: %v", err)
+			klc.healthy = false
+			return
+		}
+
+		if record, err := parseKmsgRecord(string(buf[:n])); err == nil {
+			klc.handle(record)
+		}
+	}
+}
+
+// readFile reads a file of kmsg records, one per line with optional
+// indented continuation lines, such as a test fixture
+func (klc *KernelLogCollector) readFile(file *os.File) {
+	defer klc.wg.Done()
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var pending strings.Builder
+	flush := func() {
+		if pending.Len() == 0 {
+			return
+		}
+		if record, err := parseKmsgRecord(pending.String()); err == nil {
+			klc.handle(record)
+		}
+		pending.Reset()
+	}
+
+	for scanner.Scan() {
+		if klc.ctx.Err() != nil {
+			return
+		}
+		line := scanner.Text()
+		if !strings.HasPrefix(line, " ") {
+			flush()
+		}
+		pending.WriteString(line)
+		pending.WriteByte('\n')
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		klc.lastError = fmt.Sprintf("Kernel log read error: %v", err)
+	}
+}
+
+// parseKmsgRecord parses "pri,seq,usec,flags[,...];message" followed by
+// continuation lines of the form " KEY=value"
+func parseKmsgRecord(raw string) (*kmsgRecord, error) {
+	lines := strings.Split(strings.TrimRight(raw, "\n"), "\n")
+
+	prefix, message, found := strings.Cut(lines[0], ";")
+	if !found {
+		return nil, fmt.Errorf("malformed kmsg record")
+	}
+	fields := strings.Split(prefix, ",")
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("malformed kmsg record")
+	}
+
+	priority, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid kmsg priority: %w", err)
+	}
+	sequence, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kmsg sequence: %w", err)
+	}
+	usec, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kmsg timestamp: %w", err)
+	}
+
+	record := &kmsgRecord{
+		Priority:  priority,
+		Facility:  priority >> 3,
+		Severity:  priority & 7,
+		Sequence:  sequence,
+		Monotonic: time.Duration(usec) * time.Microsecond,
+		Message:   unescapeKmsg(message),
+	}
+
+	for _, line := range lines[1:] {
+		if key, value, found := strings.Cut(strings.TrimSpace(line), "="); found {
+			if record.Metadata == nil {
+				record.Metadata = make(map[string]string)
+			}
+			record.Metadata[key] = unescapeKmsg(value)
+		}
+	}
+
+	return record, nil
+}
+
+// unescapeKmsg decodes the \xNN escapes the kernel uses for
+// non-printable bytes
+func unescapeKmsg(s string) string {
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if v, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// handle forwards a record and checks it against the incident rules
+func (klc *KernelLogCollector) handle(record *kmsgRecord) {
+	record.Time = klc.bootTime.Add(record.Monotonic)
+
+	klc.checkRules(record)
+
+	if record.Severity > klc.maxSeverity {
+		return
+	}
+
+	// Flattened structure, matching the file log collector
+	data := map[string]interface{}{
+		"message":        record.Message,
+		"timestamp":      record.Time.Format(time.RFC3339Nano),
+		"source":         "kernel",
+		"level":          syslogLevel(record.Severity),
+		"priority":       record.Priority,
+		"facility":       syslogName(syslogFacilityNames, record.Facility),
+		"severity":       syslogName(syslogSeverityNames, record.Severity),
+		"sequence":       record.Sequence,
+		"monotonic_usec": record.Monotonic.Microseconds(),
+	}
+	if device, ok := record.Metadata["DEVICE"]; ok {
+		data["device"] = device
+	}
+	if subsystem, ok := record.Metadata["SUBSYSTEM"]; ok {
+		data["subsystem"] = subsystem
+	}
+	for k, v := range klc.config.Tags {
+		data[k] = v
+	}
+
+	select {
+	case klc.dataChan <- CollectedData{
+		Type:      DataTypeLog,
+		Source:    "kernel",
+		Data:      data,
+		Tags:      klc.config.Tags,
+		Timestamp: record.Time.Format(time.RFC3339),
+	}:
+	case <-klc.ctx.Done():
+	}
+}
+
+// checkRules raises an issue for the first matching rule, suppressing
+// repeats of the same incident within the cooldown
+func (klc *KernelLogCollector) checkRules(record *kmsgRecord) {
+	for _, rule := range klc.rules {
+		match := rule.pattern.FindStringSubmatch(record.Message)
+		if match == nil {
+			continue
+		}
+
+		title, severity, key, context := rule.issue(match, record)
+
+		dedupKey := rule.name + "/" + key
+		if last, exists := klc.lastIssue[dedupKey]; exists && record.Time.Sub(last) < klc.config.IssueCooldown {
+			return
+		}
+		klc.lastIssue[dedupKey] = record.Time
+		klc.pruneIssues(record.Time)
+
+		context["message"] = record.Message
+		context["sequence"] = record.Sequence
+		context["kernel_time"] = record.Time.Format(time.RFC3339Nano)
+
+		issue := &IssueData{
+			ID:          fmt.Sprintf("kernel-%s-%d", rule.name, record.Sequence),
+			Severity:    severity,
+			Category:    rule.category,
+			Title:       title,
+			Description: record.Message,
+			Pattern:     rule.name,
+			Context:     context,
+			Source:      "kernel",
+			Timestamp:   time.Now().Format(time.RFC3339),
+		}
+
+		klc.logger.Warn("Kernel issue detected", "rule", rule.name, "severity", severity, "message", record.Message)
+
+		tags := map[string]string{"rule": rule.name}
+		for k, v := range klc.config.Tags {
+			tags[k] = v
+		}
+
+		select {
+		case klc.dataChan <- CollectedData{
+			Type:      DataTypeEvent,
+			Source:    "kernel",
+			Data:      map[string]interface{}{"issue": issue},
+			Tags:      tags,
+			Timestamp: time.Now().Format(time.RFC3339),
+		}:
+		case <-klc.ctx.Done():
+		}
+		return
+	}
+}
+
+// pruneIssues forgets dedup entries older than the cooldown
+func (klc *KernelLogCollector) pruneIssues(now time.Time) {
+	if len(klc.lastIssue) < 1024 {
+		return
+	}
+	for key, last := range klc.lastIssue {
+		if now.Sub(last) >= klc.config.IssueCooldown {
+			delete(klc.lastIssue, key)
+		}
+	}
+}
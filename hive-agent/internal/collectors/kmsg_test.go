@@ -0,0 +1,219 @@
+package collectors
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+// kmsgFixture holds kmsg records in the format read from /dev/kmsg, one
+// per line with indented continuation lines
+const kmsgFixture = "testdata/kmsg/records"
+
+func TestParseKmsgRecord(t *testing.T) {
+	record, err := parseKmsgRecord("3,9,6000000,c;usb 1-1: read\\x20error\\x0a\n SUBSYSTEM=usb\n DEVICE=c189:1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &kmsgRecord{
+		Priority:  3,
+		Facility:  0,
+		Severity:  3,
+		Sequence:  9,
+		Monotonic: 6 * time.Second,
+		Message:   "usb 1-1: read error\n",
+		Metadata:  map[string]string{"SUBSYSTEM": "usb", "DEVICE": "c189:1"},
+	}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("got %+v, want %+v", record, want)
+	}
+
+	// Facility and severity are packed into the priority
+	record, err = parseKmsgRecord("30,10,7,-,caller=T1;message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Facility != 3 || record.Severity != 6 || record.Monotonic != 7*time.Microsecond {
+		t.Errorf("got %+v", record)
+	}
+
+	for _, raw := range []string{
+		"no separator",
+		"3,1;too few fields",
+		"x,1,0,-;bad priority",
+		"3,x,0,-;bad sequence",
+		"3,1,x,-;bad timestamp",
+	} {
+		if _, err := parseKmsgRecord(raw); err == nil {
+			t.Errorf("%q: expected an error", raw)
+		}
+	}
+}
+
+func TestUnescapeKmsg(t *testing.T) {
+	tests := map[string]string{
+		`plain`:        "plain",
+		`a\x20b`:       "a b",
+		`tab\x09`:      "tab\t",
+		`bad\xzz`:      `bad\xzz`,
+		`truncated\x2`: `truncated\x2`,
+		`backslash\\x`: `backslash\\x`,
+		`\x41\x42\x43`: "ABC",
+	}
+	for input, want := range tests {
+		if got := unescapeKmsg(input); got != want {
+			t.Errorf("unescapeKmsg(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+// runKernelFixture reads the kmsg fixture and returns the forwarded log
+// records and the raised issues
+func runKernelFixture(t *testing.T, cfg config.KernelLogsConfig) ([]map[string]interface{}, []*IssueData) {
+	t.Helper()
+
+	cfg.Enabled = true
+	cfg.Path = kmsgFixture
+	collector, err := NewKernelLogCollector(cfg, newTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(chan interface{}, 100)
+	if err := collector.Start(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+	// A regular file is read once to the end
+	collector.wg.Wait()
+	collector.Stop(context.Background())
+	close(data)
+
+	var logs []map[string]interface{}
+	var issues []*IssueData
+	for item := range data {
+		collected := item.(CollectedData)
+		switch collected.Type {
+		case DataTypeLog:
+			logs = append(logs, collected.Data)
+		case DataTypeEvent:
+			issues = append(issues, collected.Data["issue"].(*IssueData))
+		}
+	}
+	return logs, issues
+}
+
+func TestKernelLogCollectorFixture(t *testing.T) {
+	logs, issues := runKernelFixture(t, config.KernelLogsConfig{
+		Level:         "info",
+		IssueCooldown: time.Minute,
+		Tags:          map[string]string{"env": "test"},
+	})
+
+	// The debug record and the malformed line are not forwarded
+	if len(logs) != 9 {
+		t.Fatalf("got %d log records, want 9", len(logs))
+	}
+	usb := logs[7]
+	if usb["message"] != "usb 1-1: device descriptor read/64, error -71" || usb["level"] != "error" ||
+		usb["facility"] != "kern" || usb["severity"] != "err" || usb["subsystem"] != "usb" || usb["device"] != "c189:1" ||
+		usb["sequence"] != uint64(9) || usb["monotonic_usec"] != int64(6000000) || usb["env"] != "test" {
+		t.Errorf("usb record = %v", usb)
+	}
+	if daemon := logs[8]; daemon["facility"] != "daemon" || daemon["message"] != "systemd[1]: Started journal" {
+		t.Errorf("daemon record = %v", daemon)
+	}
+	if mce := logs[5]; mce["level"] != "critical" {
+		t.Errorf("level of a crit record = %v", mce["level"])
+	}
+
+	// The repeated OOM kill of the same process is within the cooldown
+	want := []struct {
+		pattern  string
+		severity string
+		title    string
+	}{
+		{"oom_kill", "critical", "OOM killer killed java (pid 4242)"},
+		{"oom_kill", "critical", "OOM killer killed nginx (pid 777)"},
+		{"mce", "warning", "Hardware error reported by the kernel"},
+		{"mce", "critical", "Hardware error reported by the kernel"},
+		{"mce", "warning", "Hardware error reported by the kernel"},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("got %d issues, want %d", len(issues), len(want))
+	}
+	for i, w := range want {
+		if issues[i].Pattern != w.pattern || issues[i].Severity != w.severity || issues[i].Title != w.title {
+			t.Errorf("issue %d = %s %s %q, want %s %s %q", i, issues[i].Pattern, issues[i].Severity, issues[i].Title, w.pattern, w.severity, w.title)
+		}
+	}
+
+	java := issues[0]
+	if java.ID != "kernel-oom_kill-2" || java.Category != "memory" {
+		t.Errorf("issue id %s, category %s", java.ID, java.Category)
+	}
+	wantContext := map[string]interface{}{"victim_pid": 4242, "victim_process": "java", "cgroup_oom": false, "anon_rss_kb": 204800}
+	for k, v := range wantContext {
+		if java.Context[k] != v {
+			t.Errorf("context %s = %v, want %v", k, java.Context[k], v)
+		}
+	}
+	if issues[1].Context["cgroup_oom"] != true {
+		t.Errorf("cgroup OOM kill not flagged: %v", issues[1].Context)
+	}
+	if issues[4].Category != "hardware" {
+		t.Errorf("category = %s", issues[4].Category)
+	}
+}
+
+func TestKernelLogCollectorRules(t *testing.T) {
+	// Without a cooldown every OOM kill is reported
+	_, issues := runKernelFixture(t, config.KernelLogsConfig{Level: "err", DisableRules: []string{"mce"}})
+	if len(issues) != 3 {
+		t.Fatalf("got %d issues, want 3", len(issues))
+	}
+	for _, issue := range issues {
+		if issue.Pattern != "oom_kill" {
+			t.Errorf("unexpected %s issue", issue.Pattern)
+		}
+	}
+
+	if _, err := NewKernelLogCollector(config.KernelLogsConfig{Enabled: true, Level: "verbose"}, newTestLogger(t)); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+}
+
+func TestKernelRules(t *testing.T) {
+	tests := []struct {
+		message  string
+		rule     string
+		severity string
+		key      string
+	}{
+		{"INFO: task kworker/0:1:123 blocked for more than 120 seconds.", "hung_task", "error", "kworker/0:1"},
+		{"EXT4-fs error (device sda1): ext4_find_entry:1455: inode #2: comm ls: reading directory lblock 0", "fs_error", "error", "sda1"},
+		{"EXT4-fs (sda1): Remounting filesystem read-only", "fs_error", "critical", "sda1"},
+		{"blk_update_request: I/O error, dev nvme0n1, sector 2048 op 0x0:(READ)", "fs_error", "error", "nvme0n1"},
+		{"app[31337]: segfault at 0 ip 000055d5 sp 00007ffc error 4 in app[55d5+1000]", "segfault", "warning", "app"},
+		{"EDAC MC1: 2 UE memory read error on CPU_SrcID#1", "mce", "critical", "EDAC MC1: 2 UE memory read error on CPU_SrcID#1"},
+	}
+	for _, tt := range tests {
+		matched := false
+		for _, rule := range kernelRules {
+			match := rule.pattern.FindStringSubmatch(tt.message)
+			if match == nil {
+				continue
+			}
+			matched = true
+			_, severity, key, _ := rule.issue(match, &kmsgRecord{Message: tt.message})
+			if rule.name != tt.rule || severity != tt.severity || key != tt.key {
+				t.Errorf("%q: got %s %s %q, want %s %s %q", tt.message, rule.name, severity, key, tt.rule, tt.severity, tt.key)
+			}
+			break
+		}
+		if !matched {
+			t.Errorf("%q matched no rule", tt.message)
+		}
+	}
+}
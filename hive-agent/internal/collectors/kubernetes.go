@@ -0,0 +1,429 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/logger"
+)
+
+// kubernetesDeletedRetention is how long metadata of deleted pods is kept,
+// so that their remaining log lines are still enriched
+const kubernetesDeletedRetention = 5 * time.Minute
+
+// errWatchExpired is returned when the watch resource version is too old
+var errWatchExpired = errors.New("watch resource version expired")
+
+// kubernetesClient performs requests against the Kubernetes API server
+type kubernetesClient struct {
+	server      string
+	tokenFile   string
+	httpClient  *http.Client
+	watchClient *http.Client
+}
+
+// kubernetesPod is the subset of a pod object we need
+type kubernetesPod struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		UID             string            `json:"uid"`
+		ResourceVersion string            `json:"resourceVersion"`
+		Labels          map[string]string `json:"labels"`
+		Annotations     map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName   string `json:"nodeName"`
+		Containers []struct {
+			Name  string `json:"name"`
+			Image string `json:"image"`
+		} `json:"containers"`
+		InitContainers []struct {
+			Name  string `json:"name"`
+			Image string `json:"image"`
+		} `json:"initContainers"`
+	} `json:"spec"`
+}
+
+// kubernetesPodList is a pod list response
+type kubernetesPodList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []kubernetesPod `json:"items"`
+}
+
+// kubernetesWatchEvent is one event of a watch stream
+type kubernetesWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// kubernetesStatus is the error object of a failed request or watch
+type kubernetesStatus struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// newKubernetesClient creates an API client. The service account token
+// and CA are optional so that plain HTTP API servers work too.
+func newKubernetesClient(cfg config.KubernetesLogsConfig) (*kubernetesClient, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		if ca, err := os.ReadFile(cfg.CAFile); err == nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read kubernetes CA file: %w", err)
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+		MaxIdleConns:    10,
+		IdleConnTimeout: 90 * time.Second,
+	}
+
+	return &kubernetesClient{
+		server:      strings.TrimRight(cfg.APIServer, "/"),
+		tokenFile:   cfg.TokenFile,
+		httpClient:  &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		watchClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+// get performs a GET request. The token is read on every request because
+// projected service account tokens are rotated.
+func (kc *kubernetesClient) get(ctx context.Context, client *http.Client, path string, query url.Values) (*http.Response, error) {
+	endpoint := kc.server + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if kc.tokenFile != "" {
+		if token, err := os.ReadFile(kc.tokenFile); err == nil {
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var status kubernetesStatus
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(body, &status) == nil && status.Message != "" {
+			return nil, fmt.Errorf("kubernetes API returned %d: %s", resp.StatusCode, status.Message)
+		}
+		return nil, fmt.Errorf("kubernetes API returned %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// podMetadata is the cached metadata of a pod
+type podMetadata struct {
+	Namespace   string
+	Name        string
+	UID         string
+	Node        string
+	Labels      map[string]string
+	Annotations map[string]string
+	Images      map[string]string // by container name
+
+	deleted time.Time
+}
+
+// newPodMetadata converts a pod object
+func newPodMetadata(pod *kubernetesPod) *podMetadata {
+	meta := &podMetadata{
+		Namespace:   pod.Metadata.Namespace,
+		Name:        pod.Metadata.Name,
+		UID:         pod.Metadata.UID,
+		Node:        pod.Spec.NodeName,
+		Labels:      pod.Metadata.Labels,
+		Annotations: pod.Metadata.Annotations,
+		Images:      make(map[string]string),
+	}
+	for _, container := range pod.Spec.InitContainers {
+		meta.Images[container.Name] = container.Image
+	}
+	for _, container := range pod.Spec.Containers {
+		meta.Images[container.Name] = container.Image
+	}
+	return meta
+}
+
+// kubernetesPodCache keeps pod metadata up to date with a list and watch
+// of the pods on this node
+type kubernetesPodCache struct {
+	client *kubernetesClient
+	node   string
+	logger *logger.Logger
+
+	mu      sync.RWMutex
+	pods    map[string]*podMetadata // by UID
+	misses  map[string]time.Time    // last direct lookup of unknown pods
+	synced  bool
+	lastErr string
+}
+
+// newKubernetesPodCache creates an empty pod cache
+func newKubernetesPodCache(client *kubernetesClient, node string, log *logger.Logger) *kubernetesPodCache {
+	return &kubernetesPodCache{
+		client: client,
+		node:   node,
+		logger: log,
+		pods:   make(map[string]*podMetadata),
+		misses: make(map[string]time.Time),
+	}
+}
+
+// run lists and watches pods until the context is cancelled. A watch
+// that ends is resumed from the last resource version; an expired
+// version or an error causes a full relist.
+func (pc *kubernetesPodCache) run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		version, err := pc.list(ctx)
+		if err == nil {
+			backoff = time.Second
+		}
+		for err == nil {
+			started := time.Now()
+			version, err = pc.watch(ctx, version)
+			if ctx.Err() != nil {
+				return
+			}
+			// Do not spin against a server that ends watches immediately
+			if err == nil && time.Since(started) < time.Second {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == errWatchExpired {
+			continue
+		}
+
+		pc.logger.Warn("Kubernetes pod watch failed", "error", err, "retry", backoff)
+		pc.setError(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+// selector returns the field selector limiting pods to this node
+func (pc *kubernetesPodCache) selector() url.Values {
+	query := url.Values{}
+	if pc.node != "" {
+		query.Set("fieldSelector", "spec.nodeName="+pc.node)
+	}
+	return query
+}
+
+// list replaces the cache with the current pods. Pods missing from the
+// list are kept as deleted for the retention period.
+func (pc *kubernetesPodCache) list(ctx context.Context) (string, error) {
+	resp, err := pc.client.get(ctx, pc.client.httpClient, "/api/v1/pods", pc.selector())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var list kubernetesPodList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", fmt.Errorf("failed to decode pod list: %w", err)
+	}
+
+	now := time.Now()
+	pods := make(map[string]*podMetadata, len(list.Items))
+	for i := range list.Items {
+		meta := newPodMetadata(&list.Items[i])
+		pods[meta.UID] = meta
+	}
+
+	pc.mu.Lock()
+	for uid, meta := range pc.pods {
+		if _, exists := pods[uid]; !exists {
+			if meta.deleted.IsZero() {
+				meta.deleted = now
+			}
+			pods[uid] = meta
+		}
+	}
+	pc.pods = pods
+	pc.synced = true
+	pc.lastErr = ""
+	pc.mu.Unlock()
+
+	pc.logger.Debug("Listed kubernetes pods", "pods", len(list.Items), "resource_version", list.Metadata.ResourceVersion)
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch applies pod events from the given resource version until the
+// server ends the watch, returning the last version seen
+func (pc *kubernetesPodCache) watch(ctx context.Context, version string) (string, error) {
+	query := pc.selector()
+	query.Set("watch", "true")
+	query.Set("resourceVersion", version)
+	query.Set("allowWatchBookmarks", "true")
+	query.Set("timeoutSeconds", "300")
+
+	resp, err := pc.client.get(ctx, pc.client.watchClient, "/api/v1/pods", query)
+	if err != nil {
+		return version, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var event kubernetesWatchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return version, nil
+			}
+			return version, fmt.Errorf("failed to decode watch event: %w", err)
+		}
+
+		if event.Type == "ERROR" {
+			var status kubernetesStatus
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return version, errWatchExpired
+			}
+			return version, fmt.Errorf("watch error: %s", status.Message)
+		}
+
+		var pod kubernetesPod
+		if err := json.Unmarshal(event.Object, &pod); err != nil {
+			return version, fmt.Errorf("failed to decode watched pod: %w", err)
+		}
+		if pod.Metadata.ResourceVersion != "" {
+			version = pod.Metadata.ResourceVersion
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			meta := newPodMetadata(&pod)
+			pc.mu.Lock()
+			pc.pods[meta.UID] = meta
+			delete(pc.misses, meta.UID)
+			pc.mu.Unlock()
+		case "DELETED":
+			pc.mu.Lock()
+			if meta, exists := pc.pods[pod.Metadata.UID]; exists {
+				meta.deleted = time.Now()
+			}
+			pc.mu.Unlock()
+		}
+	}
+}
+
+// lookup returns the metadata of a pod. Pods not yet seen by the watch
+// are fetched directly, at most once a minute per pod.
+func (pc *kubernetesPodCache) lookup(ctx context.Context, namespace, name, uid string) *podMetadata {
+	pc.mu.RLock()
+	meta, exists := pc.pods[uid]
+	lastMiss, missed := pc.misses[uid]
+	pc.mu.RUnlock()
+
+	if exists {
+		return meta
+	}
+	if missed && time.Since(lastMiss) < time.Minute {
+		return nil
+	}
+
+	pc.mu.Lock()
+	pc.misses[uid] = time.Now()
+	pc.mu.Unlock()
+
+	resp, err := pc.client.get(ctx, pc.client.httpClient,
+		"/api/v1/namespaces/"+url.PathEscape(namespace)+"/pods/"+url.PathEscape(name), nil)
+	if err != nil {
+		pc.logger.Debug("Failed to look up pod", "namespace", namespace, "pod", name, "error", err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	var pod kubernetesPod
+	if err := json.NewDecoder(resp.Body).Decode(&pod); err != nil || pod.Metadata.UID != uid {
+		// A recreated pod with the same name is a different pod
+		return nil
+	}
+
+	meta = newPodMetadata(&pod)
+	pc.mu.Lock()
+	pc.pods[uid] = meta
+	delete(pc.misses, uid)
+	pc.mu.Unlock()
+	return meta
+}
+
+// prune drops pods deleted longer than the retention period ago
+func (pc *kubernetesPodCache) prune() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	for uid, meta := range pc.pods {
+		if !meta.deleted.IsZero() && time.Since(meta.deleted) > kubernetesDeletedRetention {
+			delete(pc.pods, uid)
+		}
+	}
+	for uid, missed := range pc.misses {
+		if time.Since(missed) > time.Minute {
+			delete(pc.misses, uid)
+		}
+	}
+}
+
+// status returns whether the cache has synced, the number of cached pods
+// and the last error
+func (pc *kubernetesPodCache) status() (bool, int, string) {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.synced, len(pc.pods), pc.lastErr
+}
+
+func (pc *kubernetesPodCache) setError(err error) {
+	pc.mu.Lock()
+	pc.lastErr = err.Error()
+	pc.mu.Unlock()
+}
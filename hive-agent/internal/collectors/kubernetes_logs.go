@@ -0,0 +1,723 @@
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/logger"
+)
+
+const (
+	// kubernetesReadInterval is how often pod log files are read
+	kubernetesReadInterval = time.Second
+	// kubernetesPositionSaveInterval is how often read positions are persisted
+	kubernetesPositionSaveInterval = 5 * time.Second
+	// kubernetesMaxLineSize caps a line reassembled from partial records
+	kubernetesMaxLineSize = 1024 * 1024
+	// kubernetesMaxLinesPerRead bounds the lines read from one file per
+	// interval so that a busy pod cannot starve the others
+	kubernetesMaxLinesPerRead = 5000
+
+	// kubernetesExcludeAnnotation opts a pod, or with a .<container>
+	// suffix a single container, out of log collection
+	kubernetesExcludeAnnotation = "pulse-hive.io/exclude"
+	// kubernetesParserAnnotation names one of the configured log parsers,
+	// for the pod or with a .<container> suffix for a single container
+	kubernetesParserAnnotation = "pulse-hive.io/parser"
+)
+
+// kubernetesSkippedAnnotations are not copied into log records
+var kubernetesSkippedAnnotations = map[string]bool{
+	"kubectl.kubernetes.io/last-applied-configuration": true,
+}
+
+// KubernetesLogCollector tails pod logs written by the kubelet under
+// /var/log/pods and enriches them with pod metadata from the API server
+type KubernetesLogCollector struct {
+	name          string
+	config        config.KubernetesLogsConfig
+	logger        *logger.Logger
+	dataChan      chan<- interface{}
+	parsers       map[string]*podLogParser
+	pods          *kubernetesPodCache
+	positionsFile string
+
+	files     map[string]*podLogFile
+	filesMu   sync.Mutex
+	positions map[string]podLogPosition
+	dirty     bool
+	lines     int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	healthy   bool
+	lastError string
+}
+
+// podLogParser is a compiled log parser from the log collector parsers
+type podLogParser struct {
+	config config.ParserConfig
+	regex  *regexp.Regexp
+}
+
+// podLogPosition is the persisted read position of a pod log file
+type podLogPosition struct {
+	Offset int64  `json:"offset"`
+	Inode  uint64 `json:"inode"`
+}
+
+// podLogFile is a pod container log file being tailed. The path is
+// <path>/<namespace>_<pod>_<uid>/<container>/<restart>.log.
+type podLogFile struct {
+	path      string
+	namespace string
+	pod       string
+	uid       string
+	container string
+	restart   int
+
+	file    *os.File
+	inode   uint64
+	offset  int64
+	pending []byte            // incomplete line at the end of the file
+	partial map[string][]byte // partial records by stream
+	seen    bool              // still present at the last discovery
+}
+
+// NewKubernetesLogCollector creates a new Kubernetes pod log collector.
+// Parsers are the log collector parsers that pods may select by
+// annotation.
+func NewKubernetesLogCollector(cfg config.KubernetesLogsConfig, parsers map[string]config.ParserConfig, dataDir string, log *logger.Logger) (*KubernetesLogCollector, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("kubernetes log collector is disabled")
+	}
+
+	for _, pattern := range append(append([]string{}, cfg.Include...), cfg.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern %s: %w", pattern, err)
+		}
+	}
+
+	collector := &KubernetesLogCollector{
+		name:          "kubernetes-log-collector",
+		config:        cfg,
+		logger:        log,
+		parsers:       make(map[string]*podLogParser),
+		positionsFile: filepath.Join(dataDir, "kubernetes", "positions.json"),
+		files:         make(map[string]*podLogFile),
+		positions:     make(map[string]podLogPosition),
+		healthy:       true,
+	}
+
+	for name, parser := range parsers {
+		compiled := &podLogParser{config: parser}
+		if parser.Type == "regex" {
+			regex, err := regexp.Compile(parser.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern for parser %s: %w", name, err)
+			}
+			compiled.regex = regex
+		}
+		collector.parsers[name] = compiled
+	}
+
+	if cfg.APIServer != "" {
+		client, err := newKubernetesClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		collector.pods = newKubernetesPodCache(client, cfg.NodeName, log)
+	} else {
+		log.Warn("No kubernetes API server configured, pod logs will not be enriched with metadata")
+	}
+
+	return collector, nil
+}
+
+// Name returns the collector name
+func (klc *KubernetesLogCollector) Name() string {
+	return klc.name
+}
+
+// Start starts the Kubernetes log collector
+func (klc *KubernetesLogCollector) Start(ctx context.Context, dataChan chan<- interface{}) error {
+	klc.ctx, klc.cancel = context.WithCancel(ctx)
+	klc.dataChan = dataChan
+
+	klc.logger.Info("Starting kubernetes log collector",
+		"path", klc.config.Path, "api_server", klc.config.APIServer, "node", klc.config.NodeName)
+
+	if data, err := os.ReadFile(klc.positionsFile); err == nil {
+		if err := json.Unmarshal(data, &klc.positions); err != nil {
+			klc.logger.Warn("Ignoring invalid positions file", "path", klc.positionsFile, "error", err)
+			klc.positions = make(map[string]podLogPosition)
+		}
+	}
+
+	if klc.pods != nil {
+		klc.wg.Add(1)
+		go func() {
+			defer klc.wg.Done()
+			klc.pods.run(klc.ctx)
+		}()
+	}
+
+	// Files present at startup without a saved position start at the end
+	klc.discover(true)
+	files := len(klc.files)
+
+	klc.wg.Add(1)
+	go klc.follow()
+
+	klc.logger.Info("Kubernetes log collector started", "files", files)
+	return nil
+}
+
+// Stop stops the Kubernetes log collector
+func (klc *KubernetesLogCollector) Stop(ctx context.Context) error {
+	klc.logger.Info("Stopping kubernetes log collector")
+
+	if klc.cancel != nil {
+		klc.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		klc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		klc.logger.Info("Kubernetes log collector stopped")
+		return nil
+	case <-ctx.Done():
+		klc.logger.Warn("Kubernetes log collector stop timeout")
+		return ctx.Err()
+	}
+}
+
+// Health returns the collector health status
+func (klc *KubernetesLogCollector) Health() HealthStatus {
+	klc.filesMu.Lock()
+	fileCount := len(klc.files)
+	klc.filesMu.Unlock()
+
+	status := HealthStatus{
+		Healthy:   klc.healthy,
+		Message:   "Kubernetes log collector operational",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Details: map[string]string{
+			"path":          klc.config.Path,
+			"files_watched": strconv.Itoa(fileCount),
+			"lines":         strconv.FormatInt(atomic.LoadInt64(&klc.lines), 10),
+		},
+	}
+
+	if klc.pods != nil {
+		synced, cached, lastErr := klc.pods.status()
+		status.Details["api_synced"] = strconv.FormatBool(synced)
+		status.Details["pods_cached"] = strconv.Itoa(cached)
+		if lastErr != "" {
+			status.Details["api_error"] = lastErr
+		}
+	}
+
+	if klc.lastError != "" {
+		status.Message = klc.lastError
+		status.Healthy = false
+	}
+
+	return status
+}
+
+// WatchedFiles returns the container log files being tailed and their
+// read offsets
+func (klc *KubernetesLogCollector) WatchedFiles() []WatchedFile {
+	klc.filesMu.Lock()
+	defer klc.filesMu.Unlock()
+
+	files := make([]WatchedFile, 0, len(klc.files))
+	for _, file := range klc.files {
+		files = append(files, WatchedFile{Path: file.path, Offset: file.offset})
+	}
+	return files
+}
+
+// follow reads files every interval and rediscovers them every refresh
+// interval until the collector stops
+func (klc *KubernetesLogCollector) follow() {
+	defer klc.wg.Done()
+	defer klc.closeFiles()
+
+	readTicker := time.NewTicker(kubernetesReadInterval)
+	defer readTicker.Stop()
+	refreshTicker := time.NewTicker(klc.config.RefreshInterval)
+	defer refreshTicker.Stop()
+
+	lastSave := time.Now()
+	for {
+		select {
+		case <-klc.ctx.Done():
+			return
+		case <-refreshTicker.C:
+			klc.discover(false)
+			if klc.pods != nil {
+				klc.pods.prune()
+			}
+		case <-readTicker.C:
+			klc.readAll()
+			if time.Since(lastSave) >= kubernetesPositionSaveInterval {
+				klc.savePositions()
+				lastSave = time.Now()
+			}
+		}
+	}
+}
+
+// discover opens new pod log files and closes those that are gone, after
+// reading what remains in them
+func (klc *KubernetesLogCollector) discover(initial bool) {
+	matches, err := filepath.Glob(filepath.Join(klc.config.Path, "*", "*", "*.log"))
+	if err != nil {
+		klc.logger.Error("Invalid pod log path", "path", klc.config.Path, "error", err)
+		klc.lastError = fmt.Sprintf("Invalid pod log path: %v", err)
+		return
+	}
+
+	klc.filesMu.Lock()
+	defer klc.filesMu.Unlock()
+
+	for _, file := range klc.files {
+		file.seen = false
+	}
+
+	for _, path := range matches {
+		if file, exists := klc.files[path]; exists {
+			file.seen = true
+			continue
+		}
+
+		file, ok := parsePodLogPath(klc.config.Path, path)
+		if !ok || !klc.includesNamespace(file.namespace) {
+			continue
+		}
+		if err := klc.open(file, initial); err != nil {
+			klc.logger.Debug("Failed to open pod log", "path", path, "error", err)
+			continue
+		}
+		file.seen = true
+		klc.files[path] = file
+		klc.logger.Debug("Tailing pod log", "namespace", file.namespace, "pod", file.pod, "container", file.container, "offset", file.offset)
+	}
+
+	if initial {
+		// Forget files that disappeared while the agent was not running
+		for path := range klc.positions {
+			if _, exists := klc.files[path]; !exists {
+				delete(klc.positions, path)
+				klc.dirty = true
+			}
+		}
+	}
+
+	for path, file := range klc.files {
+		if file.seen {
+			continue
+		}
+		klc.read(file)
+		file.file.Close()
+		delete(klc.files, path)
+		delete(klc.positions, path)
+		klc.dirty = true
+		klc.logger.Debug("Stopped tailing pod log", "path", path)
+	}
+}
+
+// parsePodLogPath extracts the pod identity from a kubelet log path.
+// Namespaces and pod names cannot contain underscores.
+func parsePodLogPath(root, path string) (*podLogFile, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	pod := strings.SplitN(parts[0], "_", 3)
+	if len(pod) != 3 {
+		return nil, false
+	}
+	restart, err := strconv.Atoi(strings.TrimSuffix(parts[2], ".log"))
+	if err != nil {
+		return nil, false
+	}
+
+	return &podLogFile{
+		path:      path,
+		namespace: pod[0],
+		pod:       pod[1],
+		uid:       pod[2],
+		container: parts[1],
+		restart:   restart,
+		partial:   make(map[string][]byte),
+	}, true
+}
+
+// includesNamespace applies the namespace include and exclude globs
+func (klc *KubernetesLogCollector) includesNamespace(namespace string) bool {
+	for _, pattern := range klc.config.Exclude {
+		if matched, _ := filepath.Match(pattern, namespace); matched {
+			return false
+		}
+	}
+	if len(klc.config.Include) == 0 {
+		return true
+	}
+	for _, pattern := range klc.config.Include {
+		if matched, _ := filepath.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// open opens a log file at its saved position. Without one, files found
+// at startup start at the end and files created later at the beginning.
+func (klc *KubernetesLogCollector) open(file *podLogFile, initial bool) error {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	file.file = f
+	file.inode = fileInode(info)
+
+	if position, saved := klc.positions[file.path]; saved && position.Inode == file.inode && position.Offset <= info.Size() {
+		file.offset = position.Offset
+	} else if initial {
+		file.offset = info.Size()
+	}
+	return nil
+}
+
+// fileInode returns the inode number of a file
+func fileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino
+	}
+	return 0
+}
+
+// readAll reads new lines from every file
+func (klc *KubernetesLogCollector) readAll() {
+	klc.filesMu.Lock()
+	defer klc.filesMu.Unlock()
+
+	for _, file := range klc.files {
+		if klc.ctx.Err() != nil {
+			return
+		}
+		klc.read(file)
+	}
+}
+
+// read reads new complete lines from a file. When the kubelet rotates
+// the file, the old one is read to the end before the new one is opened.
+func (klc *KubernetesLogCollector) read(file *podLogFile) {
+	if info, err := os.Stat(file.path); err == nil {
+		if inode := fileInode(info); inode != file.inode {
+			klc.readLines(file)
+			file.file.Close()
+
+			f, err := os.Open(file.path)
+			if err != nil {
+				return
+			}
+			file.file = f
+			file.inode = inode
+			file.offset = 0
+			file.pending = nil
+		} else if info.Size() < file.offset {
+			// Truncated in place
+			file.offset = 0
+			file.pending = nil
+		}
+	}
+
+	klc.readLines(file)
+}
+
+// readLines reads and handles complete lines from the current offset
+func (klc *KubernetesLogCollector) readLines(file *podLogFile) {
+	buffer := make([]byte, 32*1024)
+	lines := 0
+
+	var meta *podMetadata
+	if klc.pods != nil {
+		meta = klc.pods.lookup(klc.ctx, file.namespace, file.pod, file.uid)
+	}
+	excluded := podAnnotation(meta, kubernetesExcludeAnnotation, file.container) == "true"
+	parser := klc.parsers[podAnnotation(meta, kubernetesParserAnnotation, file.container)]
+
+	for lines < kubernetesMaxLinesPerRead {
+		n, err := file.file.ReadAt(buffer, file.offset+int64(len(file.pending)))
+		if n == 0 {
+			if err != nil && err != io.EOF {
+				klc.logger.Warn("Failed to read pod log", "path", file.path, "error", err)
+			}
+			break
+		}
+
+		data := append(file.pending, buffer[:n]...)
+		for lines < kubernetesMaxLinesPerRead {
+			idx := bytes.IndexByte(data, '\n')
+			if idx < 0 {
+				break
+			}
+			if !excluded {
+				klc.handleLine(file, string(data[:idx]), meta, parser)
+			}
+			file.offset += int64(idx + 1)
+			data = data[idx+1:]
+			lines++
+		}
+		if len(data) > kubernetesMaxLineSize {
+			// A runaway line without a newline; drop it
+			file.offset += int64(len(data))
+			data = nil
+		}
+		file.pending = append([]byte(nil), data...)
+	}
+
+	// Pending bytes are re-read from the file on the next interval
+	file.pending = nil
+
+	if lines > 0 {
+		klc.positions[file.path] = podLogPosition{Offset: file.offset, Inode: file.inode}
+		klc.dirty = true
+	}
+}
+
+// podAnnotation returns a container-specific annotation, falling back to
+// the pod-wide one
+func podAnnotation(meta *podMetadata, key, container string) string {
+	if meta == nil {
+		return ""
+	}
+	if value, ok := meta.Annotations[key+"."+container]; ok {
+		return value
+	}
+	return meta.Annotations[key]
+}
+
+// handleLine decodes a CRI or Docker JSON log line, joins partial
+// records and forwards complete ones
+func (klc *KubernetesLogCollector) handleLine(file *podLogFile, line string, meta *podMetadata, parser *podLogParser) {
+	timestamp, stream, message, partial, ok := parseCRILine(line)
+	if !ok {
+		timestamp, stream, message, partial, ok = parseDockerJSONLine(line)
+	}
+	if !ok {
+		timestamp, stream, message = time.Now(), "", line
+	}
+
+	if partial || len(file.partial[stream]) > 0 {
+		joined := append(file.partial[stream], message...)
+		if partial && len(joined) < kubernetesMaxLineSize {
+			file.partial[stream] = joined
+			return
+		}
+		message = string(joined)
+		delete(file.partial, stream)
+	}
+
+	atomic.AddInt64(&klc.lines, 1)
+
+	// Flattened structure, matching the file log collector
+	data := map[string]interface{}{
+		"message":   message,
+		"timestamp": timestamp.Format(time.RFC3339Nano),
+		"source":    "kubernetes",
+		"level":     "info",
+		"namespace": file.namespace,
+		"pod":       file.pod,
+		"pod_uid":   file.uid,
+		"container": file.container,
+		"restart":   file.restart,
+	}
+	if stream != "" {
+		data["stream"] = stream
+	}
+	if meta != nil {
+		if meta.Node != "" {
+			data["node"] = meta.Node
+		}
+		if image := meta.Images[file.container]; image != "" {
+			data["image"] = image
+		}
+		if len(meta.Labels) > 0 {
+			data["labels"] = meta.Labels
+		}
+		annotations := make(map[string]string, len(meta.Annotations))
+		for k, v := range meta.Annotations {
+			if !kubernetesSkippedAnnotations[k] {
+				annotations[k] = v
+			}
+		}
+		if len(annotations) > 0 {
+			data["annotations"] = annotations
+		}
+	}
+	if parser != nil {
+		parser.apply(message, data)
+	}
+	for k, v := range klc.config.Tags {
+		data[k] = v
+	}
+
+	select {
+	case klc.dataChan <- CollectedData{
+		Type:      DataTypeLog,
+		Source:    "kubernetes:" + file.namespace + "/" + file.pod + "/" + file.container,
+		Data:      data,
+		Tags:      klc.config.Tags,
+		Timestamp: timestamp.Format(time.RFC3339),
+	}:
+	case <-klc.ctx.Done():
+	}
+}
+
+// parseCRILine parses the CRI log format "TIMESTAMP STREAM FLAG MESSAGE",
+// where the flag is P for a partial record and F for a full one
+func parseCRILine(line string) (time.Time, string, string, bool, bool) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 {
+		return time.Time{}, "", "", false, false
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil || (parts[1] != "stdout" && parts[1] != "stderr") {
+		return time.Time{}, "", "", false, false
+	}
+	flags := strings.Split(parts[2], ":")
+	message := ""
+	if len(parts) == 4 {
+		message = parts[3]
+	}
+	return timestamp, parts[1], message, flags[0] == "P", true
+}
+
+// parseDockerJSONLine parses the Docker json-file log format. Records
+// without a trailing newline are partial.
+func parseDockerJSONLine(line string) (time.Time, string, string, bool, bool) {
+	if !strings.HasPrefix(line, "{") {
+		return time.Time{}, "", "", false, false
+	}
+	var record struct {
+		Log    string `json:"log"`
+		Stream string `json:"stream"`
+		Time   string `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil || record.Stream == "" {
+		return time.Time{}, "", "", false, false
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, record.Time)
+	if err != nil {
+		timestamp = time.Now()
+	}
+	message := strings.TrimSuffix(record.Log, "\n")
+	return timestamp, record.Stream, message, message == record.Log, true
+}
+
+// apply extracts fields from a message. JSON objects are merged into the
+// record, with their message and level replacing the line's.
+func (p *podLogParser) apply(message string, data map[string]interface{}) {
+	switch p.config.Type {
+	case "regex":
+		matches := p.regex.FindStringSubmatch(message)
+		for i, name := range p.regex.SubexpNames() {
+			if i > 0 && name != "" && i < len(matches) {
+				data[name] = matches[i]
+			}
+		}
+	case "json":
+		var fields map[string]interface{}
+		if json.Unmarshal([]byte(message), &fields) != nil {
+			return
+		}
+		for k, v := range fields {
+			switch k {
+			case "msg", "message":
+				data["message"] = fmt.Sprint(v)
+			case "level", "severity":
+				data["level"] = strings.ToLower(fmt.Sprint(v))
+			case "timestamp", "time", "ts", "source":
+				data["log_"+k] = v
+			default:
+				data[k] = v
+			}
+		}
+	}
+	for k, v := range p.config.Fields {
+		data[k] = v
+	}
+}
+
+// closeFiles saves positions and closes all files
+func (klc *KubernetesLogCollector) closeFiles() {
+	klc.filesMu.Lock()
+	for _, file := range klc.files {
+		file.file.Close()
+	}
+	klc.filesMu.Unlock()
+	klc.savePositions()
+}
+
+// savePositions persists read positions atomically when they changed
+func (klc *KubernetesLogCollector) savePositions() {
+	klc.filesMu.Lock()
+	if !klc.dirty {
+		klc.filesMu.Unlock()
+		return
+	}
+	data, err := json.Marshal(klc.positions)
+	klc.dirty = false
+	klc.filesMu.Unlock()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(klc.positionsFile), 0755); err != nil {
+		klc.logger.Error("Failed to create positions directory", "error", err)
+		return
+	}
+	tmp := klc.positionsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		klc.logger.Error("Failed to save pod log positions", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, klc.positionsFile); err != nil {
+		klc.logger.Error("Failed to save pod log positions", "error", err)
+	}
+}
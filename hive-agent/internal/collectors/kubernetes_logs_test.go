@@ -0,0 +1,237 @@
+package collectors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+func TestParseCRILine(t *testing.T) {
+	tests := []struct {
+		line      string
+		timestamp time.Time
+		stream    string
+		message   string
+		partial   bool
+		ok        bool
+	}{
+		{"2024-05-01T10:00:00.123456789Z stdout F hello world", time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC), "stdout", "hello world", false, true},
+		{"2024-05-01T10:00:00Z stderr P first half ", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), "stderr", "first half ", true, true},
+		// Flags may carry further fields after a colon
+		{"2024-05-01T12:00:00+02:00 stdout P:extra text", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), "stdout", "text", true, true},
+		{"2024-05-01T10:00:00Z stdout F", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), "stdout", "", false, true},
+		{"2024-05-01T10:00:00Z stdout F ", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), "stdout", "", false, true},
+		{"2024-05-01T10:00:00Z console F message", time.Time{}, "", "", false, false},
+		{"yesterday stdout F message", time.Time{}, "", "", false, false},
+		{"2024-05-01T10:00:00Z stdout", time.Time{}, "", "", false, false},
+		{`{"log":"json\n","stream":"stdout"}`, time.Time{}, "", "", false, false},
+	}
+	for _, tt := range tests {
+		timestamp, stream, message, partial, ok := parseCRILine(tt.line)
+		if !timestamp.Equal(tt.timestamp) || stream != tt.stream || message != tt.message || partial != tt.partial || ok != tt.ok {
+			t.Errorf("%q: got %v %q %q %v %v, want %v %q %q %v %v", tt.line, timestamp, stream, message, partial, ok,
+				tt.timestamp, tt.stream, tt.message, tt.partial, tt.ok)
+		}
+	}
+}
+
+func TestParseDockerJSONLine(t *testing.T) {
+	tests := []struct {
+		line      string
+		timestamp time.Time
+		stream    string
+		message   string
+		partial   bool
+		ok        bool
+	}{
+		{`{"log":"hello world\n","stream":"stdout","time":"2024-05-01T10:00:00.5Z"}`, time.Date(2024, 5, 1, 10, 0, 0, 500000000, time.UTC), "stdout", "hello world", false, true},
+		// Records split by the runtime have no trailing newline
+		{`{"log":"first half ","stream":"stderr","time":"2024-05-01T10:00:00Z"}`, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), "stderr", "first half ", true, true},
+		{`{"log":"tab\tand \"quotes\"\n","stream":"stdout","time":"2024-05-01T10:00:00Z"}`, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), "stdout", "tab\tand \"quotes\"", false, true},
+		{`{"log":"no stream\n","time":"2024-05-01T10:00:00Z"}`, time.Time{}, "", "", false, false},
+		{`{"log":"truncated`, time.Time{}, "", "", false, false},
+		{"2024-05-01T10:00:00Z stdout F cri", time.Time{}, "", "", false, false},
+	}
+	for _, tt := range tests {
+		timestamp, stream, message, partial, ok := parseDockerJSONLine(tt.line)
+		if !timestamp.Equal(tt.timestamp) || stream != tt.stream || message != tt.message || partial != tt.partial || ok != tt.ok {
+			t.Errorf("%q: got %v %q %q %v %v, want %v %q %q %v %v", tt.line, timestamp, stream, message, partial, ok,
+				tt.timestamp, tt.stream, tt.message, tt.partial, tt.ok)
+		}
+	}
+
+	// An invalid time falls back to the time read
+	before := time.Now()
+	timestamp, _, _, _, ok := parseDockerJSONLine(`{"log":"x\n","stream":"stdout","time":"never"}`)
+	if !ok || timestamp.Before(before) {
+		t.Errorf("got %v, %v for an invalid time", timestamp, ok)
+	}
+}
+
+func TestParsePodLogPath(t *testing.T) {
+	root := "/var/log/pods"
+
+	file, ok := parsePodLogPath(root, "/var/log/pods/default_web-7d4b9_0f8e-11ee/app/3.log")
+	if !ok {
+		t.Fatal("valid path rejected")
+	}
+	if file.namespace != "default" || file.pod != "web-7d4b9" || file.uid != "0f8e-11ee" || file.container != "app" || file.restart != 3 {
+		t.Errorf("got %+v", file)
+	}
+
+	for _, path := range []string{
+		"/var/log/pods/default_web/app/0.log",             // no UID
+		"/var/log/pods/default_web_uid/app/current.log",   // no restart count
+		"/var/log/pods/default_web_uid/0.log",             // no container
+		"/var/log/pods/default_web_uid/app/extra/0.log",   // too deep
+		"/var/log/containers/default_web_uid/app/0.log",   // outside the root
+		"/var/log/pods/default_web_uid/app/0.log.2024050", // rotated file
+	} {
+		if file, ok := parsePodLogPath(root, path); ok {
+			t.Errorf("%s: got %+v", path, file)
+		}
+	}
+}
+
+// writePodLog appends lines to a pod log file, creating it if needed
+func writePodLog(t *testing.T, root, podDir, container string, lines ...string) {
+	t.Helper()
+
+	dir := filepath.Join(root, podDir, container)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "0.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKubernetesLogCollector(t *testing.T) {
+	api, server := newFakeKubernetesAPI(t)
+	api.setPods("1", testPod("default", "web", "uid-web", "1", map[string]string{"app": "web"}, map[string]string{
+		"team":                          "payments",
+		"pulse-hive.io/parser.app":      "json",
+		"pulse-hive.io/exclude.sidecar": "true",
+		"kubectl.kubernetes.io/last-applied-configuration": "{}",
+	}))
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(api.token), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	dataDir := t.TempDir()
+	cfg := config.KubernetesLogsConfig{
+		Enabled:         true,
+		Path:            root,
+		APIServer:       server.URL,
+		TokenFile:       tokenFile,
+		NodeName:        "node-1",
+		Exclude:         []string{"kube-*"},
+		RefreshInterval: 50 * time.Millisecond,
+		Tags:            map[string]string{"env": "test"},
+	}
+	parsers := map[string]config.ParserConfig{"json": {Type: "json", Fields: map[string]interface{}{"parsed": true}}}
+	collector, err := NewKubernetesLogCollector(cfg, parsers, dataDir, newTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines written before the collector starts are skipped
+	writePodLog(t, root, "default_web_uid-web", "app", "2024-05-01T09:00:00Z stdout F old line")
+
+	data := make(chan interface{}, 100)
+	if err := collector.Start(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Stop(context.Background())
+
+	writePodLog(t, root, "default_web_uid-web", "app",
+		`2024-05-01T10:00:00.000000001Z stdout P {"level":"ERROR",`,
+		`2024-05-01T10:00:00.000000002Z stderr F plain stderr line`,
+		`2024-05-01T10:00:00.000000003Z stdout F "msg":"request failed","status":500}`,
+	)
+	writePodLog(t, root, "default_web_uid-web", "sidecar", "2024-05-01T10:00:00Z stdout F excluded container")
+	writePodLog(t, root, "kube-system_proxy_uid-proxy", "proxy", "2024-05-01T10:00:00Z stdout F excluded namespace")
+	// Pods unknown to the API server are forwarded without metadata
+	writePodLog(t, root, "default_worker_uid-worker", "worker",
+		`{"log":"split ","stream":"stdout","time":"2024-05-01T10:00:01Z"}`,
+		`{"log":"record\n","stream":"stdout","time":"2024-05-01T10:00:02Z"}`,
+	)
+
+	var records []CollectedData
+	for len(records) < 3 {
+		select {
+		case item := <-data:
+			records = append(records, item.(CollectedData))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d records, want 3", len(records))
+		}
+	}
+	select {
+	case item := <-data:
+		t.Errorf("unexpected record %v", item.(CollectedData).Data)
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	bySource := make(map[string][]map[string]interface{})
+	for _, record := range records {
+		bySource[record.Source] = append(bySource[record.Source], record.Data)
+	}
+	web := bySource["kubernetes:default/web/app"]
+	if len(web) != 2 {
+		t.Fatalf("got %d records from the web pod, want 2", len(web))
+	}
+
+	// The stderr line is complete on its own; the stdout record is joined
+	// and parsed as JSON
+	if web[0]["message"] != "plain stderr line" || web[0]["stream"] != "stderr" || web[0]["level"] != "info" {
+		t.Errorf("stderr record = %v", web[0])
+	}
+	want := map[string]interface{}{
+		"message":     "request failed",
+		"timestamp":   "2024-05-01T10:00:00.000000003Z",
+		"source":      "kubernetes",
+		"level":       "error",
+		"status":      float64(500),
+		"parsed":      true,
+		"namespace":   "default",
+		"pod":         "web",
+		"pod_uid":     "uid-web",
+		"container":   "app",
+		"restart":     0,
+		"stream":      "stdout",
+		"node":        "node-1",
+		"image":       "app:1.0",
+		"labels":      map[string]string{"app": "web"},
+		"annotations": map[string]string{"team": "payments", "pulse-hive.io/parser.app": "json", "pulse-hive.io/exclude.sidecar": "true"},
+		"env":         "test",
+	}
+	if !reflect.DeepEqual(web[1], want) {
+		t.Errorf("got %v, want %v", web[1], want)
+	}
+
+	worker := bySource["kubernetes:default/worker/worker"]
+	if len(worker) != 1 {
+		t.Fatalf("got %d records from the worker pod, want 1", len(worker))
+	}
+	if worker[0]["message"] != "split record" || worker[0]["timestamp"] != "2024-05-01T10:00:02Z" {
+		t.Errorf("worker record = %v", worker[0])
+	}
+	for _, key := range []string{"node", "image", "labels"} {
+		if _, exists := worker[0][key]; exists {
+			t.Errorf("record of an unknown pod has %s", key)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package collectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+// fakeKubernetesAPI serves pod list, watch and get requests. Watches
+// stream the events sent on the events channel; like the API server, a
+// watch ends after an ERROR event, and an empty event ends it normally.
+type fakeKubernetesAPI struct {
+	t      *testing.T
+	token  string
+	events chan string
+
+	mu      sync.Mutex
+	pods    []map[string]interface{}
+	version string
+	lists   int
+	watches []string // resource versions watched from
+	gets    int
+}
+
+func newFakeKubernetesAPI(t *testing.T) (*fakeKubernetesAPI, *httptest.Server) {
+	api := &fakeKubernetesAPI{t: t, token: "secret", events: make(chan string, 10), version: "1"}
+	server := httptest.NewServer(api)
+	// Watches end when the events channel is closed
+	t.Cleanup(func() {
+		close(api.events)
+		server.Close()
+	})
+	return api, server
+}
+
+// testPod builds a pod object
+func testPod(namespace, name, uid, version string, labels, annotations map[string]string) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": name, "namespace": namespace, "uid": uid, "resourceVersion": version,
+			"labels": labels, "annotations": annotations,
+		},
+		"spec": map[string]interface{}{
+			"nodeName":       "node-1",
+			"containers":     []map[string]string{{"name": "app", "image": "app:1.0"}},
+			"initContainers": []map[string]string{{"name": "init", "image": "busybox"}},
+		},
+	}
+}
+
+// watchEvent encodes a watch event
+func watchEvent(eventType string, object interface{}) string {
+	data, _ := json.Marshal(map[string]interface{}{"type": eventType, "object": object})
+	return string(data)
+}
+
+func (api *fakeKubernetesAPI) setPods(version string, pods ...map[string]interface{}) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.version = version
+	api.pods = pods
+}
+
+func (api *fakeKubernetesAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+api.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]interface{}{"kind": "Status", "code": 401, "message": "Unauthorized"})
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/api/v1/namespaces/") {
+		api.get(w, r)
+		return
+	}
+	if r.URL.Path != "/api/v1/pods" {
+		http.NotFound(w, r)
+		return
+	}
+	if selector := r.URL.Query().Get("fieldSelector"); selector != "spec.nodeName=node-1" {
+		api.t.Errorf("pods requested with field selector %q", selector)
+	}
+
+	if r.URL.Query().Get("watch") != "true" {
+		api.mu.Lock()
+		api.lists++
+		list := map[string]interface{}{"metadata": map[string]string{"resourceVersion": api.version}, "items": api.pods}
+		api.mu.Unlock()
+		writeJSON(w, list)
+		return
+	}
+
+	api.mu.Lock()
+	api.watches = append(api.watches, r.URL.Query().Get("resourceVersion"))
+	api.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case event, ok := <-api.events:
+			if !ok || event == "" {
+				return
+			}
+			fmt.Fprintln(w, event)
+			w.(http.Flusher).Flush()
+			if strings.Contains(event, `"type":"ERROR"`) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// get serves /api/v1/namespaces/<namespace>/pods/<name>
+func (api *fakeKubernetesAPI) get(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/")
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.gets++
+	for _, pod := range api.pods {
+		meta := pod["metadata"].(map[string]interface{})
+		if len(parts) == 3 && meta["namespace"] == parts[0] && meta["name"] == parts[2] {
+			writeJSON(w, pod)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+	writeJSON(w, map[string]interface{}{"kind": "Status", "code": 404, "message": "pods \"" + parts[len(parts)-1] + "\" not found"})
+}
+
+// newTestPodCache returns a pod cache for the fake API server
+func newTestPodCache(t *testing.T, server *httptest.Server, token string) *kubernetesPodCache {
+	t.Helper()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(token+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := newKubernetesClient(config.KubernetesLogsConfig{APIServer: server.URL + "/", TokenFile: tokenFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newKubernetesPodCache(client, "node-1", newTestLogger(t))
+}
+
+// waitFor polls a condition until it holds
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// cachedPod returns a copy of the cached metadata of a pod
+func cachedPod(pc *kubernetesPodCache, uid string) (podMetadata, bool) {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	meta, exists := pc.pods[uid]
+	if !exists {
+		return podMetadata{}, false
+	}
+	return *meta, true
+}
+
+func TestKubernetesPodCacheListAndWatch(t *testing.T) {
+	api, server := newFakeKubernetesAPI(t)
+	api.setPods("100",
+		testPod("default", "web", "uid-web", "90", map[string]string{"app": "web"}, nil),
+		testPod("default", "db", "uid-db", "95", nil, nil),
+	)
+	pc := newTestPodCache(t, server, api.token)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pc.run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor(t, "the initial list", func() bool {
+		synced, count, _ := pc.status()
+		return synced && count == 2
+	})
+	web, _ := cachedPod(pc, "uid-web")
+	if web.Namespace != "default" || web.Name != "web" || web.Node != "node-1" || web.Labels["app"] != "web" ||
+		web.Images["app"] != "app:1.0" || web.Images["init"] != "busybox" {
+		t.Errorf("cached pod = %+v", web)
+	}
+
+	api.events <- watchEvent("ADDED", testPod("default", "worker", "uid-worker", "101", nil, nil))
+	api.events <- watchEvent("MODIFIED", testPod("default", "web", "uid-web", "102", map[string]string{"app": "web", "version": "2"}, nil))
+	api.events <- watchEvent("DELETED", testPod("default", "db", "uid-db", "103", nil, nil))
+	// Bookmarks only advance the resource version
+	api.events <- watchEvent("BOOKMARK", map[string]interface{}{"metadata": map[string]string{"resourceVersion": "104"}})
+
+	waitFor(t, "the watch events", func() bool {
+		worker, added := cachedPod(pc, "uid-worker")
+		web, _ := cachedPod(pc, "uid-web")
+		db, _ := cachedPod(pc, "uid-db")
+		return added && worker.Name == "worker" && web.Labels["version"] == "2" && !db.deleted.IsZero()
+	})
+	if _, count, _ := pc.status(); count != 3 {
+		t.Errorf("got %d cached pods, want 3 including the deleted one", count)
+	}
+
+	// An expired resource version causes a relist; pods gone from the new
+	// list are kept as deleted
+	api.setPods("200", testPod("default", "web", "uid-web", "199", nil, nil))
+	api.events <- watchEvent("ERROR", map[string]interface{}{"kind": "Status", "code": 410, "reason": "Expired", "message": "too old resource version"})
+
+	waitFor(t, "the relist", func() bool {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		return api.lists == 2 && len(api.watches) == 2
+	})
+	api.mu.Lock()
+	watches := append([]string(nil), api.watches...)
+	api.mu.Unlock()
+	if watches[0] != "100" || watches[1] != "200" {
+		t.Errorf("watched from resource versions %v, want [100 200]", watches)
+	}
+	worker, _ := cachedPod(pc, "uid-worker")
+	if worker.deleted.IsZero() {
+		t.Error("pod missing from the relist is not marked deleted")
+	}
+	if _, _, lastErr := pc.status(); lastErr != "" {
+		t.Errorf("unexpected error after an expired watch: %s", lastErr)
+	}
+}
+
+func TestKubernetesPodCacheWatchResume(t *testing.T) {
+	api, server := newFakeKubernetesAPI(t)
+	api.setPods("100")
+	pc := newTestPodCache(t, server, api.token)
+
+	// A watch that ends normally returns the last version seen
+	api.events <- watchEvent("ADDED", testPod("default", "web", "uid-web", "150", nil, nil))
+	api.events <- ""
+	version, err := pc.watch(context.Background(), "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "150" {
+		t.Errorf("watch ended at version %q, want 150", version)
+	}
+
+	api.events <- watchEvent("ERROR", map[string]interface{}{"kind": "Status", "code": 500, "message": "internal error"})
+	if _, err := pc.watch(context.Background(), version); err == nil || !strings.Contains(err.Error(), "internal error") {
+		t.Errorf("got %v, want the watch error", err)
+	}
+
+	api.events <- "{not json"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := pc.watch(ctx, version); err == nil {
+		t.Error("expected an error for a malformed event")
+	}
+}
+
+func TestKubernetesPodCacheLookup(t *testing.T) {
+	api, server := newFakeKubernetesAPI(t)
+	api.setPods("1", testPod("default", "web", "uid-web", "1", map[string]string{"app": "web"}, nil))
+	pc := newTestPodCache(t, server, api.token)
+	ctx := context.Background()
+
+	// Pods not seen by the watch are fetched directly and cached
+	meta := pc.lookup(ctx, "default", "web", "uid-web")
+	if meta == nil || meta.Labels["app"] != "web" {
+		t.Fatalf("lookup returned %+v", meta)
+	}
+	pc.lookup(ctx, "default", "web", "uid-web")
+
+	// A pod recreated under the same name is a different pod, and misses
+	// are not retried within a minute
+	if meta := pc.lookup(ctx, "default", "web", "uid-old"); meta != nil {
+		t.Errorf("lookup of a recreated pod returned %+v", meta)
+	}
+	pc.lookup(ctx, "default", "web", "uid-old")
+	if meta := pc.lookup(ctx, "default", "gone", "uid-gone"); meta != nil {
+		t.Errorf("lookup of a missing pod returned %+v", meta)
+	}
+
+	api.mu.Lock()
+	gets := api.gets
+	api.mu.Unlock()
+	if gets != 3 {
+		t.Errorf("got %d API requests, want 3", gets)
+	}
+}
+
+func TestKubernetesClientErrors(t *testing.T) {
+	api, server := newFakeKubernetesAPI(t)
+	pc := newTestPodCache(t, server, "wrong")
+
+	if _, err := pc.list(context.Background()); err == nil || !strings.Contains(err.Error(), "401: Unauthorized") {
+		t.Errorf("got %v, want the API status message", err)
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.lists != 0 {
+		t.Error("request was served without a valid token")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -180,6 +181,18 @@ func (lc *LogCollector) Health() HealthStatus {
 	return status
 }
 
+// WatchedFiles returns the log files being tailed and their read positions
+func (lc *LogCollector) WatchedFiles() []WatchedFile {
+	lc.filesMu.RLock()
+	defer lc.filesMu.RUnlock()
+
+	files := make([]WatchedFile, 0, len(lc.files))
+	for _, file := range lc.files {
+		files = append(files, WatchedFile{Path: file.path, Offset: atomic.LoadInt64(&file.position)})
+	}
+	return files
+}
+
 // discoverLogFiles discovers log files based on configuration
 func (lc *LogCollector) discoverLogFiles() error {
 	for _, pathConfig := range lc.config.Paths {
@@ -446,7 +459,8 @@ func (lc *LogCollector) scanFile(logFile *logFile) {
 				}
 				
 				// Update position after processing the newline
-				logFile.position, _ = logFile.file.Seek(0, 1)
+				position, _ := logFile.file.Seek(0, 1)
+				atomic.StoreInt64(&logFile.position, position)
 			} else if b != '\r' { // Skip carriage returns
 				// Add byte to line buffer
 				lineBuffer = append(lineBuffer, b)
@@ -454,7 +468,8 @@ func (lc *LogCollector) scanFile(logFile *logFile) {
 		}
 		
 		// Update position after reading chunk
-		logFile.position, _ = logFile.file.Seek(0, 1)
+		position, _ := logFile.file.Seek(0, 1)
+		atomic.StoreInt64(&logFile.position, position)
 		
 		// Rate limiting check
 		if linesRead > 0 && linesRead%100 == 0 {
@@ -29,6 +29,10 @@ type SystemMetricsCollector struct {
 	
 	healthy   bool
 	lastError string
+
+	processes *processTracker
+	docker    *dockerClient
+	services  *systemdReader
 }
 
 // NewSystemMetricsCollector creates a new system metrics collector
@@ -37,12 +41,27 @@ func NewSystemMetricsCollector(cfg config.MetricsCollectorConfig, log *logger.Lo
 		return nil, fmt.Errorf("metrics collector is disabled")
 	}
 
-	return &SystemMetricsCollector{
-		name:    "system-metrics-collector",
-		config:  cfg,
-		logger:  log,
-		healthy: true,
-	}, nil
+	processes, err := newProcessTracker(cfg.SystemMetrics.Processes)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := &SystemMetricsCollector{
+		name:      "system-metrics-collector",
+		config:    cfg,
+		logger:    log,
+		healthy:   true,
+		processes: processes,
+	}
+
+	if cfg.SystemMetrics.Docker {
+		collector.docker = newDockerClient(cfg.SystemMetrics.DockerSocket)
+	}
+	if cfg.SystemMetrics.Services {
+		collector.services = newSystemdReader()
+	}
+
+	return collector, nil
 }
 
 // Name returns the collector name
@@ -81,6 +100,9 @@ func (smc *SystemMetricsCollector) Stop(ctx context.Context) error {
 
 	select {
 	case <-done:
+		if smc.services != nil {
+			smc.services.close()
+		}
 		smc.logger.Info("System metrics collector stopped")
 		return nil
 	case <-ctx.Done():
@@ -152,6 +174,22 @@ func (smc *SystemMetricsCollector) gatherMetrics() {
 		smc.collectProcessMetrics(timestamp)
 	}
 
+	if smc.config.SystemMetrics.Docker {
+		smc.collectDockerMetrics(timestamp)
+	}
+
+	if smc.config.SystemMetrics.Services {
+		smc.collectServiceMetrics(timestamp)
+	}
+
+	if smc.config.SystemMetrics.Pressure {
+		smc.collectPressureMetrics(timestamp)
+	}
+
+	if smc.config.SystemMetrics.Cgroups.Enabled {
+		smc.collectCgroupMetrics(timestamp)
+	}
+
 	// Collect custom metrics
 	for _, customMetric := range smc.config.CustomMetrics {
 		smc.collectCustomMetric(customMetric, timestamp)
@@ -408,6 +446,9 @@ func (smc *SystemMetricsCollector) collectProcessMetrics(timestamp time.Time) {
 			Unit:      "count",
 		})
 	}
+
+	// Per-process metrics for the top consumers and tracked groups
+	smc.collectProcessDetails(processes, timestamp)
 }
 
 // collectCustomMetric collects a custom metric
@@ -0,0 +1,328 @@
+package collectors
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"hive-agent/internal/config"
+)
+
+// processMatcher matches processes against a ProcessMatchConfig
+type processMatcher struct {
+	name    string
+	process string
+	cmdline *regexp.Regexp
+	user    string
+}
+
+// processSample holds the resource usage of a single process
+type processSample struct {
+	pid        int32
+	name       string
+	user       string
+	cmdline    string
+	cpuPercent float64
+	rss        uint64
+	openFDs    int32
+	threads    int32
+	readBytes  uint64
+	writeBytes uint64
+}
+
+// processTracker keeps process handles between collections so that CPU
+// percentages can be computed from the delta since the previous sample
+type processTracker struct {
+	procs   map[int32]*process.Process
+	groups  []*processMatcher
+	exclude []*processMatcher
+}
+
+// newProcessTracker compiles the configured process matchers
+func newProcessTracker(cfg config.ProcessMetricsConfig) (*processTracker, error) {
+	groups, err := compileProcessMatchers(cfg.Groups)
+	if err != nil {
+		return nil, fmt.Errorf("invalid process group: %w", err)
+	}
+	exclude, err := compileProcessMatchers(cfg.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid process exclude: %w", err)
+	}
+
+	return &processTracker{
+		procs:   make(map[int32]*process.Process),
+		groups:  groups,
+		exclude: exclude,
+	}, nil
+}
+
+// compileProcessMatchers compiles match configurations
+func compileProcessMatchers(cfgs []config.ProcessMatchConfig) ([]*processMatcher, error) {
+	matchers := make([]*processMatcher, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg.Process == "" && cfg.Cmdline == "" && cfg.User == "" {
+			return nil, fmt.Errorf("%s: at least one of process, cmdline or user is required", cfg.Name)
+		}
+
+		matcher := &processMatcher{
+			name:    processMatcherName(cfg),
+			process: cfg.Process,
+			user:    cfg.User,
+		}
+		if cfg.Cmdline != "" {
+			regex, err := regexp.Compile(cfg.Cmdline)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid cmdline pattern: %w", matcher.name, err)
+			}
+			matcher.cmdline = regex
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// processMatcherName returns the label of a match configuration: its name,
+// or else its criteria, so that unnamed groups stay distinguishable
+func processMatcherName(cfg config.ProcessMatchConfig) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	var criteria []string
+	if cfg.Process != "" {
+		criteria = append(criteria, "process="+cfg.Process)
+	}
+	if cfg.Cmdline != "" {
+		criteria = append(criteria, "cmdline="+cfg.Cmdline)
+	}
+	if cfg.User != "" {
+		criteria = append(criteria, "user="+cfg.User)
+	}
+	return strings.Join(criteria, ",")
+}
+
+// matches reports whether the sample satisfies all criteria of the matcher
+func (m *processMatcher) matches(sample *processSample) bool {
+	if m.process != "" && m.process != sample.name {
+		return false
+	}
+	if m.user != "" && m.user != sample.user {
+		return false
+	}
+	if m.cmdline != nil && !m.cmdline.MatchString(sample.cmdline) {
+		return false
+	}
+	return true
+}
+
+// needs reports which optional fields the configured matchers require
+func (pt *processTracker) needs() (user bool, cmdline bool) {
+	for _, matchers := range [][]*processMatcher{pt.groups, pt.exclude} {
+		for _, m := range matchers {
+			user = user || m.user != ""
+			cmdline = cmdline || m.cmdline != nil
+		}
+	}
+	return user, cmdline
+}
+
+// sample takes a lightweight sample of every running process. Only the
+// fields needed for ranking and matching are read here; the expensive
+// details are filled in later for the selected processes only.
+func (pt *processTracker) sample(processes []*process.Process) []*processSample {
+	needUser, needCmdline := pt.needs()
+
+	seen := make(map[int32]bool, len(processes))
+	samples := make([]*processSample, 0, len(processes))
+
+	for _, proc := range processes {
+		seen[proc.Pid] = true
+
+		// Reuse the handle from the previous run to keep CPU time history,
+		// unless the PID now belongs to another process
+		tracked, exists := pt.procs[proc.Pid]
+		if !exists || !sameProcess(tracked, proc) {
+			tracked = proc
+			pt.procs[proc.Pid] = tracked
+		}
+
+		name, err := tracked.Name()
+		if err != nil {
+			continue
+		}
+
+		sample := &processSample{pid: tracked.Pid, name: name}
+		if cpuPercent, err := tracked.Percent(0); err == nil {
+			sample.cpuPercent = cpuPercent
+		}
+		if memInfo, err := tracked.MemoryInfo(); err == nil {
+			sample.rss = memInfo.RSS
+		}
+		if needUser {
+			sample.user, _ = tracked.Username()
+		}
+		if needCmdline {
+			sample.cmdline, _ = tracked.Cmdline()
+		}
+
+		if pt.excluded(sample) {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+
+	// Forget processes that have exited
+	for pid := range pt.procs {
+		if !seen[pid] {
+			delete(pt.procs, pid)
+		}
+	}
+
+	return samples
+}
+
+// sameProcess reports whether two handles of a PID refer to the same
+// process, by comparing their creation times. These have a resolution of a
+// second, which leaves PIDs reused within the same second undetected.
+func sameProcess(tracked, current *process.Process) bool {
+	previous, err := tracked.CreateTime()
+	if err != nil {
+		return false
+	}
+	created, err := current.CreateTime()
+	return err == nil && created == previous
+}
+
+// excluded reports whether the sample matches any exclude rule
+func (pt *processTracker) excluded(sample *processSample) bool {
+	for _, m := range pt.exclude {
+		if m.matches(sample) {
+			return true
+		}
+	}
+	return false
+}
+
+// fillDetails reads file descriptor, thread and I/O counters for a sample
+func (pt *processTracker) fillDetails(sample *processSample) {
+	proc, exists := pt.procs[sample.pid]
+	if !exists {
+		return
+	}
+
+	if sample.user == "" {
+		sample.user, _ = proc.Username()
+	}
+	if fds, err := proc.NumFDs(); err == nil {
+		sample.openFDs = fds
+	}
+	if threads, err := proc.NumThreads(); err == nil {
+		sample.threads = threads
+	}
+	if io, err := proc.IOCounters(); err == nil {
+		sample.readBytes = io.ReadBytes
+		sample.writeBytes = io.WriteBytes
+	}
+}
+
+// topProcesses returns the top N samples by CPU and by memory. The value
+// maps each selected sample to the rankings it was selected for.
+func topProcesses(samples []*processSample, n int) map[*processSample][]string {
+	selected := make(map[*processSample][]string)
+
+	byCPU := func(i, j int) bool { return samples[i].cpuPercent > samples[j].cpuPercent }
+	for _, i := range TopRanked(len(samples), n, byCPU) {
+		selected[samples[i]] = append(selected[samples[i]], "cpu")
+	}
+	byMemory := func(i, j int) bool { return samples[i].rss > samples[j].rss }
+	for _, i := range TopRanked(len(samples), n, byMemory) {
+		selected[samples[i]] = append(selected[samples[i]], "memory")
+	}
+
+	return selected
+}
+
+// TopRanked returns the indexes of the first n of count items, ordered by
+// ranksBefore, which reports whether item i ranks before item j. Items that
+// rank equally keep their order.
+func TopRanked(count, n int, ranksBefore func(i, j int) bool) []int {
+	if n <= 0 {
+		return nil
+	}
+	ranked := make([]int, count)
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranksBefore(ranked[i], ranked[j]) })
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// collectProcessDetails emits per-process metrics for the top processes and
+// aggregated metrics for each configured process group
+func (smc *SystemMetricsCollector) collectProcessDetails(processes []*process.Process, timestamp time.Time) {
+	samples := smc.processes.sample(processes)
+
+	top := topProcesses(samples, smc.config.SystemMetrics.Processes.TopN)
+	for sample, rankings := range top {
+		smc.processes.fillDetails(sample)
+
+		labels := map[string]string{
+			"pid":     fmt.Sprintf("%d", sample.pid),
+			"process": sample.name,
+			"user":    sample.user,
+			"top":     strings.Join(rankings, ","),
+		}
+		smc.sendProcessMetrics("system.process", sample, labels, "counter", timestamp)
+	}
+
+	for _, group := range smc.processes.groups {
+		total := &processSample{}
+		count := 0
+		for _, sample := range samples {
+			if !group.matches(sample) {
+				continue
+			}
+			if _, detailed := top[sample]; !detailed {
+				smc.processes.fillDetails(sample)
+			}
+			count++
+			total.cpuPercent += sample.cpuPercent
+			total.rss += sample.rss
+			total.openFDs += sample.openFDs
+			total.threads += sample.threads
+			total.readBytes += sample.readBytes
+			total.writeBytes += sample.writeBytes
+		}
+
+		labels := map[string]string{"group": group.name}
+		smc.sendMetric(&MetricData{
+			Name:      "system.process.group.count",
+			Type:      "gauge",
+			Value:     count,
+			Labels:    labels,
+			Timestamp: timestamp.Format(time.RFC3339),
+			Unit:      "count",
+		})
+		// Summed I/O drops when a process of the group exits, so it is
+		// not a counter
+		smc.sendProcessMetrics("system.process.group", total, labels, "gauge", timestamp)
+	}
+}
+
+// sendProcessMetrics emits the resource usage metrics of a process sample.
+// ioType is the metric type of the I/O byte totals.
+func (smc *SystemMetricsCollector) sendProcessMetrics(prefix string, sample *processSample, labels map[string]string, ioType string, timestamp time.Time) {
+	ts := timestamp.Format(time.RFC3339)
+
+	smc.sendMetric(&MetricData{Name: prefix + ".cpu_percent", Type: "gauge", Value: sample.cpuPercent, Labels: labels, Timestamp: ts, Unit: "percent"})
+	smc.sendMetric(&MetricData{Name: prefix + ".memory_rss", Type: "gauge", Value: sample.rss, Labels: labels, Timestamp: ts, Unit: "bytes"})
+	smc.sendMetric(&MetricData{Name: prefix + ".open_fds", Type: "gauge", Value: sample.openFDs, Labels: labels, Timestamp: ts, Unit: "count"})
+	smc.sendMetric(&MetricData{Name: prefix + ".threads", Type: "gauge", Value: sample.threads, Labels: labels, Timestamp: ts, Unit: "count"})
+	smc.sendMetric(&MetricData{Name: prefix + ".io_read_bytes", Type: ioType, Value: sample.readBytes, Labels: labels, Timestamp: ts, Unit: "bytes"})
+	smc.sendMetric(&MetricData{Name: prefix + ".io_write_bytes", Type: ioType, Value: sample.writeBytes, Labels: labels, Timestamp: ts, Unit: "bytes"})
+}
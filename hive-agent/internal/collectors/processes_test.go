@@ -0,0 +1,176 @@
+package collectors
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"hive-agent/internal/config"
+)
+
+func TestProcessMatchers(t *testing.T) {
+	matchers, err := compileProcessMatchers([]config.ProcessMatchConfig{
+		{Name: "web", Process: "nginx"},
+		{Cmdline: "^java .*app\\.jar", User: "app"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	web, java := matchers[0], matchers[1]
+	if web.name != "web" || java.name != `cmdline=^java .*app\.jar,user=app` {
+		t.Errorf("names = %q, %q", web.name, java.name)
+	}
+
+	tests := []struct {
+		matcher *processMatcher
+		sample  processSample
+		want    bool
+	}{
+		{web, processSample{name: "nginx", user: "www-data"}, true},
+		{web, processSample{name: "nginx-debug"}, false},
+		{java, processSample{name: "java", user: "app", cmdline: "java -jar app.jar"}, true},
+		// All criteria must match
+		{java, processSample{name: "java", user: "root", cmdline: "java -jar app.jar"}, false},
+		{java, processSample{name: "java", user: "app", cmdline: "/usr/bin/java -jar app.jar"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.matcher.matches(&tt.sample); got != tt.want {
+			t.Errorf("%s matches %+v = %v, want %v", tt.matcher.name, tt.sample, got, tt.want)
+		}
+	}
+
+	for _, cfgs := range [][]config.ProcessMatchConfig{
+		{{Name: "empty"}},
+		{{Name: "bad", Cmdline: "("}},
+	} {
+		if _, err := compileProcessMatchers(cfgs); err == nil {
+			t.Errorf("%+v: expected an error", cfgs)
+		}
+	}
+}
+
+func TestProcessTrackerExclude(t *testing.T) {
+	tracker, err := newProcessTracker(config.ProcessMetricsConfig{
+		Groups:  []config.ProcessMatchConfig{{Name: "web", Process: "nginx"}},
+		Exclude: []config.ProcessMatchConfig{{User: "backup"}, {Process: "rsync"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, cmdline := tracker.needs(); !user || cmdline {
+		t.Errorf("needs() = %v, %v", user, cmdline)
+	}
+
+	tests := []struct {
+		sample processSample
+		want   bool
+	}{
+		{processSample{name: "nginx", user: "www-data"}, false},
+		{processSample{name: "tar", user: "backup"}, true},
+		{processSample{name: "rsync", user: "root"}, true},
+	}
+	for _, tt := range tests {
+		if got := tracker.excluded(&tt.sample); got != tt.want {
+			t.Errorf("excluded(%+v) = %v, want %v", tt.sample, got, tt.want)
+		}
+	}
+
+	if _, err := newProcessTracker(config.ProcessMetricsConfig{Exclude: []config.ProcessMatchConfig{{Cmdline: "["}}}); err == nil {
+		t.Error("expected an error for an invalid exclude pattern")
+	}
+}
+
+func TestTopProcesses(t *testing.T) {
+	busy := &processSample{pid: 1, cpuPercent: 90, rss: 10}
+	large := &processSample{pid: 2, cpuPercent: 5, rss: 900}
+	both := &processSample{pid: 3, cpuPercent: 50, rss: 500}
+	idle := &processSample{pid: 4, cpuPercent: 0, rss: 1}
+	samples := []*processSample{idle, busy, large, both}
+
+	want := map[*processSample][]string{
+		busy:  {"cpu"},
+		large: {"memory"},
+		both:  {"cpu", "memory"},
+	}
+	if got := topProcesses(samples, 2); !reflect.DeepEqual(got, want) {
+		t.Errorf("top 2 = %v, want %v", got, want)
+	}
+	if got := topProcesses(samples, 10); len(got) != 4 || len(got[idle]) != 2 {
+		t.Errorf("top 10 = %v", got)
+	}
+	if got := topProcesses(samples, -1); len(got) != 0 {
+		t.Errorf("disabled top = %v", got)
+	}
+}
+
+func TestTopRanked(t *testing.T) {
+	values := []int{3, 7, 1, 7, 5}
+	higher := func(i, j int) bool { return values[i] > values[j] }
+
+	tests := []struct {
+		n    int
+		want []int
+	}{
+		// Equal values keep their order
+		{3, []int{1, 3, 4}},
+		{10, []int{1, 3, 4, 0, 2}},
+		{0, nil},
+	}
+	for _, tt := range tests {
+		if got := TopRanked(len(values), tt.n, higher); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TopRanked(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestProcessTrackerPIDReuse(t *testing.T) {
+	handle := func(pid int32) *process.Process {
+		t.Helper()
+		proc, err := process.NewProcess(pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return proc
+	}
+
+	// Creation times have a resolution of a second, so the process that
+	// stands in for the previous owner of the PID must be older than that
+	older := handle(int32(os.Getpid()))
+	time.Sleep(1100 * time.Millisecond)
+
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	pid := int32(cmd.Process.Pid)
+
+	tracker, err := newProcessTracker(config.ProcessMetricsConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := handle(pid)
+	tracker.sample([]*process.Process{first})
+	// The same process keeps its handle, and so its CPU time history
+	tracker.sample([]*process.Process{handle(pid)})
+	if tracker.procs[pid] != first {
+		t.Error("handle of a running process replaced")
+	}
+
+	// Stand in for a reused PID with the handle of the older process
+	tracker.procs[pid] = older
+	current := handle(pid)
+	samples := tracker.sample([]*process.Process{current})
+	if tracker.procs[pid] != current {
+		t.Error("handle of a previous process with the same PID kept")
+	}
+	if len(samples) != 1 || samples[0].name != "sleep" {
+		t.Errorf("samples = %+v", samples)
+	}
+}
@@ -0,0 +1,146 @@
+package collectors
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"hive-agent/internal/config"
+)
+
+// metricNameLabel holds the metric name during relabeling
+const metricNameLabel = "__name__"
+
+// relabelRule is a compiled Prometheus-style relabeling rule
+type relabelRule struct {
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+	action       string
+}
+
+// compileRelabelRules validates and compiles relabeling rules
+func compileRelabelRules(rules []config.RelabelConfig) ([]*relabelRule, error) {
+	compiled := make([]*relabelRule, 0, len(rules))
+
+	for i, rule := range rules {
+		r := &relabelRule{
+			sourceLabels: rule.SourceLabels,
+			separator:    rule.Separator,
+			targetLabel:  rule.TargetLabel,
+			replacement:  rule.Replacement,
+			action:       strings.ToLower(rule.Action),
+		}
+		if r.separator == "" {
+			r.separator = ";"
+		}
+		if r.action == "" {
+			r.action = "replace"
+		}
+
+		pattern := rule.Regex
+		if pattern == "" {
+			pattern = "(.*)"
+		}
+		regex, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: invalid regex %q: %w", i, rule.Regex, err)
+		}
+		r.regex = regex
+
+		switch r.action {
+		case "replace":
+			if r.targetLabel == "" {
+				return nil, fmt.Errorf("relabel rule %d: replace requires target_label", i)
+			}
+			if rule.Replacement == "" {
+				r.replacement = "$1"
+			}
+		case "labelmap":
+			if rule.Replacement == "" {
+				r.replacement = "$1"
+			}
+		case "keep", "drop":
+			if len(r.sourceLabels) == 0 {
+				return nil, fmt.Errorf("relabel rule %d: %s requires source_labels", i, r.action)
+			}
+		case "labeldrop", "labelkeep":
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unsupported action %q", i, rule.Action)
+		}
+
+		compiled = append(compiled, r)
+	}
+
+	return compiled, nil
+}
+
+// relabel applies the rules to a label set in order. It returns false when
+// the sample is dropped. Labels whose value becomes empty are removed.
+func relabel(labels map[string]string, rules []*relabelRule) bool {
+	for _, r := range rules {
+		switch r.action {
+		case "replace":
+			value := r.sourceValue(labels)
+			match := r.regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			target := string(r.regex.ExpandString(nil, r.targetLabel, value, match))
+			result := string(r.regex.ExpandString(nil, r.replacement, value, match))
+			if result == "" {
+				delete(labels, target)
+			} else {
+				labels[target] = result
+			}
+
+		case "keep":
+			if !r.regex.MatchString(r.sourceValue(labels)) {
+				return false
+			}
+
+		case "drop":
+			if r.regex.MatchString(r.sourceValue(labels)) {
+				return false
+			}
+
+		case "labelmap":
+			mapped := make(map[string]string)
+			for name, value := range labels {
+				if match := r.regex.FindStringSubmatchIndex(name); match != nil {
+					mapped[string(r.regex.ExpandString(nil, r.replacement, name, match))] = value
+				}
+			}
+			for name, value := range mapped {
+				labels[name] = value
+			}
+
+		case "labeldrop":
+			for name := range labels {
+				if name != metricNameLabel && r.regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+
+		case "labelkeep":
+			for name := range labels {
+				if name != metricNameLabel && !r.regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+
+	return labels[metricNameLabel] != ""
+}
+
+// sourceValue joins the values of the rule's source labels
+func (r *relabelRule) sourceValue(labels map[string]string) string {
+	values := make([]string, len(r.sourceLabels))
+	for i, name := range r.sourceLabels {
+		values[i] = labels[name]
+	}
+	return strings.Join(values, r.separator)
+}
@@ -0,0 +1,559 @@
+package collectors
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/logger"
+)
+
+// scrapeAcceptHeader prefers OpenMetrics and falls back to the text format
+const scrapeAcceptHeader = "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+
+// maxScrapeBodySize bounds the size of a single scrape response
+const maxScrapeBodySize = 64 * 1024 * 1024
+
+// ScrapeCollector scrapes Prometheus and OpenMetrics endpoints
+type ScrapeCollector struct {
+	name     string
+	config   config.ScrapeCollectorConfig
+	logger   *logger.Logger
+	dataChan chan<- interface{}
+	targets  []*scrapeTarget
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	healthy   bool
+	lastError string
+}
+
+// scrapeTarget is a configured target and its last scrape result
+type scrapeTarget struct {
+	config   config.ScrapeTargetConfig
+	job      string
+	instance string
+	client   *http.Client
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	relabel  []*relabelRule
+
+	mu         sync.Mutex
+	up         bool
+	lastScrape time.Time
+	lastError  string
+	samples    int
+}
+
+// NewScrapeCollector creates a new scrape collector
+func NewScrapeCollector(cfg config.ScrapeCollectorConfig, log *logger.Logger) (*ScrapeCollector, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("scrape collector is disabled")
+	}
+
+	collector := &ScrapeCollector{
+		name:    "scrape-collector",
+		config:  cfg,
+		logger:  log,
+		healthy: true,
+	}
+
+	for i, targetCfg := range cfg.Targets {
+		target, err := newScrapeTarget(targetCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scrape target %d: %w", i, err)
+		}
+		collector.targets = append(collector.targets, target)
+	}
+
+	return collector, nil
+}
+
+// newScrapeTarget validates a target configuration and prepares its client
+func newScrapeTarget(cfg config.ScrapeTargetConfig) (*scrapeTarget, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", cfg.URL)
+	}
+
+	target := &scrapeTarget{
+		config:   cfg,
+		job:      cfg.Name,
+		instance: u.Host,
+	}
+	if target.job == "" {
+		target.job = u.Host
+	}
+
+	if target.include, err = compileRegexps(cfg.Include); err != nil {
+		return nil, err
+	}
+	if target.exclude, err = compileRegexps(cfg.Exclude); err != nil {
+		return nil, err
+	}
+	if target.relabel, err = compileRelabelRules(cfg.Relabel); err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:        2,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	if cfg.TLS.Enabled || u.Scheme == "https" {
+		tlsConfig, err := scrapeTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	target.client = &http.Client{Transport: transport}
+
+	return target, nil
+}
+
+// compileRegexps compiles anchored metric name patterns
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, regex)
+	}
+	return compiled, nil
+}
+
+// scrapeTLSConfig builds the client TLS configuration of a target
+func scrapeTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" && cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// Name returns the collector name
+func (sc *ScrapeCollector) Name() string {
+	return sc.name
+}
+
+// Start starts scraping all targets
+func (sc *ScrapeCollector) Start(ctx context.Context, dataChan chan<- interface{}) error {
+	sc.ctx, sc.cancel = context.WithCancel(ctx)
+	sc.dataChan = dataChan
+
+	sc.logger.Info("Starting scrape collector", "targets", len(sc.targets))
+
+	for _, target := range sc.targets {
+		sc.wg.Add(1)
+		go sc.scrapeLoop(target)
+	}
+
+	sc.logger.Info("Scrape collector started")
+	return nil
+}
+
+// Stop stops the scrape collector
+func (sc *ScrapeCollector) Stop(ctx context.Context) error {
+	sc.logger.Info("Stopping scrape collector")
+
+	if sc.cancel != nil {
+		sc.cancel()
+	}
+
+	// Wait for goroutines to finish
+	done := make(chan struct{})
+	go func() {
+		sc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		sc.logger.Info("Scrape collector stopped")
+		return nil
+	case <-ctx.Done():
+		sc.logger.Warn("Scrape collector stop timeout")
+		return ctx.Err()
+	}
+}
+
+// Health returns the collector health status
+func (sc *ScrapeCollector) Health() HealthStatus {
+	status := HealthStatus{
+		Healthy:   sc.healthy,
+		Message:   "Scrape collector operational",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Details:   make(map[string]string),
+	}
+
+	down := 0
+	for _, target := range sc.targets {
+		target.mu.Lock()
+		state := "pending"
+		switch {
+		case target.up:
+			state = fmt.Sprintf("up (%d samples)", target.samples)
+		case !target.lastScrape.IsZero():
+			state = "down: " + target.lastError
+			down++
+		}
+		target.mu.Unlock()
+		status.Details[target.job+"/"+target.instance] = state
+	}
+
+	if down > 0 {
+		status.Message = fmt.Sprintf("%d of %d scrape targets down", down, len(sc.targets))
+		if down == len(sc.targets) {
+			status.Healthy = false
+		}
+	}
+
+	return status
+}
+
+// scrapeLoop scrapes a target at its interval
+func (sc *ScrapeCollector) scrapeLoop(target *scrapeTarget) {
+	defer sc.wg.Done()
+
+	ticker := time.NewTicker(target.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		sc.scrape(target)
+
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scrape fetches and forwards the metrics of a target once
+func (sc *ScrapeCollector) scrape(target *scrapeTarget) {
+	start := time.Now()
+
+	families, err := sc.fetch(target)
+	if sc.ctx.Err() != nil {
+		return
+	}
+
+	samples := 0
+	if err == nil {
+		samples = sc.sendFamilies(target, families, start)
+	}
+	duration := time.Since(start)
+
+	target.mu.Lock()
+	target.lastScrape = start
+	target.up = err == nil
+	target.samples = samples
+	if err != nil {
+		target.lastError = err.Error()
+	} else {
+		target.lastError = ""
+	}
+	target.mu.Unlock()
+
+	if err != nil {
+		sc.logger.Warn("Scrape failed", "job", target.job, "url", target.config.URL, "error", err)
+	}
+
+	// Scrape health metrics, as Prometheus records them per target
+	up := 0
+	if err == nil {
+		up = 1
+	}
+	ts := start.Format(time.RFC3339)
+	labels := target.baseLabels()
+	sc.sendMetric(&MetricData{Name: "scrape.up", Type: "gauge", Value: up, Labels: labels, Timestamp: ts, Unit: "boolean"})
+	sc.sendMetric(&MetricData{Name: "scrape.duration", Type: "gauge", Value: duration.Seconds(), Labels: labels, Timestamp: ts, Unit: "seconds"})
+	sc.sendMetric(&MetricData{Name: "scrape.samples", Type: "gauge", Value: samples, Labels: labels, Timestamp: ts, Unit: "count"})
+}
+
+// fetch requests the target and parses the exposition
+func (sc *ScrapeCollector) fetch(target *scrapeTarget) ([]*metricFamily, error) {
+	ctx, cancel := context.WithTimeout(sc.ctx, target.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.config.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", scrapeAcceptHeader)
+	req.Header.Set("User-Agent", "pulse-hive-agent")
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", strconv.FormatFloat(target.config.Timeout.Seconds(), 'f', -1, 64))
+	for key, value := range target.config.Headers {
+		req.Header.Set(key, value)
+	}
+	target.config.Auth.SetHeaders(req)
+
+	resp, err := target.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	openMetrics := strings.HasPrefix(resp.Header.Get("Content-Type"), "application/openmetrics-text")
+	families, err := parseExposition(io.LimitReader(resp.Body, maxScrapeBodySize), openMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+	return families, nil
+}
+
+// sendFamilies converts metric families to metric data and returns the
+// number of series forwarded
+func (sc *ScrapeCollector) sendFamilies(target *scrapeTarget, families []*metricFamily, scrapeTime time.Time) int {
+	sent := 0
+
+	for _, family := range families {
+		if !target.allowed(family.Name) {
+			continue
+		}
+
+		if family.Type == "histogram" || family.Type == "summary" {
+			sent += sc.sendDistributions(target, family, scrapeTime)
+			continue
+		}
+
+		metricType := "gauge"
+		if family.Type == "counter" {
+			metricType = "counter"
+		}
+
+		for _, sample := range family.Samples {
+			// Creation timestamps are metadata, not values
+			if strings.HasSuffix(sample.Name, "_created") && sample.Name != family.Name {
+				continue
+			}
+			// NaN and infinite values cannot be encoded by the JSON outputs
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+
+			timestamp := scrapeTime
+			if sample.HasTimestamp {
+				timestamp = time.UnixMilli(sample.TimestampMs)
+			}
+
+			if sc.sendSample(target, sample.Name, sample.Labels, metricType, sample.Value, timestamp, family.Unit) {
+				sent++
+			}
+		}
+	}
+
+	return sent
+}
+
+// distributionSeries collects the samples of one histogram or summary series
+type distributionSeries struct {
+	labels    map[string]string
+	buckets   []cumulativeBucket
+	quantiles []QuantileValue
+	count     float64
+	sum       float64
+	timestamp time.Time
+}
+
+// sendDistributions groups the bucket, quantile, sum and count samples of
+// a histogram or summary family into one metric per series
+func (sc *ScrapeCollector) sendDistributions(target *scrapeTarget, family *metricFamily, scrapeTime time.Time) int {
+	series := make(map[string]*distributionSeries)
+	var order []string
+
+	for _, sample := range family.Samples {
+		labels := make(map[string]string, len(sample.Labels))
+		for k, v := range sample.Labels {
+			if k != "le" && k != "quantile" {
+				labels[k] = v
+			}
+		}
+
+		key := seriesKey(family.Name, labels)
+		s, exists := series[key]
+		if !exists {
+			s = &distributionSeries{labels: labels, timestamp: scrapeTime}
+			series[key] = s
+			order = append(order, key)
+		}
+		if sample.HasTimestamp {
+			s.timestamp = time.UnixMilli(sample.TimestampMs)
+		}
+
+		switch strings.TrimPrefix(sample.Name, family.Name) {
+		case "_bucket":
+			if bound, err := parseExpositionFloat(sample.Labels["le"]); err == nil {
+				s.buckets = append(s.buckets, cumulativeBucket{UpperBound: bound, Count: sample.Value})
+			}
+		case "_sum":
+			s.sum = sample.Value
+		case "_count":
+			s.count = sample.Value
+		case "":
+			q, err := parseExpositionFloat(sample.Labels["quantile"])
+			if err == nil && !math.IsNaN(sample.Value) && !math.IsInf(sample.Value, 0) {
+				s.quantiles = append(s.quantiles, QuantileValue{Quantile: q, Value: sample.Value})
+			}
+		}
+	}
+
+	sent := 0
+	for _, key := range order {
+		s := series[key]
+		if math.IsNaN(s.sum) || math.IsInf(s.sum, 0) {
+			s.sum = 0
+		}
+		count := uint64(math.Round(s.count))
+
+		var value interface{}
+		if family.Type == "histogram" {
+			value = histogramFromCumulative(s.buckets, count, s.sum)
+		} else {
+			sort.Slice(s.quantiles, func(i, j int) bool { return s.quantiles[i].Quantile < s.quantiles[j].Quantile })
+			value = &SummaryValue{Count: count, Sum: s.sum, Quantiles: s.quantiles}
+		}
+
+		if sc.sendSample(target, family.Name, s.labels, family.Type, value, s.timestamp, family.Unit) {
+			sent++
+		}
+	}
+
+	return sent
+}
+
+// sendSample applies target labels and relabeling to a sample and sends
+// it. It returns false when relabeling dropped the sample.
+func (sc *ScrapeCollector) sendSample(target *scrapeTarget, name string, sampleLabels map[string]string, metricType string, value interface{}, timestamp time.Time, unit string) bool {
+	labels := target.sampleLabels(sampleLabels)
+	labels[metricNameLabel] = name
+	if !relabel(labels, target.relabel) {
+		return false
+	}
+	name = labels[metricNameLabel]
+	delete(labels, metricNameLabel)
+
+	sc.sendMetric(&MetricData{
+		Name:      name,
+		Type:      metricType,
+		Value:     value,
+		Labels:    labels,
+		Timestamp: timestamp.Format(time.RFC3339),
+		Unit:      unit,
+	})
+	return true
+}
+
+// allowed applies the metric allow and deny lists to a family name
+func (t *scrapeTarget) allowed(name string) bool {
+	if len(t.include) > 0 {
+		matched := false
+		for _, regex := range t.include {
+			if regex.MatchString(name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, regex := range t.exclude {
+		if regex.MatchString(name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// baseLabels returns the job, instance and configured target labels
+func (t *scrapeTarget) baseLabels() map[string]string {
+	labels := make(map[string]string, len(t.config.Labels)+2)
+	for k, v := range t.config.Labels {
+		labels[k] = v
+	}
+	labels["job"] = t.job
+	labels["instance"] = t.instance
+	return labels
+}
+
+// sampleLabels merges the scraped labels with the target labels. Conflicting
+// scraped labels are kept as exported_<name> unless honor_labels is set.
+func (t *scrapeTarget) sampleLabels(sampleLabels map[string]string) map[string]string {
+	labels := make(map[string]string, len(sampleLabels)+len(t.config.Labels)+3)
+	for k, v := range sampleLabels {
+		labels[k] = v
+	}
+
+	for k, v := range t.baseLabels() {
+		if existing, exists := labels[k]; exists && existing != "" {
+			if t.config.HonorLabels {
+				continue
+			}
+			labels["exported_"+k] = existing
+		}
+		labels[k] = v
+	}
+
+	return labels
+}
+
+// sendMetric sends a metric to the data channel
+func (sc *ScrapeCollector) sendMetric(metric *MetricData) {
+	select {
+	case sc.dataChan <- CollectedData{
+		Type:      DataTypeMetric,
+		Source:    "scrape",
+		Data:      map[string]interface{}{"metric": metric},
+		Timestamp: metric.Timestamp,
+	}:
+	case <-sc.ctx.Done():
+		return
+	}
+}
@@ -0,0 +1,614 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/logger"
+)
+
+// StatsDCollector receives StatsD and DogStatsD metrics over UDP and unix
+// datagram sockets and aggregates them per flush interval
+type StatsDCollector struct {
+	name     string
+	config   config.StatsDCollectorConfig
+	logger   *logger.Logger
+	dataChan chan<- interface{}
+
+	conns      []net.PacketConn
+	socketMode os.FileMode
+
+	// Aggregation state for the current flush interval
+	mu       sync.Mutex
+	counters map[string]*statsdCounter
+	gauges   map[string]*statsdGauge
+	sets     map[string]*statsdSet
+	timers   map[string]*statsdTimer
+	received uint64
+	invalid  uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// healthy and lastError are guarded by mu, as listeners set them
+	healthy   bool
+	lastError string
+}
+
+// statsdMetric is a single parsed StatsD line
+type statsdMetric struct {
+	Name   string
+	Values []string
+	Type   string // c, g, ms, h, d, s
+	Rate   float64
+	Labels map[string]string
+}
+
+// statsdCounter holds both the count of the current flush interval and
+// the running total since the series first appeared
+type statsdCounter struct {
+	name     string
+	labels   map[string]string
+	interval float64
+	total    float64
+	updated  time.Time
+}
+
+type statsdGauge struct {
+	name    string
+	labels  map[string]string
+	value   float64
+	updated time.Time
+}
+
+type statsdSet struct {
+	name   string
+	labels map[string]string
+	values map[string]struct{}
+}
+
+type statsdTimer struct {
+	name   string
+	kind   string
+	labels map[string]string
+	values []float64
+	count  float64 // sample-rate weighted count
+}
+
+// NewStatsDCollector creates a new StatsD receiver
+func NewStatsDCollector(cfg config.StatsDCollectorConfig, log *logger.Logger) (*StatsDCollector, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("statsd collector is disabled")
+	}
+
+	for _, p := range cfg.Percentiles {
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid statsd percentile %v: must be in (0, 100]", p)
+		}
+	}
+
+	socketMode := os.FileMode(0660)
+	if cfg.SocketMode != "" {
+		parsed, err := strconv.ParseUint(cfg.SocketMode, 8, 32)
+		if err != nil || parsed > 0777 {
+			return nil, fmt.Errorf("invalid statsd socket mode %q", cfg.SocketMode)
+		}
+		socketMode = os.FileMode(parsed)
+	}
+
+	collector := &StatsDCollector{
+		name:       "statsd-collector",
+		config:     cfg,
+		logger:     log,
+		socketMode: socketMode,
+		healthy:    true,
+	}
+	collector.reset()
+
+	return collector, nil
+}
+
+// Name returns the collector name
+func (sc *StatsDCollector) Name() string {
+	return sc.name
+}
+
+// Start starts the StatsD listeners
+func (sc *StatsDCollector) Start(ctx context.Context, dataChan chan<- interface{}) error {
+	sc.ctx, sc.cancel = context.WithCancel(ctx)
+	sc.dataChan = dataChan
+
+	sc.logger.Info("Starting statsd collector", "address", sc.config.Address, "socket", sc.config.Socket)
+
+	if sc.config.Address != "" {
+		conn, err := net.ListenPacket("udp", sc.config.Address)
+		if err != nil {
+			sc.setError(fmt.Sprintf("Statsd listen error: %v", err))
+			return fmt.Errorf("failed to listen on %s: %w", sc.config.Address, err)
+		}
+		sc.conns = append(sc.conns, conn)
+	}
+
+	if sc.config.Socket != "" {
+		// Remove a stale socket left behind by a previous run
+		os.Remove(sc.config.Socket)
+		conn, err := net.ListenPacket("unixgram", sc.config.Socket)
+		if err != nil {
+			sc.setError(fmt.Sprintf("Statsd listen error: %v", err))
+			sc.closeConns()
+			return fmt.Errorf("failed to listen on %s: %w", sc.config.Socket, err)
+		}
+		sc.conns = append(sc.conns, conn)
+		if err := os.Chmod(sc.config.Socket, sc.socketMode); err != nil {
+			sc.closeConns()
+			return fmt.Errorf("failed to set mode of %s: %w", sc.config.Socket, err)
+		}
+	}
+
+	for _, conn := range sc.conns {
+		sc.wg.Add(1)
+		go sc.readPackets(conn)
+	}
+
+	sc.wg.Add(1)
+	go sc.flushLoop()
+
+	sc.logger.Info("Statsd collector started")
+	return nil
+}
+
+// Stop stops the StatsD listeners
+func (sc *StatsDCollector) Stop(ctx context.Context) error {
+	sc.logger.Info("Stopping statsd collector")
+
+	if sc.cancel != nil {
+		sc.cancel()
+	}
+	sc.closeConns()
+
+	// Wait for goroutines to finish
+	done := make(chan struct{})
+	go func() {
+		sc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if sc.config.Socket != "" {
+			os.Remove(sc.config.Socket)
+		}
+		sc.logger.Info("Statsd collector stopped")
+		return nil
+	case <-ctx.Done():
+		sc.logger.Warn("Statsd collector stop timeout")
+		return ctx.Err()
+	}
+}
+
+// Health returns the collector health status
+func (sc *StatsDCollector) Health() HealthStatus {
+	sc.mu.Lock()
+	received, invalid := sc.received, sc.invalid
+	healthy, lastError := sc.healthy, sc.lastError
+	sc.mu.Unlock()
+
+	status := HealthStatus{
+		Healthy:   healthy,
+		Message:   "Statsd collector operational",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Details: map[string]string{
+			"address":          sc.config.Address,
+			"socket":           sc.config.Socket,
+			"metrics_received": fmt.Sprintf("%d", received),
+			"metrics_invalid":  fmt.Sprintf("%d", invalid),
+		},
+	}
+
+	if lastError != "" {
+		status.Message = lastError
+		status.Healthy = false
+	}
+
+	return status
+}
+
+// setError marks the collector unhealthy with the given message
+func (sc *StatsDCollector) setError(message string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.healthy = false
+	sc.lastError = message
+}
+
+// clearError marks the collector healthy again, unless another listener
+// has failed since message was set
+func (sc *StatsDCollector) clearError(message string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.lastError == message {
+		sc.healthy = true
+		sc.lastError = ""
+	}
+}
+
+// closeConns closes all listening sockets
+func (sc *StatsDCollector) closeConns() {
+	for _, conn := range sc.conns {
+		conn.Close()
+	}
+}
+
+// readPackets reads datagrams from a socket until it is closed
+func (sc *StatsDCollector) readPackets(conn net.PacketConn) {
+	defer sc.wg.Done()
+
+	buffer := make([]byte, sc.config.MaxPacketSize)
+	failure := ""
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || sc.ctx.Err() != nil {
+				return
+			}
+			sc.logger.Warn("Failed to read statsd packet", "error", err)
+			failure = fmt.Sprintf("Statsd read error on %s: %v", conn.LocalAddr(), err)
+			sc.setError(failure)
+			continue
+		}
+		if failure != "" {
+			sc.clearError(failure)
+			failure = ""
+		}
+
+		for _, line := range strings.Split(string(buffer[:n]), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+
+			// DogStatsD events and service checks are not metrics
+			if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+				continue
+			}
+
+			metric, err := parseStatsDLine(line)
+			if err != nil {
+				sc.mu.Lock()
+				sc.invalid++
+				sc.mu.Unlock()
+				sc.logger.Debug("Invalid statsd line", "line", line, "error", err)
+				continue
+			}
+			sc.aggregate(metric)
+		}
+	}
+}
+
+// parseStatsDLine parses a StatsD or DogStatsD line of the form
+// name:value[:value...]|type[|@rate][|#tag:value,tag]
+func parseStatsDLine(line string) (*statsdMetric, error) {
+	nameValues, rest, found := strings.Cut(line, "|")
+	if !found {
+		return nil, fmt.Errorf("missing metric type")
+	}
+
+	parts := strings.Split(nameValues, ":")
+	if len(parts) < 2 || parts[0] == "" {
+		return nil, fmt.Errorf("missing metric name or value")
+	}
+
+	metric := &statsdMetric{
+		Name:   parts[0],
+		Values: parts[1:],
+		Rate:   1,
+	}
+
+	sections := strings.Split(rest, "|")
+	metric.Type = sections[0]
+	switch metric.Type {
+	case "c", "g", "ms", "h", "d", "s":
+	default:
+		return nil, fmt.Errorf("unsupported metric type %q", metric.Type)
+	}
+
+	for _, section := range sections[1:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || math.IsNaN(rate) || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid sample rate %q", section)
+			}
+			metric.Rate = rate
+		case strings.HasPrefix(section, "#"):
+			metric.Labels = make(map[string]string)
+			for _, tag := range strings.Split(section[1:], ",") {
+				if tag == "" {
+					continue
+				}
+				key, value, _ := strings.Cut(tag, ":")
+				metric.Labels[key] = value
+			}
+		}
+		// Other DogStatsD extensions (container ID, timestamp) are ignored
+	}
+
+	// Sets keep raw values; everything else must be a finite number, as
+	// NaN and infinite values cannot be aggregated or encoded as JSON
+	if metric.Type != "s" {
+		for _, value := range metric.Values {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+				return nil, fmt.Errorf("invalid value %q", value)
+			}
+		}
+	}
+
+	return metric, nil
+}
+
+// seriesKey builds a key identifying a metric name and label set
+func seriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString("|")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(labels[k])
+	}
+	return b.String()
+}
+
+// aggregate adds a parsed metric to the current flush interval
+func (sc *StatsDCollector) aggregate(metric *statsdMetric) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.received++
+	key := seriesKey(metric.Name, metric.Labels)
+
+	switch metric.Type {
+	case "c":
+		counter, exists := sc.counters[key]
+		if !exists {
+			counter = &statsdCounter{name: metric.Name, labels: metric.Labels}
+			sc.counters[key] = counter
+		}
+		for _, raw := range metric.Values {
+			value, _ := strconv.ParseFloat(raw, 64)
+			counter.interval += value / metric.Rate
+			counter.total += value / metric.Rate
+		}
+		counter.updated = time.Now()
+
+	case "g":
+		gauge, exists := sc.gauges[key]
+		if !exists {
+			gauge = &statsdGauge{name: metric.Name, labels: metric.Labels}
+			sc.gauges[key] = gauge
+		}
+		for _, raw := range metric.Values {
+			value, _ := strconv.ParseFloat(raw, 64)
+			// A leading sign makes the value relative to the current gauge
+			if strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-") {
+				gauge.value += value
+			} else {
+				gauge.value = value
+			}
+		}
+		gauge.updated = time.Now()
+
+	case "s":
+		set, exists := sc.sets[key]
+		if !exists {
+			set = &statsdSet{name: metric.Name, labels: metric.Labels, values: make(map[string]struct{})}
+			sc.sets[key] = set
+		}
+		for _, raw := range metric.Values {
+			set.values[raw] = struct{}{}
+		}
+
+	case "ms", "h", "d":
+		timer, exists := sc.timers[key]
+		if !exists {
+			timer = &statsdTimer{name: metric.Name, kind: metric.Type, labels: metric.Labels}
+			sc.timers[key] = timer
+		}
+		for _, raw := range metric.Values {
+			value, _ := strconv.ParseFloat(raw, 64)
+			timer.values = append(timer.values, value)
+			timer.count += 1 / metric.Rate
+		}
+	}
+}
+
+// reset clears the per-interval aggregates. Gauges keep their last value
+// across intervals, as in the reference StatsD implementation, and counters
+// keep their running total, which flush reports as a monotonic series next
+// to the per-interval count. Both are dropped in flush once they expire.
+func (sc *StatsDCollector) reset() {
+	sc.sets = make(map[string]*statsdSet)
+	sc.timers = make(map[string]*statsdTimer)
+	if sc.counters == nil {
+		sc.counters = make(map[string]*statsdCounter)
+	}
+	if sc.gauges == nil {
+		sc.gauges = make(map[string]*statsdGauge)
+	}
+}
+
+// expired reports whether a counter or gauge last updated at the given
+// time should no longer be reported
+func (sc *StatsDCollector) expired(updated time.Time) bool {
+	return sc.config.SeriesExpiry > 0 && time.Since(updated) > sc.config.SeriesExpiry
+}
+
+// flushLoop periodically flushes the aggregates to the data channel
+func (sc *StatsDCollector) flushLoop() {
+	defer sc.wg.Done()
+
+	ticker := time.NewTicker(sc.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sc.ctx.Done():
+			return
+		case <-ticker.C:
+			sc.flush()
+		}
+	}
+}
+
+// flush converts the current aggregates into metric data
+func (sc *StatsDCollector) flush() {
+	sc.mu.Lock()
+	sets, timers := sc.sets, sc.timers
+	// Drop series whose sender has stopped reporting them
+	counters := make([]statsdCounter, 0, len(sc.counters))
+	for key, counter := range sc.counters {
+		if sc.expired(counter.updated) {
+			delete(sc.counters, key)
+			continue
+		}
+		counters = append(counters, *counter)
+		counter.interval = 0
+	}
+	gauges := make([]statsdGauge, 0, len(sc.gauges))
+	for key, gauge := range sc.gauges {
+		if sc.expired(gauge.updated) {
+			delete(sc.gauges, key)
+			continue
+		}
+		gauges = append(gauges, *gauge)
+	}
+	sc.reset()
+	sc.mu.Unlock()
+
+	ts := time.Now().Format(time.RFC3339)
+
+	// The count of the interval keeps the metric name, as in the reference
+	// StatsD implementation; the running total is the .total counter
+	for _, counter := range counters {
+		labels := sc.labels(counter.labels)
+		sc.sendMetric(&MetricData{Name: counter.name, Type: "gauge", Value: counter.interval, Labels: labels, Timestamp: ts})
+		sc.sendMetric(&MetricData{Name: counter.name + ".total", Type: "counter", Value: counter.total, Labels: labels, Timestamp: ts})
+	}
+
+	for _, gauge := range gauges {
+		sc.sendMetric(&MetricData{Name: gauge.name, Type: "gauge", Value: gauge.value, Labels: sc.labels(gauge.labels), Timestamp: ts})
+	}
+
+	for _, set := range sets {
+		sc.sendMetric(&MetricData{Name: set.name, Type: "gauge", Value: len(set.values), Labels: sc.labels(set.labels), Timestamp: ts, Unit: "count"})
+	}
+
+	for _, timer := range timers {
+		sc.flushTimer(timer, ts)
+	}
+}
+
+// flushTimer emits a timer or histogram as a summary with the configured
+// percentiles, and a distribution as an exponential histogram so that it
+// can be aggregated across hosts
+func (sc *StatsDCollector) flushTimer(timer *statsdTimer, ts string) {
+	if len(timer.values) == 0 {
+		return
+	}
+
+	unit := ""
+	if timer.kind == "ms" {
+		unit = "milliseconds"
+	}
+	metric := &MetricData{Name: timer.name, Labels: sc.labels(timer.labels), Timestamp: ts, Unit: unit}
+
+	// Observations are scaled by the average sample rate
+	weight := timer.count / float64(len(timer.values))
+
+	if timer.kind == "d" {
+		metric.Type = "exponential_histogram"
+		metric.Value = newExponentialHistogram(timer.values, weight)
+	} else {
+		values := timer.values
+		sort.Float64s(values)
+
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+
+		metric.Type = "summary"
+		metric.Value = newSummaryValue(values, uint64(math.Round(timer.count)), sum*weight, sc.config.Percentiles)
+	}
+
+	sc.sendMetric(metric)
+}
+
+// percentile returns the p-th percentile of sorted values using the
+// nearest-rank method
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// labels merges metric tags with the configured static tags
+func (sc *StatsDCollector) labels(tags map[string]string) map[string]string {
+	if len(tags) == 0 && len(sc.config.Tags) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(tags)+len(sc.config.Tags))
+	for k, v := range sc.config.Tags {
+		labels[k] = v
+	}
+	for k, v := range tags {
+		labels[k] = v
+	}
+	return labels
+}
+
+// sendMetric sends a metric to the data channel
+func (sc *StatsDCollector) sendMetric(metric *MetricData) {
+	select {
+	case sc.dataChan <- CollectedData{
+		Type:      DataTypeMetric,
+		Source:    "statsd",
+		Data:      map[string]interface{}{"metric": metric},
+		Timestamp: metric.Timestamp,
+	}:
+	case <-sc.ctx.Done():
+		return
+	}
+}
@@ -0,0 +1,203 @@
+package collectors
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+func TestParseStatsDLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want statsdMetric
+	}{
+		{"requests:1|c", statsdMetric{Name: "requests", Values: []string{"1"}, Type: "c", Rate: 1}},
+		{"latency:12.5:30|ms|@0.5", statsdMetric{Name: "latency", Values: []string{"12.5", "30"}, Type: "ms", Rate: 0.5}},
+		{"temp:-3|g", statsdMetric{Name: "temp", Values: []string{"-3"}, Type: "g", Rate: 1}},
+		{"users:alice|s", statsdMetric{Name: "users", Values: []string{"alice"}, Type: "s", Rate: 1}},
+		{
+			"page.views:1|c|@0.25|#env:prod,region:eu,canary,|c:abc123",
+			statsdMetric{Name: "page.views", Values: []string{"1"}, Type: "c", Rate: 0.25,
+				Labels: map[string]string{"env": "prod", "region": "eu", "canary": ""}},
+		},
+		{
+			"queue.size:7|d|#queue:jobs|T1700000000",
+			statsdMetric{Name: "queue.size", Values: []string{"7"}, Type: "d", Rate: 1,
+				Labels: map[string]string{"queue": "jobs"}},
+		},
+	}
+	for _, tt := range tests {
+		metric, err := parseStatsDLine(tt.line)
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(*metric, tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.line, *metric, tt.want)
+		}
+	}
+}
+
+func TestParseStatsDLineInvalid(t *testing.T) {
+	lines := []string{
+		"requests:1",
+		":1|c",
+		"requests|c",
+		"requests:1|x",
+		"requests:abc|c",
+		"requests:1|c|@0",
+		"requests:1|c|@1.5",
+		"requests:1|c|@-0.5",
+		"requests:1|c|@NaN",
+		"requests:1|c|@fast",
+		"latency:Inf|d",
+		"latency:-Inf|ms",
+		"temp:NaN|g",
+		"temp:+Inf|g",
+		"requests:1:NaN|c",
+	}
+	for _, line := range lines {
+		if metric, err := parseStatsDLine(line); err == nil {
+			t.Errorf("%q: expected an error, got %+v", line, *metric)
+		}
+	}
+}
+
+func TestStatsDSocketMode(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dsd.socket")
+
+	tests := []struct {
+		mode string
+		want os.FileMode
+	}{
+		{"", 0660},
+		{"0600", 0600},
+	}
+	for _, tt := range tests {
+		collector, err := NewStatsDCollector(config.StatsDCollectorConfig{
+			Enabled:       true,
+			Socket:        socket,
+			SocketMode:    tt.mode,
+			FlushInterval: time.Hour,
+			MaxPacketSize: 8192,
+		}, newTestLogger(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := collector.Start(context.Background(), make(chan interface{}, 10)); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(socket)
+		collector.Stop(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != tt.want {
+			t.Errorf("mode %q: socket has mode %o, want %o", tt.mode, info.Mode().Perm(), tt.want)
+		}
+	}
+
+	for _, mode := range []string{"rw", "1777", "0999"} {
+		if _, err := NewStatsDCollector(config.StatsDCollectorConfig{Enabled: true, SocketMode: mode}, newTestLogger(t)); err == nil {
+			t.Errorf("mode %q: expected an error", mode)
+		}
+	}
+}
+
+func TestStatsDHealth(t *testing.T) {
+	taken, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	collector, err := NewStatsDCollector(config.StatsDCollectorConfig{
+		Enabled:       true,
+		Address:       taken.LocalAddr().String(),
+		FlushInterval: time.Hour,
+		MaxPacketSize: 8192,
+	}, newTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !collector.Health().Healthy {
+		t.Error("new collector is unhealthy")
+	}
+	if err := collector.Start(context.Background(), make(chan interface{}, 10)); err == nil {
+		collector.Stop(context.Background())
+		t.Fatal("expected an error for an address in use")
+	}
+	if status := collector.Health(); status.Healthy || !strings.Contains(status.Message, "listen error") {
+		t.Errorf("health after a listen error = %+v", status)
+	}
+
+	// A listener recovering does not clear the failure of another
+	collector.setError("read error on a")
+	collector.setError("read error on b")
+	collector.clearError("read error on a")
+	if status := collector.Health(); status.Healthy || status.Message != "read error on b" {
+		t.Errorf("health = %+v", status)
+	}
+	collector.clearError("read error on b")
+	if status := collector.Health(); !status.Healthy {
+		t.Errorf("health after recovering = %+v", status)
+	}
+}
+
+func TestStatsDSeriesExpiry(t *testing.T) {
+	collector, err := NewStatsDCollector(config.StatsDCollectorConfig{Enabled: true, SeriesExpiry: time.Minute}, newTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(chan interface{}, 10)
+	collector.dataChan = data
+	collector.ctx = context.Background()
+
+	aggregate := func(lines ...string) {
+		for _, line := range lines {
+			metric, err := parseStatsDLine(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			collector.aggregate(metric)
+		}
+	}
+
+	aggregate("stale:1|g", "fresh:2|g", "fresh:+3|g", "old.hits:1|c", "hits:2|c", "hits:1|c|@0.5")
+	collector.gauges["stale"].updated = time.Now().Add(-2 * time.Minute)
+	collector.counters["old.hits"].updated = time.Now().Add(-2 * time.Minute)
+
+	collector.flush()
+	metrics := drainMetrics(data)
+	want := map[string]interface{}{"fresh{}": 5.0, "hits{}": 4.0, "hits.total{}": 4.0}
+	if !reflect.DeepEqual(metrics, want) {
+		t.Errorf("got %v, want %v", metrics, want)
+	}
+
+	// Counters report the count of each interval next to their running
+	// total, and gauges keep their value
+	aggregate("hits:1|c")
+	collector.flush()
+	want = map[string]interface{}{"fresh{}": 5.0, "hits{}": 1.0, "hits.total{}": 5.0}
+	if metrics := drainMetrics(data); !reflect.DeepEqual(metrics, want) {
+		t.Errorf("got %v on the second flush, want %v", metrics, want)
+	}
+	collector.flush()
+	want = map[string]interface{}{"fresh{}": 5.0, "hits{}": 0.0, "hits.total{}": 5.0}
+	if metrics := drainMetrics(data); !reflect.DeepEqual(metrics, want) {
+		t.Errorf("got %v on an idle flush, want %v", metrics, want)
+	}
+	if _, exists := collector.gauges["stale"]; exists {
+		t.Error("expired gauge was not removed")
+	}
+	if _, exists := collector.counters["old.hits"]; exists {
+		t.Error("expired counter was not removed")
+	}
+}
@@ -0,0 +1,554 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hive-agent/internal/config"
+	"hive-agent/internal/logger"
+)
+
+// syslogMaxOctetDigits bounds the octet count prefix of a frame, which is
+// read before the message size can be checked
+const syslogMaxOctetDigits = 10
+
+// SyslogCollector receives RFC 3164 and RFC 5424 messages over UDP, TCP
+// and TLS
+type SyslogCollector struct {
+	name      string
+	config    config.SyslogLogsConfig
+	logger    *logger.Logger
+	dataChan  chan<- interface{}
+	tlsConfig *tls.Config
+	limiter   *syslogRateLimiter
+
+	packetConn net.PacketConn
+	listeners  map[string]net.Listener // by transport
+	connSlots  chan struct{}           // one per open stream connection
+
+	received int64
+	dropped  int64
+	invalid  int64
+	rejected int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	healthy   bool
+	lastError string
+}
+
+// NewSyslogCollector creates a new syslog receiver
+func NewSyslogCollector(cfg config.SyslogLogsConfig, log *logger.Logger) (*SyslogCollector, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("syslog collector is disabled")
+	}
+	if cfg.UDPAddress == "" && cfg.TCPAddress == "" && cfg.TLSAddress == "" {
+		return nil, fmt.Errorf("syslog collector requires udp_address, tcp_address or tls_address")
+	}
+	if cfg.RateLimit < 0 || cfg.RateBurst < 0 {
+		return nil, fmt.Errorf("invalid syslog rate limit")
+	}
+	if cfg.MaxConnections < 0 {
+		return nil, fmt.Errorf("invalid syslog max_connections %d", cfg.MaxConnections)
+	}
+
+	collector := &SyslogCollector{
+		name:      "syslog-collector",
+		config:    cfg,
+		logger:    log,
+		listeners: make(map[string]net.Listener),
+		healthy:   true,
+	}
+	if cfg.MaxConnections > 0 {
+		collector.connSlots = make(chan struct{}, cfg.MaxConnections)
+	}
+
+	if cfg.TLSAddress != "" {
+		tlsConfig, err := syslogTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		collector.tlsConfig = tlsConfig
+	}
+
+	if cfg.RateLimit > 0 {
+		burst := float64(cfg.RateBurst)
+		if burst == 0 {
+			burst = cfg.RateLimit
+			if burst < 1 {
+				burst = 1
+			}
+		}
+		collector.limiter = newSyslogRateLimiter(cfg.RateLimit, burst)
+	}
+
+	return collector, nil
+}
+
+// syslogTLSConfig builds the server TLS configuration. A CA file makes
+// client certificates mandatory.
+func syslogTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("syslog tls_address requires tls cert_file and key_file")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load syslog TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.CAFile != "" {
+		ca, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read syslog CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// Name returns the collector name
+func (sc *SyslogCollector) Name() string {
+	return sc.name
+}
+
+// Start starts the syslog listeners
+func (sc *SyslogCollector) Start(ctx context.Context, dataChan chan<- interface{}) error {
+	sc.ctx, sc.cancel = context.WithCancel(ctx)
+	sc.dataChan = dataChan
+
+	sc.logger.Info("Starting syslog collector",
+		"udp", sc.config.UDPAddress, "tcp", sc.config.TCPAddress, "tls", sc.config.TLSAddress)
+
+	if sc.config.UDPAddress != "" {
+		conn, err := net.ListenPacket("udp", sc.config.UDPAddress)
+		if err != nil {
+			sc.cancel()
+			return fmt.Errorf("failed to listen on %s: %w", sc.config.UDPAddress, err)
+		}
+		sc.packetConn = conn
+	}
+
+	if sc.config.TCPAddress != "" {
+		listener, err := net.Listen("tcp", sc.config.TCPAddress)
+		if err != nil {
+			sc.closeListeners()
+			sc.cancel()
+			return fmt.Errorf("failed to listen on %s: %w", sc.config.TCPAddress, err)
+		}
+		sc.listeners["tcp"] = listener
+	}
+
+	if sc.config.TLSAddress != "" {
+		listener, err := tls.Listen("tcp", sc.config.TLSAddress, sc.tlsConfig)
+		if err != nil {
+			sc.closeListeners()
+			sc.cancel()
+			return fmt.Errorf("failed to listen on %s: %w", sc.config.TLSAddress, err)
+		}
+		sc.listeners["tls"] = listener
+	}
+
+	if sc.packetConn != nil {
+		sc.wg.Add(1)
+		go sc.readPackets()
+	}
+	for transport, listener := range sc.listeners {
+		sc.wg.Add(1)
+		go sc.accept(listener, transport)
+	}
+	if sc.limiter != nil {
+		sc.wg.Add(1)
+		go sc.pruneLimiter()
+	}
+
+	// Listeners are closed on cancellation to unblock reads and accepts
+	go func() {
+		<-sc.ctx.Done()
+		sc.closeListeners()
+	}()
+
+	sc.logger.Info("Syslog collector started")
+	return nil
+}
+
+// Stop stops the syslog listeners
+func (sc *SyslogCollector) Stop(ctx context.Context) error {
+	sc.logger.Info("Stopping syslog collector")
+
+	if sc.cancel != nil {
+		sc.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		sc.logger.Info("Syslog collector stopped")
+		return nil
+	case <-ctx.Done():
+		sc.logger.Warn("Syslog collector stop timeout")
+		return ctx.Err()
+	}
+}
+
+// Health returns the collector health status
+func (sc *SyslogCollector) Health() HealthStatus {
+	status := HealthStatus{
+		Healthy:   sc.healthy,
+		Message:   "Syslog collector operational",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Details: map[string]string{
+			"received": strconv.FormatInt(atomic.LoadInt64(&sc.received), 10),
+			"dropped":  strconv.FormatInt(atomic.LoadInt64(&sc.dropped), 10),
+			"invalid":  strconv.FormatInt(atomic.LoadInt64(&sc.invalid), 10),
+			"rejected": strconv.FormatInt(atomic.LoadInt64(&sc.rejected), 10),
+		},
+	}
+
+	if sc.lastError != "" {
+		status.Message = sc.lastError
+		status.Healthy = false
+	}
+
+	return status
+}
+
+// closeListeners closes all listening sockets
+func (sc *SyslogCollector) closeListeners() {
+	if sc.packetConn != nil {
+		sc.packetConn.Close()
+	}
+	for _, listener := range sc.listeners {
+		listener.Close()
+	}
+}
+
+// readPackets handles UDP datagrams, one message each
+func (sc *SyslogCollector) readPackets() {
+	defer sc.wg.Done()
+
+	buffer := make([]byte, sc.config.MaxMessageSize)
+	for {
+		n, addr, err := sc.packetConn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || sc.ctx.Err() != nil {
+				return
+			}
+			sc.logger.Warn("Failed to read syslog datagram", "error", err)
+			continue
+		}
+		sc.handle(string(buffer[:n]), addr, "udp")
+	}
+}
+
+// accept accepts stream connections until the listener is closed.
+// Connections beyond max_connections are closed right away.
+func (sc *SyslogCollector) accept(listener net.Listener, transport string) {
+	defer sc.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || sc.ctx.Err() != nil {
+				return
+			}
+			sc.logger.Warn("Failed to accept syslog connection", "error", err)
+			select {
+			case <-sc.ctx.Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+
+		if sc.connSlots != nil {
+			select {
+			case sc.connSlots <- struct{}{}:
+			default:
+				atomic.AddInt64(&sc.rejected, 1)
+				sc.logger.Debug("Too many syslog connections, rejecting", "remote", conn.RemoteAddr().String())
+				conn.Close()
+				continue
+			}
+		}
+
+		sc.wg.Add(1)
+		go sc.readStream(conn, transport)
+	}
+}
+
+// readStream reads framed messages from a TCP or TLS connection. Each
+// frame is octet-counted ("LEN SP MSG", RFC 6587) when it starts with a
+// digit, and newline-delimited otherwise.
+func (sc *SyslogCollector) readStream(conn net.Conn, transport string) {
+	defer sc.wg.Done()
+	defer conn.Close()
+	if sc.connSlots != nil {
+		defer func() { <-sc.connSlots }()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-sc.ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	for {
+		conn.SetReadDeadline(time.Now().Add(sc.config.IdleTimeout))
+
+		message, err := sc.readFrame(reader)
+		if err != nil {
+			if err != io.EOF && sc.ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				sc.logger.Debug("Closing syslog connection", "remote", conn.RemoteAddr().String(), "error", err)
+			}
+			return
+		}
+		if message == "" {
+			continue
+		}
+		sc.handle(message, conn.RemoteAddr(), transport)
+	}
+}
+
+// readFrame reads one octet-counted or newline-delimited frame
+func (sc *SyslogCollector) readFrame(reader *bufio.Reader) (string, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		var length []byte
+		for {
+			c, err := reader.ReadByte()
+			if err == io.EOF {
+				return "", io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return "", err
+			}
+			if c == ' ' {
+				break
+			}
+			if c < '0' || c > '9' || len(length) == syslogMaxOctetDigits {
+				return "", fmt.Errorf("invalid octet count %q", append(length, c))
+			}
+			length = append(length, c)
+		}
+		size, err := strconv.Atoi(string(length))
+		if err != nil {
+			return "", fmt.Errorf("invalid octet count %q", length)
+		}
+		if size > sc.config.MaxMessageSize {
+			return "", fmt.Errorf("message of %d bytes exceeds the maximum of %d", size, sc.config.MaxMessageSize)
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			return "", err
+		}
+		return string(frame), nil
+	}
+
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return string(line), nil
+			}
+			return "", err
+		}
+		// Overlong lines are truncated rather than dropping the connection
+		if len(line) < sc.config.MaxMessageSize {
+			line = append(line, chunk...)
+			if len(line) > sc.config.MaxMessageSize {
+				line = line[:sc.config.MaxMessageSize]
+			}
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// handle rate limits, parses and forwards a message
+func (sc *SyslogCollector) handle(raw string, addr net.Addr, transport string) {
+	remote := ""
+	if addr != nil {
+		remote = addr.String()
+	}
+	host := remote
+	if h, _, err := net.SplitHostPort(remote); err == nil {
+		host = h
+	}
+
+	if sc.limiter != nil && !sc.limiter.allow(host, time.Now()) {
+		atomic.AddInt64(&sc.dropped, 1)
+		return
+	}
+
+	now := time.Now()
+	msg := parseSyslog(raw, now)
+	if msg.Message == "" && msg.AppName == "" {
+		atomic.AddInt64(&sc.invalid, 1)
+		return
+	}
+	atomic.AddInt64(&sc.received, 1)
+
+	hostname := msg.Hostname
+	if hostname == "" {
+		hostname = host
+	}
+
+	// Flattened structure, matching the file log collector
+	data := map[string]interface{}{
+		"message":     msg.Message,
+		"timestamp":   msg.Timestamp.Format(time.RFC3339Nano),
+		"source":      "syslog",
+		"level":       syslogLevel(msg.Severity),
+		"facility":    syslogName(syslogFacilityNames, msg.Facility),
+		"severity":    syslogName(syslogSeverityNames, msg.Severity),
+		"hostname":    hostname,
+		"remote_addr": host,
+		"transport":   transport,
+		"format":      msg.Format,
+	}
+	if msg.AppName != "" {
+		data["appname"] = msg.AppName
+	}
+	if msg.ProcID != "" {
+		data["procid"] = msg.ProcID
+	}
+	if msg.MsgID != "" {
+		data["msgid"] = msg.MsgID
+	}
+	if len(msg.StructuredData) > 0 {
+		data["structured_data"] = msg.StructuredData
+	}
+	for k, v := range sc.config.Tags {
+		data[k] = v
+	}
+
+	source := "syslog"
+	if msg.AppName != "" {
+		source = "syslog:" + msg.AppName
+	}
+
+	select {
+	case sc.dataChan <- CollectedData{
+		Type:      DataTypeLog,
+		Source:    source,
+		Data:      data,
+		Tags:      sc.config.Tags,
+		Timestamp: msg.Timestamp.Format(time.RFC3339),
+	}:
+	case <-sc.ctx.Done():
+	}
+}
+
+// pruneLimiter drops idle rate limit buckets
+func (sc *SyslogCollector) pruneLimiter() {
+	defer sc.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sc.ctx.Done():
+			return
+		case now := <-ticker.C:
+			sc.limiter.prune(now)
+		}
+	}
+}
+
+// syslogRateLimiter is a token bucket per source IP
+type syslogRateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*syslogBucket
+}
+
+type syslogBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newSyslogRateLimiter(rate, burst float64) *syslogRateLimiter {
+	return &syslogRateLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*syslogBucket),
+	}
+}
+
+// allow takes a token from the bucket of a source, if one is available
+func (l *syslogRateLimiter) allow(source string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, exists := l.buckets[source]
+	if !exists {
+		bucket = &syslogBucket{tokens: l.burst, last: now}
+		l.buckets[source] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// prune removes buckets that have refilled completely
+func (l *syslogRateLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for source, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, source)
+		}
+	}
+}
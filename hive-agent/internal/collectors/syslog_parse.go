@@ -0,0 +1,241 @@
+package collectors
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslogMessage is a parsed RFC 3164 or RFC 5424 message
+type syslogMessage struct {
+	Format         string // rfc3164, rfc5424
+	Facility       int
+	Severity       int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData map[string]map[string]string
+	Message        string
+}
+
+// parseSyslog parses a syslog message. Messages without a valid PRI are
+// kept whole as user.notice, as RFC 3164 recommends for relays.
+func parseSyslog(raw string, received time.Time) *syslogMessage {
+	raw = strings.TrimRight(raw, "\r\n\x00")
+	msg := &syslogMessage{Format: "rfc3164", Facility: 1, Severity: 5, Timestamp: received}
+
+	rest, ok := parseSyslogPRI(raw, msg)
+	if !ok {
+		msg.Message = raw
+		return msg
+	}
+
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		if parseRFC5424(rest[2:], msg) == nil {
+			return msg
+		}
+		// Not valid RFC 5424 after all; reset and fall back
+		*msg = syslogMessage{Format: "rfc3164", Facility: msg.Facility, Severity: msg.Severity, Timestamp: received}
+	}
+
+	parseRFC3164(rest, msg, received)
+	return msg
+}
+
+// parseSyslogPRI parses the <PRI> prefix
+func parseSyslogPRI(raw string, msg *syslogMessage) (string, bool) {
+	if len(raw) < 3 || raw[0] != '<' {
+		return raw, false
+	}
+	end := strings.IndexByte(raw, '>')
+	if end < 2 || end > 4 {
+		return raw, false
+	}
+	pri, err := strconv.Atoi(raw[1:end])
+	if err != nil || pri > 191 {
+		return raw, false
+	}
+	msg.Facility = pri >> 3
+	msg.Severity = pri & 7
+	return raw[end+1:], true
+}
+
+// parseRFC5424 parses TIMESTAMP HOSTNAME APP-NAME PROCID MSGID
+// STRUCTURED-DATA [MSG], following the version
+func parseRFC5424(s string, msg *syslogMessage) error {
+	msg.Format = "rfc5424"
+
+	var fields [5]string
+	for i := range fields {
+		field, rest, found := strings.Cut(s, " ")
+		if !found && i < 4 {
+			return fmt.Errorf("truncated RFC 5424 header")
+		}
+		fields[i] = field
+		s = rest
+	}
+
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid RFC 5424 timestamp: %w", err)
+		}
+		msg.Timestamp = ts
+	}
+	msg.Hostname = syslogNil(fields[1])
+	msg.AppName = syslogNil(fields[2])
+	msg.ProcID = syslogNil(fields[3])
+	msg.MsgID = syslogNil(fields[4])
+
+	sd, rest, err := parseStructuredData(s)
+	if err != nil {
+		return err
+	}
+	msg.StructuredData = sd
+
+	rest = strings.TrimPrefix(rest, " ")
+	msg.Message = strings.TrimPrefix(rest, "\ufeff")
+	return nil
+}
+
+// syslogNil maps the RFC 5424 nil value to an empty string
+func syslogNil(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// parseStructuredData parses "-" or one or more [id name="value" ...]
+// elements, returning the remainder of the message
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	if strings.HasPrefix(s, "-") {
+		return nil, s[1:], nil
+	}
+	if !strings.HasPrefix(s, "[") {
+		return nil, "", fmt.Errorf("invalid structured data")
+	}
+
+	sd := make(map[string]map[string]string)
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		end := strings.IndexAny(s, " ]")
+		if end <= 0 {
+			return nil, "", fmt.Errorf("invalid structured data element")
+		}
+		id := s[:end]
+		params := make(map[string]string)
+		s = s[end:]
+
+		for {
+			s = strings.TrimLeft(s, " ")
+			if strings.HasPrefix(s, "]") {
+				s = s[1:]
+				break
+			}
+			eq := strings.Index(s, `="`)
+			if eq <= 0 {
+				return nil, "", fmt.Errorf("invalid structured data parameter")
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+
+			// Values escape ", \ and ] with a backslash
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				c := s[i]
+				if c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+					value.WriteByte(s[i+1])
+					i++
+					continue
+				}
+				if c == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(c)
+			}
+			if !closed {
+				return nil, "", fmt.Errorf("unterminated structured data value")
+			}
+			params[name] = value.String()
+		}
+
+		sd[id] = params
+	}
+
+	return sd, s, nil
+}
+
+// rfc3164Layouts are the accepted RFC 3164 timestamp layouts; RFC 3339
+// is common from rsyslog's high-precision templates
+var rfc3164Layouts = []string{time.Stamp, time.StampMicro}
+
+// parseRFC3164 parses "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG". Each
+// part is optional in practice; what cannot be recognized stays in MSG.
+func parseRFC3164(s string, msg *syslogMessage, received time.Time) {
+	if ts, rest, ok := parseRFC3164Timestamp(s, received); ok {
+		msg.Timestamp = ts
+		s = rest
+
+		// A hostname follows the timestamp, unless the next token is
+		// already the tag
+		if token, rest, found := strings.Cut(s, " "); found && token != "" && !isSyslogTag(token) {
+			msg.Hostname = token
+			s = rest
+		}
+	}
+
+	if token, rest, found := strings.Cut(s, " "); found && isSyslogTag(token) {
+		tag := strings.TrimSuffix(token, ":")
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			msg.ProcID = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		msg.AppName = tag
+		s = rest
+	}
+
+	msg.Message = s
+}
+
+// parseRFC3164Timestamp parses a leading timestamp. The year is not part
+// of RFC 3164 timestamps, so the year that puts it closest to the
+// receive time is used.
+func parseRFC3164Timestamp(s string, received time.Time) (time.Time, string, bool) {
+	if token, rest, found := strings.Cut(s, " "); found && len(token) >= 20 && token[4] == '-' {
+		if ts, err := time.Parse(time.RFC3339Nano, token); err == nil {
+			return ts, rest, true
+		}
+	}
+
+	for _, layout := range rfc3164Layouts {
+		if len(s) <= len(layout) || s[len(layout)] != ' ' {
+			continue
+		}
+		ts, err := time.ParseInLocation(layout, s[:len(layout)], received.Location())
+		if err != nil {
+			continue
+		}
+		ts = time.Date(received.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), ts.Location())
+		if ts.Sub(received) > 24*time.Hour {
+			ts = ts.AddDate(-1, 0, 0)
+		}
+		return ts, s[len(layout)+1:], true
+	}
+
+	return time.Time{}, s, false
+}
+
+// isSyslogTag reports whether a token looks like "tag:" or "tag[pid]:"
+func isSyslogTag(token string) bool {
+	if !strings.HasSuffix(token, ":") || len(token) < 2 || len(token) > 64 {
+		return false
+	}
+	return !strings.ContainsAny(token[:len(token)-1], ":/ ") || strings.Contains(token, "[")
+}
@@ -0,0 +1,155 @@
+package collectors
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSyslogRFC5424(t *testing.T) {
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		raw  string
+		want syslogMessage
+	}{
+		{
+			name: "full header",
+			raw:  "<165>1 2024-05-01T10:00:00.123Z web-1 nginx 4242 ID47 - \ufeffrequest failed\n",
+			want: syslogMessage{
+				Format: "rfc5424", Facility: 20, Severity: 5,
+				Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 123000000, time.UTC),
+				Hostname:  "web-1", AppName: "nginx", ProcID: "4242", MsgID: "ID47",
+				Message: "request failed",
+			},
+		},
+		{
+			name: "nil values and no message",
+			raw:  "<14>1 - - - - - -",
+			want: syslogMessage{Format: "rfc5424", Facility: 1, Severity: 6, Timestamp: received},
+		},
+		{
+			name: "structured data",
+			raw:  `<11>1 2024-05-01T10:00:00Z host app - - [exampleSDID@32473 iut="3" eventSource="App\"lic\]ation\\"][origin ip="192.0.2.1"] started`,
+			want: syslogMessage{
+				Format: "rfc5424", Facility: 1, Severity: 3,
+				Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+				Hostname:  "host", AppName: "app",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473": {"iut": "3", "eventSource": `App"lic]ation\`},
+					"origin":            {"ip": "192.0.2.1"},
+				},
+				Message: "started",
+			},
+		},
+		{
+			name: "element without parameters",
+			raw:  "<11>1 2024-05-01T10:00:00Z host app - - [meta]",
+			want: syslogMessage{
+				Format: "rfc5424", Facility: 1, Severity: 3,
+				Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+				Hostname:  "host", AppName: "app",
+				StructuredData: map[string]map[string]string{"meta": {}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSyslog(tt.raw, received); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSyslogRFC5424Fallback(t *testing.T) {
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Invalid RFC 5424 messages are kept as RFC 3164 with their PRI
+	tests := []string{
+		"<11>1 2024-05-01T10:00:00Z host app",                                  // truncated header
+		"<11>1 yesterday host app - - - message",                               // invalid timestamp
+		"<11>1 2024-05-01T10:00:00Z host app - - [id name=\"unterminated] msg", // unterminated value
+		"<11>1 2024-05-01T10:00:00Z host app - - [id name] msg",                // parameter without value
+		"<11>1 2024-05-01T10:00:00Z host app - - garbage",                      // missing structured data
+	}
+	for _, raw := range tests {
+		msg := parseSyslog(raw, received)
+		if msg.Format != "rfc3164" || msg.Facility != 1 || msg.Severity != 3 || msg.Message == "" {
+			t.Errorf("%q: got %+v", raw, *msg)
+		}
+	}
+}
+
+func TestParseSyslogRFC3164(t *testing.T) {
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name string
+		raw  string
+		want syslogMessage
+	}{
+		{
+			name: "full message",
+			raw:  "<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick",
+			want: syslogMessage{
+				Format: "rfc3164", Facility: 4, Severity: 2,
+				// A date after the receive time is from the previous year
+				Timestamp: time.Date(2023, 10, 11, 22, 14, 15, 0, time.Local),
+				Hostname:  "mymachine", AppName: "su", ProcID: "123",
+				Message: "'su root' failed for lonvick",
+			},
+		},
+		{
+			name: "no hostname",
+			raw:  "<13>May  1 11:59:00 cron: job done",
+			want: syslogMessage{
+				Format: "rfc3164", Facility: 1, Severity: 5,
+				Timestamp: time.Date(2024, 5, 1, 11, 59, 0, 0, time.Local),
+				AppName:   "cron", Message: "job done",
+			},
+		},
+		{
+			name: "RFC 3339 timestamp",
+			raw:  "<30>2024-05-01T10:00:00.5+02:00 host app: message",
+			want: syslogMessage{
+				Format: "rfc3164", Facility: 3, Severity: 6,
+				Timestamp: time.Date(2024, 5, 1, 8, 0, 0, 500000000, time.UTC),
+				Hostname:  "host", AppName: "app", Message: "message",
+			},
+		},
+		{
+			name: "no timestamp or tag",
+			raw:  "<13>just a message",
+			want: syslogMessage{Format: "rfc3164", Facility: 1, Severity: 5, Timestamp: received, Message: "just a message"},
+		},
+		{
+			name: "no PRI",
+			raw:  "plain text\r\n",
+			want: syslogMessage{Format: "rfc3164", Facility: 1, Severity: 5, Timestamp: received, Message: "plain text"},
+		},
+		{
+			name: "PRI out of range",
+			raw:  "<192>Oct 11 22:14:15 host app: x",
+			want: syslogMessage{Format: "rfc3164", Facility: 1, Severity: 5, Timestamp: received, Message: "<192>Oct 11 22:14:15 host app: x"},
+		},
+		{
+			name: "URL is not a tag",
+			raw:  "<13>http://example.com: down",
+			want: syslogMessage{Format: "rfc3164", Facility: 1, Severity: 5, Timestamp: received, Message: "http://example.com: down"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSyslog(tt.raw, received)
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("timestamp = %v, want %v", got.Timestamp, tt.want.Timestamp)
+			}
+			got.Timestamp = tt.want.Timestamp
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"hive-agent/internal/config"
+)
+
+func TestSyslogReadFrame(t *testing.T) {
+	sc := &SyslogCollector{config: config.SyslogLogsConfig{MaxMessageSize: 16}}
+
+	stream := "11 <13>hello\nx" + // octet-counted, the newline is part of the frame
+		"<13>newline framed\r\n" +
+		"<13>this line is longer than the limit\n" +
+		"5 <13>a" +
+		"<13>last line without newline"
+	reader := bufio.NewReader(strings.NewReader(stream))
+
+	// Newline-delimited frames are truncated to the maximum message size
+	want := []string{
+		"<13>hello\nx",
+		"<13>newline fram",
+		"<13>this line is",
+		"<13>a",
+		"<13>last line wi",
+	}
+	for _, w := range want {
+		frame, err := sc.readFrame(reader)
+		if err != nil {
+			t.Fatalf("reading %q: %v", w, err)
+		}
+		if frame != w {
+			t.Errorf("got frame %q, want %q", frame, w)
+		}
+	}
+	if _, err := sc.readFrame(reader); err != io.EOF {
+		t.Errorf("got %v at the end of the stream, want io.EOF", err)
+	}
+}
+
+func TestSyslogReadFrameInvalid(t *testing.T) {
+	sc := &SyslogCollector{config: config.SyslogLogsConfig{MaxMessageSize: 1024}}
+
+	tests := []struct {
+		name   string
+		stream string
+	}{
+		{"truncated frame", "20 <13>short"},
+		{"truncated length", "12"},
+		{"non-digit in length", "12a <13>message"},
+		{"oversized frame", "2048 " + strings.Repeat("x", 2048)},
+		// The length is rejected before an unbounded number of digits is read
+		{"overlong length", strings.Repeat("9", 1000) + " x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := sc.readFrame(bufio.NewReader(strings.NewReader(tt.stream)))
+			if err == nil || err == io.EOF {
+				t.Errorf("got %q, %v; want an error", frame, err)
+			}
+		})
+	}
+}
+
+// startTestSyslog starts a syslog collector listening on a random local
+// TCP port and returns its address
+func startTestSyslog(t *testing.T, cfg config.SyslogLogsConfig) (*SyslogCollector, string, chan interface{}) {
+	t.Helper()
+
+	cfg.Enabled = true
+	cfg.TCPAddress = "127.0.0.1:0"
+	if cfg.MaxMessageSize == 0 {
+		cfg.MaxMessageSize = 1024
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = time.Minute
+	}
+	collector, err := NewSyslogCollector(cfg, newTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(chan interface{}, 100)
+	if err := collector.Start(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { collector.Stop(context.Background()) })
+
+	return collector, collector.listeners["tcp"].Addr().String(), data
+}
+
+// nextSyslogRecord waits for the next forwarded record
+func nextSyslogRecord(t *testing.T, data chan interface{}) map[string]interface{} {
+	t.Helper()
+
+	select {
+	case item := <-data:
+		return item.(CollectedData).Data
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a syslog record")
+		return nil
+	}
+}
+
+func TestSyslogCollectorTCP(t *testing.T) {
+	_, addr, data := startTestSyslog(t, config.SyslogLogsConfig{Tags: map[string]string{"env": "test"}})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	message := `<165>1 2024-05-01T10:00:00Z web-1 nginx 42 - [meta seq="1"] request failed`
+	if _, err := io.WriteString(conn, "74 "+message+"<13>May  1 10:00:00 cron: done\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	first := nextSyslogRecord(t, data)
+	if first["message"] != "request failed" || first["appname"] != "nginx" || first["hostname"] != "web-1" ||
+		first["format"] != "rfc5424" || first["transport"] != "tcp" || first["remote_addr"] != "127.0.0.1" ||
+		first["facility"] != "local4" || first["severity"] != "notice" || first["env"] != "test" {
+		t.Errorf("first record = %v", first)
+	}
+	if sd, _ := first["structured_data"].(map[string]map[string]string); sd["meta"]["seq"] != "1" {
+		t.Errorf("structured data = %v", first["structured_data"])
+	}
+
+	// Without a hostname in the message the peer address is used
+	second := nextSyslogRecord(t, data)
+	if second["message"] != "done" || second["appname"] != "cron" || second["hostname"] != "127.0.0.1" {
+		t.Errorf("second record = %v", second)
+	}
+}
+
+func TestSyslogCollectorMaxConnections(t *testing.T) {
+	collector, addr, data := startTestSyslog(t, config.SyslogLogsConfig{MaxConnections: 1})
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	io.WriteString(first, "<13>first connection\n")
+	nextSyslogRecord(t, data)
+
+	// The second connection is closed by the agent without being read
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("got %v reading from a rejected connection, want io.EOF", err)
+	}
+	if rejected := collector.Health().Details["rejected"]; rejected != "1" {
+		t.Errorf("rejected = %s, want 1", rejected)
+	}
+
+	// Closing the first connection frees its slot
+	first.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		third, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(third, "<13>third connection\n")
+		select {
+		case item := <-data:
+			third.Close()
+			if got := item.(CollectedData).Data["message"]; got != "third connection" {
+				t.Errorf("got %q", got)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+		third.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("connection slot was not released")
+		}
+	}
+}
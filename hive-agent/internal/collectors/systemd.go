@@ -0,0 +1,219 @@
+package collectors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	systemd "github.com/coreos/go-systemd/v22/dbus"
+)
+
+// defaultServicePatterns matches all service units
+var defaultServicePatterns = []string{"*.service"}
+
+// systemdUnit is the state of a single systemd unit
+type systemdUnit struct {
+	Name        string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Restarts    uint32
+}
+
+// found reports whether the unit exists. Both D-Bus and systemctl list
+// units that are only referenced, such as by a dependency, as not-found.
+func (u systemdUnit) found() bool {
+	return u.LoadState != "not-found"
+}
+
+// restarting reports whether systemd is waiting to restart the unit
+func (u systemdUnit) restarting() bool {
+	return u.SubState == "auto-restart"
+}
+
+// systemdReader reads unit states over the systemd D-Bus API, falling back
+// to `systemctl show` when the bus is not reachable
+type systemdReader struct {
+	mu   sync.Mutex
+	conn *systemd.Conn
+}
+
+// newSystemdReader creates a new systemd unit reader
+func newSystemdReader() *systemdReader {
+	return &systemdReader{}
+}
+
+// units returns the state of all loaded units matching the patterns
+func (sr *systemdReader) units(ctx context.Context, patterns []string) ([]systemdUnit, error) {
+	if len(patterns) == 0 {
+		patterns = defaultServicePatterns
+	}
+
+	units, err := sr.unitsDBus(ctx, patterns)
+	if err == nil {
+		return units, nil
+	}
+
+	units, fallbackErr := sr.unitsSystemctl(ctx, patterns)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("dbus: %v; systemctl: %w", err, fallbackErr)
+	}
+	return units, nil
+}
+
+// unitsDBus reads unit states over D-Bus
+func (sr *systemdReader) unitsDBus(ctx context.Context, patterns []string) ([]systemdUnit, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if sr.conn == nil || !sr.conn.Connected() {
+		conn, err := systemd.NewSystemConnectionContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to systemd: %w", err)
+		}
+		sr.conn = conn
+	}
+
+	statuses, err := sr.conn.ListUnitsByPatternsContext(ctx, nil, patterns)
+	if err != nil {
+		sr.conn.Close()
+		sr.conn = nil
+		return nil, fmt.Errorf("failed to list units: %w", err)
+	}
+
+	units := make([]systemdUnit, 0, len(statuses))
+	for _, status := range statuses {
+		unit := systemdUnit{
+			Name:        status.Name,
+			LoadState:   status.LoadState,
+			ActiveState: status.ActiveState,
+			SubState:    status.SubState,
+		}
+		if !unit.found() {
+			continue
+		}
+
+		if strings.HasSuffix(status.Name, ".service") {
+			if prop, err := sr.conn.GetServicePropertyContext(ctx, status.Name, "NRestarts"); err == nil {
+				if restarts, ok := prop.Value.Value().(uint32); ok {
+					unit.Restarts = restarts
+				}
+			}
+		}
+
+		units = append(units, unit)
+	}
+
+	return units, nil
+}
+
+// unitsSystemctl reads unit states by parsing `systemctl show` output
+func (sr *systemdReader) unitsSystemctl(ctx context.Context, patterns []string) ([]systemdUnit, error) {
+	args := append([]string{"show", "--all", "--property=Id,LoadState,ActiveState,SubState,NRestarts", "--"}, patterns...)
+	output, err := exec.CommandContext(ctx, "systemctl", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("systemctl show failed: %w", err)
+	}
+	return parseSystemctlShow(output), nil
+}
+
+// parseSystemctlShow parses blank-line separated blocks of Key=Value pairs
+func parseSystemctlShow(output []byte) []systemdUnit {
+	var units []systemdUnit
+	var unit systemdUnit
+
+	flush := func() {
+		if unit.Name != "" && unit.found() {
+			units = append(units, unit)
+		}
+		unit = systemdUnit{}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			flush()
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "Id":
+			unit.Name = value
+		case "LoadState":
+			unit.LoadState = value
+		case "ActiveState":
+			unit.ActiveState = value
+		case "SubState":
+			unit.SubState = value
+		case "NRestarts":
+			if restarts, err := strconv.ParseUint(value, 10, 32); err == nil {
+				unit.Restarts = uint32(restarts)
+			}
+		}
+	}
+	flush()
+
+	return units
+}
+
+// close closes the D-Bus connection
+func (sr *systemdReader) close() {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if sr.conn != nil {
+		sr.conn.Close()
+		sr.conn = nil
+	}
+}
+
+// collectServiceMetrics collects systemd service state metrics
+func (smc *SystemMetricsCollector) collectServiceMetrics(timestamp time.Time) {
+	ctx, cancel := context.WithTimeout(smc.ctx, 30*time.Second)
+	defer cancel()
+
+	units, err := smc.services.units(ctx, smc.config.SystemMetrics.ServiceUnits)
+	if err != nil {
+		smc.logger.Error("Failed to get systemd unit states", "error", err)
+		smc.lastError = fmt.Sprintf("Service metrics error: %v", err)
+		return
+	}
+
+	ts := timestamp.Format(time.RFC3339)
+	active, failed, restarting := 0, 0, 0
+
+	for _, unit := range units {
+		up := 0
+		switch {
+		case unit.ActiveState == "active":
+			active++
+			up = 1
+		case unit.ActiveState == "failed":
+			failed++
+		}
+		if unit.restarting() {
+			restarting++
+		}
+
+		// States are not labels, so that a state change does not start a
+		// new series; service events report the states themselves
+		labels := map[string]string{"unit": unit.Name}
+		smc.sendMetric(&MetricData{Name: "system.service.up", Type: "gauge", Value: up, Labels: labels, Timestamp: ts, Unit: "boolean"})
+		smc.sendMetric(&MetricData{Name: "system.service.restarts", Type: "counter", Value: unit.Restarts, Labels: labels, Timestamp: ts, Unit: "count"})
+	}
+
+	smc.sendMetric(&MetricData{Name: "system.services.active", Type: "gauge", Value: active, Timestamp: ts, Unit: "count"})
+	smc.sendMetric(&MetricData{Name: "system.services.failed", Type: "gauge", Value: failed, Timestamp: ts, Unit: "count"})
+	smc.sendMetric(&MetricData{Name: "system.services.restarting", Type: "gauge", Value: restarting, Timestamp: ts, Unit: "count"})
+}
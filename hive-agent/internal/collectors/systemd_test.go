@@ -0,0 +1,42 @@
+package collectors
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSystemctlShow(t *testing.T) {
+	output := []byte(`Id=nginx.service
+LoadState=loaded
+ActiveState=active
+SubState=running
+NRestarts=2
+
+Id=missing.service
+LoadState=not-found
+ActiveState=inactive
+SubState=dead
+NRestarts=0
+
+Id=worker.service
+LoadState=loaded
+ActiveState=activating
+SubState=auto-restart
+NRestarts=invalid
+`)
+
+	want := []systemdUnit{
+		{Name: "nginx.service", LoadState: "loaded", ActiveState: "active", SubState: "running", Restarts: 2},
+		{Name: "worker.service", LoadState: "loaded", ActiveState: "activating", SubState: "auto-restart"},
+	}
+	units := parseSystemctlShow(output)
+	if !reflect.DeepEqual(units, want) {
+		t.Errorf("got %+v, want %+v", units, want)
+	}
+	if units[0].restarting() || !units[1].restarting() {
+		t.Error("restarting units not detected")
+	}
+	if len(parseSystemctlShow(nil)) != 0 {
+		t.Error("units parsed from empty output")
+	}
+}
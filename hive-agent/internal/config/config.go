@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 // Config represents the complete agent configuration
 type Config struct {
 	Server      ServerConfig      `yaml:"server"`
+	Commands    CommandsConfig    `yaml:"commands"`
 	Agent       AgentConfig       `yaml:"agent"`
 	Logging     LoggingConfig     `yaml:"logging"`
 	Collectors  CollectorsConfig  `yaml:"collectors"`
@@ -29,6 +32,22 @@ type ServerConfig struct {
 	Timeout           time.Duration `yaml:"timeout"`
 }
 
+// CommandsConfig contains remote command settings
+type CommandsConfig struct {
+	// PolicyFile is the local command policy; when empty,
+	// /etc/pulse-hive/command-policy.yaml is used if it exists
+	PolicyFile string `yaml:"policy_file,omitempty"`
+	// SigningKeys are pinned base64 Ed25519 public keys; when set, every
+	// command must carry a valid signature by one of them
+	SigningKeys []string `yaml:"signing_keys,omitempty"`
+	// MaxCommandTTL bounds how far in the future a signed command may expire
+	MaxCommandTTL time.Duration `yaml:"max_command_ttl,omitempty"`
+	// DefaultTimeout applies to commands that do not set a timeout
+	DefaultTimeout time.Duration `yaml:"default_timeout,omitempty"`
+	// MaxTimeout caps the timeout a command may request
+	MaxTimeout time.Duration `yaml:"max_timeout,omitempty"`
+}
+
 // AgentConfig contains agent-specific settings
 type AgentConfig struct {
 	Name                string            `yaml:"name"`
@@ -63,6 +82,8 @@ type CollectorsConfig struct {
 	Metrics MetricsCollectorConfig `yaml:"metrics"`
 	Traces  TracesCollectorConfig `yaml:"traces"`
 	Events  EventsCollectorConfig `yaml:"events"`
+	StatsD  StatsDCollectorConfig `yaml:"statsd,omitempty"`
+	Scrape  ScrapeCollectorConfig `yaml:"scrape,omitempty"`
 }
 
 // LogCollectorConfig configures log collection
@@ -76,6 +97,75 @@ type LogCollectorConfig struct {
 	RotateWait  time.Duration           `yaml:"rotate_wait"`
 	ScanFreq    time.Duration           `yaml:"scan_frequency"`
 	MaxFileSize int64                   `yaml:"max_file_size"` // bytes
+	Docker      DockerLogsConfig        `yaml:"docker,omitempty"`
+	Kernel      KernelLogsConfig        `yaml:"kernel,omitempty"`
+	Journald    JournaldLogsConfig      `yaml:"journald,omitempty"`
+	Syslog      SyslogLogsConfig        `yaml:"syslog,omitempty"`
+	Kubernetes  KubernetesLogsConfig    `yaml:"kubernetes,omitempty"`
+}
+
+// KubernetesLogsConfig configures pod log collection from the node's
+// /var/log/pods directory, enriched with pod metadata from the API server
+type KubernetesLogsConfig struct {
+	Enabled            bool              `yaml:"enabled"`
+	Path               string            `yaml:"path,omitempty"`
+	APIServer          string            `yaml:"api_server,omitempty"` // defaults to the in-cluster service address
+	TokenFile          string            `yaml:"token_file,omitempty"`
+	CAFile             string            `yaml:"ca_file,omitempty"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify,omitempty"`
+	NodeName           string            `yaml:"node_name,omitempty"` // defaults to $NODE_NAME; limits the pod watch to this node
+	Include            []string          `yaml:"include,omitempty"`   // namespace globs
+	Exclude            []string          `yaml:"exclude,omitempty"`   // namespace globs
+	RefreshInterval    time.Duration     `yaml:"refresh_interval,omitempty"`
+	Tags               map[string]string `yaml:"tags,omitempty"`
+}
+
+// SyslogLogsConfig configures the syslog receiver
+type SyslogLogsConfig struct {
+	Enabled        bool              `yaml:"enabled"`
+	UDPAddress     string            `yaml:"udp_address,omitempty"`
+	TCPAddress     string            `yaml:"tcp_address,omitempty"`
+	TLSAddress     string            `yaml:"tls_address,omitempty"` // TCP with TLS; cert_file and key_file required, ca_file requires client certificates
+	TLS            TLSConfig         `yaml:"tls,omitempty"`
+	RateLimit      float64           `yaml:"rate_limit,omitempty"` // messages per second per source IP, 0 for unlimited
+	RateBurst      int               `yaml:"rate_burst,omitempty"`
+	MaxMessageSize int               `yaml:"max_message_size,omitempty"`
+	IdleTimeout    time.Duration     `yaml:"idle_timeout,omitempty"`    // closes idle TCP connections
+	MaxConnections int               `yaml:"max_connections,omitempty"` // open TCP and TLS connections
+	Tags           map[string]string `yaml:"tags,omitempty"`
+}
+
+// JournaldLogsConfig configures systemd journal collection via journalctl
+type JournaldLogsConfig struct {
+	Enabled   bool              `yaml:"enabled"`
+	Command   string            `yaml:"command,omitempty"`   // journalctl binary
+	Directory string            `yaml:"directory,omitempty"` // read journal files from this directory instead of the system journal
+	Level     string            `yaml:"level,omitempty"`     // lowest priority forwarded: emerg .. debug
+	Include   []string          `yaml:"include,omitempty"`   // unit name globs
+	Exclude   []string          `yaml:"exclude,omitempty"`   // unit name globs
+	Tags      map[string]string `yaml:"tags,omitempty"`
+}
+
+// KernelLogsConfig configures kernel log collection from /dev/kmsg
+type KernelLogsConfig struct {
+	Enabled       bool              `yaml:"enabled"`
+	Path          string            `yaml:"path,omitempty"`           // /dev/kmsg, or a file in the same format
+	Level         string            `yaml:"level,omitempty"`          // lowest severity forwarded: emerg .. debug
+	FromStart     bool              `yaml:"from_start,omitempty"`     // replay the ring buffer on start
+	DisableRules  []string          `yaml:"disable_rules,omitempty"`  // oom_kill, hung_task, fs_error, segfault, mce
+	IssueCooldown time.Duration     `yaml:"issue_cooldown,omitempty"` // minimum gap between identical issues
+	Tags          map[string]string `yaml:"tags,omitempty"`
+}
+
+// DockerLogsConfig configures collection of container json-file logs,
+// with containers discovered through the Docker Engine API
+type DockerLogsConfig struct {
+	Enabled         bool              `yaml:"enabled"`
+	Socket          string            `yaml:"socket,omitempty"`
+	Include         []string          `yaml:"include,omitempty"` // container name globs
+	Exclude         []string          `yaml:"exclude,omitempty"` // container name globs
+	Tags            map[string]string `yaml:"tags,omitempty"`
+	RefreshInterval time.Duration     `yaml:"refresh_interval,omitempty"`
 }
 
 // LogPathConfig defines a log file path configuration
@@ -133,6 +223,37 @@ type SystemMetricsConfig struct {
 	Process   bool `yaml:"process"`
 	Docker    bool `yaml:"docker,omitempty"`
 	Services  bool `yaml:"services,omitempty"`
+
+	DockerSocket string               `yaml:"docker_socket,omitempty"`
+	ServiceUnits []string             `yaml:"service_units,omitempty"` // unit name globs, default all services
+	Processes    ProcessMetricsConfig `yaml:"processes,omitempty"`
+
+	Pressure bool                `yaml:"pressure,omitempty"` // Linux pressure stall information
+	ProcRoot string              `yaml:"proc_root,omitempty"`
+	Cgroups  CgroupMetricsConfig `yaml:"cgroups,omitempty"`
+}
+
+// CgroupMetricsConfig defines cgroup v2 metrics collection
+type CgroupMetricsConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Root    string   `yaml:"root,omitempty"`
+	Paths   []string `yaml:"paths,omitempty"` // globs relative to root
+}
+
+// ProcessMetricsConfig defines per-process metrics collection
+type ProcessMetricsConfig struct {
+	TopN    int                  `yaml:"top_n"`             // top processes by CPU and by memory; -1 disables
+	Groups  []ProcessMatchConfig `yaml:"groups,omitempty"`  // always-tracked process groups
+	Exclude []ProcessMatchConfig `yaml:"exclude,omitempty"` // processes ignored for top-N and groups
+}
+
+// ProcessMatchConfig matches processes by name, command line or user.
+// All non-empty criteria must match.
+type ProcessMatchConfig struct {
+	Name    string `yaml:"name"`
+	Process string `yaml:"process,omitempty"` // exact executable name
+	Cmdline string `yaml:"cmdline,omitempty"` // regex
+	User    string `yaml:"user,omitempty"`
 }
 
 // CustomMetricConfig defines custom metrics
@@ -147,6 +268,54 @@ type CustomMetricConfig struct {
 	Parser   map[string]interface{} `yaml:"parser,omitempty"`
 }
 
+// StatsDCollectorConfig configures the StatsD/DogStatsD receiver
+type StatsDCollectorConfig struct {
+	Enabled       bool              `yaml:"enabled"`
+	Address       string            `yaml:"address,omitempty"`     // UDP listen address
+	Socket        string            `yaml:"socket,omitempty"`      // unix datagram socket path
+	SocketMode    string            `yaml:"socket_mode,omitempty"` // octal permissions of the socket
+	FlushInterval time.Duration     `yaml:"flush_interval,omitempty"`
+	SeriesExpiry  time.Duration     `yaml:"series_expiry,omitempty"` // negative keeps counters and gauges forever
+	Percentiles   []float64         `yaml:"percentiles,omitempty"`
+	MaxPacketSize int               `yaml:"max_packet_size,omitempty"`
+	Tags          map[string]string `yaml:"tags,omitempty"`
+}
+
+// ScrapeCollectorConfig configures scraping of Prometheus and OpenMetrics endpoints
+type ScrapeCollectorConfig struct {
+	Enabled  bool                 `yaml:"enabled"`
+	Interval time.Duration        `yaml:"interval,omitempty"` // default for targets
+	Timeout  time.Duration        `yaml:"timeout,omitempty"`  // default for targets
+	Targets  []ScrapeTargetConfig `yaml:"targets"`
+}
+
+// ScrapeTargetConfig defines a single scrape target
+type ScrapeTargetConfig struct {
+	Name        string            `yaml:"name"` // job label
+	URL         string            `yaml:"url"`
+	Interval    time.Duration     `yaml:"interval,omitempty"`
+	Timeout     time.Duration     `yaml:"timeout,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	Auth        AuthConfig        `yaml:"auth,omitempty"`
+	TLS         TLSConfig         `yaml:"tls,omitempty"`
+	HonorLabels bool              `yaml:"honor_labels,omitempty"`
+	Include     []string          `yaml:"include,omitempty"` // metric name regexes
+	Exclude     []string          `yaml:"exclude,omitempty"` // metric name regexes
+	Relabel     []RelabelConfig   `yaml:"relabel,omitempty"`
+}
+
+// RelabelConfig is a Prometheus-style relabeling rule applied to every
+// scraped sample. The metric name is available as __name__.
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels,omitempty"`
+	Separator    string   `yaml:"separator,omitempty"`
+	Regex        string   `yaml:"regex,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+	Action       string   `yaml:"action,omitempty"` // replace, keep, drop, labelmap, labeldrop, labelkeep
+}
+
 // TracesCollectorConfig configures distributed tracing
 type TracesCollectorConfig struct {
 	Enabled    bool                      `yaml:"enabled"`
@@ -174,6 +343,7 @@ type EventsCollectorConfig struct {
 	Enabled      bool                  `yaml:"enabled"`
 	SystemEvents SystemEventsConfig    `yaml:"system"`
 	CustomEvents []CustomEventConfig   `yaml:"custom,omitempty"`
+	Integrity    FileIntegrityConfig   `yaml:"integrity,omitempty"`
 }
 
 // SystemEventsConfig defines system events to monitor
@@ -182,6 +352,41 @@ type SystemEventsConfig struct {
 	Process    bool `yaml:"process"`
 	Network    bool `yaml:"network"`
 	Services   bool `yaml:"services"`
+
+	ServiceUnits    []string      `yaml:"service_units,omitempty"` // unit name globs, default all services
+	ServiceInterval time.Duration `yaml:"service_interval,omitempty"`
+
+	FileSystemPaths []string `yaml:"filesystem_paths,omitempty"` // files or directories watched when filesystem is set
+
+	ProcessSource   string               `yaml:"process_source,omitempty"`   // auto, netlink, poll
+	ProcessInterval time.Duration        `yaml:"process_interval,omitempty"` // snapshot interval when polling
+	ProcessInclude  []ProcessMatchConfig `yaml:"process_include,omitempty"`  // only these processes, default all
+	ProcessExclude  []ProcessMatchConfig `yaml:"process_exclude,omitempty"`
+
+	NetworkInterval   time.Duration `yaml:"network_interval,omitempty"`
+	NetworkInterfaces []string      `yaml:"network_interfaces,omitempty"` // interface name globs, default all
+	ExpectedPorts     []int         `yaml:"expected_ports,omitempty"`     // listeners on other ports are flagged
+}
+
+// FileIntegrityConfig configures file integrity monitoring against a
+// baseline stored under the agent data directory
+type FileIntegrityConfig struct {
+	Enabled  bool                `yaml:"enabled"`
+	Interval time.Duration       `yaml:"interval,omitempty"` // periodic full verification
+	Debounce time.Duration       `yaml:"debounce,omitempty"` // delay before event-triggered verification
+	MaxSize  int64               `yaml:"max_size,omitempty"` // largest file hashed, in bytes
+	Rules    []FileIntegrityRule `yaml:"rules"`
+}
+
+// FileIntegrityRule defines a monitored file or directory
+type FileIntegrityRule struct {
+	Name      string   `yaml:"name"`
+	Path      string   `yaml:"path"`
+	Recursive bool     `yaml:"recursive,omitempty"`
+	Include   []string `yaml:"include,omitempty"` // file name globs
+	Exclude   []string `yaml:"exclude,omitempty"` // file name globs
+	Severity  string   `yaml:"severity,omitempty"`
+	Watch     bool     `yaml:"watch,omitempty"` // verify on change events as well as periodically
 }
 
 // CustomEventConfig defines custom event monitoring
@@ -193,6 +398,23 @@ type CustomEventConfig struct {
 	Config      map[string]interface{} `yaml:"config,omitempty"`
 }
 
+// DecodeOptions decodes the type-specific Config map into out, which
+// should be a pointer to a struct with yaml tags
+func (c CustomEventConfig) DecodeOptions(out interface{}) error {
+	if len(c.Config) == 0 {
+		return nil
+	}
+
+	data, err := yaml.Marshal(c.Config)
+	if err != nil {
+		return fmt.Errorf("invalid config for custom event %s: %w", c.Name, err)
+	}
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid config for custom event %s: %w", c.Name, err)
+	}
+	return nil
+}
+
 // ProcessorConfig defines data processors
 type ProcessorConfig struct {
 	Name   string                 `yaml:"name"`
@@ -227,6 +449,28 @@ type AuthConfig struct {
 	Header   string `yaml:"header,omitempty"`
 }
 
+// SetHeaders sets the headers of the authentication method on a request
+func (a AuthConfig) SetHeaders(req *http.Request) {
+	switch a.Type {
+	case "bearer":
+		if a.Token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.Token))
+		}
+	case "basic":
+		if a.Username != "" && a.Password != "" {
+			req.SetBasicAuth(a.Username, a.Password)
+		}
+	case "api_key":
+		if a.APIKey != "" {
+			headerName := a.Header
+			if headerName == "" {
+				headerName = "X-API-Key"
+			}
+			req.Header.Set(headerName, a.APIKey)
+		}
+	}
+}
+
 // RetryConfig defines retry behavior
 type RetryConfig struct {
 	MaxRetries      int           `yaml:"max_retries"`
@@ -305,6 +549,17 @@ func (c *Config) setDefaults() error {
 		c.Server.Timeout = 30 * time.Second
 	}
 
+	// Command defaults
+	if c.Commands.MaxCommandTTL == 0 {
+		c.Commands.MaxCommandTTL = time.Hour
+	}
+	if c.Commands.DefaultTimeout == 0 {
+		c.Commands.DefaultTimeout = 30 * time.Second
+	}
+	if c.Commands.MaxTimeout == 0 {
+		c.Commands.MaxTimeout = time.Hour
+	}
+
 	// Agent defaults
 	if c.Agent.Name == "" {
 		hostname, _ := os.Hostname()
@@ -350,9 +605,145 @@ func (c *Config) setDefaults() error {
 	if c.Collectors.Logs.RotateWait == 0 {
 		c.Collectors.Logs.RotateWait = 5 * time.Second
 	}
+	if c.Collectors.Logs.Docker.Socket == "" {
+		c.Collectors.Logs.Docker.Socket = "/var/run/docker.sock"
+	}
+	if c.Collectors.Logs.Kernel.Path == "" {
+		c.Collectors.Logs.Kernel.Path = "/dev/kmsg"
+	}
+	if c.Collectors.Logs.Kernel.Level == "" {
+		c.Collectors.Logs.Kernel.Level = "info"
+	}
+	if c.Collectors.Logs.Kernel.IssueCooldown == 0 {
+		c.Collectors.Logs.Kernel.IssueCooldown = time.Minute
+	}
+	if c.Collectors.Logs.Journald.Command == "" {
+		c.Collectors.Logs.Journald.Command = "journalctl"
+	}
+	if c.Collectors.Logs.Journald.Level == "" {
+		c.Collectors.Logs.Journald.Level = "debug"
+	}
+	if c.Collectors.Logs.Kubernetes.Path == "" {
+		c.Collectors.Logs.Kubernetes.Path = "/var/log/pods"
+	}
+	if c.Collectors.Logs.Kubernetes.APIServer == "" {
+		if host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"); host != "" && port != "" {
+			c.Collectors.Logs.Kubernetes.APIServer = "https://" + net.JoinHostPort(host, port)
+		}
+	}
+	if c.Collectors.Logs.Kubernetes.TokenFile == "" {
+		c.Collectors.Logs.Kubernetes.TokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	}
+	if c.Collectors.Logs.Kubernetes.CAFile == "" {
+		c.Collectors.Logs.Kubernetes.CAFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	}
+	if c.Collectors.Logs.Kubernetes.NodeName == "" {
+		c.Collectors.Logs.Kubernetes.NodeName = os.Getenv("NODE_NAME")
+	}
+	if c.Collectors.Logs.Kubernetes.RefreshInterval == 0 {
+		c.Collectors.Logs.Kubernetes.RefreshInterval = 10 * time.Second
+	}
+	if c.Collectors.Logs.Syslog.MaxMessageSize == 0 {
+		c.Collectors.Logs.Syslog.MaxMessageSize = 64 * 1024
+	}
+	if c.Collectors.Logs.Syslog.IdleTimeout == 0 {
+		c.Collectors.Logs.Syslog.IdleTimeout = 5 * time.Minute
+	}
+	if c.Collectors.Logs.Syslog.MaxConnections == 0 {
+		c.Collectors.Logs.Syslog.MaxConnections = 256
+	}
+	if c.Collectors.Logs.Docker.RefreshInterval == 0 {
+		c.Collectors.Logs.Docker.RefreshInterval = 10 * time.Second
+	}
 	if c.Collectors.Metrics.Interval == 0 {
 		c.Collectors.Metrics.Interval = 60 * time.Second
 	}
+	if c.Collectors.Metrics.SystemMetrics.DockerSocket == "" {
+		c.Collectors.Metrics.SystemMetrics.DockerSocket = "/var/run/docker.sock"
+	}
+	if c.Collectors.Metrics.SystemMetrics.ProcRoot == "" {
+		c.Collectors.Metrics.SystemMetrics.ProcRoot = "/proc"
+	}
+	if c.Collectors.Metrics.SystemMetrics.Cgroups.Root == "" {
+		c.Collectors.Metrics.SystemMetrics.Cgroups.Root = "/sys/fs/cgroup"
+	}
+	if len(c.Collectors.Metrics.SystemMetrics.Cgroups.Paths) == 0 {
+		c.Collectors.Metrics.SystemMetrics.Cgroups.Paths = []string{
+			"*.slice",
+			"system.slice/*.service",
+			"system.slice/docker-*.scope",
+			"kubepods.slice/*.slice",
+			"kubepods.slice/*.slice/*.slice",
+		}
+	}
+	// 0 means unset; a negative top_n disables the top-N metrics
+	if c.Collectors.Metrics.SystemMetrics.Processes.TopN == 0 {
+		c.Collectors.Metrics.SystemMetrics.Processes.TopN = 10
+	}
+
+	if c.Collectors.StatsD.Address == "" && c.Collectors.StatsD.Socket == "" {
+		c.Collectors.StatsD.Address = "127.0.0.1:8125"
+	}
+	if c.Collectors.StatsD.SocketMode == "" {
+		c.Collectors.StatsD.SocketMode = "0660"
+	}
+	if c.Collectors.StatsD.FlushInterval == 0 {
+		c.Collectors.StatsD.FlushInterval = 10 * time.Second
+	}
+	// 0 means unset; a negative series_expiry never expires counters and gauges
+	if c.Collectors.StatsD.SeriesExpiry == 0 {
+		c.Collectors.StatsD.SeriesExpiry = 5 * time.Minute
+	}
+	if len(c.Collectors.StatsD.Percentiles) == 0 {
+		c.Collectors.StatsD.Percentiles = []float64{50, 90, 95, 99}
+	}
+	if c.Collectors.StatsD.MaxPacketSize == 0 {
+		c.Collectors.StatsD.MaxPacketSize = 8192
+	}
+
+	if c.Collectors.Scrape.Interval == 0 {
+		c.Collectors.Scrape.Interval = 30 * time.Second
+	}
+	if c.Collectors.Scrape.Timeout == 0 {
+		c.Collectors.Scrape.Timeout = 10 * time.Second
+	}
+	for i := range c.Collectors.Scrape.Targets {
+		target := &c.Collectors.Scrape.Targets[i]
+		if target.Interval == 0 {
+			target.Interval = c.Collectors.Scrape.Interval
+		}
+		if target.Timeout == 0 {
+			target.Timeout = c.Collectors.Scrape.Timeout
+		}
+		if target.Timeout > target.Interval {
+			target.Timeout = target.Interval
+		}
+	}
+
+	if c.Collectors.Events.SystemEvents.ServiceInterval == 0 {
+		c.Collectors.Events.SystemEvents.ServiceInterval = 10 * time.Second
+	}
+	if c.Collectors.Events.Integrity.Interval == 0 {
+		c.Collectors.Events.Integrity.Interval = time.Hour
+	}
+	if c.Collectors.Events.Integrity.Debounce == 0 {
+		c.Collectors.Events.Integrity.Debounce = 2 * time.Second
+	}
+	if c.Collectors.Events.Integrity.MaxSize == 0 {
+		c.Collectors.Events.Integrity.MaxSize = 256 * 1024 * 1024
+	}
+	if c.Collectors.Events.SystemEvents.ProcessSource == "" {
+		c.Collectors.Events.SystemEvents.ProcessSource = "auto"
+	}
+	if c.Collectors.Events.SystemEvents.ProcessInterval == 0 {
+		c.Collectors.Events.SystemEvents.ProcessInterval = time.Second
+	}
+	if c.Collectors.Events.SystemEvents.NetworkInterval == 0 {
+		c.Collectors.Events.SystemEvents.NetworkInterval = 5 * time.Second
+	}
+	if len(c.Collectors.Events.SystemEvents.FileSystemPaths) == 0 {
+		c.Collectors.Events.SystemEvents.FileSystemPaths = []string{"/etc"}
+	}
 
 	// Healthcheck defaults
 	if c.Healthcheck.Enabled && c.Healthcheck.Port == 0 {
@@ -388,5 +779,40 @@ func (c *Config) validate() error {
 		return fmt.Errorf("invalid logging level: %s", c.Logging.Level)
 	}
 
+	// Validate scrape targets
+	if c.Collectors.Scrape.Enabled {
+		for i, target := range c.Collectors.Scrape.Targets {
+			if target.URL == "" {
+				return fmt.Errorf("collectors.scrape.targets[%d].url is required", i)
+			}
+		}
+	}
+
+	// Validate process event source
+	switch c.Collectors.Events.SystemEvents.ProcessSource {
+	case "auto", "netlink", "poll":
+	default:
+		return fmt.Errorf("invalid collectors.events.system.process_source: %s", c.Collectors.Events.SystemEvents.ProcessSource)
+	}
+
+	// Validate event intervals, which drive tickers. Integrity checks for
+	// debounced changes every half debounce.
+	events := c.Collectors.Events
+	for _, interval := range []struct {
+		name  string
+		value time.Duration
+		min   time.Duration
+	}{
+		{"system.service_interval", events.SystemEvents.ServiceInterval, time.Millisecond},
+		{"system.process_interval", events.SystemEvents.ProcessInterval, time.Millisecond},
+		{"system.network_interval", events.SystemEvents.NetworkInterval, time.Millisecond},
+		{"integrity.interval", events.Integrity.Interval, time.Millisecond},
+		{"integrity.debounce", events.Integrity.Debounce, 2 * time.Millisecond},
+	} {
+		if interval.value < interval.min {
+			return fmt.Errorf("invalid collectors.events.%s: %s, must be at least %s", interval.name, interval.value, interval.min)
+		}
+	}
+
 	return nil
 }
\ No newline at end of file
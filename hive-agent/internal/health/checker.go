@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"hive-agent/internal/config"
@@ -16,14 +17,25 @@ type Checker struct {
 	config config.HealthcheckConfig
 	logger *logger.Logger
 	server *http.Server
+
+	checks   map[string]func() ComponentStatus
+	checksMu sync.RWMutex
 }
 
 // HealthStatus represents overall health status
 type HealthStatus struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Uptime    string    `json:"uptime"`
-	Version   string    `json:"version"`
+	Status     string                     `json:"status"`
+	Timestamp  time.Time                  `json:"timestamp"`
+	Uptime     string                     `json:"uptime"`
+	Version    string                     `json:"version"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+// ComponentStatus is the health of one agent component
+type ComponentStatus struct {
+	Healthy bool              `json:"healthy"`
+	Message string            `json:"message,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
 }
 
 // New creates a new health checker
@@ -31,9 +43,18 @@ func New(cfg config.HealthcheckConfig, log *logger.Logger) *Checker {
 	return &Checker{
 		config: cfg,
 		logger: log,
+		checks: make(map[string]func() ComponentStatus),
 	}
 }
 
+// Register adds a component check to the health response. An unhealthy
+// component makes the overall status degraded.
+func (hc *Checker) Register(name string, check func() ComponentStatus) {
+	hc.checksMu.Lock()
+	defer hc.checksMu.Unlock()
+	hc.checks[name] = check
+}
+
 // Start starts the health check server
 func (hc *Checker) Start(ctx context.Context) error {
 	if !hc.config.Enabled {
@@ -78,6 +99,19 @@ func (hc *Checker) healthHandler(w http.ResponseWriter, r *http.Request) {
 		Version:   "1.0.0",
 	}
 
+	hc.checksMu.RLock()
+	for name, check := range hc.checks {
+		component := check()
+		if status.Components == nil {
+			status.Components = make(map[string]ComponentStatus)
+		}
+		status.Components[name] = component
+		if !component.Healthy {
+			status.Status = "degraded"
+		}
+	}
+	hc.checksMu.RUnlock()
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
 }
\ No newline at end of file
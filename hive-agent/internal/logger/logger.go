@@ -172,6 +172,17 @@ func (l *Logger) SetOutput(output io.Writer) {
 	l.Logger.SetOutput(output)
 }
 
+// SetLevelName changes the log level by name. Loggers derived from this
+// one share its level, so the change applies to all of them.
+func (l *Logger) SetLevelName(name string) error {
+	level, err := logrus.ParseLevel(name)
+	if err != nil {
+		return fmt.Errorf("invalid log level %s: %w", name, err)
+	}
+	l.Logger.SetLevel(level)
+	return nil
+}
+
 // parseKVs parses key-value pairs into logrus.Fields
 func parseKVs(kvs ...interface{}) logrus.Fields {
 	fields := logrus.Fields{}
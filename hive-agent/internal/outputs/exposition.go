@@ -0,0 +1,267 @@
+package outputs
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hive-agent/internal/collectors"
+)
+
+// expositionFamily holds the series of one metric name in a batch
+type expositionFamily struct {
+	name   string
+	typ    string
+	series map[string][]string // series key -> sample lines
+	order  []string
+}
+
+// writeExposition encodes the metrics of a batch in the Prometheus text
+// format and returns the number of series written. Within a batch the last
+// value of a series wins, and a name keeps the type it was first seen with.
+func writeExposition(w io.Writer, data []interface{}) int {
+	families := make(map[string]*expositionFamily)
+	var order []string
+
+	for _, item := range data {
+		metric := batchMetric(item)
+		if metric == nil {
+			continue
+		}
+
+		name := sanitizeMetricName(metric.Name)
+		typ := expositionType(metric.Type)
+
+		family, exists := families[name]
+		if !exists {
+			family = &expositionFamily{name: name, typ: typ, series: make(map[string][]string)}
+			families[name] = family
+			order = append(order, name)
+		}
+		if family.typ != typ {
+			continue
+		}
+
+		labels := sanitizeLabels(metric.Labels)
+		lines := expositionLines(name, labels, metric)
+		if len(lines) == 0 {
+			continue
+		}
+
+		key := labelString(labels, "", "")
+		if _, seen := family.series[key]; !seen {
+			family.order = append(family.order, key)
+		}
+		family.series[key] = lines
+	}
+
+	written := 0
+	for _, name := range order {
+		family := families[name]
+		if len(family.order) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", family.name, family.typ)
+		for _, key := range family.order {
+			for _, line := range family.series[key] {
+				io.WriteString(w, line)
+			}
+			written++
+		}
+	}
+
+	return written
+}
+
+// batchMetric extracts the metric of a collected metric item
+func batchMetric(item interface{}) *collectors.MetricData {
+	var data collectors.CollectedData
+	switch v := item.(type) {
+	case collectors.CollectedData:
+		data = v
+	case *collectors.CollectedData:
+		data = *v
+	default:
+		return nil
+	}
+
+	if data.Type != collectors.DataTypeMetric {
+		return nil
+	}
+	metric, _ := data.Data["metric"].(*collectors.MetricData)
+	return metric
+}
+
+// expositionType maps a MetricData type to a Prometheus metric type
+func expositionType(metricType string) string {
+	switch metricType {
+	case "counter", "summary":
+		return metricType
+	case "histogram", "exponential_histogram":
+		return "histogram"
+	default:
+		return "gauge"
+	}
+}
+
+// expositionLines encodes the sample lines of a single series
+func expositionLines(name string, labels map[string]string, metric *collectors.MetricData) []string {
+	switch value := metric.Value.(type) {
+	case *collectors.HistogramValue:
+		return histogramLines(name, labels, value)
+	case *collectors.ExponentialHistogramValue:
+		return histogramLines(name, labels, value.ExplicitHistogram())
+	case *collectors.SummaryValue:
+		return summaryLines(name, labels, value)
+	default:
+		v, ok := metricFloat(metric.Value)
+		if !ok {
+			return nil
+		}
+		return []string{sampleLine(name, labels, "", "", v)}
+	}
+}
+
+// histogramLines encodes cumulative buckets, sum and count
+func histogramLines(name string, labels map[string]string, h *collectors.HistogramValue) []string {
+	lines := make([]string, 0, len(h.Bounds)+3)
+	cumulative := uint64(0)
+	for i, bound := range h.Bounds {
+		if i < len(h.Counts) {
+			cumulative += h.Counts[i]
+		}
+		lines = append(lines, sampleLine(name+"_bucket", labels, "le", formatFloat(bound), float64(cumulative)))
+	}
+	lines = append(lines, sampleLine(name+"_bucket", labels, "le", "+Inf", float64(h.Count)))
+	lines = append(lines, sampleLine(name+"_sum", labels, "", "", h.Sum))
+	lines = append(lines, sampleLine(name+"_count", labels, "", "", float64(h.Count)))
+	return lines
+}
+
+// summaryLines encodes quantiles, sum and count
+func summaryLines(name string, labels map[string]string, s *collectors.SummaryValue) []string {
+	lines := make([]string, 0, len(s.Quantiles)+2)
+	for _, q := range s.Quantiles {
+		lines = append(lines, sampleLine(name, labels, "quantile", formatFloat(q.Quantile), q.Value))
+	}
+	lines = append(lines, sampleLine(name+"_sum", labels, "", "", s.Sum))
+	lines = append(lines, sampleLine(name+"_count", labels, "", "", float64(s.Count)))
+	return lines
+}
+
+// sampleLine formats one sample with an optional extra label
+func sampleLine(name string, labels map[string]string, extraName, extraValue string, value float64) string {
+	return name + labelString(labels, extraName, extraValue) + " " + formatFloat(value) + "\n"
+}
+
+// labelString formats a label set in sorted order
+func labelString(labels map[string]string, extraName, extraValue string) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabelValue(labels[name])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+escapeLabelValue(extraValue)+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sanitizeMetricName maps a metric name such as system.cpu.usage to a valid
+// Prometheus name
+func sanitizeMetricName(name string) string {
+	return sanitizeName(name, true)
+}
+
+// sanitizeLabels maps label names to valid Prometheus label names
+func sanitizeLabels(labels map[string]string) map[string]string {
+	sanitized := make(map[string]string, len(labels))
+	for name, value := range labels {
+		name = sanitizeName(name, false)
+		if name == "le" || name == "quantile" {
+			name = "exported_" + name
+		}
+		sanitized[name] = value
+	}
+	return sanitized
+}
+
+// sanitizeName replaces invalid characters with underscores
+func sanitizeName(name string, allowColon bool) string {
+	var b strings.Builder
+	for i, r := range name {
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(i > 0 && r >= '0' && r <= '9') || (allowColon && r == ':')
+		if valid {
+			b.WriteRune(r)
+		} else if i == 0 && r >= '0' && r <= '9' {
+			b.WriteByte('_')
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// escapeLabelValue escapes backslashes, quotes and newlines
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat formats a sample value or bound
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricFloat converts a numeric metric value to float64
+func metricFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
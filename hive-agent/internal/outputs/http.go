@@ -195,24 +195,7 @@ func (ho *HTTPOutput) sendWithRetry(ctx context.Context, req *http.Request) erro
 
 // setAuthHeaders sets authentication headers
 func (ho *HTTPOutput) setAuthHeaders(req *http.Request) {
-	switch ho.config.Auth.Type {
-	case "bearer":
-		if ho.config.Auth.Token != "" {
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ho.config.Auth.Token))
-		}
-	case "basic":
-		if ho.config.Auth.Username != "" && ho.config.Auth.Password != "" {
-			req.SetBasicAuth(ho.config.Auth.Username, ho.config.Auth.Password)
-		}
-	case "api_key":
-		if ho.config.Auth.APIKey != "" {
-			headerName := ho.config.Auth.Header
-			if headerName == "" {
-				headerName = "X-API-Key"
-			}
-			req.Header.Set(headerName, ho.config.Auth.APIKey)
-		}
-	}
+	ho.config.Auth.SetHeaders(req)
 }
 
 // Health returns the output health status
@@ -1,7 +1,15 @@
 package outputs
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	"hive-agent/internal/config"
@@ -10,9 +18,11 @@ import (
 
 // PrometheusOutput sends metrics to Prometheus Push Gateway
 type PrometheusOutput struct {
-	name   string
-	config config.OutputConfig
-	logger *logger.Logger
+	name       string
+	config     config.OutputConfig
+	logger     *logger.Logger
+	httpClient *http.Client
+	pushURL    string
 	
 	healthy   bool
 	lastError string
@@ -20,11 +30,48 @@ type PrometheusOutput struct {
 
 // NewPrometheusOutput creates a new Prometheus output
 func NewPrometheusOutput(cfg config.OutputConfig, log *logger.Logger) (*PrometheusOutput, error) {
+	transport := &http.Transport{
+		MaxIdleConns:        10,
+		IdleConnTimeout:     30 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	if cfg.TLS.Enabled {
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+		}
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	// Metrics are grouped by job and instance on the push gateway
+	job := "hive-agent"
+	if v, ok := cfg.Config["job"].(string); ok && v != "" {
+		job = v
+	}
+	instance, _ := os.Hostname()
+	if v, ok := cfg.Config["instance"].(string); ok && v != "" {
+		instance = v
+	}
+
+	// Without a push gateway the output accepts and drops metrics
+	pushURL := ""
+	if cfg.URL != "" {
+		pushURL = fmt.Sprintf("%s/metrics/job/%s", strings.TrimRight(cfg.URL, "/"), url.PathEscape(job))
+		if instance != "" {
+			pushURL += "/instance/" + url.PathEscape(instance)
+		}
+	}
+
 	return &PrometheusOutput{
-		name:    cfg.Name,
-		config:  cfg,
-		logger:  log.WithField("output", cfg.Name),
-		healthy: true,
+		name:       cfg.Name,
+		config:     cfg,
+		logger:     log.WithField("output", cfg.Name),
+		httpClient: &http.Client{Transport: transport, Timeout: timeout},
+		pushURL:    pushURL,
+		healthy:    true,
 	}, nil
 }
 
@@ -45,21 +92,86 @@ func (po *PrometheusOutput) Stop(ctx context.Context) error {
 	return nil
 }
 
-// Send sends metrics to Prometheus
+// Send pushes the metrics of a batch to the push gateway in the
+// Prometheus text format. Other data types are ignored.
 func (po *PrometheusOutput) Send(ctx context.Context, data []interface{}) error {
-	// Stub implementation - would use Prometheus client
-	po.logger.Debug("Would send metrics to Prometheus", "items", len(data))
+	if !po.config.Enabled {
+		return nil
+	}
+	if po.pushURL == "" {
+		po.logger.Debug("No push gateway configured, dropping metrics", "items", len(data))
+		return nil
+	}
+
+	var buf bytes.Buffer
+	series := writeExposition(&buf, data)
+	if series == 0 {
+		return nil
+	}
+
+	// POST replaces only the pushed metric names within the group
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, po.pushURL, &buf)
+	if err != nil {
+		po.setError(fmt.Sprintf("Failed to create request: %v", err))
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	req.Header.Set("User-Agent", "Pulse-Hive-Agent/1.0.0")
+	for key, value := range po.config.Headers {
+		req.Header.Set(key, value)
+	}
+	po.config.Auth.SetHeaders(req)
+
+	resp, err := po.httpClient.Do(req)
+	if err != nil {
+		po.setError(fmt.Sprintf("Push failed: %v", err))
+		return fmt.Errorf("push to gateway failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		po.setError(fmt.Sprintf("Push failed with status %d", resp.StatusCode))
+		return fmt.Errorf("push to gateway failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	po.clearError()
+	po.logger.Debug("Pushed metrics to gateway", "series", series)
 	return nil
 }
 
 // Health returns the output health status
 func (po *PrometheusOutput) Health() HealthStatus {
-	return HealthStatus{
+	status := HealthStatus{
 		Healthy:   po.healthy,
-		Message:   "Prometheus output operational (stub)",
+		Message:   "Prometheus output operational",
 		Timestamp: time.Now().Format(time.RFC3339),
 		Details: map[string]string{
-			"url": po.config.URL,
+			"url":      po.config.URL,
+			"push_url": po.pushURL,
 		},
 	}
+
+	if po.pushURL == "" {
+		status.Message = "Prometheus output operational (no push gateway configured)"
+	}
+
+	if po.lastError != "" {
+		status.Message = po.lastError
+		status.Healthy = false
+	}
+
+	return status
+}
+
+// setError sets the last error and marks output as unhealthy
+func (po *PrometheusOutput) setError(err string) {
+	po.lastError = err
+	po.healthy = false
+}
+
+// clearError clears the last error and marks output as healthy
+func (po *PrometheusOutput) clearError() {
+	po.lastError = ""
+	po.healthy = true
 }
\ No newline at end of file
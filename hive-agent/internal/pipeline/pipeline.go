@@ -141,6 +141,17 @@ func (p *Pipeline) flushTimer() {
 	}
 }
 
+// Flush sends the buffered data to the outputs right away instead of
+// waiting for the flush interval, and returns the number of items flushed
+func (p *Pipeline) Flush() int {
+	p.bufferMu.Lock()
+	defer p.bufferMu.Unlock()
+
+	count := len(p.buffer)
+	p.flushUnsafe()
+	return count
+}
+
 // flush flushes the buffer (thread-safe)
 func (p *Pipeline) flush() {
 	p.bufferMu.Lock()
@@ -24,6 +24,11 @@ type Client struct {
 	httpClient *http.Client
 	wsConn     *websocket.Conn
 	wsConnMu   sync.RWMutex
+	wsWriteMu  sync.Mutex // gorilla/websocket allows one concurrent writer
+	
+	// WebSocket command channel state
+	wsState    WebSocketState
+	wsStateMu  sync.RWMutex
 	
 	// Connection state
 	connected    bool
@@ -32,6 +37,7 @@ type Client struct {
 	
 	// Command handling
 	commandChan chan Command
+	sessionChan chan SessionMessage
 }
 
 // AgentRegistration contains agent registration information
@@ -71,7 +77,10 @@ type Command struct {
 	Command     string                 `json:"command"`
 	Parameters  map[string]interface{} `json:"parameters,omitempty"`
 	Timeout     time.Duration          `json:"timeout,omitempty"`
+	BadTimeout  string                 `json:"-"` // raw timeout that could not be decoded
 	SessionID   string                 `json:"session_id,omitempty"`
+	ExpiresAt   int64                  `json:"expires_at,omitempty"` // unix seconds
+	Signature   string                 `json:"signature,omitempty"`  // base64 Ed25519 over SigningPayload
 }
 
 // CommandResponse represents a command response
@@ -82,9 +91,75 @@ type CommandResponse struct {
 	Error         string    `json:"error,omitempty"`
 	ExitCode      int       `json:"exit_code,omitempty"`
 	ExecutionTime int64     `json:"execution_time_ms"`
+	OutputChunks  int64     `json:"output_chunks,omitempty"` // chunks streamed instead of Response
 	Timestamp     time.Time `json:"timestamp"`
 }
 
+// UnmarshalJSON decodes a command, accepting the timeout either as
+// nanoseconds or as a duration string such as "30s". A timeout that cannot
+// be decoded is kept in BadTimeout rather than failing the decode, so that
+// one bad command is rejected on its own instead of failing the whole poll.
+func (c *Command) UnmarshalJSON(data []byte) error {
+	type command Command
+	aux := struct {
+		*command
+		Timeout json.RawMessage `json:"timeout,omitempty"`
+	}{command: (*command)(c)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	c.Timeout = 0
+	c.BadTimeout = ""
+	if len(aux.Timeout) == 0 || string(aux.Timeout) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(aux.Timeout, &text); err == nil {
+		timeout, err := time.ParseDuration(text)
+		if err != nil {
+			c.BadTimeout = string(aux.Timeout)
+			return nil
+		}
+		c.Timeout = timeout
+		return nil
+	}
+	var nanos int64
+	if err := json.Unmarshal(aux.Timeout, &nanos); err != nil {
+		c.BadTimeout = string(aux.Timeout)
+		return nil
+	}
+	c.Timeout = time.Duration(nanos)
+	return nil
+}
+
+// CommandOutput is a chunk of streamed command output. Sequence numbers
+// start at 1 and are shared by both streams of a command.
+type CommandOutput struct {
+	ID        string    `json:"id"`
+	Sequence  int64     `json:"sequence"`
+	Stream    string    `json:"stream"`           // stdout, stderr, file
+	Offset    int64     `json:"offset,omitempty"` // position in the file, for file chunks
+	Data      []byte    `json:"data"`             // base64 in JSON
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SessionMessage is a message of an interactive shell session over the
+// WebSocket channel. The platform sends session_input, session_resize and
+// session_close; the agent sends session_output and session_closed.
+type SessionMessage struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Sequence  int64  `json:"sequence,omitempty"`
+	Data      []byte `json:"data,omitempty"` // base64 in JSON
+	Rows      uint16 `json:"rows,omitempty"`
+	Cols      uint16 `json:"cols,omitempty"`
+	ExitCode  int    `json:"exit_code,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Signature string `json:"signature,omitempty"` // base64 Ed25519 over SigningPayload, from the platform
+}
+
 // ConfigurationUpdate represents a configuration update from the platform
 type ConfigurationUpdate struct {
 	Version     string                 `json:"version"`
@@ -122,6 +197,8 @@ func New(cfg config.ServerConfig, log *logger.Logger) (*Client, error) {
 		httpClient: httpClient,
 		connected:  false,
 		commandChan: make(chan Command, 100),
+		sessionChan: make(chan SessionMessage, 100),
+		wsState:    WebSocketState{State: "disconnected", Since: time.Now()},
 	}, nil
 }
 
@@ -310,6 +387,75 @@ func (c *Client) SendCommandResponse(ctx context.Context, response CommandRespon
 	return nil
 }
 
+// SendCommandOutput sends chunks of streamed output of a command
+func (c *Client) SendCommandOutput(ctx context.Context, id string, chunks []CommandOutput) error {
+	endpoint := fmt.Sprintf("%s/api/hive/commands/%s/output", c.config.URL, id)
+
+	data, err := json.Marshal(chunks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal command output: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setAuthHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send command output: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("command output failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// FetchCommandFile downloads part of the content of a file_put command,
+// requesting length bytes from offset with a Range header
+func (c *Client) FetchCommandFile(ctx context.Context, id string, offset, length int64) ([]byte, error) {
+	endpoint := fmt.Sprintf("%s/api/hive/commands/%s/file", c.config.URL, id)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setAuthHeaders(req)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch file content: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The whole file; skip to the requested part
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			return nil, fmt.Errorf("failed to read file content: %w", err)
+		}
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("file content request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, length))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file content: %w", err)
+	}
+	return data, nil
+}
+
 // ConnectWebSocket establishes a WebSocket connection for real-time communication
 func (c *Client) ConnectWebSocket(ctx context.Context) error {
 	c.wsConnMu.Lock()
@@ -337,8 +483,8 @@ func (c *Client) ConnectWebSocket(ctx context.Context) error {
 	q.Set("api_key", c.config.APIKey)
 	u.RawQuery = q.Encode()
 
-	// Set up WebSocket dialer
-	dialer := websocket.DefaultDialer
+	// Set up WebSocket dialer; a copy, so the shared default is not modified
+	dialer := *websocket.DefaultDialer
 	dialer.HandshakeTimeout = c.config.Timeout
 
 	// Connect
@@ -350,52 +496,9 @@ func (c *Client) ConnectWebSocket(ctx context.Context) error {
 	c.wsConn = conn
 	c.logger.Info("WebSocket connection established")
 	
-	// Start command listener in background
-	go c.startCommandListener(ctx)
-	
 	return nil
 }
 
-// ListenForCommands listens for commands from the platform via WebSocket
-func (c *Client) ListenForCommands(ctx context.Context, commandChan chan<- Command) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-			c.wsConnMu.RLock()
-			conn := c.wsConn
-			c.wsConnMu.RUnlock()
-
-			if conn == nil {
-				// Try to reconnect
-				if err := c.ConnectWebSocket(ctx); err != nil {
-					c.logger.Error("Failed to reconnect WebSocket", "error", err)
-					time.Sleep(c.config.ReconnectInterval)
-					continue
-				}
-				continue
-			}
-
-			// Set read deadline
-			conn.SetReadDeadline(time.Now().Add(c.config.Timeout))
-
-			var command Command
-			if err := conn.ReadJSON(&command); err != nil {
-				c.logger.Error("Failed to read WebSocket message", "error", err)
-				c.closeWebSocket()
-				continue
-			}
-
-			select {
-			case commandChan <- command:
-			case <-ctx.Done():
-				return nil
-			}
-		}
-	}
-}
-
 // closeWebSocket safely closes the WebSocket connection
 func (c *Client) closeWebSocket() {
 	c.wsConnMu.Lock()
@@ -423,6 +526,29 @@ func (c *Client) GetCommandChannel() <-chan Command {
 	return c.commandChan
 }
 
+// GetSessionChannel returns the channel of messages for shell sessions
+func (c *Client) GetSessionChannel() <-chan SessionMessage {
+	return c.sessionChan
+}
+
+// SendSessionMessageWS sends a shell session message via WebSocket
+func (c *Client) SendSessionMessageWS(message SessionMessage) error {
+	c.wsConnMu.RLock()
+	conn := c.wsConn
+	c.wsConnMu.RUnlock()
+
+	if conn == nil {
+		return fmt.Errorf("WebSocket connection not available")
+	}
+
+	c.wsWriteMu.Lock()
+	defer c.wsWriteMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(c.config.Timeout))
+
+	return conn.WriteJSON(message)
+}
+
 // SendCommandResponseWS sends a command response back to the platform via WebSocket
 func (c *Client) SendCommandResponseWS(response CommandResponse) error {
 	c.wsConnMu.RLock()
@@ -433,6 +559,9 @@ func (c *Client) SendCommandResponseWS(response CommandResponse) error {
 		return fmt.Errorf("WebSocket connection not available")
 	}
 
+	c.wsWriteMu.Lock()
+	defer c.wsWriteMu.Unlock()
+
 	// Set write deadline
 	conn.SetWriteDeadline(time.Now().Add(c.config.Timeout))
 
@@ -448,70 +577,25 @@ func (c *Client) SendCommandResponseWS(response CommandResponse) error {
 	return nil
 }
 
-// UpdateListenForCommands modifies the existing method to use the internal channel
-func (c *Client) startCommandListener(ctx context.Context) {
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				c.wsConnMu.RLock()
-				conn := c.wsConn
-				c.wsConnMu.RUnlock()
-
-				if conn == nil {
-					// Try to reconnect
-					if err := c.ConnectWebSocket(ctx); err != nil {
-						c.logger.Error("Failed to reconnect WebSocket", "error", err)
-						time.Sleep(c.config.ReconnectInterval)
-						continue
-					}
-					continue
-				}
-
-				// Set read deadline
-				conn.SetReadDeadline(time.Now().Add(c.config.Timeout))
-
-				var message map[string]interface{}
-				if err := conn.ReadJSON(&message); err != nil {
-					c.logger.Error("Failed to read WebSocket message", "error", err)
-					c.closeWebSocket()
-					continue
-				}
-
-				// Handle different message types
-				msgType, ok := message["type"].(string)
-				if !ok {
-					c.logger.Warn("Received message without type")
-					continue
-				}
-
-				switch msgType {
-				case "command":
-					// Parse command
-					var command Command
-					if cmdData, ok := message["command"]; ok {
-						if cmdBytes, err := json.Marshal(cmdData); err == nil {
-							if err := json.Unmarshal(cmdBytes, &command); err == nil {
-								select {
-								case c.commandChan <- command:
-								case <-ctx.Done():
-									return
-								}
-							}
-						}
-					}
-				case "config_update":
-					// Handle config updates
-					c.logger.Info("Configuration update received")
-					// This would be processed by the agent's config service
-				default:
-					c.logger.Debug("Received unknown message type", "type", msgType)
-				}
-			}
-		}
-	}()
+// SendCommandOutputWS sends chunks of streamed output via WebSocket
+func (c *Client) SendCommandOutputWS(chunks []CommandOutput) error {
+	c.wsConnMu.RLock()
+	conn := c.wsConn
+	c.wsConnMu.RUnlock()
+
+	if conn == nil {
+		return fmt.Errorf("WebSocket connection not available")
+	}
+
+	c.wsWriteMu.Lock()
+	defer c.wsWriteMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(c.config.Timeout))
+
+	return conn.WriteJSON(map[string]interface{}{
+		"type":   "command_output",
+		"chunks": chunks,
+	})
 }
 
 // Close closes all connections
@@ -519,5 +603,6 @@ func (c *Client) Close() error {
 	c.closeWebSocket()
 	c.connected = false
 	close(c.commandChan)
+	close(c.sessionChan)
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,54 @@
+package platform
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Signed payload formats
+const (
+	commandSigningVersion = "pulse-hive-command-v2"
+	sessionSigningVersion = "pulse-hive-session-v1"
+)
+
+// SigningPayload returns the bytes a command signature covers: the JSON
+// array
+//
+//	["pulse-hive-command-v2", id, type, command, parameters, timeout, session_id, expires_at]
+//
+// without whitespace, with object keys sorted and without HTML escaping.
+// Parameters are null when absent, the timeout is in nanoseconds and 0
+// when absent, and the session ID is empty for commands outside a session.
+func (c Command) SigningPayload() ([]byte, error) {
+	return encodeSigningPayload([]interface{}{
+		commandSigningVersion, c.ID, c.Type, c.Command, c.Parameters,
+		int64(c.Timeout), c.SessionID, c.ExpiresAt,
+	})
+}
+
+// SigningPayload returns the bytes a session message signature covers:
+// the JSON array
+//
+//	["pulse-hive-session-v1", type, session_id, sequence, data, rows, cols]
+//
+// encoded like command payloads, with data in base64 and null when absent.
+// Messages are signed with the private half of the session key carried by
+// the signed session command.
+func (m SessionMessage) SigningPayload() ([]byte, error) {
+	return encodeSigningPayload([]interface{}{
+		sessionSigningVersion, m.Type, m.SessionID, m.Sequence, m.Data, m.Rows, m.Cols,
+	})
+}
+
+// encodeSigningPayload encodes a payload array without whitespace, with
+// object keys sorted and without HTML escaping
+func encodeSigningPayload(payload []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(payload); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
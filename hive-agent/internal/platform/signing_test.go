@@ -0,0 +1,79 @@
+package platform
+
+import (
+	"testing"
+	"time"
+)
+
+// The payloads are what the platform's signer must produce byte for byte;
+// a change here breaks every deployed signer.
+func TestCommandSigningPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  Command
+		want string
+	}{
+		{
+			name: "all fields",
+			cmd: Command{
+				ID:         "cmd-1",
+				Type:       "execute",
+				Command:    "echo '<a&b>' \"quoted\"",
+				Parameters: map[string]interface{}{"lines": 100, "path": "/var/log/app.log", "nested": map[string]interface{}{"z": true, "a": nil}},
+				Timeout:    30 * time.Second,
+				SessionID:  "s-1",
+				ExpiresAt:  1700000000,
+				Signature:  "not covered",
+			},
+			want: `["pulse-hive-command-v2","cmd-1","execute","echo '<a&b>' \"quoted\"",{"lines":100,"nested":{"a":null,"z":true},"path":"/var/log/app.log"},30000000000,"s-1",1700000000]`,
+		},
+		{
+			name: "absent fields",
+			cmd:  Command{ID: "cmd-2", Type: "status"},
+			want: `["pulse-hive-command-v2","cmd-2","status","",null,0,"",0]`,
+		},
+		{
+			// Line and paragraph separators are escaped by encoding/json
+			name: "non-ASCII",
+			cmd:  Command{ID: "cmd-3", Type: "system", Command: "echo é\u2028"},
+			want: "[\"pulse-hive-command-v2\",\"cmd-3\",\"system\",\"echo é\\u2028\",null,0,\"\",0]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := tt.cmd.SigningPayload()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(payload) != tt.want {
+				t.Errorf("got  %s\nwant %s", payload, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionMessageSigningPayload(t *testing.T) {
+	message := SessionMessage{
+		Type:      "session_input",
+		SessionID: "s-1",
+		Sequence:  7,
+		Data:      []byte("ls -l\n"),
+		Signature: "not covered",
+	}
+	payload, err := message.SigningPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `["pulse-hive-session-v1","session_input","s-1",7,"bHMgLWwK",0,0]`; string(payload) != want {
+		t.Errorf("got  %s\nwant %s", payload, want)
+	}
+
+	resize := SessionMessage{Type: "session_resize", SessionID: "s-1", Sequence: 8, Rows: 40, Cols: 120}
+	payload, err = resize.SigningPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `["pulse-hive-session-v1","session_resize","s-1",8,null,40,120]`; string(payload) != want {
+		t.Errorf("got  %s\nwant %s", payload, want)
+	}
+}
@@ -0,0 +1,263 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsPingInterval is how often the agent pings the platform
+	wsPingInterval = 30 * time.Second
+	// wsPongWait is how long the connection may stay silent before it is
+	// considered dead; any message, ping or pong extends it
+	wsPongWait = 2 * wsPingInterval
+	// wsMaxBackoff caps the delay between reconnection attempts
+	wsMaxBackoff = 5 * time.Minute
+	// wsFallbackCooldown is how long the agent relies on polling alone
+	// after MaxReconnects consecutive failed attempts
+	wsFallbackCooldown = 5 * time.Minute
+)
+
+// WebSocketState describes the WebSocket command channel
+type WebSocketState struct {
+	State       string    `json:"state"` // connecting, connected, disconnected, fallback
+	Since       time.Time `json:"since"`
+	Failures    int       `json:"failures"` // consecutive failed connection attempts
+	Connects    int       `json:"connects"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastMessage time.Time `json:"last_message,omitempty"`
+}
+
+// wsMessage is a message received over the WebSocket channel
+type wsMessage struct {
+	Type    string          `json:"type"`
+	Command json.RawMessage `json:"command,omitempty"`
+}
+
+// RunWebSocket keeps the WebSocket command channel connected until the
+// context is cancelled, delivering commands to the command channel.
+// Attempts are spaced by a jittered exponential backoff starting at
+// ReconnectInterval; after MaxReconnects consecutive failures the channel
+// is left in fallback for a cooldown period before trying again.
+func (c *Client) RunWebSocket(ctx context.Context) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	failures := 0
+
+	for ctx.Err() == nil {
+		c.setWSState("connecting", failures, nil)
+
+		if err := c.ConnectWebSocket(ctx); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			failures++
+
+			state, wait := "disconnected", c.reconnectDelay(failures, random)
+			if c.config.MaxReconnects > 0 && failures >= c.config.MaxReconnects {
+				state, wait = "fallback", wsFallbackCooldown
+				c.logger.Warn("WebSocket unavailable, relying on command polling",
+					"failures", failures, "retry", wait, "error", err)
+				failures = 0
+			} else {
+				c.logger.Warn("WebSocket connection failed", "failures", failures, "retry", wait, "error", err)
+			}
+			c.setWSState(state, failures, err)
+
+			if !SleepContext(ctx, wait) {
+				break
+			}
+			continue
+		}
+
+		failures = 0
+		c.wsStateMu.Lock()
+		c.wsState.Connects++
+		c.wsStateMu.Unlock()
+		c.setWSState("connected", 0, nil)
+
+		err := c.readWebSocket(ctx)
+		c.closeWebSocket()
+		if ctx.Err() != nil {
+			break
+		}
+
+		c.logger.Warn("WebSocket connection lost", "error", err)
+		c.setWSState("disconnected", 0, err)
+
+		// A short jittered pause so that a fleet does not reconnect at once
+		if !SleepContext(ctx, c.reconnectDelay(1, random)) {
+			break
+		}
+	}
+
+	c.closeWebSocket()
+	c.setWSState("disconnected", 0, nil)
+}
+
+// reconnectDelay returns the delay before the given attempt: the
+// reconnect interval doubled per failure, capped, with the upper half
+// randomized
+func (c *Client) reconnectDelay(failures int, random *rand.Rand) time.Duration {
+	delay := c.config.ReconnectInterval
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for i := 1; i < failures && delay < wsMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > wsMaxBackoff {
+		delay = wsMaxBackoff
+	}
+	half := delay / 2
+	return half + time.Duration(random.Int63n(int64(half)+1))
+}
+
+// readWebSocket reads messages until the connection fails. The agent
+// pings periodically and treats a connection without any traffic for
+// wsPongWait as dead.
+func (c *Client) readWebSocket(ctx context.Context) error {
+	c.wsConnMu.RLock()
+	conn := c.wsConn
+	c.wsConnMu.RUnlock()
+	if conn == nil {
+		return fmt.Errorf("WebSocket connection not available")
+	}
+
+	alive := func() {
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	}
+	alive()
+	conn.SetPongHandler(func(string) error {
+		alive()
+		return nil
+	})
+	conn.SetPingHandler(func(data string) error {
+		alive()
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(c.config.Timeout))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				// Unblock the read below
+				conn.Close()
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.config.Timeout)); err != nil {
+					c.logger.Debug("WebSocket ping failed", "error", err)
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		alive()
+
+		c.wsStateMu.Lock()
+		c.wsState.LastMessage = time.Now()
+		c.wsStateMu.Unlock()
+
+		var message wsMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			c.logger.Warn("Invalid WebSocket message", "error", err)
+			continue
+		}
+
+		switch message.Type {
+		case "command":
+			var command Command
+			if err := json.Unmarshal(message.Command, &command); err != nil {
+				c.logger.Warn("Invalid command received over WebSocket", "error", err)
+				continue
+			}
+			select {
+			case c.commandChan <- command:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case "session_input", "session_resize", "session_close":
+			var session SessionMessage
+			if err := json.Unmarshal(data, &session); err != nil || session.SessionID == "" {
+				c.logger.Warn("Invalid session message received over WebSocket", "type", message.Type)
+				continue
+			}
+			select {
+			case c.sessionChan <- session:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case "config_update":
+			// Handle config updates
+			c.logger.Info("Configuration update received")
+			// This would be processed by the agent's config service
+		case "":
+			c.logger.Warn("Received message without type")
+		default:
+			c.logger.Debug("Received unknown message type", "type", message.Type)
+		}
+	}
+}
+
+// setWSState records a change of the WebSocket channel state
+func (c *Client) setWSState(state string, failures int, err error) {
+	c.wsStateMu.Lock()
+	defer c.wsStateMu.Unlock()
+
+	if c.wsState.State != state {
+		c.wsState.State = state
+		c.wsState.Since = time.Now()
+	}
+	c.wsState.Failures = failures
+	if err != nil {
+		c.wsState.LastError = err.Error()
+	} else if state == "connected" {
+		c.wsState.LastError = ""
+	}
+}
+
+// WebSocketState returns the state of the WebSocket command channel
+func (c *Client) WebSocketState() WebSocketState {
+	c.wsStateMu.RLock()
+	defer c.wsStateMu.RUnlock()
+	return c.wsState
+}
+
+// WebSocketConnected returns whether the WebSocket command channel is up
+func (c *Client) WebSocketConnected() bool {
+	return c.WebSocketState().State == "connected"
+}
+
+// SleepContext waits for the duration, returning false if the context
+// was cancelled first
+func SleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}